@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
 	"net/http"
 	"strings"
 	"time"
@@ -16,6 +17,16 @@ type AccuWeather struct {
 	Config *Config // Current Configuration
 }
 
+var accuURL = "http://dataservice.accuweather.com"
+
+func init() {
+	RegisterProvider(ProviderInfo{
+		Name:        "AccuWeather",
+		Description: "AccuWeather",
+		New:         func() WeatherProvider { return new(AccuWeather) },
+	})
+}
+
 type accuWeatherResponse []struct {
 	LocalObservationDateTime time.Time `json:"LocalObservationDateTime"`
 	EpochTime                int       `json:"EpochTime"`
@@ -34,8 +45,22 @@ type accuWeatherResponse []struct {
 			UnitType int     `json:"UnitType"`
 		} `json:"Imperial"`
 	} `json:"Temperature"`
+	RealFeelTemperature struct {
+		Metric struct {
+			Value    float64 `json:"Value"`
+			Unit     string  `json:"Unit"`
+			UnitType int     `json:"UnitType"`
+		} `json:"Metric"`
+	} `json:"RealFeelTemperature"`
 	RelativeHumidity float64 `json:"RelativeHumidity"`
-	Wind             struct {
+	DewPoint         struct {
+		Metric struct {
+			Value    float64 `json:"Value"`
+			Unit     string  `json:"Unit"`
+			UnitType int     `json:"UnitType"`
+		} `json:"Metric"`
+	} `json:"DewPoint"`
+	Wind struct {
 		Direction struct {
 			Degrees   float64 `json:"Degrees"`
 			Localized string  `json:"Localized"`
@@ -70,8 +95,15 @@ type accuWeatherResponse []struct {
 	} `json:"WindGust"`
 	UVIndex     float64 `json:"UVIndex"`
 	UVIndexText string  `json:"UVIndexText"`
-	CloudCover  float64 `json:"CloudCover"`
-	Pressure    struct {
+	Visibility  struct {
+		Metric struct {
+			Value    float64 `json:"Value"`
+			Unit     string  `json:"Unit"`
+			UnitType int     `json:"UnitType"`
+		} `json:"Metric"`
+	} `json:"Visibility"`
+	CloudCover float64 `json:"CloudCover"`
+	Pressure   struct {
 		Metric struct {
 			Value    float64 `json:"Value"`
 			Unit     string  `json:"Unit"`
@@ -116,17 +148,48 @@ type accuForecastResponse struct {
 				UnitType int     `json:"UnitType"`
 			} `json:"Maximum"`
 		} `json:"Temperature"`
-		Day struct {
-			Icon       int    `json:"Icon"`
-			IconPhrase string `json:"IconPhrase"`
-		} `json:"Day"`
-		Night struct {
-			Icon       int    `json:"Icon"`
-			IconPhrase string `json:"IconPhrase"`
-		} `json:"Night"`
+		Sun struct {
+			EpochRise int64 `json:"EpochRise"`
+			EpochSet  int64 `json:"EpochSet"`
+		} `json:"Sun"`
+		AirAndPollen []struct {
+			Name  string  `json:"Name"`
+			Value float64 `json:"Value"`
+		} `json:"AirAndPollen"`
+		Day   accuForecastPeriod `json:"Day"`
+		Night accuForecastPeriod `json:"Night"`
 	} `json:"DailyForecasts"`
 }
 
+// accuForecastPeriod holds the forecast for the day or night time of a day
+type accuForecastPeriod struct {
+	Icon                     int       `json:"Icon"`
+	IconPhrase               string    `json:"IconPhrase"`
+	PrecipitationProbability float64   `json:"PrecipitationProbability"`
+	Wind                     accuWind  `json:"Wind"`
+	WindGust                 accuWind  `json:"WindGust"`
+	TotalLiquid              accuValue `json:"TotalLiquid"`
+	Rain                     accuValue `json:"Rain"`
+	Snow                     accuValue `json:"Snow"`
+	RelativeHumidity         struct {
+		Average float64 `json:"Average"`
+	} `json:"RelativeHumidity"`
+}
+
+type accuWind struct {
+	Speed accuValue `json:"Speed"`
+}
+
+type accuValue struct {
+	Value float64 `json:"Value"`
+	Unit  string  `json:"Unit"`
+}
+
+type accuErrorResponse struct {
+	Code    string `json:"Code"`
+	Message string `json:"Message"`
+}
+
 type accuLocationResponse struct {
 	Version int    `json:"Version"`
 	Key     string `json:"Key"`
@@ -154,10 +217,10 @@ func (p *AccuWeather) GetWeather() (Weather, error) {
 	if err := p.checkConfig(); err != nil {
 		return w, err
 	}
-	w.ID = p.Config.LocationID
+	w.ID = p.Config.GetLocationID(p.GetProviderName())
 	w.Name = p.Config.LocationName
 
-	url := fmt.Sprintf("http://dataservice.accuweather.com/currentconditions/v1/%s?apikey=%s&details=true", p.Config.LocationID, p.Config.AppID)
+	url := fmt.Sprintf("%s/currentconditions/v1/%s?apikey=%s&details=true&language=%s", accuURL, w.ID, p.Config.GetAppID(p.GetProviderName()), p.Config.GetLanguage())
 	resp, err := http.Get(url)
 	if resp != nil {
 		defer resp.Body.Close()
@@ -165,7 +228,7 @@ func (p *AccuWeather) GetWeather() (Weather, error) {
 	}
 	if err == nil {
 		// Load the weather from the response
-		err = p.decodeWeather(&w, resp.Body)
+		err = p.decodeWeather(&w, resp.StatusCode, resp.Body)
 	}
 	if err == nil {
 		// Load the sunrise and sunset times
@@ -175,9 +238,6 @@ func (p *AccuWeather) GetWeather() (Weather, error) {
 			w.Sunset = ss
 		}
 	}
-	if err == nil {
-		w.WriteToFile("lastweather.json")
-	}
 	return w, err
 }
 
@@ -194,18 +254,14 @@ func (p *AccuWeather) GetForecast() (Forecast, error) {
 		return f, err
 	}
 
-	metric := "true"
-	if p.Config.UnitType != 0 {
-		metric = "false"
-	}
-	url := fmt.Sprintf("http://dataservice.accuweather.com/forecasts/v1/daily/5day/%s?metric=%s&apikey=%s", p.Config.LocationID, metric, p.Config.AppID)
+	url := fmt.Sprintf("%s/forecasts/v1/daily/5day/%s?metric=true&details=true&apikey=%s&language=%s", accuURL, p.Config.GetLocationID(p.GetProviderName()), p.Config.GetAppID(p.GetProviderName()), p.Config.GetLanguage())
 	resp, err := http.Get(url)
 	if resp != nil {
 		defer resp.Body.Close()
 		resp.Close = true
 	}
 	if err == nil {
-		err = p.decodeForecast(&f, resp.Body)
+		err = p.decodeForecast(&f, resp.StatusCode, resp.Body)
 	}
 	if err == nil {
 		// Get the current weather as well
@@ -216,65 +272,131 @@ func (p *AccuWeather) GetForecast() (Forecast, error) {
 	return f, err
 }
 
-func (p *AccuWeather) decodeWeather(w *Weather, r io.ReadCloser) error {
+// accuResponseError returns the error of a response whose status is not successful, or whose body
+// holds the Code and Message of an error in place of the weather, e.g. once the daily quota is used up
+func accuResponseError(status int, b []byte) error {
+	e := accuErrorResponse{}
+	// The current conditions are an array, so a successful response is not an error object
+	json.Unmarshal(b, &e)
+	if status/100 == 2 && e.Code == "" && e.Message == "" {
+		return nil
+	}
+	if e.Message == "" {
+		e.Message = http.StatusText(status)
+		if e.Code != "" {
+			e.Message = e.Code
+		}
+	}
+	return errors.New("AccuWeather error. " + e.Message)
+}
+
+func (p *AccuWeather) decodeWeather(w *Weather, status int, r io.ReadCloser) error {
 	b, err := ioutil.ReadAll(r)
 	if err == nil {
-		if b != nil && len(b) != 0 {
-			ioutil.WriteFile("lastweatherresp.json", b, 0666)
-			var r = accuWeatherResponse{}
-			err = json.Unmarshal(b, &r)
-			if err == nil && r != nil && len(r) != 0 {
-				r1 := r[0]
-				w.WeatherIcon = p.getWeatherIcon(r1.WeatherIcon)
-				w.IsDay = r1.IsDayTime
-				w.WeatherDesc = strings.Replace(strings.Title(r1.WeatherText), "W/", "With", -1)
-				w.ReadingTime = r1.LocalObservationDateTime
-				w.Humidity = float32(r1.RelativeHumidity)
-				w.WindDirection = float32(r1.Wind.Direction.Degrees)
-				if p.Config.UnitType != 0 {
-					// Get imperial values
-					w.Temp = float32(r1.Temperature.Imperial.Value)
-					w.Pressure = float32(r1.Pressure.Imperial.Value)
-					w.WindSpeed = float32(r1.Wind.Speed.Imperial.Value)
-				} else {
-					// Get metric values
-					w.Temp = float32(r1.Temperature.Metric.Value)
-					w.Pressure = float32(r1.Pressure.Metric.Value)
-					w.WindSpeed = float32(r1.Wind.Speed.Metric.Value)
-				}
-			}
+		err = accuResponseError(status, b)
+	}
+	if err == nil {
+		ioutil.WriteFile("lastweatherresp.json", b, 0666)
+		var r = accuWeatherResponse{}
+		err = json.Unmarshal(b, &r)
+		if err == nil && len(r) == 0 {
+			err = errors.New("AccuWeather returned no current conditions")
+		}
+		if err == nil {
+			r1 := r[0]
+			w.WeatherIcon = p.getWeatherIcon(r1.WeatherIcon)
+			w.IsDay = r1.IsDayTime
+			w.WeatherDesc = p.getWeatherDesc(r1.WeatherText)
+			w.ReadingTime = r1.LocalObservationDateTime
+			w.Humidity = float32(r1.RelativeHumidity)
+			w.WindDirection = float32(r1.Wind.Direction.Degrees)
+			w.Temp = float32(r1.Temperature.Metric.Value)
+			w.Pressure = float32(r1.Pressure.Metric.Value)
+			// km/h to m/s
+			w.WindSpeed = float32(r1.Wind.Speed.Metric.Value / 3.6)
+			w.WindGust = float32(r1.WindGust.Speed.Metric.Value / 3.6)
+			w.FeelsLike = float32(r1.RealFeelTemperature.Metric.Value)
+			w.DewPoint = float32(r1.DewPoint.Metric.Value)
+			w.Visibility = float32(r1.Visibility.Metric.Value)
+			w.CloudCover = float32(r1.CloudCover)
+			w.UVIndex = float32(r1.UVIndex)
+			w.PressureTrend = p.getPressureTrend(r1.PressureTendency.Code)
 		}
 	}
 	return err
 }
 
-func (p *AccuWeather) decodeForecast(f *Forecast, r io.ReadCloser) error {
+// getWeatherDesc returns the English description in title case with w/ written out, e.g. Partly Sunny With Showers.
+// Descriptions in other languages are returned as AccuWeather wrote them.
+func (p *AccuWeather) getWeatherDesc(s string) string {
+	if p.Config.GetLanguage() != "en" {
+		return s
+	}
+	return strings.Replace(strings.Title(s), "W/", "With", -1)
+}
+
+// getPressureTrend returns the pressure tendency for the AccuWeather tendency code
+func (p *AccuWeather) getPressureTrend(code string) string {
+	switch code {
+	case "R":
+		return "rising"
+	case "S":
+		return "steady"
+	case "F":
+		return "falling"
+	}
+	return ""
+}
+
+func (p *AccuWeather) decodeForecast(f *Forecast, status int, r io.ReadCloser) error {
 	b, err := ioutil.ReadAll(r)
 	if err == nil {
-		if b != nil && len(b) != 0 {
-			ioutil.WriteFile("lastforecastresp.json", b, 0666)
-			var r = accuForecastResponse{}
-			err = json.Unmarshal(b, &r)
-			if err == nil && r.DailyForecasts != nil && len(r.DailyForecasts) != 0 {
-				for _, d := range r.DailyForecasts {
-					fd := ForecastDay{}
-					fd.Day = d.Date
-					fd.Name = d.Date.Weekday().String()
-					fd.TempMax = float32(d.Temperature.Maximum.Value)
-					fd.TempMin = float32(d.Temperature.Minimum.Value)
+		err = accuResponseError(status, b)
+	}
+	if err == nil {
+		ioutil.WriteFile("lastforecastresp.json", b, 0666)
+		var r = accuForecastResponse{}
+		err = json.Unmarshal(b, &r)
+		if err == nil && len(r.DailyForecasts) == 0 {
+			err = errors.New("AccuWeather returned no forecast days")
+		}
+		if err == nil {
+			for _, d := range r.DailyForecasts {
+				fd := ForecastDay{}
+				fd.Day = d.Date
+				fd.Name = DayName(d.Date, p.Config.Language)
+				fd.TempMax = float32(d.Temperature.Maximum.Value)
+				fd.TempMin = float32(d.Temperature.Minimum.Value)
 
-					di := p.getWeatherIcon(d.Day.Icon)
-					ni := p.getWeatherIcon(d.Night.Icon)
-					if di >= ni {
-						fd.WeatherIcon = di
-						fd.WeatherDesc = strings.Replace(strings.Title(d.Day.IconPhrase), "W/", "With", -1)
-					} else {
-						fd.WeatherIcon = ni
-						fd.WeatherDesc = strings.Replace(strings.Title(d.Night.IconPhrase), "W/", "With", -1)
-					}
-					f.Forecast = append(f.Forecast, fd)
+				di := p.getWeatherIcon(d.Day.Icon)
+				ni := p.getWeatherIcon(d.Night.Icon)
+				if di >= ni {
+					fd.WeatherIcon = di
+					fd.WeatherDesc = p.getWeatherDesc(d.Day.IconPhrase)
+				} else {
+					fd.WeatherIcon = ni
+					fd.WeatherDesc = p.getWeatherDesc(d.Night.IconPhrase)
+				}
 
+				// Metric values are in mm, cm of snow and km/h
+				fd.PrecipProb = float32(math.Max(d.Day.PrecipitationProbability, d.Night.PrecipitationProbability))
+				fd.Precip = float32(d.Day.TotalLiquid.Value + d.Night.TotalLiquid.Value)
+				fd.Rain = float32(d.Day.Rain.Value + d.Night.Rain.Value)
+				fd.Snow = fd.Precip - fd.Rain
+				fd.WindSpeed = float32(math.Max(d.Day.Wind.Speed.Value, d.Night.Wind.Speed.Value) / 3.6)
+				fd.WindGust = float32(math.Max(d.Day.WindGust.Speed.Value, d.Night.WindGust.Speed.Value) / 3.6)
+				fd.Humidity = float32((d.Day.RelativeHumidity.Average + d.Night.RelativeHumidity.Average) / 2)
+				for _, a := range d.AirAndPollen {
+					if a.Name == "UVIndex" {
+						fd.UVIndex = float32(a.Value)
+					}
+				}
+				if d.Sun.EpochRise != 0 {
+					fd.Sunrise = time.Unix(d.Sun.EpochRise, 0).In(d.Date.Location())
+					fd.Sunset = time.Unix(d.Sun.EpochSet, 0).In(d.Date.Location())
 				}
+				f.Forecast = append(f.Forecast, fd)
+
 			}
 		}
 	}
@@ -282,11 +404,12 @@ func (p *AccuWeather) decodeForecast(f *Forecast, r io.ReadCloser) error {
 }
 
 func (p *AccuWeather) checkConfig() error {
-	if p.Config.AppID == "" {
+	key := p.Config.GetAppID(p.GetProviderName())
+	if key == "" {
 		return errors.New("Accuweather API Key has not been set in the configuration")
 	}
-	if p.Config.LocationID == "" {
-		url := fmt.Sprintf("http://dataservice.accuweather.com/locations/v1/cities/geoposition/search?apikey=%s&q=%f%%2C%f", p.Config.AppID, p.Config.Latitude, p.Config.Longitude)
+	if p.Config.GetLocationID(p.GetProviderName()) == "" {
+		url := fmt.Sprintf("%s/locations/v1/cities/geoposition/search?apikey=%s&q=%f%%2C%f", accuURL, key, p.Config.Latitude, p.Config.Longitude)
 		resp, err := http.Get(url)
 		if resp != nil {
 			defer resp.Body.Close()
@@ -307,7 +430,7 @@ func (p *AccuWeather) checkConfig() error {
 		if r.Message != "" {
 			return errors.New(r.Message)
 		}
-		p.Config.LocationID = r.Key
+		p.Config.SetLocationID(p.GetProviderName(), r.Key)
 
 		p.Config.WriteToFile("config.json")
 	}
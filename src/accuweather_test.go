@@ -3,7 +3,13 @@ package main
 import (
 	"encoding/json"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestGetAccuWeather(t *testing.T) {
@@ -23,7 +29,7 @@ func TestGetAccuWeather(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	err = ioutil.WriteFile("test.json", data, 0666)
+	err = ioutil.WriteFile(filepath.Join(t.TempDir(), "test.json"), data, 0666)
 	if err != nil {
 		t.Error(err)
 	}
@@ -46,8 +52,115 @@ func TestGetAccuWeatherForecast(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	err = ioutil.WriteFile("test.json", data, 0666)
+	err = ioutil.WriteFile(filepath.Join(t.TempDir(), "test.json"), data, 0666)
 	if err != nil {
 		t.Error(err)
 	}
 }
+
+func TestCanDecodeAccuForecastDetails(t *testing.T) {
+	path, _ := filepath.Abs(filepath.Join("testdata", "accuweather_forecast.json"))
+	// The forecast response is written to the working directory
+	chdirTemp(t)
+	r, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	p := AccuWeather{Config: &Config{}}
+	f := Forecast{}
+	if err := p.decodeForecast(&f, http.StatusOK, r); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Forecast) != 1 {
+		t.Fatal("Expected 1 forecast day, got", len(f.Forecast))
+	}
+	d := f.Forecast[0]
+	if d.WeatherDesc != "Partly Sunny With Showers" {
+		t.Error("Unexpected description", d.WeatherDesc)
+	}
+	if d.PrecipProb != 55 || d.Precip != 3.5 || d.Rain != 3.5 || d.Snow != 0 || d.Humidity != 76 || d.UVIndex != 8 {
+		t.Error("Unexpected precipitation, humidity or UV index", d)
+	}
+	checkClose(t, "WindSpeed", d.WindSpeed, 7.19)
+	checkClose(t, "WindGust", d.WindGust, 12.86)
+	if !d.Sunrise.Equal(time.Unix(1760846520, 0)) || !d.Sunset.Equal(time.Unix(1760894520, 0)) {
+		t.Error("Unexpected sunrise or sunset", d.Sunrise, d.Sunset)
+	}
+}
+
+func TestCanDecodeAccuCurrentConditions(t *testing.T) {
+	path, _ := filepath.Abs(filepath.Join("testdata", "accuweather_current.json"))
+	// The weather response is written to the working directory
+	chdirTemp(t)
+	r, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	p := AccuWeather{Config: &Config{}}
+	w := Weather{}
+	if err := p.decodeWeather(&w, http.StatusOK, r); err != nil {
+		t.Fatal(err)
+	}
+	if w.Temp != 18.3 || w.FeelsLike != 16.1 || w.DewPoint != 11.4 || w.Visibility != 16.1 || w.CloudCover != 25 || w.UVIndex != 5 {
+		t.Error("The current conditions were not decoded", w)
+	}
+	checkClose(t, "WindGust", w.WindGust, 11.83)
+	if w.PressureTrend != "falling" {
+		t.Error("Unexpected pressure trend", w.PressureTrend)
+	}
+}
+
+func TestAccuWeatherDescriptionsInOtherLanguages(t *testing.T) {
+	p := AccuWeather{Config: &Config{Language: "de"}}
+	if d := p.getWeatherDesc("Teilweise sonnig mit Schauern"); d != "Teilweise sonnig mit Schauern" {
+		t.Error("Expected the description to be left alone, got", d)
+	}
+	p.Config.Language = "en"
+	if d := p.getWeatherDesc("Partly sunny w/ showers"); d != "Partly Sunny With Showers" {
+		t.Error("Expected the English description in title case, got", d)
+	}
+}
+
+func TestAccuWeatherReportsErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"Code":"ServiceUnavailable","Message":"The allowed number of requests has been exceeded.","Reference":"/forecasts/v1/daily/5day/1"}`))
+	}))
+	defer srv.Close()
+	au := accuURL
+	accuURL = srv.URL
+	defer func() { accuURL = au }()
+	chdirTemp(t)
+
+	p := AccuWeather{Config: &Config{AppID: "key", LocationIDs: map[string]string{"AccuWeather": "1"}}}
+	if _, err := p.GetWeather(); err == nil || !strings.Contains(err.Error(), "requests has been exceeded") {
+		t.Error("Expected the weather to fail with the message of the error, got", err)
+	}
+	if _, err := p.GetForecast(); err == nil || !strings.Contains(err.Error(), "requests has been exceeded") {
+		t.Error("Expected the forecast to fail with the message of the error, got", err)
+	}
+
+	// An error in the body is reported even if the status is successful
+	f := Forecast{}
+	body := ioutil.NopCloser(strings.NewReader(`{"Code":"Unauthorized","Message":"Api Authorization failed"}`))
+	if err := p.decodeForecast(&f, http.StatusOK, body); err == nil || !strings.Contains(err.Error(), "Authorization failed") {
+		t.Error("Expected the error in the forecast body, got", err)
+	}
+
+	// A forecast without days and current conditions without a reading are errors
+	body = ioutil.NopCloser(strings.NewReader(`{"Headline":{},"DailyForecasts":[]}`))
+	if err := p.decodeForecast(&f, http.StatusOK, body); err == nil {
+		t.Error("Expected an error for the forecast without days")
+	}
+	w := Weather{}
+	if err := p.decodeWeather(&w, http.StatusOK, ioutil.NopCloser(strings.NewReader(`[]`))); err == nil {
+		t.Error("Expected an error for the empty current conditions")
+	}
+	if err := p.decodeWeather(&w, http.StatusForbidden, ioutil.NopCloser(strings.NewReader(""))); err == nil {
+		t.Error("Expected an error for the failed status")
+	}
+}
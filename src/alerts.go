@@ -0,0 +1,456 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AlertProvider is implemented by the weather providers that can report the weather alerts
+// issued for the location.
+type AlertProvider interface {
+	GetAlerts() ([]Alert, error)
+}
+
+// errAlertsNotSupported is returned by an alert provider that cannot report alerts with its current configuration
+var errAlertsNotSupported = errors.New("Alerts are not supported")
+
+// AlertReport holds the weather alerts issued for the location
+type AlertReport struct {
+	Created  time.Time `json:"created"`  // Date and time the alerts were received
+	Alerts   []Alert   `json:"alerts"`   // Alerts that have not expired, the most severe first
+	Language string    `json:"language"` // Language of the alert descriptions
+}
+
+// severityRank orders the CAP severities from the least to the most severe
+var severityRank = map[string]int{"Unknown": 0, "Minor": 1, "Moderate": 2, "Severe": 3, "Extreme": 4}
+
+// CAPFeed reads the alerts of a national warning service from a Common Alerting Protocol (CAP)
+// alert, or from an Atom feed of CAP alerts. Only the alerts for areas that contain the
+// configured location are returned, or those that do not describe their area geometrically.
+type CAPFeed struct {
+	URL    string  // Address of the CAP alert or Atom feed
+	Config *Config // Current Configuration
+}
+
+type capAlert struct {
+	Identifier string    `xml:"identifier"`
+	Sender     string    `xml:"sender"`
+	Status     string    `xml:"status"`
+	MsgType    string    `xml:"msgType"`
+	Info       []capInfo `xml:"info"`
+}
+
+type capInfo struct {
+	Language    string    `xml:"language"`
+	Event       string    `xml:"event"`
+	Severity    string    `xml:"severity"`
+	Effective   string    `xml:"effective"`
+	Onset       string    `xml:"onset"`
+	Expires     string    `xml:"expires"`
+	SenderName  string    `xml:"senderName"`
+	Headline    string    `xml:"headline"`
+	Description string    `xml:"description"`
+	Area        []capArea `xml:"area"`
+}
+
+type capArea struct {
+	AreaDesc string   `xml:"areaDesc"`
+	Polygon  []string `xml:"polygon"`
+	Circle   []string `xml:"circle"`
+}
+
+type atomFeed struct {
+	Entries []atomEntry `xml:"entry"`
+}
+
+// atomEntry is an entry of an Atom feed of CAP alerts. Some services include the
+// main CAP fields in the entry, others only link to the CAP alert.
+type atomEntry struct {
+	ID      string `xml:"id"`
+	Title   string `xml:"title"`
+	Summary string `xml:"summary"`
+	Links   []struct {
+		Href string `xml:"href,attr"`
+		Type string `xml:"type,attr"`
+		Rel  string `xml:"rel,attr"`
+	} `xml:"link"`
+	Identifier string   `xml:"identifier"`
+	Status     string   `xml:"status"`
+	MsgType    string   `xml:"msgType"`
+	Event      string   `xml:"event"`
+	Severity   string   `xml:"severity"`
+	Effective  string   `xml:"effective"`
+	Onset      string   `xml:"onset"`
+	Expires    string   `xml:"expires"`
+	AreaDesc   string   `xml:"areaDesc"`
+	Polygon    []string `xml:"polygon"`
+}
+
+// GetAlerts returns the alerts in the feed that apply to the location
+func (f *CAPFeed) GetAlerts() ([]Alert, error) {
+	b, err := f.get(f.URL)
+	if err != nil {
+		return nil, err
+	}
+	root, err := xmlRootName(b)
+	if err != nil {
+		return nil, err
+	}
+	switch root {
+	case "alert":
+		return f.decodeAlert(b)
+	case "feed":
+		return f.decodeFeed(b)
+	}
+	return nil, fmt.Errorf("%s is not a CAP alert or an Atom feed", f.URL)
+}
+
+// getSource returns the name the alerts of the feed are reported under
+func (f *CAPFeed) getSource() string {
+	if u, err := url.Parse(f.URL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return f.URL
+}
+
+func (f *CAPFeed) decodeFeed(b []byte) ([]Alert, error) {
+	r := atomFeed{}
+	if err := xml.Unmarshal(b, &r); err != nil {
+		return nil, err
+	}
+	as := []Alert{}
+	for _, e := range r.Entries {
+		if e.Event == "" {
+			// The entry only links to the CAP alert
+			l := e.capLink()
+			if l == "" {
+				continue
+			}
+			// Links may be relative to the feed
+			if base, err := url.Parse(f.URL); err == nil {
+				if u, err := base.Parse(l); err == nil {
+					l = u.String()
+				}
+			}
+			// An alert that cannot be read is skipped, so that it does not hide the others
+			cb, err := f.get(l)
+			if err != nil {
+				logger.Error("CAPFeed: [Err] ", "Error getting the alert "+l+". "+err.Error())
+				continue
+			}
+			a, err := f.decodeAlert(cb)
+			if err != nil {
+				logger.Error("CAPFeed: [Err] ", "Error reading the alert "+l+". "+err.Error())
+				continue
+			}
+			as = append(as, a...)
+			continue
+		}
+		if !isActualAlert(e.Status, e.MsgType) || !f.inArea(e.Polygon, nil) {
+			continue
+		}
+		a := Alert{
+			ID:          e.Identifier,
+			Source:      f.getSource(),
+			Event:       e.Event,
+			Severity:    e.Severity,
+			Area:        e.AreaDesc,
+			Start:       parseCAPTime(e.Onset, e.Effective),
+			End:         parseCAPTime(e.Expires),
+			Description: strings.TrimSpace(e.Summary),
+		}
+		if a.ID == "" {
+			// Entry identifiers are usually the address of the alert, which ends with its CAP identifier
+			a.ID = e.ID
+			if u, err := url.Parse(e.ID); err == nil && u.Scheme != "" && u.Host != "" {
+				a.ID = path.Base(u.Path)
+			}
+		}
+		as = append(as, a)
+	}
+	return as, nil
+}
+
+// capLink returns the address of the CAP alert the entry links to
+func (e atomEntry) capLink() string {
+	for _, l := range e.Links {
+		if strings.Contains(l.Type, "cap+xml") {
+			return l.Href
+		}
+	}
+	for _, l := range e.Links {
+		if l.Rel == "" || l.Rel == "alternate" {
+			return l.Href
+		}
+	}
+	return ""
+}
+
+func (f *CAPFeed) decodeAlert(b []byte) ([]Alert, error) {
+	r := capAlert{}
+	if err := xml.Unmarshal(b, &r); err != nil {
+		return nil, err
+	}
+	if !isActualAlert(r.Status, r.MsgType) || len(r.Info) == 0 {
+		return nil, nil
+	}
+	i := f.selectInfo(r.Info)
+	a := Alert{
+		ID:          r.Identifier,
+		Source:      f.getSource(),
+		Sender:      i.SenderName,
+		Event:       i.Event,
+		Severity:    i.Severity,
+		Start:       parseCAPTime(i.Onset, i.Effective),
+		End:         parseCAPTime(i.Expires),
+		Description: strings.TrimSpace(i.Description),
+	}
+	if a.Sender == "" {
+		a.Sender = r.Sender
+	}
+	if a.Description == "" {
+		a.Description = i.Headline
+	}
+	areas := []string{}
+	located := len(i.Area) == 0
+	for _, ar := range i.Area {
+		areas = append(areas, ar.AreaDesc)
+		if f.inArea(ar.Polygon, ar.Circle) {
+			located = true
+		}
+	}
+	if !located {
+		return nil, nil
+	}
+	a.Area = strings.Join(areas, ", ")
+	return []Alert{a}, nil
+}
+
+// selectInfo returns the information block of the alert in the configured language,
+// else in English, else the first one
+func (f *CAPFeed) selectInfo(is []capInfo) capInfo {
+	for _, l := range []string{f.Config.GetLanguage(), "en"} {
+		for _, i := range is {
+			if strings.HasPrefix(strings.ToLower(i.Language), l) {
+				return i
+			}
+		}
+	}
+	return is[0]
+}
+
+// inArea indicates whether the location is within one of the polygons or circles.
+// An area without polygons or circles is assumed to contain the location.
+func (f *CAPFeed) inArea(polygons []string, circles []string) bool {
+	if len(polygons) == 0 && len(circles) == 0 {
+		return true
+	}
+	lat, lon := float64(f.Config.Latitude), float64(f.Config.Longitude)
+	for _, p := range polygons {
+		if inPolygon(lat, lon, parseCAPPoints(p)) {
+			return true
+		}
+	}
+	for _, c := range circles {
+		// A circle is the centre point followed by the radius in kilometres
+		s := strings.Fields(c)
+		if len(s) != 2 {
+			continue
+		}
+		pts := parseCAPPoints(s[0])
+		r, err := strconv.ParseFloat(s[1], 64)
+		if err != nil || len(pts) != 1 {
+			continue
+		}
+		if distanceKm(lat, lon, pts[0][0], pts[0][1]) <= r {
+			return true
+		}
+	}
+	return false
+}
+
+// get downloads the document at the address
+func (f *CAPFeed) get(u string) ([]byte, error) {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", providerUserAgent)
+	resp, err := http.DefaultClient.Do(req)
+	if resp != nil {
+		defer resp.Body.Close()
+		resp.Close = true
+	}
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned status %s", u, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// xmlRootName returns the local name of the root element of the XML document
+func xmlRootName(b []byte) (string, error) {
+	d := xml.NewDecoder(bytes.NewReader(b))
+	for {
+		t, err := d.Token()
+		if err != nil {
+			return "", err
+		}
+		if s, ok := t.(xml.StartElement); ok {
+			return s.Name.Local, nil
+		}
+	}
+}
+
+// isActualAlert indicates whether the CAP status and message type are of an alert in force,
+// rather than a test, exercise or cancellation
+func isActualAlert(status string, msgType string) bool {
+	return (status == "" || status == "Actual") && msgType != "Cancel"
+}
+
+// parseCAPTime returns the first of the CAP date and time values that is set
+func parseCAPTime(vs ...string) time.Time {
+	for _, v := range vs {
+		if t, err := time.Parse(time.RFC3339, strings.TrimSpace(v)); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// parseCAPPoints parses the space separated "latitude,longitude" pairs of a CAP polygon
+func parseCAPPoints(s string) [][2]float64 {
+	pts := [][2]float64{}
+	for _, p := range strings.Fields(s) {
+		ll := strings.Split(p, ",")
+		if len(ll) != 2 {
+			continue
+		}
+		lat, err1 := strconv.ParseFloat(ll[0], 64)
+		lon, err2 := strconv.ParseFloat(ll[1], 64)
+		if err1 == nil && err2 == nil {
+			pts = append(pts, [2]float64{lat, lon})
+		}
+	}
+	return pts
+}
+
+// inPolygon indicates whether the point is inside the polygon, using the even-odd rule
+func inPolygon(lat float64, lon float64, pts [][2]float64) bool {
+	in := false
+	for i, j := 0, len(pts)-1; i < len(pts); j, i = i, i+1 {
+		a, b := pts[i], pts[j]
+		if (a[0] > lat) != (b[0] > lat) && lon < (b[1]-a[1])*(lat-a[0])/(b[0]-a[0])+a[1] {
+			in = !in
+		}
+	}
+	return in
+}
+
+// distanceKm returns the great circle distance between two points in kilometres
+func distanceKm(lat1 float64, lon1 float64, lat2 float64, lon2 float64) float64 {
+	r := math.Pi / 180
+	dLat := (lat2 - lat1) * r
+	dLon := (lon2 - lon1) * r
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1*r)*math.Cos(lat2*r)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 6371 * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+// MergeAlerts combines the alerts, removing duplicates and those that expired before t.
+// The most severe alerts are returned first.
+func MergeAlerts(t time.Time, lists ...[]Alert) []Alert {
+	as := []Alert{}
+	seen := map[string]bool{}
+	for _, l := range lists {
+		for _, a := range l {
+			if !a.End.IsZero() && a.End.Before(t) {
+				continue
+			}
+			k := a.key()
+			if seen[k] {
+				continue
+			}
+			seen[k] = true
+			as = append(as, a)
+		}
+	}
+	sort.SliceStable(as, func(i, j int) bool {
+		if ri, rj := severityRank[as[i].Severity], severityRank[as[j].Severity]; ri != rj {
+			return ri > rj
+		}
+		return as[i].Start.Before(as[j].Start)
+	})
+	return as
+}
+
+// key returns the value that identifies duplicates of the alert
+func (a Alert) key() string {
+	if a.ID != "" {
+		return a.ID
+	}
+	return a.Sender + "|" + a.Event + "|" + strconv.FormatInt(a.Start.Unix(), 10)
+}
+
+// IsActive indicates whether the alert is in force at t
+func (a Alert) IsActive(t time.Time) bool {
+	return !a.Start.After(t) && (a.End.IsZero() || a.End.After(t))
+}
+
+// In returns the alerts with their times in the location
+func (c AlertReport) In(loc *time.Location) AlertReport {
+	as := make([]Alert, len(c.Alerts))
+	for i, a := range c.Alerts {
+		a.Start = a.Start.In(loc)
+		a.End = a.End.In(loc)
+		as[i] = a
+	}
+	c.Alerts = as
+	return c
+}
+
+// ReadFromFile will read the alerts from the specified file
+func (c *AlertReport) ReadFromFile(path string) error {
+	_, err := os.Stat(path)
+	if !os.IsNotExist(err) {
+		b, err := ioutil.ReadFile(path)
+		if err == nil {
+			err = json.Unmarshal(b, &c)
+		}
+	}
+	return err
+}
+
+// WriteToFile will write the alerts to the specified file
+func (c *AlertReport) WriteToFile(path string) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0666)
+}
+
+// WriteTo serializes the entity and writes it to the http response
+func (c *AlertReport) WriteTo(w http.ResponseWriter) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("content-type", "application/json")
+	w.Write(b)
+	return nil
+}
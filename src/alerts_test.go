@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// testAlertProvider is a weather provider that also reports canned alerts
+type testAlertProvider struct {
+	testProvider
+	Alerts []Alert
+}
+
+func (p *testAlertProvider) GetAlerts() ([]Alert, error) {
+	p.Calls++
+	return p.Alerts, p.Err
+}
+
+func newCAPTestServer() *httptest.Server {
+	return httptest.NewServer(http.FileServer(http.Dir("testdata")))
+}
+
+func TestCanReadCAPAtomFeed(t *testing.T) {
+	srv := newCAPTestServer()
+	defer srv.Close()
+
+	f := CAPFeed{URL: srv.URL + "/cap_feed.xml", Config: &Config{Latitude: -33.92, Longitude: 18.42}}
+	as, err := f.GetAlerts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The snow warning is for another area and the test message is not in force
+	if len(as) != 2 {
+		t.Fatal("Expected 2 alerts, got", len(as), as)
+	}
+	u, _ := url.Parse(srv.URL)
+	a := as[0]
+	if a.ID != "2.49.0.0.710.0.2024.6.1.0900.RAIN" || a.Source != u.Host || a.Event != "Disruptive Rain" || a.Severity != "Moderate" || a.Area != "City of Cape Town" {
+		t.Error("Unexpected inline alert", a)
+	}
+	if a.Start.Unix() != time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC).Unix() || a.End.Unix() != time.Date(2024, 6, 2, 0, 0, 0, 0, time.UTC).Unix() {
+		t.Error("Unexpected inline alert times", a.Start, a.End)
+	}
+	// The last entry links to the CAP alert
+	a = as[1]
+	if a.ID != "2.49.0.0.710.0.2024.6.1.0800.WIND" || a.Sender != "South African Weather Service" || a.Event != "Damaging Winds" || a.Severity != "Severe" {
+		t.Error("Unexpected linked alert", a)
+	}
+}
+
+func TestCAPFeedSkipsAlertsThatCannotBeRead(t *testing.T) {
+	files := http.FileServer(http.Dir("testdata"))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/links.xml" {
+			files.ServeHTTP(w, r)
+			return
+		}
+		w.Write([]byte(`<feed xmlns="http://www.w3.org/2005/Atom">
+			<entry><id>missing</id><link type="application/cap+xml" href="missing.xml"/></entry>
+			<entry><id>wind</id><link type="application/cap+xml" href="cap_alert.xml"/></entry>
+		</feed>`))
+	}))
+	defer srv.Close()
+
+	f := CAPFeed{URL: srv.URL + "/links.xml", Config: &Config{Latitude: -33.92, Longitude: 18.42}}
+	as, err := f.GetAlerts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(as) != 1 || as[0].Event != "Damaging Winds" {
+		t.Error("Expected the alert that could be read, got", as)
+	}
+}
+
+func TestCAPAlertIsReadInTheConfiguredLanguage(t *testing.T) {
+	srv := newCAPTestServer()
+	defer srv.Close()
+
+	f := CAPFeed{URL: srv.URL + "/cap_alert.xml", Config: &Config{Latitude: -33.92, Longitude: 18.42, Language: "af"}}
+	as, err := f.GetAlerts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(as) != 1 || as[0].Event != "Skadelike Winde" || as[0].Area != "Stad Kaapstad" {
+		t.Error("Expected the Afrikaans alert", as)
+	}
+
+	// A language the alert is not issued in falls back to English
+	f.Config.Language = "de"
+	if as, err = f.GetAlerts(); err != nil || len(as) != 1 || as[0].Event != "Damaging Winds" {
+		t.Error("Expected the English alert", as, err)
+	}
+}
+
+func TestCAPAlertOutsideTheLocationIsIgnored(t *testing.T) {
+	srv := newCAPTestServer()
+	defer srv.Close()
+
+	f := CAPFeed{URL: srv.URL + "/cap_alert.xml", Config: &Config{Latitude: 39.0473, Longitude: -95.6752}}
+	as, err := f.GetAlerts()
+	if err != nil || len(as) != 0 {
+		t.Error("Expected no alerts for Topeka", as, err)
+	}
+}
+
+func TestCAPCircleContainsLocation(t *testing.T) {
+	f := CAPFeed{Config: &Config{Latitude: -33.92, Longitude: 18.42}}
+	if !f.inArea(nil, []string{"-33.96,18.60 20"}) {
+		t.Error("Expected Cape Town to be within 20km of the circle centre")
+	}
+	if f.inArea(nil, []string{"-33.96,18.60 10"}) {
+		t.Error("Expected Cape Town to be outside the 10km circle")
+	}
+}
+
+func TestMergeAlertsRemovesDuplicates(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	minor := Alert{Sender: "SAWS", Event: "Fog", Severity: "Minor", Start: now.Add(-time.Hour)}
+	severe := Alert{ID: "wind", Event: "Damaging Winds", Severity: "Severe", Start: now, End: now.Add(12 * time.Hour)}
+	expired := Alert{ID: "rain", Event: "Rain", Severity: "Extreme", End: now.Add(-time.Minute)}
+
+	as := MergeAlerts(now, []Alert{minor, expired, severe}, []Alert{severe, minor})
+	if len(as) != 2 {
+		t.Fatal("Expected 2 alerts, got", len(as), as)
+	}
+	if as[0].ID != "wind" || as[1].Event != "Fog" {
+		t.Error("Expected the most severe alert first", as)
+	}
+	if !as[1].IsActive(now) || as[0].IsActive(now.Add(13*time.Hour)) {
+		t.Error("Unexpected active state")
+	}
+}
+
+func TestAlertsCombineProviderAndFeeds(t *testing.T) {
+	chdirTemp(t)
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	a := Alert{ID: "wind", Event: "Damaging Winds", Severity: "Severe", Start: time.Now(), End: time.Now().Add(time.Hour)}
+	plain := &testProvider{Name: "Plain"}
+	bad := &testAlertProvider{testProvider: testProvider{Name: "Bad", Err: errors.New("quota exceeded")}}
+	good := &testAlertProvider{testProvider: testProvider{Name: "Good"}, Alerts: []Alert{a, a}}
+	cfg := &Config{AlertFeeds: []string{srv.URL + "/missing.xml"}}
+	c := WeatherController{Srv: &Server{Config: cfg}}
+	ps := []WeatherProvider{plain, bad, good}
+
+	// The missing feed does not stop the alerts of the provider from being returned
+	ar, err := c.getAlerts(cfg, ps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ar.Alerts) != 1 || ar.Alerts[0].ID != "wind" {
+		t.Error("Expected the alert of the provider", ar.Alerts)
+	}
+
+	// The alerts are cached
+	if ar, err = c.getAlerts(cfg, ps); err != nil || len(ar.Alerts) != 1 || good.Calls != 1 {
+		t.Error("Expected the cached alerts", ar, err, good.Calls)
+	}
+
+	// Stale alerts are returned with the error when every source fails
+	ar.Created = time.Now().Add(-time.Hour)
+	ar.WriteToFile("lastalerts.json")
+	ar, err = c.getAlerts(cfg, []WeatherProvider{bad})
+	if err == nil || len(ar.Alerts) != 1 {
+		t.Error("Expected the last alerts with the error", ar, err)
+	}
+}
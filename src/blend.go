@@ -0,0 +1,385 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Consensus is a virtual weather provider that queries several providers in parallel
+// and blends their results into a single forecast.
+type Consensus struct {
+	Config *Config // Current Configuration
+}
+
+func init() {
+	RegisterProvider(ProviderInfo{
+		Name:          "Consensus",
+		Description:   "Consensus of all providers",
+		AppIDOptional: true,
+		New:           func() WeatherProvider { return new(Consensus) },
+	})
+}
+
+// iconSeverity ranks the weather icons from the mildest to the most severe weather
+var iconSeverity = map[int]int{1: 1, 2: 2, 3: 3, 4: 4, 9: 5, 5: 6, 6: 7, 8: 8, 7: 9}
+
+// SetConfig sets the configuration for the provider
+func (p *Consensus) SetConfig(c *Config) {
+	p.Config = c
+}
+
+// GetProviderName returns the name of the provider
+func (p *Consensus) GetProviderName() string {
+	return "Consensus"
+}
+
+// GetWeather returns the blended current weather of the providers
+func (p *Consensus) GetWeather() (Weather, error) {
+	ws := []Weather{}
+	err := p.query(func(wp WeatherProvider) (interface{}, error) {
+		return wp.GetWeather()
+	}, func(wp WeatherProvider, v interface{}) {
+		ws = append(ws, v.(Weather))
+	})
+	w := blendWeather(ws)
+	w.Name = p.Config.LocationName
+	return w, err
+}
+
+// GetForecast returns the blended forecast of the providers. The daily forecasts of the providers
+// are kept in the sources of the forecast, so that each provider's forecast can be verified.
+func (p *Consensus) GetForecast() (Forecast, error) {
+	fs := []Forecast{}
+	srcs := []Forecast{}
+	err := p.query(func(wp WeatherProvider) (interface{}, error) {
+		return wp.GetForecast()
+	}, func(wp WeatherProvider, v interface{}) {
+		fs = append(fs, v.(Forecast))
+		srcs = append(srcs, Forecast{Current: Weather{Provider: wp.GetProviderName()}, Forecast: v.(Forecast).Forecast, Units: SIUnits})
+	})
+	f := blendForecast(fs)
+	f.Current.Name = p.Config.LocationName
+	f.Sources = srcs
+	return f, err
+}
+
+// GetAlerts returns the alerts of all the blended providers that report them
+func (p *Consensus) GetAlerts() ([]Alert, error) {
+	ps, err := p.getSources()
+	if err != nil {
+		return nil, err
+	}
+	aps := []WeatherProvider{}
+	for _, wp := range ps {
+		if _, ok := wp.(AlertProvider); ok {
+			aps = append(aps, wp)
+		}
+	}
+	vs, errs := queryProviders(aps, func(wp WeatherProvider) (interface{}, error) {
+		return wp.(AlertProvider).GetAlerts()
+	})
+	lists := [][]Alert{}
+	err = errAlertsNotSupported
+	for i, v := range vs {
+		if errs[i] == nil {
+			lists = append(lists, v.([]Alert))
+		} else if errs[i] != errAlertsNotSupported {
+			logger.Error("Consensus: [Err] ", "Error getting alerts from "+aps[i].GetProviderName()+". "+errs[i].Error())
+			err = errs[i]
+		}
+	}
+	if len(lists) == 0 {
+		return nil, err
+	}
+	return MergeAlerts(time.Now(), lists...), nil
+}
+
+// getSources returns the providers that are blended. If none are configured then
+// all the registered providers that do not need an Application ID, or have one, are used.
+func (p *Consensus) getSources() ([]WeatherProvider, error) {
+	names := p.Config.Blend
+	if len(names) == 0 {
+		for _, i := range GetProviders() {
+			// A weather station cannot forecast
+			if i.Name == p.GetProviderName() || i.Name == "Station" {
+				continue
+			}
+			if i.AppIDOptional || p.Config.GetAppID(i.Name) != "" {
+				names = append(names, i.Name)
+			}
+		}
+	}
+	ps := []WeatherProvider{}
+	for _, n := range names {
+		if n == p.GetProviderName() {
+			continue
+		}
+		wp, err := NewWeatherProvider(n, p.Config)
+		if err != nil {
+			return nil, err
+		}
+		ps = append(ps, wp)
+	}
+	if len(ps) == 0 {
+		return nil, errors.New("No providers are configured to blend")
+	}
+	return ps, nil
+}
+
+// query calls get on each of the source providers in parallel and passes the successful
+// results to add in the order of the providers. An error is only returned if all the providers fail.
+func (p *Consensus) query(get func(WeatherProvider) (interface{}, error), add func(WeatherProvider, interface{})) error {
+	ps, err := p.getSources()
+	if err != nil {
+		return err
+	}
+	vs, errs := queryProviders(ps, get)
+	for i, v := range vs {
+		if errs[i] == nil {
+			add(ps[i], v)
+		} else {
+			logger.Error("Consensus: [Err] ", "Error getting weather from "+ps[i].GetProviderName()+". "+errs[i].Error())
+		}
+	}
+	for _, e := range errs {
+		if e == nil {
+			return nil
+		}
+	}
+	msg := []string{}
+	for i, e := range errs {
+		msg = append(msg, ps[i].GetProviderName()+": "+e.Error())
+	}
+	return errors.New(strings.Join(msg, "; "))
+}
+
+// queryProviders calls get on each of the providers in parallel
+func queryProviders(ps []WeatherProvider, get func(WeatherProvider) (interface{}, error)) ([]interface{}, []error) {
+	vs := make([]interface{}, len(ps))
+	errs := make([]error, len(ps))
+	var wg sync.WaitGroup
+	for i, wp := range ps {
+		wg.Add(1)
+		go func(i int, wp WeatherProvider) {
+			defer wg.Done()
+			vs[i], errs[i] = get(wp)
+		}(i, wp)
+	}
+	wg.Wait()
+	return vs, errs
+}
+
+// blendWeather averages the current weather of the providers
+func blendWeather(ws []Weather) Weather {
+	w := Weather{Provider: "Consensus", Created: time.Now()}
+	if len(ws) == 0 {
+		return w
+	}
+	var x, y float64
+	icons := []int{}
+	for _, e := range ws {
+		w.Temp += e.Temp
+		w.Pressure += e.Pressure
+		w.Humidity += e.Humidity
+		w.WindSpeed += e.WindSpeed
+		// Wind directions are averaged as vectors so that 350° and 10° blend to 0°
+		r := float64(e.WindDirection) * math.Pi / 180
+		x += math.Cos(r) * float64(e.WindSpeed+1)
+		y += math.Sin(r) * float64(e.WindSpeed+1)
+		icons = append(icons, e.WeatherIcon)
+		if e.ReadingTime.After(w.ReadingTime) {
+			w.ReadingTime = e.ReadingTime
+		}
+		w.Sources = append(w.Sources, e.Provider)
+	}
+	n := float32(len(ws))
+	w.Temp /= n
+	w.Pressure /= n
+	w.Humidity /= n
+	w.WindSpeed /= n
+	w.WindDirection = float32(math.Mod(math.Atan2(y, x)*180/math.Pi+360, 360))
+	w.WeatherIcon = consensusIcon(icons)
+	for _, e := range ws {
+		if e.WeatherIcon == w.WeatherIcon {
+			w.WeatherDesc = e.WeatherDesc
+			break
+		}
+	}
+	f := ws[0]
+	w.IsDay = f.IsDay
+	w.Sunrise = f.Sunrise
+	w.Sunset = f.Sunset
+	// Not every provider reports the other conditions, they are taken from the first that does
+	for _, e := range ws {
+		if e.FeelsLike != 0 || e.DewPoint != 0 || e.Visibility != 0 || e.CloudCover != 0 || e.UVIndex != 0 || e.WindGust != 0 {
+			w.FeelsLike = e.FeelsLike
+			w.DewPoint = e.DewPoint
+			w.Visibility = e.Visibility
+			w.CloudCover = e.CloudCover
+			w.UVIndex = e.UVIndex
+			w.WindGust = e.WindGust
+			break
+		}
+	}
+	for _, e := range ws {
+		if e.Precip != 0 {
+			w.Precip = e.Precip
+			break
+		}
+	}
+	for _, e := range ws {
+		if e.PrecipRate != 0 {
+			w.PrecipRate = e.PrecipRate
+			break
+		}
+	}
+	for _, e := range ws {
+		if e.PressureTrend != "" {
+			w.PressureTrend = e.PressureTrend
+			break
+		}
+	}
+	return w
+}
+
+// blendForecast averages the forecast of the providers for each day, and records the
+// range of the forecast temperatures as the spread
+func blendForecast(fs []Forecast) Forecast {
+	f := Forecast{}
+	ws := []Weather{}
+	days := map[string][]reportedDay{}
+	for _, e := range fs {
+		if e.Current.Provider != "" {
+			ws = append(ws, e.Current)
+		}
+		r := reportedFields(e.Forecast)
+		for _, d := range e.Forecast {
+			// Providers place the day in the location's time zone, so the date is taken as is
+			k := d.Day.Format("2006-01-02")
+			days[k] = append(days[k], reportedDay{d, r})
+		}
+		f.Alerts = append(f.Alerts, e.Alerts...)
+		// Hourly forecasts are not blended, the first provider that has one is used
+		if len(f.Hourly) == 0 {
+			f.Hourly = e.Hourly
+		}
+	}
+	f.Current = blendWeather(ws)
+
+	keys := []string{}
+	for k := range days {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		f.Forecast = append(f.Forecast, blendDay(days[k], fs))
+	}
+	return f
+}
+
+// dayFields are the values of a forecast day that not every provider reports
+var dayFields = []func(d *ForecastDay) *float32{
+	func(d *ForecastDay) *float32 { return &d.PrecipProb },
+	func(d *ForecastDay) *float32 { return &d.Precip },
+	func(d *ForecastDay) *float32 { return &d.Rain },
+	func(d *ForecastDay) *float32 { return &d.Snow },
+	func(d *ForecastDay) *float32 { return &d.WindSpeed },
+	func(d *ForecastDay) *float32 { return &d.WindGust },
+	func(d *ForecastDay) *float32 { return &d.Humidity },
+	func(d *ForecastDay) *float32 { return &d.UVIndex },
+}
+
+// reportedDay is the forecast of a day by a provider, along with which of the dayFields the provider reports
+type reportedDay struct {
+	ForecastDay
+	reported []bool
+}
+
+// reportedFields returns which of the dayFields the provider reports, taken to be those it gave a value on any day.
+// A provider that does not report a value leaves it at 0 every day.
+func reportedFields(ds []ForecastDay) []bool {
+	r := make([]bool, len(dayFields))
+	for i, v := range dayFields {
+		for _, d := range ds {
+			if *v(&d) != 0 {
+				r[i] = true
+				break
+			}
+		}
+	}
+	return r
+}
+
+// blendDay averages the forecasts of the providers for a single day
+func blendDay(ds []reportedDay, fs []Forecast) ForecastDay {
+	d := ForecastDay{Day: ds[0].Day, Name: ds[0].Name, Sunrise: ds[0].Sunrise, Sunset: ds[0].Sunset}
+	s := &ForecastSpread{
+		TempMinLow: ds[0].TempMin, TempMinHigh: ds[0].TempMin,
+		TempMaxLow: ds[0].TempMax, TempMaxHigh: ds[0].TempMax,
+	}
+	icons := []int{}
+	for _, e := range ds {
+		d.TempMin += e.TempMin
+		d.TempMax += e.TempMax
+		s.TempMinLow = float32(math.Min(float64(s.TempMinLow), float64(e.TempMin)))
+		s.TempMinHigh = float32(math.Max(float64(s.TempMinHigh), float64(e.TempMin)))
+		s.TempMaxLow = float32(math.Min(float64(s.TempMaxLow), float64(e.TempMax)))
+		s.TempMaxHigh = float32(math.Max(float64(s.TempMaxHigh), float64(e.TempMax)))
+		icons = append(icons, e.WeatherIcon)
+	}
+	n := float32(len(ds))
+	d.TempMin /= n
+	d.TempMax /= n
+	// The other values are averaged over the providers that report them
+	for i, v := range dayFields {
+		var sum float32
+		c := 0
+		for _, e := range ds {
+			if e.reported[i] {
+				sum += *v(&e.ForecastDay)
+				c++
+			}
+		}
+		if c != 0 {
+			*v(&d) = sum / float32(c)
+		}
+	}
+	d.WeatherIcon = consensusIcon(icons)
+	for _, e := range ds {
+		if e.WeatherIcon == d.WeatherIcon {
+			d.WeatherDesc = e.WeatherDesc
+			break
+		}
+	}
+	// Record which providers forecast this day
+	for _, f := range fs {
+		for _, e := range f.Forecast {
+			if e.Day.Format("2006-01-02") == d.Day.Format("2006-01-02") {
+				s.Sources = append(s.Sources, f.Current.Provider)
+				break
+			}
+		}
+	}
+	d.Spread = s
+	return d
+}
+
+// consensusIcon returns the icon most of the providers agree on.
+// If there is no majority then the most severe of the most common icons is used.
+func consensusIcon(icons []int) int {
+	c := map[int]int{}
+	for _, i := range icons {
+		c[i]++
+	}
+	b := 0
+	for i, n := range c {
+		if n > c[b] || (n == c[b] && iconSeverity[i] > iconSeverity[b]) {
+			b = i
+		}
+	}
+	return b
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBlendForecast(t *testing.T) {
+	d1 := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	d2 := d1.AddDate(0, 0, 1)
+	fs := []Forecast{
+		{
+			Current: Weather{Provider: "A", Temp: 20, WindDirection: 350, WeatherIcon: 2},
+			Forecast: []ForecastDay{
+				{Day: d1, Name: "Saturday", TempMin: 10, TempMax: 20, WeatherIcon: 3, WeatherDesc: "Partly Cloudy"},
+				{Day: d2, Name: "Sunday", TempMin: 8, TempMax: 18, WeatherIcon: 6, WeatherDesc: "Rain"},
+			},
+		},
+		{
+			Current: Weather{Provider: "B", Temp: 22, WindDirection: 10, WeatherIcon: 2},
+			Forecast: []ForecastDay{
+				{Day: d1, Name: "Saturday", TempMin: 12, TempMax: 24, WeatherIcon: 3, WeatherDesc: "Cloudy Spells"},
+				{Day: d2, Name: "Sunday", TempMin: 6, TempMax: 16, WeatherIcon: 7, WeatherDesc: "Thunderstorms"},
+			},
+		},
+		{
+			Current: Weather{Provider: "C", Temp: 24, WindDirection: 0, WeatherIcon: 1},
+			Forecast: []ForecastDay{
+				{Day: d1, Name: "Saturday", TempMin: 11, TempMax: 22, WeatherIcon: 1, WeatherDesc: "Clear"},
+			},
+		},
+	}
+	f := blendForecast(fs)
+
+	w := f.Current
+	if w.Provider != "Consensus" || w.Temp != 22 || w.WeatherIcon != 2 || len(w.Sources) != 3 {
+		t.Error("Current weather was not blended", w)
+	}
+	if w.WindDirection > 1 && w.WindDirection < 359 {
+		t.Error("Wind direction was not averaged as a vector", w.WindDirection)
+	}
+
+	if len(f.Forecast) != 2 {
+		t.Fatal("Expected 2 forecast days, got", len(f.Forecast))
+	}
+	d := f.Forecast[0]
+	if d.TempMin != 11 || d.TempMax != 22 || d.WeatherIcon != 3 || d.WeatherDesc != "Partly Cloudy" {
+		t.Error("Unexpected blend for the first day", d)
+	}
+	s := d.Spread
+	if s == nil || s.TempMinLow != 10 || s.TempMinHigh != 12 || s.TempMaxLow != 20 || s.TempMaxHigh != 24 || len(s.Sources) != 3 {
+		t.Error("Unexpected spread for the first day", s)
+	}
+
+	// Without a majority the most severe weather is used
+	d = f.Forecast[1]
+	if d.WeatherIcon != 7 || d.TempMax != 17 || len(d.Spread.Sources) != 2 {
+		t.Error("Unexpected blend for the second day", d)
+	}
+}
+
+func TestBlendForecastOnlyAveragesReportedValues(t *testing.T) {
+	d1 := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	d2 := d1.AddDate(0, 0, 1)
+	fs := []Forecast{
+		{
+			Current: Weather{Provider: "A"},
+			Forecast: []ForecastDay{
+				{Day: d1, TempMin: 10, TempMax: 20, Humidity: 70, UVIndex: 6, PrecipProb: 40, Precip: 2, Rain: 2, WindGust: 12},
+				{Day: d2, TempMin: 10, TempMax: 20, Humidity: 60, UVIndex: 5},
+			},
+		},
+		{
+			// Reports no humidity, UV index or gusts
+			Current: Weather{Provider: "B"},
+			Forecast: []ForecastDay{
+				{Day: d1, TempMin: 12, TempMax: 22, PrecipProb: 60, Precip: 4, Rain: 4},
+				{Day: d2, TempMin: 12, TempMax: 22, PrecipProb: 10, Precip: 1, Rain: 1},
+			},
+		},
+	}
+	f := blendForecast(fs)
+	if len(f.Forecast) != 2 {
+		t.Fatal("Expected 2 forecast days, got", len(f.Forecast))
+	}
+	d := f.Forecast[0]
+	if d.Humidity != 70 || d.UVIndex != 6 || d.WindGust != 12 {
+		t.Error("Values not reported by a provider were averaged with 0", d)
+	}
+	if d.PrecipProb != 50 || d.Precip != 3 || d.Rain != 3 {
+		t.Error("Unexpected precipitation for the first day", d)
+	}
+
+	// A day without rain from a provider that reports precipitation still counts
+	d = f.Forecast[1]
+	if d.PrecipProb != 5 || d.Precip != 0.5 || d.Humidity != 60 {
+		t.Error("Unexpected blend for the second day", d)
+	}
+}
+
+func TestConsensusIcon(t *testing.T) {
+	tests := []struct {
+		icons []int
+		i     int
+	}{
+		{[]int{1, 1, 6}, 1},
+		{[]int{4, 9}, 9},
+		{[]int{8, 6}, 8},
+		{[]int{5, 4, 3}, 5},
+		{[]int{}, 0},
+	}
+	for _, e := range tests {
+		if i := consensusIcon(e.icons); i != e.i {
+			t.Error("Icons", e.icons, "gave", i, "expected", e.i)
+		}
+	}
+}
+
+func TestQueryProvidersInParallel(t *testing.T) {
+	ps := []WeatherProvider{
+		&testProvider{Name: "A", Temp: 20},
+		&testProvider{Name: "B", Err: errors.New("quota exceeded")},
+		&testProvider{Name: "C", Temp: 24},
+	}
+	vs, errs := queryProviders(ps, func(wp WeatherProvider) (interface{}, error) {
+		return wp.GetWeather()
+	})
+	if errs[0] != nil || errs[1] == nil || errs[2] != nil {
+		t.Error("Unexpected errors", errs)
+	}
+	if vs[0].(Weather).Provider != "A" || vs[2].(Weather).Temp != 24 {
+		t.Error("Results were not returned in the order of the providers", vs)
+	}
+}
@@ -7,17 +7,78 @@ import (
 	"io/ioutil"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	// The time zone database is embedded for systems that do not have one
+	_ "time/tzdata"
 )
 
 // Config holds the configuration required for the Soil Monitor module.
 type Config struct {
-	LocationName string  `json:"locationName"` // Name of the Location
-	LocationID   string  `json:"locationID"`   // Location identifier
-	Latitude     float32 `json:"latitude"`     // Location Latitude
-	Longitude    float32 `json:"longitude"`    // Location Longitude
-	Provider     int     `json:"provider"`     // Provider type: 0=OpenWeather, 1=AccuWeather
-	UnitType     int     `json:"unitType"`     // Unit type: 0=Metric, 1=Imperial
-	AppID        string  `json:"appID"`        // Provider Application Identifier
+	LocationName string            `json:"locationName"`          // Name of the Location
+	LocationID   string            `json:"locationID,omitempty"`  // Legacy location identifier of the configured provider
+	LocationIDs  map[string]string `json:"locationIDs,omitempty"` // Location identifiers cached by each provider
+	Latitude     float32           `json:"latitude"`              // Location Latitude
+	Longitude    float32           `json:"longitude"`             // Location Longitude
+	TimeZone     string            `json:"timeZone"`              // IANA time zone of the location, e.g. Africa/Johannesburg
+	Provider     string            `json:"provider"`              // Name of the preferred weather provider
+	Fallbacks    []string          `json:"fallbacks,omitempty"`   // Names of the providers to try, in order, if the preferred provider fails
+	UnitType     int               `json:"unitType"`              // Unit type: 0=Metric, 1=Imperial
+	Units        Units             `json:"units"`                 // Units of particular quantities that replace those of the unit type
+	AppID        string            `json:"appID,omitempty"`       // Provider Application Identifier used if a provider does not have its own
+	AppIDs       map[string]string `json:"appIDs,omitempty"`      // Application Identifiers for each provider
+	StationKey   string            `json:"stationKey"`            // Password or passkey a weather station must upload with, if set
+	Blend        []string          `json:"blend,omitempty"`       // Names of the providers blended by the Consensus provider, all usable providers if empty
+	OneCall      bool              `json:"oneCall"`               // Use the OpenWeather One Call 3.0 API, which needs a One Call subscription
+	Language     string            `json:"language"`              // Language the weather is reported in
+	AlertFeeds   []string          `json:"alertFeeds,omitempty"`  // Addresses of CAP alerts or Atom feeds of CAP alerts of national warning services
+	Rules        []Rule            `json:"rules,omitempty"`       // Threshold rules that fire notifications
+	Webhooks     []Webhook         `json:"webhooks,omitempty"`    // Addresses that are posted weather events
+	MQTT         MQTTConfig        `json:"mqtt"`                  // MQTT broker the weather is published to
+	Locations    []Location        `json:"locations,omitempty"`   // Named locations the weather is also reported for
+	owner        *Config           // Configuration this configuration was derived from
+	location     string            // Identifier of the named location this configuration was derived for, if any
+}
+
+// configLock guards the location identifiers cached by providers that run in parallel, the rules, the webhooks
+// and the named locations
+var configLock sync.Mutex
+
+// tzLookups holds the coordinates whose time zone has been looked up
+var tzLookups = struct {
+	sync.Mutex
+	tried map[string]bool
+}{tried: map[string]bool{}}
+
+// legacyProviders maps the integer provider values used by earlier versions of the configuration
+// onto the registered provider names.
+var legacyProviders = []string{"OpenWeather", "AccuWeather"}
+
+// UnmarshalJSON deserializes the configuration, accepting the legacy integer provider value
+func (c *Config) UnmarshalJSON(b []byte) error {
+	type config Config
+	v := struct {
+		*config
+		Provider json.RawMessage `json:"provider"`
+	}{config: (*config)(c)}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	if len(v.Provider) == 0 || string(v.Provider) == "null" {
+		return nil
+	}
+	var n int
+	if err := json.Unmarshal(v.Provider, &n); err == nil {
+		if n < 0 || n >= len(legacyProviders) {
+			return fmt.Errorf("invalid legacy provider value %d", n)
+		}
+		c.Provider = legacyProviders[n]
+		return nil
+	}
+	return json.Unmarshal(v.Provider, &c.Provider)
 }
 
 // ReadFromFile will read the configuration settings from the specified file
@@ -35,7 +96,13 @@ func (c *Config) ReadFromFile(path string) error {
 
 // WriteToFile will write the configuration settings to the specified file
 func (c *Config) WriteToFile(path string) error {
+	if c.owner != nil {
+		// Save the configuration this one was derived from instead
+		return c.owner.WriteToFile(path)
+	}
+	configLock.Lock()
 	b, err := json.Marshal(c)
+	configLock.Unlock()
 	if err != nil {
 		return err
 	}
@@ -84,13 +151,390 @@ func (c *Config) Deserialize(v string) error {
 // SetDefaults checks the configuration and makes sure that, if a value is not configured, the default value is set.
 func (c *Config) SetDefaults() {
 	// Set any defaults required
+	if c.Provider == "" {
+		// Default to a provider that does not need an Application ID
+		c.Provider = "OpenMeteo"
+	}
+	if l, ok := ParseLanguage(c.Language); ok {
+		c.Language = l
+	} else {
+		c.Language = "en"
+	}
+	if c.LocationID != "" {
+		// Earlier versions only cached the location identifier of the configured provider
+		c.SetLocationID(c.Provider, c.LocationID)
+		c.LocationID = ""
+	}
 	if c.Longitude == 0 && c.Latitude == 0 {
 		i, err := GetIPLocationInfo()
 		if err == nil {
 			c.LocationName = fmt.Sprintf("%s, %s", i.City, i.Country)
 			c.Longitude = i.Longitude
 			c.Latitude = i.Latitude
+			if c.TimeZone == "" {
+				c.TimeZone = i.TimeZone
+			}
+		}
+	}
+}
+
+// LookupTimeZones looks up the time zone of the configured location, and of each named location, that was
+// entered without one from its coordinates. The coordinates are only looked up once, whether or not a time zone
+// is found. It returns whether a time zone was found, so that the configuration can be saved.
+func (c *Config) LookupTimeZones() bool {
+	tzLookups.Lock()
+	defer tzLookups.Unlock()
+	found := false
+	lookup := func(tz *string, lat float32, lon float32) {
+		k := fmt.Sprintf("%f,%f", lat, lon)
+		if *tz != "" || (lat == 0 && lon == 0) || tzLookups.tried[k] {
+			return
+		}
+		tzLookups.tried[k] = true
+		t, err := LookupTimeZone(lat, lon)
+		if err != nil {
+			logger.Error("Config: [Err] ", fmt.Sprintf("Error looking up the time zone of %f,%f. %s", lat, lon, err.Error()))
+			return
+		}
+		configLock.Lock()
+		*tz = t
+		configLock.Unlock()
+		found = true
+	}
+	lookup(&c.TimeZone, c.Latitude, c.Longitude)
+	configLock.Lock()
+	ls := make([]Location, len(c.Locations))
+	copy(ls, c.Locations)
+	configLock.Unlock()
+	for _, l := range ls {
+		lookup(&l.TimeZone, l.Latitude, l.Longitude)
+		if l.TimeZone != "" {
+			configLock.Lock()
+			if i := c.findLocation(l.ID); i >= 0 && c.Locations[i].TimeZone == "" {
+				c.Locations[i].TimeZone = l.TimeZone
+			}
+			configLock.Unlock()
+		}
+	}
+	return found
+}
+
+// ProviderOrder returns the names of the configured providers in order of preference
+func (c *Config) ProviderOrder() []string {
+	l := []string{c.Provider}
+	for _, n := range c.Fallbacks {
+		f := false
+		for _, e := range l {
+			f = f || e == n
+		}
+		if !f {
+			l = append(l, n)
+		}
+	}
+	return l
+}
+
+// GetAppID returns the Application Identifier configured for the named provider
+func (c *Config) GetAppID(provider string) string {
+	if a, ok := c.AppIDs[provider]; ok && a != "" {
+		return a
+	}
+	return c.AppID
+}
+
+// GetLocationID returns the location identifier cached by the named provider
+func (c *Config) GetLocationID(provider string) string {
+	if c.owner != nil {
+		return c.owner.getLocationID(c.location, provider)
+	}
+	return c.getLocationID("", provider)
+}
+
+// getLocationID returns the location identifier the named provider cached for the named location,
+// or for the configured location if no location is named
+func (c *Config) getLocationID(location string, provider string) string {
+	configLock.Lock()
+	defer configLock.Unlock()
+	if location == "" {
+		return c.LocationIDs[provider]
+	}
+	if i := c.findLocation(location); i >= 0 {
+		return c.Locations[i].LocationIDs[provider]
+	}
+	return ""
+}
+
+// SetLocationID caches the location identifier for the named provider
+func (c *Config) SetLocationID(provider string, id string) {
+	if c.owner != nil {
+		c.owner.setLocationID(c.location, provider, id)
+		return
+	}
+	c.setLocationID("", provider, id)
+}
+
+// setLocationID caches the location identifier the named provider uses for the named location,
+// or for the configured location if no location is named
+func (c *Config) setLocationID(location string, provider string, id string) {
+	configLock.Lock()
+	defer configLock.Unlock()
+	ids := &c.LocationIDs
+	if location != "" {
+		i := c.findLocation(location)
+		if i < 0 {
+			return
+		}
+		ids = &c.Locations[i].LocationIDs
+	}
+	if *ids == nil {
+		*ids = map[string]string{}
+	}
+	(*ids)[provider] = id
+}
+
+// GetRules returns a copy of the threshold rules
+func (c *Config) GetRules() []Rule {
+	if c.owner != nil {
+		return c.owner.GetRules()
+	}
+	configLock.Lock()
+	defer configLock.Unlock()
+	return append([]Rule{}, c.Rules...)
+}
+
+// SetRule adds the rule, or replaces the rule with the same identifier.
+// A new rule is given an identifier if it does not have one.
+func (c *Config) SetRule(r Rule) Rule {
+	if c.owner != nil {
+		return c.owner.SetRule(r)
+	}
+	configLock.Lock()
+	defer configLock.Unlock()
+	if r.ID == "" {
+		r.ID = strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	for i, e := range c.Rules {
+		if e.ID == r.ID {
+			c.Rules[i] = r
+			return r
+		}
+	}
+	c.Rules = append(c.Rules, r)
+	return r
+}
 
+// DeleteRule removes the rule with the identifier, returning false if there is no such rule
+func (c *Config) DeleteRule(id string) bool {
+	if c.owner != nil {
+		return c.owner.DeleteRule(id)
+	}
+	configLock.Lock()
+	defer configLock.Unlock()
+	for i, e := range c.Rules {
+		if e.ID == id {
+			c.Rules = append(c.Rules[:i:i], c.Rules[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// GetWebhooks returns a copy of the webhooks
+func (c *Config) GetWebhooks() []Webhook {
+	if c.owner != nil {
+		return c.owner.GetWebhooks()
+	}
+	configLock.Lock()
+	defer configLock.Unlock()
+	return append([]Webhook{}, c.Webhooks...)
+}
+
+// SetWebhook adds the webhook, or replaces the webhook with the same identifier.
+// A new webhook is given an identifier if it does not have one.
+func (c *Config) SetWebhook(h Webhook) Webhook {
+	if c.owner != nil {
+		return c.owner.SetWebhook(h)
+	}
+	configLock.Lock()
+	defer configLock.Unlock()
+	if h.ID == "" {
+		h.ID = strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	for i, e := range c.Webhooks {
+		if e.ID == h.ID {
+			c.Webhooks[i] = h
+			return h
+		}
+	}
+	c.Webhooks = append(c.Webhooks, h)
+	return h
+}
+
+// DeleteWebhook removes the webhook with the identifier, returning false if there is no such webhook
+func (c *Config) DeleteWebhook(id string) bool {
+	if c.owner != nil {
+		return c.owner.DeleteWebhook(id)
+	}
+	configLock.Lock()
+	defer configLock.Unlock()
+	for i, e := range c.Webhooks {
+		if e.ID == id {
+			c.Webhooks = append(c.Webhooks[:i:i], c.Webhooks[i+1:]...)
+			return true
 		}
 	}
+	return false
+}
+
+// GetLocations returns a copy of the named locations
+func (c *Config) GetLocations() []Location {
+	if c.owner != nil {
+		return c.owner.GetLocations()
+	}
+	configLock.Lock()
+	defer configLock.Unlock()
+	ls := []Location{}
+	for _, l := range c.Locations {
+		l.LocationIDs = copyLocationIDs(l.LocationIDs)
+		ls = append(ls, l)
+	}
+	return ls
+}
+
+// SetLocation adds the named location, or replaces the location with the same identifier.
+// The location identifiers cached by the providers are kept if the coordinates have not changed.
+func (c *Config) SetLocation(l Location) Location {
+	if c.owner != nil {
+		return c.owner.SetLocation(l)
+	}
+	configLock.Lock()
+	defer configLock.Unlock()
+	l.LocationIDs = nil
+	if i := c.findLocation(l.ID); i >= 0 {
+		if e := c.Locations[i]; e.Latitude == l.Latitude && e.Longitude == l.Longitude {
+			l.LocationIDs = e.LocationIDs
+		}
+		c.Locations[i] = l
+		return l
+	}
+	c.Locations = append(c.Locations, l)
+	return l
+}
+
+// DeleteLocation removes the named location, returning false if there is no such location
+func (c *Config) DeleteLocation(id string) bool {
+	if c.owner != nil {
+		return c.owner.DeleteLocation(id)
+	}
+	configLock.Lock()
+	defer configLock.Unlock()
+	i := c.findLocation(id)
+	if i < 0 {
+		return false
+	}
+	c.Locations = append(c.Locations[:i:i], c.Locations[i+1:]...)
+	return true
+}
+
+// findLocation returns the index of the named location, or -1 if there is no such location.
+// The lock must be held.
+func (c *Config) findLocation(id string) int {
+	for i, l := range c.Locations {
+		if l.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// copyLocationIDs returns a copy of the location identifiers cached by the providers
+func copyLocationIDs(ids map[string]string) map[string]string {
+	if ids == nil {
+		return nil
+	}
+	m := map[string]string{}
+	for k, v := range ids {
+		m[k] = v
+	}
+	return m
+}
+
+// GetNamedLocation returns the identifier of the named location the configuration reports the weather for,
+// or an empty string if it reports the weather for the configured location
+func (c *Config) GetNamedLocation() string {
+	return c.location
+}
+
+// GetTimeZone returns the time zone of the location.
+// The time zone of the server is used if the time zone is not configured or unknown.
+func (c *Config) GetTimeZone() *time.Location {
+	if c.TimeZone != "" {
+		if l, err := time.LoadLocation(c.TimeZone); err == nil {
+			return l
+		}
+	}
+	return time.Local
+}
+
+// GetLanguage returns the language the weather is reported in
+func (c *Config) GetLanguage() string {
+	if c.Language == "" {
+		return "en"
+	}
+	return c.Language
+}
+
+// ForLanguage returns a copy of the configuration that reports the weather in the language.
+// Location identifiers cached by the providers are saved to this configuration.
+func (c *Config) ForLanguage(lang string) *Config {
+	d := *c
+	d.Language = lang
+	d.owner = c.getRoot()
+	return &d
+}
+
+// ForLocation returns a copy of the configuration that reports the weather for the named location, which is
+// found by its identifier or its name. Location identifiers cached by the providers are saved to the named location.
+// False is returned if there is no such location.
+func (c *Config) ForLocation(id string) (*Config, bool) {
+	r := c.getRoot()
+	configLock.Lock()
+	i := r.findLocation(id)
+	if i < 0 {
+		for j, e := range r.Locations {
+			if strings.EqualFold(e.Name, id) {
+				i = j
+			}
+		}
+	}
+	if i < 0 {
+		configLock.Unlock()
+		return nil, false
+	}
+	l := r.Locations[i]
+	configLock.Unlock()
+
+	d := *c
+	d.LocationName = l.Name
+	d.Latitude = l.Latitude
+	d.Longitude = l.Longitude
+	d.TimeZone = l.TimeZone
+	if l.Provider != "" {
+		d.Provider = l.Provider
+		d.Fallbacks = l.Fallbacks
+	}
+	d.UnitType = l.UnitType
+	d.Units = l.Units
+	d.LocationIDs = nil
+	d.location = l.ID
+	d.owner = r
+	return &d, true
+}
+
+// getRoot returns the configuration this configuration was derived from, or this configuration if it was not derived
+func (c *Config) getRoot() *Config {
+	if c.owner != nil {
+		return c.owner
+	}
+	return c
 }
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestCanReadLegacyProvider(t *testing.T) {
+	for v, n := range map[string]string{"0": "OpenWeather", "1": "AccuWeather", `"AccuWeather"`: "AccuWeather"} {
+		c := Config{}
+		err := c.Deserialize(`{"latitude":-33.9,"longitude":18.4,"provider":` + v + `}`)
+		if err != nil {
+			t.Error(err)
+		}
+		if c.Provider != n {
+			t.Error("Provider", v, "was read as", c.Provider, "expected", n)
+		}
+		if c.Latitude != -33.9 {
+			t.Error("Latitude was not read")
+		}
+	}
+}
+
+func TestInvalidLegacyProviderFails(t *testing.T) {
+	c := Config{}
+	if err := c.Deserialize(`{"latitude":-33.9,"longitude":18.4,"provider":5}`); err == nil {
+		t.Error("Expected an error for an unknown legacy provider")
+	}
+}
+
+func TestLegacyLocationIDBelongsToProvider(t *testing.T) {
+	c := Config{}
+	err := c.Deserialize(`{"latitude":-33.9,"longitude":18.4,"provider":1,"locationID":"305605","appID":"key"}`)
+	if err != nil {
+		t.Error(err)
+	}
+	if c.GetLocationID("AccuWeather") != "305605" || c.GetLocationID("NWS") != "" || c.LocationID != "" {
+		t.Error("The legacy location ID was not assigned to the configured provider", c.LocationIDs)
+	}
+	if c.GetAppID("AccuWeather") != "key" {
+		t.Error("The legacy application ID was not used", c.GetAppID("AccuWeather"))
+	}
+}
+
+// useTestTimeZones answers the time zone lookups with the time zone, counting the calls
+func useTestTimeZones(t *testing.T, tz string) *int {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte(`{"latitude":-33.92,"longitude":18.42,"timezone":"` + tz + `","timezone_abbreviation":"SAST"}`))
+	}))
+	u := omURL
+	omURL = srv.URL
+	tzLookups.tried = map[string]bool{}
+	t.Cleanup(func() {
+		omURL = u
+		srv.Close()
+	})
+	return &calls
+}
+
+func TestTimeZoneIsLookedUp(t *testing.T) {
+	calls := useTestTimeZones(t, "Africa/Johannesburg")
+	c := Config{}
+	if err := c.Deserialize(`{"latitude":-33.92,"longitude":18.42}`); err != nil {
+		t.Fatal(err)
+	}
+	if c.TimeZone != "" || *calls != 0 {
+		t.Error("Expected the time zone not to be looked up while reading the configuration, got", c.TimeZone, *calls)
+	}
+	if !c.LookupTimeZones() || c.TimeZone != "Africa/Johannesburg" || *calls != 1 {
+		t.Error("Expected the time zone to be looked up, got", c.TimeZone, *calls)
+	}
+	if c.LookupTimeZones() || *calls != 1 {
+		t.Error("Expected a known time zone not to be looked up again")
+	}
+}
+
+func TestTimeZoneIsLookedUpOnce(t *testing.T) {
+	calls := useTestTimeZones(t, "Atlantis/Lost")
+	c := Config{Latitude: -33.92, Longitude: 18.42}
+	if c.LookupTimeZones() || c.LookupTimeZones() || c.TimeZone != "" || *calls != 1 {
+		t.Error("Expected an unknown time zone to be looked up once, got", c.TimeZone, *calls)
+	}
+}
+
+func TestBlankTimeZoneKeepsTheConfiguredOne(t *testing.T) {
+	chdirTemp(t)
+	calls := useTestTimeZones(t, "Africa/Johannesburg")
+	s := &Server{Config: &Config{Latitude: -33.92, Longitude: 18.42, TimeZone: "Europe/London"}}
+	router := mux.NewRouter()
+	c := ConfigController{}
+	c.AddController(router, s)
+	post := func(lat string) {
+		f := url.Values{"locationname": {"Cape Town"}, "latitude": {lat}, "longitude": {"18.42"}, "timezone": {""}, "provider": {"OpenMeteo"}, "unittype": {"0"}}
+		req := httptest.NewRequest("POST", "/config/set", strings.NewReader(f.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != 200 {
+			t.Fatal("Unexpected response", rec.Code, rec.Body.String())
+		}
+	}
+	post("-33.92")
+	if s.Config.TimeZone != "Europe/London" || *calls != 0 {
+		t.Error("Expected the time zone to be kept, got", s.Config.TimeZone)
+	}
+	// The time zone of a location that moved is looked up with its weather
+	post("-33.93")
+	if s.Config.TimeZone != "" || *calls != 0 {
+		t.Error("Expected the time zone to be cleared without a lookup, got", s.Config.TimeZone, *calls)
+	}
+	if !s.Config.LookupTimeZones() || s.Config.TimeZone != "Africa/Johannesburg" || *calls != 1 {
+		t.Error("Expected the time zone to be looked up, got", s.Config.TimeZone)
+	}
+}
+
+func TestBlankMQTTPasswordKeepsTheConfiguredOne(t *testing.T) {
+	s := &Server{Config: &Config{Latitude: -33.92, Longitude: 18.42, TimeZone: "Africa/Johannesburg", MQTT: MQTTConfig{Broker: "mqtt.local:1883", Username: "weather", Password: "s3cret"}}}
+	router := mux.NewRouter()
+	c := ConfigController{}
+	c.AddController(router, s)
+	post := func(user string, password string) {
+		f := url.Values{"locationname": {"Cape Town"}, "latitude": {"-33.92"}, "longitude": {"18.42"}, "timezone": {"Africa/Johannesburg"}, "provider": {"OpenMeteo"}, "unittype": {"0"},
+			"mqttbroker": {"mqtt.local:1883"}, "mqttusername": {user}, "mqttpassword": {password}}
+		req := httptest.NewRequest("POST", "/config/set", strings.NewReader(f.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != 200 {
+			t.Fatal("Unexpected response", rec.Code, rec.Body.String())
+		}
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/config.html", nil))
+	if b := rec.Body.String(); strings.Contains(b, "s3cret") || !strings.Contains(b, "Leave empty to keep the password") {
+		t.Error("Expected the password not to be shown")
+	}
+
+	// The configuration is written to the working directory
+	chdirTemp(t)
+	post("weather", "")
+	if s.Config.MQTT.Password != "s3cret" {
+		t.Error("Expected the password to be kept, got", s.Config.MQTT.Password)
+	}
+	post("weather", "n3w")
+	if s.Config.MQTT.Password != "n3w" {
+		t.Error("Expected the password to be changed, got", s.Config.MQTT.Password)
+	}
+	post("", "")
+	if s.Config.MQTT.Password != "" {
+		t.Error("Expected the password to be cleared with the user name, got", s.Config.MQTT.Password)
+	}
+}
@@ -3,8 +3,12 @@ package main
 import (
 	"fmt"
 	"html/template"
+	"net"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 )
@@ -16,14 +20,30 @@ type ConfigController struct {
 
 // ConfigPageData holds the data used to write to the configuration page.
 type ConfigPageData struct {
-	LocationName string // Name of the location
-	Longitude    string // Location Latitude
-	Latitude     string // Location Longitude
-	Provider     int    // Weather Provider: 0=OpenWeather, 1=AccuWeather
-	AppID        string // Provider Application Identifier
-	UnitType     int    // Unit Type: 0=Metric, 1=Imperial
+	LocationName string            // Name of the location
+	Longitude    string            // Location Latitude
+	Latitude     string            // Location Longitude
+	TimeZone     string            // IANA time zone of the location
+	Provider     string            // Name of the selected Weather Provider
+	Fallbacks    []string          // Names of the fallback Weather Providers, in order
+	Providers    []ProviderInfo    // Registered Weather Providers
+	AppIDs       map[string]string // Application Identifier for each provider
+	UnitType     int               // Unit Type: 0=Metric, 1=Imperial
+	Units        Units             // Units of particular quantities that replace those of the unit type
+	StationKey   string            // Password or passkey a weather station must upload with
+	OneCall      bool              // Use the OpenWeather One Call API
+	Language     string            // Language of the page and the weather
+	Languages    []LanguageInfo    // Supported languages
+	AlertFeeds   string            // Addresses of the CAP alert feeds, one per line
+	Rules        RuleList          // Threshold rules and their states
+	Metrics      []RuleMetric      // Quantities rules can compare
+	Locations    []Location        // Named locations rules can compare the weather of
+	MQTT         MQTTConfig        // MQTT broker the weather is published to
 }
 
+// maxFallbacks is the number of fallback providers that can be selected on the configuration page
+const maxFallbacks = 3
+
 // AddController adds the controller routes to the router
 func (c *ConfigController) AddController(router *mux.Router, s *Server) {
 	c.Srv = s
@@ -35,14 +55,41 @@ func (c *ConfigController) AddController(router *mux.Router, s *Server) {
 }
 
 func (c *ConfigController) handleConfigWebPage(w http.ResponseWriter, r *http.Request) {
-	t := template.Must(template.ParseFiles("./html/config.html"))
+	lang := c.Srv.Config.GetLanguage()
+	if l, ok := ParseLanguage(r.URL.Query().Get("lang")); ok {
+		lang = l
+	}
+	t := template.Must(template.New("config.html").Funcs(templateFuncs(lang)).ParseFiles("./html/config.html"))
 
 	v := ConfigPageData{
 		LocationName: c.Srv.Config.LocationName,
 		Longitude:    fmt.Sprintf("%f", c.Srv.Config.Longitude),
 		Latitude:     fmt.Sprintf("%f", c.Srv.Config.Latitude),
+		TimeZone:     c.Srv.Config.TimeZone,
 		Provider:     c.Srv.Config.Provider,
-		AppID:        c.Srv.Config.AppID,
+		Providers:    GetProviders(),
+		AppIDs:       map[string]string{},
+		StationKey:   c.Srv.Config.StationKey,
+		OneCall:      c.Srv.Config.OneCall,
+		UnitType:     c.Srv.Config.UnitType,
+		Units:        c.Srv.Config.Units,
+		Language:     lang,
+		Languages:    Languages,
+		AlertFeeds:   strings.Join(c.Srv.Config.AlertFeeds, "\n"),
+		Metrics:      RuleMetrics,
+		Locations:    c.Srv.Config.GetLocations(),
+		MQTT:         c.Srv.Config.MQTT,
+	}
+	rc := RuleController{Srv: c.Srv}
+	v.Rules = rc.getRuleList()
+
+	for _, p := range v.Providers {
+		v.AppIDs[p.Name] = c.Srv.Config.GetAppID(p.Name)
+	}
+	// Show an empty slot for each fallback provider that could still be added
+	v.Fallbacks = append(v.Fallbacks, c.Srv.Config.Fallbacks...)
+	for len(v.Fallbacks) < len(v.Providers)-1 && len(v.Fallbacks) < maxFallbacks {
+		v.Fallbacks = append(v.Fallbacks, "")
 	}
 
 	t.Execute(w, v)
@@ -60,9 +107,31 @@ func (c *ConfigController) handleSetConfig(w http.ResponseWriter, r *http.Reques
 	nam := r.Form.Get("locationname")
 	lon := r.Form.Get("longitude")
 	lat := r.Form.Get("latitude")
+	tz := r.Form.Get("timezone")
 	prv := r.Form.Get("provider")
 	app := r.Form.Get("appid")
 	unt := r.Form.Get("unittype")
+	stk := r.Form.Get("stationkey")
+	onc := r.Form.Get("onecall") != ""
+	lng := r.Form.Get("language")
+	afs := strings.Fields(r.Form.Get("alertfeeds"))
+	mqt := c.Srv.Config.MQTT
+	mqt.Broker = strings.TrimSpace(r.Form.Get("mqttbroker"))
+	mqt.Username = r.Form.Get("mqttusername")
+	// The password is not shown on the page, so it is kept unless a new one is given or the user name is cleared
+	if p := r.Form.Get("mqttpassword"); p != "" || mqt.Username == "" {
+		mqt.Password = p
+	}
+	mqt.Prefix = strings.Trim(strings.TrimSpace(r.Form.Get("mqttprefix")), "/")
+	mqt.TLS = r.Form.Get("mqtttls") != ""
+	mqt.Discovery = r.Form.Get("mqttdiscovery") != ""
+	uns := Units{
+		Temp:      r.Form.Get("tempunit"),
+		WindSpeed: r.Form.Get("windunit"),
+		Pressure:  r.Form.Get("pressureunit"),
+		Precip:    r.Form.Get("precipunit"),
+		Distance:  r.Form.Get("distanceunit"),
+	}
 
 	if lon == "" {
 		http.Error(w, "The Longitude of the forecast location must be specified", 500)
@@ -82,18 +151,46 @@ func (c *ConfigController) handleSetConfig(w http.ResponseWriter, r *http.Reques
 		http.Error(w, "Invalid Latitude value", 500)
 		return
 	}
+	if tz != "" {
+		if _, err := time.LoadLocation(tz); err != nil {
+			http.Error(w, "Invalid Time Zone value", 500)
+			return
+		}
+	}
 	if prv == "" {
 		http.Error(w, "The Forecast Provider must be selected", 500)
 		return
 	}
-	p, err := strconv.Atoi(prv)
-	if err != nil || p < 0 || p > 1 {
+	if _, ok := GetProviderInfo(prv); !ok {
 		http.Error(w, "Invalid Forecast Provider value", 500)
 		return
 	}
-	if app == "" {
-		http.Error(w, "The Forecast Provider Application ID must be selected", 500)
-		return
+	fbs := []string{}
+	for _, f := range r.Form["fallback"] {
+		if f == "" || f == prv {
+			continue
+		}
+		if _, ok := GetProviderInfo(f); !ok {
+			http.Error(w, "Invalid Fallback Provider value", 500)
+			return
+		}
+		fbs = append(fbs, f)
+	}
+	apps := map[string]string{}
+	for _, pi := range GetProviders() {
+		if a := r.Form.Get("appid_" + pi.Name); a != "" {
+			apps[pi.Name] = a
+		}
+	}
+	if app != "" && apps[prv] == "" {
+		// Application ID posted for the selected provider only
+		apps[prv] = app
+	}
+	for _, n := range append([]string{prv}, fbs...) {
+		if pi, _ := GetProviderInfo(n); apps[n] == "" && !pi.AppIDOptional {
+			http.Error(w, "The "+pi.Description+" Application ID must be specified", 500)
+			return
+		}
 	}
 	if unt == "" {
 		http.Error(w, "The unit type must be selected", 500)
@@ -104,19 +201,57 @@ func (c *ConfigController) handleSetConfig(w http.ResponseWriter, r *http.Reques
 		http.Error(w, "Invalid Unit Type value", 500)
 		return
 	}
+	if err := uns.Validate(); err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if lng == "" {
+		lng = c.Srv.Config.GetLanguage()
+	}
+	l, ok := ParseLanguage(lng)
+	if !ok {
+		http.Error(w, "Unsupported language "+lng, 500)
+		return
+	}
+	for _, f := range afs {
+		if fu, err := url.Parse(f); err != nil || (fu.Scheme != "http" && fu.Scheme != "https") || fu.Host == "" {
+			http.Error(w, "Invalid Alert Feed address "+f, 500)
+			return
+		}
+	}
+
+	if mqt.Broker != "" {
+		if _, _, err := net.SplitHostPort(mqt.Broker); err != nil {
+			http.Error(w, "Invalid MQTT Broker address "+mqt.Broker+", expected host:port", 500)
+			return
+		}
+	}
 
 	c.LogInfo("Setting new configuration values.")
 
 	c.Srv.Config.LocationName = nam
-	if c.Srv.Config.Longitude != float32(a) || c.Srv.Config.Latitude != float32(b) {
+	moved := c.Srv.Config.Longitude != float32(a) || c.Srv.Config.Latitude != float32(b)
+	if moved {
 		c.Srv.Config.Longitude = float32(a)
 		c.Srv.Config.Latitude = float32(b)
-		// Reset the location ID
-		c.Srv.Config.LocationID = ""
+		// Reset the location IDs
+		c.Srv.Config.LocationIDs = nil
+	}
+	if tz != "" || moved {
+		// A blank time zone keeps the configured one, unless the location moved and it is looked up again
+		c.Srv.Config.TimeZone = tz
 	}
-	c.Srv.Config.Provider = p
-	c.Srv.Config.AppID = app
+	c.Srv.Config.Provider = prv
+	c.Srv.Config.Fallbacks = fbs
+	c.Srv.Config.AppID = ""
+	c.Srv.Config.AppIDs = apps
 	c.Srv.Config.UnitType = u
+	c.Srv.Config.Units = uns
+	c.Srv.Config.StationKey = stk
+	c.Srv.Config.OneCall = onc
+	c.Srv.Config.Language = l
+	c.Srv.Config.AlertFeeds = afs
+	c.Srv.Config.MQTT = mqt
 
 	c.Srv.Config.SetDefaults()
 
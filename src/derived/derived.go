@@ -0,0 +1,82 @@
+// Package derived computes weather metrics that are derived from the temperature, humidity and wind speed,
+// so that they are the same whichever weather provider reported the conditions.
+//
+// Temperatures are in degrees Celsius, humidity in % and wind speeds in m/s.
+package derived
+
+import "math"
+
+// Metrics holds the metrics derived from the weather conditions
+type Metrics struct {
+	DewPoint     float32 `json:"dewPoint"`     // Dew Point (Magnus formula)
+	HeatIndex    float32 `json:"heatIndex"`    // Heat Index (US National Weather Service)
+	WindChill    float32 `json:"windChill"`    // Wind Chill (Environment Canada / US National Weather Service)
+	Humidex      float32 `json:"humidex"`      // Humidex (Environment Canada)
+	ApparentTemp float32 `json:"apparentTemp"` // Apparent Temperature (Australian Bureau of Meteorology)
+}
+
+// Compute returns the metrics derived from the temperature, relative humidity and wind speed
+func Compute(temp float32, humidity float32, windSpeed float32) Metrics {
+	return Metrics{
+		DewPoint:     DewPoint(temp, humidity),
+		HeatIndex:    HeatIndex(temp, humidity),
+		WindChill:    WindChill(temp, windSpeed),
+		Humidex:      Humidex(temp, humidity),
+		ApparentTemp: ApparentTemp(temp, humidity, windSpeed),
+	}
+}
+
+// DewPoint returns the dew point using the Magnus formula with the Sonntag (1990) constants.
+// The dew point of perfectly dry air is undefined, so the humidity is taken to be at least 0.1%.
+func DewPoint(temp float32, humidity float32) float32 {
+	const a, b = 17.62, 243.12
+	t := float64(temp)
+	rh := math.Max(float64(humidity), 0.1)
+	g := math.Log(rh/100) + a*t/(b+t)
+	return float32(b * g / (a - g))
+}
+
+// HeatIndex returns the heat index using the US National Weather Service algorithm:
+// Steadman's simple formula, or the Rothfusz regression with its adjustments above 80°F.
+func HeatIndex(temp float32, humidity float32) float32 {
+	t := float64(temp)*9/5 + 32
+	rh := float64(humidity)
+	hi := 0.5 * (t + 61 + (t-68)*1.2 + rh*0.094)
+	if (hi+t)/2 >= 80 {
+		hi = -42.379 + 2.04901523*t + 10.14333127*rh - 0.22475541*t*rh - 0.00683783*t*t -
+			0.05481717*rh*rh + 0.00122874*t*t*rh + 0.00085282*t*rh*rh - 0.00000199*t*t*rh*rh
+		if rh < 13 && t >= 80 && t <= 112 {
+			hi -= (13 - rh) / 4 * math.Sqrt((17-math.Abs(t-95))/17)
+		} else if rh > 85 && t >= 80 && t <= 87 {
+			hi += (rh - 85) / 10 * (87 - t) / 5
+		}
+	}
+	return float32((hi - 32) * 5 / 9)
+}
+
+// WindChill returns the wind chill index used by Environment Canada and the US National Weather Service.
+// It is only defined at or below 10°C with wind above 4.8 km/h, otherwise the temperature is returned.
+func WindChill(temp float32, windSpeed float32) float32 {
+	t := float64(temp)
+	v := float64(windSpeed) * 3.6
+	if t > 10 || v <= 4.8 {
+		return temp
+	}
+	p := math.Pow(v, 0.16)
+	return float32(13.12 + 0.6215*t - 11.37*p + 0.3965*t*p)
+}
+
+// Humidex returns the Environment Canada humidex, using the dew point of the temperature and humidity
+func Humidex(temp float32, humidity float32) float32 {
+	td := float64(DewPoint(temp, humidity))
+	e := 6.11 * math.Exp(5417.7530*(1/273.16-1/(273.15+td)))
+	return float32(float64(temp) + 0.5555*(e-10))
+}
+
+// ApparentTemp returns the apparent temperature used by the Australian Bureau of Meteorology,
+// which is Steadman's formula without the effect of the sun
+func ApparentTemp(temp float32, humidity float32, windSpeed float32) float32 {
+	t := float64(temp)
+	e := float64(humidity) / 100 * 6.105 * math.Exp(17.27*t/(237.7+t))
+	return float32(t + 0.33*e - 0.70*float64(windSpeed) - 4.00)
+}
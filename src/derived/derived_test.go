@@ -0,0 +1,124 @@
+package derived
+
+import (
+	"math"
+	"testing"
+)
+
+// fahrenheit converts the temperatures of the US reference tables to Celsius
+func fahrenheit(f float32) float32 {
+	return (f - 32) * 5 / 9
+}
+
+// humidityForDewPoint returns the relative humidity of the temperature with the dew point,
+// for the reference tables that are given by dew point
+func humidityForDewPoint(temp float32, dewPoint float32) float32 {
+	const a, b = 17.62, 243.12
+	t, d := float64(temp), float64(dewPoint)
+	return float32(100 * math.Exp(a*d/(b+d)-a*t/(b+t)))
+}
+
+func checkClose(t *testing.T, n string, v float32, e float32, tol float32) {
+	t.Helper()
+	if d := v - e; d > tol || d < -tol {
+		t.Error(n, "is", v, "expected", e)
+	}
+}
+
+func TestDewPoint(t *testing.T) {
+	// Psychrometric dew point tables over water, to a tenth of a degree
+	tests := []struct {
+		temp, humidity, expected float32
+	}{
+		{30, 50, 18.4},
+		{25, 80, 21.3},
+		{25, 60, 16.7},
+		{20, 60, 12.0},
+		{20, 100, 20},
+		{15, 40, 1.5},
+		{10, 90, 8.4},
+	}
+	for _, e := range tests {
+		checkClose(t, "DewPoint", DewPoint(e.temp, e.humidity), e.expected, 0.2)
+	}
+}
+
+func TestHeatIndex(t *testing.T) {
+	// US National Weather Service heat index chart, in °F
+	tests := []struct {
+		temp, humidity, expected float32
+	}{
+		{80, 40, 80},
+		{90, 70, 106},
+		{96, 65, 121},
+		{100, 40, 109},
+		{86, 90, 105},
+		{84, 55, 86},
+		{88, 60, 95},
+	}
+	for _, e := range tests {
+		checkClose(t, "HeatIndex", HeatIndex(fahrenheit(e.temp), e.humidity), fahrenheit(e.expected), 0.6)
+	}
+}
+
+func TestWindChill(t *testing.T) {
+	// Environment Canada wind chill chart, with the wind in km/h
+	tests := []struct {
+		temp, wind, expected float32
+	}{
+		{-20, 30, -33},
+		{-10, 20, -18},
+		{-30, 50, -49},
+		{0, 10, -3},
+		{5, 40, -1},
+		// Not defined above 10°C or in calm air
+		{15, 30, 15},
+		{-5, 3, -5},
+	}
+	for _, e := range tests {
+		checkClose(t, "WindChill", WindChill(e.temp, e.wind/3.6), e.expected, 0.5)
+	}
+}
+
+func TestHumidex(t *testing.T) {
+	// Environment Canada humidex table, given by temperature and dew point
+	tests := []struct {
+		temp, dewPoint, expected float32
+	}{
+		{30, 15, 34},
+		{35, 25, 47},
+		{25, 20, 33},
+	}
+	for _, e := range tests {
+		rh := humidityForDewPoint(e.temp, e.dewPoint)
+		checkClose(t, "Humidex", Humidex(e.temp, rh), e.expected, 0.6)
+	}
+}
+
+func TestApparentTemp(t *testing.T) {
+	// Australian Bureau of Meteorology apparent temperature, AT = T + 0.33e - 0.70ws - 4.00,
+	// with the vapour pressure e taken from the WMO saturation vapour pressure table in hPa
+	tests := []struct {
+		temp, humidity, wind, saturation float32
+	}{
+		{30, 50, 2, 42.43},
+		{20, 70, 5, 23.37},
+		{10, 80, 10, 12.27},
+		{35, 40, 0, 56.22},
+	}
+	for _, e := range tests {
+		expected := e.temp + 0.33*e.humidity/100*e.saturation - 0.70*e.wind - 4
+		checkClose(t, "ApparentTemp", ApparentTemp(e.temp, e.humidity, e.wind), expected, 0.1)
+	}
+}
+
+func TestCompute(t *testing.T) {
+	m := Compute(-10, 80, 20/3.6)
+	if m.WindChill != WindChill(-10, 20/3.6) || m.DewPoint != DewPoint(-10, 80) || m.ApparentTemp != ApparentTemp(-10, 80, 20/3.6) {
+		t.Error("Unexpected metrics", m)
+	}
+	// Dry air still has a dew point
+	if d := DewPoint(20, 0); d > -50 || d != d {
+		t.Error("Unexpected dew point of dry air", d)
+	}
+}
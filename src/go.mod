@@ -3,12 +3,15 @@ module github.com/brumawen/weather
 go 1.20
 
 require (
-	github.com/IvanMenshykov/MoonPhase v0.0.0-20210411203237-6c61017953a8 // indirect
-	github.com/brumawen/gopi-finder v0.0.0-20230310115501-8bc5a4bde6cb // indirect
+	github.com/IvanMenshykov/MoonPhase v0.0.0-20210411203237-6c61017953a8
 	github.com/brumawen/gopi-finder/src v0.0.0-20230310120639-ddc0e2f898b7
-	github.com/gorilla/mux v1.8.0 // indirect
-	github.com/kardianos/service v1.2.2 // indirect
-	github.com/kelvins/sunrisesunset v0.0.0-20210220141756-39fa1bd816d5 // indirect
+	github.com/gorilla/mux v1.8.0
+	github.com/kardianos/service v1.2.2
+	github.com/kelvins/sunrisesunset v0.0.0-20210220141756-39fa1bd816d5
+)
+
+require (
+	github.com/brumawen/gopi-finder v0.0.0-20230310115501-8bc5a4bde6cb // indirect
 	github.com/satori/go.uuid v1.2.0 // indirect
 	golang.org/x/sys v0.0.0-20201015000850-e3ed0017c211 // indirect
 )
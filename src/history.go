@@ -0,0 +1,418 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Observation is a weather observation kept in the history.
+// The values are kept in SI units, keyed by the name of the field of the weather.
+type Observation struct {
+	Time     time.Time          `json:"time"`               // Date and time the observation was taken, or the start of the interval
+	Provider string             `json:"provider,omitempty"` // Provider of the observation
+	Count    int                `json:"count,omitempty"`    // Number of observations averaged, if downsampled
+	Values   map[string]float64 `json:"values"`             // Values of the observation
+}
+
+// History holds the observations of a location over a range of time
+type History struct {
+	Name         string        `json:"locationName"`       // Location Name
+	From         time.Time     `json:"from"`               // Start of the range
+	To           time.Time     `json:"to"`                 // End of the range
+	Interval     string        `json:"interval,omitempty"` // Interval the observations were averaged over, if downsampled
+	Units        Units         `json:"units"`              // Units of measure of the values
+	Observations []Observation `json:"observations"`       // Observations, the oldest first
+}
+
+// historyField is a field of the weather that is kept in the history
+type historyField struct {
+	Name     string // Name of the field in the weather
+	Quantity string // Quantity of the field, used to convert its units
+	OmitZero bool   // The field is not kept if it is zero, since most providers that do not report it leave it at zero
+}
+
+// HistoryFields are the fields of the weather kept in the history
+var HistoryFields = []historyField{
+	{"temp", "temp", false},
+	{"feelsLike", "temp", true},
+	{"dewPoint", "temp", true},
+	{"humidity", "", true},
+	{"pressure", "pressure", true},
+	{"windSpeed", "speed", false},
+	{"windGust", "speed", true},
+	{"windDirection", "direction", false},
+	{"visibility", "distance", true},
+	{"cloudCover", "", true},
+	{"uvIndex", "", true},
+	{"precip", "precip", true},
+	{"precipRate", "precip", true},
+	{"weatherIcon", "", true},
+}
+
+// HistoryStore appends the weather observations to a file for each location and day, so that a
+// range of time can be read without reading the whole history. Each line of a file is an observation.
+type HistoryStore struct {
+	Dir       string // Directory the history is kept in
+	last      map[string]time.Time
+	lock      sync.Mutex
+	statsLock sync.Mutex
+}
+
+// NewHistoryStore creates a store that keeps the history in the directory
+func NewHistoryStore(dir string) *HistoryStore {
+	return &HistoryStore{Dir: dir, last: map[string]time.Time{}}
+}
+
+// getLocationKey returns the key the history of the location of the configuration is kept under.
+// The coordinates are used, so that renaming the location does not lose its history.
+func getLocationKey(cfg *Config) string {
+	return fmt.Sprintf("%.4f_%.4f", cfg.Latitude, cfg.Longitude)
+}
+
+// NewObservation returns the observation of the weather, with its values in SI units
+func NewObservation(w Weather) Observation {
+	if w.Units.IsSet() {
+		w = SIUnits.ConvertWeather(w)
+	}
+	t := w.ReadingTime
+	if t.IsZero() {
+		t = w.Created
+	}
+	all := map[string]float32{
+		"temp":          w.Temp,
+		"feelsLike":     w.FeelsLike,
+		"dewPoint":      w.DewPoint,
+		"humidity":      w.Humidity,
+		"pressure":      w.Pressure,
+		"windSpeed":     w.WindSpeed,
+		"windGust":      w.WindGust,
+		"windDirection": w.WindDirection,
+		"visibility":    w.Visibility,
+		"cloudCover":    w.CloudCover,
+		"uvIndex":       w.UVIndex,
+		"precip":        w.Precip,
+		"precipRate":    w.PrecipRate,
+		"weatherIcon":   float32(w.WeatherIcon),
+	}
+	o := Observation{Time: t.UTC(), Provider: w.Provider, Values: map[string]float64{}}
+	// A provider that reports the precipitation reports a dry spell as zero
+	rp := reportedPrecip(w)
+	for _, f := range HistoryFields {
+		if v := all[f.Name]; v != 0 || !f.OmitZero || rp[f.Name] {
+			o.Values[f.Name] = float64(v)
+		}
+	}
+	return o
+}
+
+// reportedPrecip returns the fields the precipitation of the weather is reported in by its
+// provider, or the providers blended into it
+func reportedPrecip(w Weather) map[string]bool {
+	ns := w.Sources
+	if len(ns) == 0 {
+		ns = []string{w.Provider}
+	}
+	r := map[string]bool{}
+	for _, n := range ns {
+		if f := providers[n].Precip; f != "" {
+			r[f] = true
+		}
+	}
+	return r
+}
+
+// getPath returns the file the observations of the location on the day are kept in
+func (s *HistoryStore) getPath(key string, t time.Time) string {
+	return filepath.Join(s.Dir, key, t.UTC().Format("2006-01-02")+".jsonl")
+}
+
+// Append adds the weather to the history of the location of the configuration.
+// Weather that is not newer than the last observation appended is ignored.
+func (s *HistoryStore) Append(cfg *Config, w Weather) error {
+	o := NewObservation(w)
+	if o.Time.IsZero() {
+		return errors.New("The weather has no time")
+	}
+	key := getLocationKey(cfg)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !o.Time.After(s.last[key]) {
+		return nil
+	}
+	b, err := json.Marshal(o)
+	if err != nil {
+		return err
+	}
+	path := s.getPath(key, o.Time)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	s.last[key] = o.Time
+	return nil
+}
+
+// Query returns the observations of the location of the configuration taken from the start
+// of the range up to, but not including, its end. The oldest observation is returned first.
+func (s *HistoryStore) Query(cfg *Config, from time.Time, to time.Time) ([]Observation, error) {
+	key := getLocationKey(cfg)
+	obs := []Observation{}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for d := from.UTC().Truncate(24 * time.Hour); d.Before(to); d = d.Add(24 * time.Hour) {
+		ds, err := s.readFile(s.getPath(key, d))
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range ds {
+			if !o.Time.Before(from) && o.Time.Before(to) {
+				obs = append(obs, o)
+			}
+		}
+	}
+	sort.SliceStable(obs, func(i, j int) bool { return obs[i].Time.Before(obs[j].Time) })
+
+	// Remove observations appended again after a restart
+	r := []Observation{}
+	for _, o := range obs {
+		if len(r) == 0 || !o.Time.Equal(r[len(r)-1].Time) {
+			r = append(r, o)
+		}
+	}
+	return r, nil
+}
+
+// readFile reads the observations in the file
+func (s *HistoryStore) readFile(path string) ([]Observation, error) {
+	obs := []Observation{}
+	err := readLines(path, func(b []byte) {
+		o := Observation{}
+		if err := json.Unmarshal(b, &o); err == nil {
+			obs = append(obs, o)
+		}
+	})
+	return obs, err
+}
+
+// readLines passes each line of the file to read. A missing file has no lines, and a line
+// that cannot be read, such as one cut short by a power failure, is skipped by read.
+func readLines(path string, read func([]byte)) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		read(sc.Bytes())
+	}
+	return sc.Err()
+}
+
+// ParseInterval parses the interval observations are averaged over: hour, day or a duration such as 15m
+func ParseInterval(s string) (time.Duration, error) {
+	switch strings.ToLower(s) {
+	case "", "raw":
+		return 0, nil
+	case "hour", "hourly":
+		return time.Hour, nil
+	case "day", "daily":
+		return 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < time.Minute {
+		return 0, errors.New("Invalid interval " + s)
+	}
+	return d, nil
+}
+
+// Downsample averages the observations over each interval. Days start at midnight in the
+// location, the wind direction is averaged as a direction so that 350° and 10° average to 0°,
+// and the weather icon is the one observed most often.
+func Downsample(obs []Observation, d time.Duration, loc *time.Location) []Observation {
+	if d <= 0 {
+		return obs
+	}
+	type bucket struct {
+		Observation
+		sums   map[string]float64
+		counts map[string]int
+		icons  map[int]int
+	}
+	bs := []*bucket{}
+	for _, o := range obs {
+		var t time.Time
+		if d == 24*time.Hour {
+			l := o.Time.In(loc)
+			t = time.Date(l.Year(), l.Month(), l.Day(), 0, 0, 0, 0, loc)
+		} else {
+			t = o.Time.Truncate(d)
+		}
+		if len(bs) == 0 || !bs[len(bs)-1].Time.Equal(t) {
+			bs = append(bs, &bucket{Observation: Observation{Time: t}, sums: map[string]float64{}, counts: map[string]int{}, icons: map[int]int{}})
+		}
+		b := bs[len(bs)-1]
+		b.Count++
+		for k, v := range o.Values {
+			if k == "windDirection" {
+				// Sum the direction as a vector, weighted by the wind speed so that calm readings count for little
+				w := o.Values["windSpeed"]
+				if w == 0 {
+					w = 0.001
+				}
+				r := v * math.Pi / 180
+				b.sums["windDirectionX"] += w * math.Sin(r)
+				b.sums["windDirectionY"] += w * math.Cos(r)
+			}
+			if k == "weatherIcon" {
+				b.icons[int(v)]++
+			}
+			b.sums[k] += v
+			b.counts[k]++
+		}
+	}
+
+	r := []Observation{}
+	for _, b := range bs {
+		o := Observation{Time: b.Time, Count: b.Count, Values: map[string]float64{}}
+		for k, n := range b.counts {
+			o.Values[k] = b.sums[k] / float64(n)
+		}
+		if _, ok := b.counts["windDirection"]; ok {
+			a := math.Atan2(b.sums["windDirectionX"], b.sums["windDirectionY"]) * 180 / math.Pi
+			o.Values["windDirection"] = math.Mod(a+360, 360)
+		}
+		if len(b.icons) != 0 {
+			o.Values["weatherIcon"] = float64(getMostFrequentIcon(b.icons))
+		}
+		r = append(r, o)
+	}
+	return r
+}
+
+// getMostFrequentIcon returns the icon counted most often, the more severe weather winning a tie
+func getMostFrequentIcon(n map[int]int) int {
+	r := 0
+	for i, c := range n {
+		if c > n[r] || (c == n[r] && iconSeverity[i] > iconSeverity[r]) {
+			r = i
+		}
+	}
+	return r
+}
+
+// ConvertObservations returns the observations with their values converted from SI to the units,
+// keeping only the fields named, or all the fields if none are named.
+func ConvertObservations(obs []Observation, u Units, fields []string) []Observation {
+	keep := map[string]bool{}
+	for _, f := range fields {
+		keep[f] = true
+	}
+	r := make([]Observation, len(obs))
+	for i, o := range obs {
+		vs := map[string]float64{}
+		for _, f := range HistoryFields {
+			v, ok := o.Values[f.Name]
+			if !ok || (len(keep) != 0 && !keep[f.Name]) {
+				continue
+			}
+			switch f.Quantity {
+			case "temp":
+				v = float64(convertTemp(float32(v), SIUnits.Temp, u.Temp))
+			case "speed":
+				v = float64(convertSpeed(float32(v), SIUnits.WindSpeed, u.WindSpeed))
+			case "pressure":
+				v = float64(convertUnit(float32(v), pressureUnits, SIUnits.Pressure, u.Pressure))
+			case "distance":
+				v = float64(convertUnit(float32(v), distanceUnits, SIUnits.Distance, u.Distance))
+			case "precip":
+				v = float64(convertUnit(float32(v), precipUnits, SIUnits.Precip, u.Precip))
+			}
+			vs[f.Name] = math.Round(v*100) / 100
+		}
+		o.Values = vs
+		r[i] = o
+	}
+	return r
+}
+
+// ParseHistoryFields parses a comma separated list of the fields kept in the history
+func ParseHistoryFields(s string) ([]string, error) {
+	fs := []string{}
+	for _, n := range strings.Split(s, ",") {
+		n = strings.TrimSpace(n)
+		if n == "" {
+			continue
+		}
+		ok := false
+		for _, f := range HistoryFields {
+			if strings.EqualFold(f.Name, n) {
+				fs = append(fs, f.Name)
+				ok = true
+			}
+		}
+		if !ok {
+			return nil, errors.New("Unknown history field " + n)
+		}
+	}
+	return fs, nil
+}
+
+// parseHistoryTime parses a date and time in RFC 3339 format, or a date or date and time in the location
+func parseHistoryTime(s string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, f := range []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(f, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New("Invalid date and time " + s)
+}
+
+// In returns the history with its times in the location
+func (h History) In(loc *time.Location) History {
+	h.From = h.From.In(loc)
+	h.To = h.To.In(loc)
+	obs := make([]Observation, len(h.Observations))
+	for i, o := range h.Observations {
+		o.Time = o.Time.In(loc)
+		obs[i] = o
+	}
+	h.Observations = obs
+	return h
+}
+
+// WriteTo serializes the entity and writes it to the http response
+func (h *History) WriteTo(w http.ResponseWriter) error {
+	b, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("content-type", "application/json")
+	w.Write(b)
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestHistoryCanBeQueriedAcrossDays(t *testing.T) {
+	s := NewHistoryStore(t.TempDir())
+	cfg := &Config{Latitude: -33.92, Longitude: 18.42}
+	start := time.Date(2024, 6, 1, 22, 0, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		w := Weather{Provider: "OpenMeteo", Created: start.Add(time.Duration(i) * time.Hour), Temp: float32(10 + i), Units: SIUnits}
+		if err := s.Append(cfg, w); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Weather that is not newer is not appended again, and other locations are kept apart
+	s.Append(cfg, Weather{Created: start, Temp: 30, Units: SIUnits})
+	s.Append(&Config{Latitude: 50.45, Longitude: 30.52}, Weather{Created: start, Temp: 5, Units: SIUnits})
+
+	obs, err := s.Query(cfg, start.Add(time.Hour), start.Add(3*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(obs) != 2 || obs[0].Values["temp"] != 11 || obs[1].Values["temp"] != 12 || !obs[1].Time.Equal(start.Add(2*time.Hour)) {
+		t.Error("Expected the observations of the range, across midnight", obs)
+	}
+	if obs, _ = s.Query(cfg, start.Add(-time.Hour), start.Add(5*time.Hour)); len(obs) != 4 || obs[0].Values["temp"] != 10 {
+		t.Error("Expected all the observations once", obs)
+	}
+}
+
+func TestObservationsOmitUnreportedFields(t *testing.T) {
+	o := NewObservation(Weather{Created: time.Now(), Temp: 0, WindSpeed: 18, Units: MetricUnits})
+	for _, f := range []string{"pressure", "cloudCover", "uvIndex", "precip"} {
+		if _, ok := o.Values[f]; ok {
+			t.Error("Expected the unreported", f, "to be omitted")
+		}
+	}
+	if v, ok := o.Values["temp"]; !ok || v != 0 || o.Values["windSpeed"] != 5 {
+		t.Error("Expected the values in SI units", o.Values)
+	}
+}
+
+func TestHistoryIsDownsampled(t *testing.T) {
+	start := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+	obs := []Observation{
+		{Time: start, Values: map[string]float64{"temp": 10, "windSpeed": 4, "windDirection": 350, "weatherIcon": 1}},
+		{Time: start.Add(30 * time.Minute), Values: map[string]float64{"temp": 12, "windSpeed": 4, "windDirection": 10, "weatherIcon": 5}},
+		{Time: start.Add(time.Hour), Values: map[string]float64{"temp": 15}},
+	}
+	hs := Downsample(obs, time.Hour, time.UTC)
+	if len(hs) != 2 || hs[0].Count != 2 || hs[0].Values["temp"] != 11 || hs[1].Values["temp"] != 15 {
+		t.Fatal("Expected hourly averages", hs)
+	}
+	if d := hs[0].Values["windDirection"]; d > 0.001 && d < 359.999 {
+		t.Error("Expected the wind direction to average to north, got", d)
+	}
+	if i := hs[0].Values["weatherIcon"]; i != 5 {
+		t.Error("Expected the more severe of the icons, got", i)
+	}
+
+	// Days start at midnight in the location
+	sast, _ := time.LoadLocation("Africa/Johannesburg")
+	ds := Downsample(obs, 24*time.Hour, sast)
+	if len(ds) != 1 || !ds[0].Time.Equal(time.Date(2024, 6, 1, 0, 0, 0, 0, sast)) {
+		t.Error("Expected a single day", ds)
+	}
+}
+
+func TestGetHistory(t *testing.T) {
+	chdirTemp(t)
+	cfg := &Config{LocationName: "Cape Town", Latitude: -33.92, Longitude: 18.42, TimeZone: "Africa/Johannesburg"}
+	s := &Server{Config: cfg, History: NewHistoryStore("history")}
+	start := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 6; i++ {
+		s.History.Append(cfg, Weather{Created: start.Add(time.Duration(i) * 20 * time.Minute), Temp: float32(i), Humidity: 50, Units: SIUnits})
+	}
+	router := mux.NewRouter()
+	c := WeatherController{}
+	c.AddController(router, s)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/weather/history?from=2024-06-01T12:00&to=2024-06-01T14:00&fields=temp&interval=hour&units=imperial", nil))
+	h := History{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &h); err != nil {
+		t.Fatal(err, rec.Body.String())
+	}
+	if len(h.Observations) != 2 || h.Units.Temp != "F" || h.Interval != "hour" {
+		t.Fatal("Unexpected history", rec.Body.String())
+	}
+	// The hour from 10:00 UTC averages 0, 1 and 2 degrees Celsius
+	if o := h.Observations[0]; o.Count != 3 || o.Values["temp"] != 33.8 || len(o.Values) != 1 {
+		t.Error("Unexpected first hour", o)
+	}
+	if _, off := h.Observations[1].Time.Zone(); off != 2*60*60 {
+		t.Error("Expected the times in the configured time zone")
+	}
+
+	for _, q := range []string{"from=yesterday", "fields=rain", "interval=fortnightly", "from=2024-06-02&to=2024-06-01"} {
+		rec = httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("GET", "/weather/history?"+q, nil))
+		if rec.Code != 400 {
+			t.Error("Expected the query to be rejected with 400", q, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,421 @@
+package main
+
+import (
+	"html/template"
+	"strings"
+	"time"
+)
+
+// LanguageInfo holds a language the weather can be reported in
+type LanguageInfo struct {
+	Code string // ISO 639-1 language code
+	Name string // Name of the language in the language itself
+}
+
+// Languages holds the languages the weather can be reported in
+var Languages = []LanguageInfo{
+	{Code: "en", Name: "English"},
+	{Code: "af", Name: "Afrikaans"},
+	{Code: "de", Name: "Deutsch"},
+}
+
+// messages holds the translations of the English text for each language
+var messages = map[string]map[string]string{
+	"af": {
+		// Days
+		"Monday":    "Maandag",
+		"Tuesday":   "Dinsdag",
+		"Wednesday": "Woensdag",
+		"Thursday":  "Donderdag",
+		"Friday":    "Vrydag",
+		"Saturday":  "Saterdag",
+		"Sunday":    "Sondag",
+
+		// Moon phases
+		"New":             "Nuwemaan",
+		"New Moon":        "Nuwemaan",
+		"Waxing Crescent": "Groeiende Sekel",
+		"First Quarter":   "Eerste Kwartier",
+		"Waxing Gibbous":  "Groeiende Maan",
+		"Full":            "Volmaan",
+		"Full Moon":       "Volmaan",
+		"Waning Gibbous":  "Afnemende Maan",
+		"Third Quarter":   "Laaste Kwartier",
+		"Waning Crescent": "Afnemende Sekel",
+
+		// Weather
+		"Clear Sky":                       "Helder",
+		"Mainly Clear":                    "Meestal Helder",
+		"Fair":                            "Mooi Weer",
+		"Partly Cloudy":                   "Gedeeltelik Bewolk",
+		"Cloudy":                          "Bewolk",
+		"Overcast":                        "Oortrek",
+		"Fog":                             "Mis",
+		"Depositing Rime Fog":             "Ysmis",
+		"Light Drizzle":                   "Ligte Motreën",
+		"Moderate Drizzle":                "Matige Motreën",
+		"Dense Drizzle":                   "Digte Motreën",
+		"Light Freezing Drizzle":          "Ligte Vriesende Motreën",
+		"Dense Freezing Drizzle":          "Digte Vriesende Motreën",
+		"Slight Rain":                     "Ligte Reën",
+		"Light Rain":                      "Ligte Reën",
+		"Moderate Rain":                   "Matige Reën",
+		"Rain":                            "Reën",
+		"Heavy Rain":                      "Swaar Reën",
+		"Light Freezing Rain":             "Ligte Vriesende Reën",
+		"Heavy Freezing Rain":             "Swaar Vriesende Reën",
+		"Slight Snow Fall":                "Ligte Sneeu",
+		"Moderate Snow Fall":              "Matige Sneeu",
+		"Heavy Snow Fall":                 "Swaar Sneeu",
+		"Snow Grains":                     "Sneeukorrels",
+		"Slight Rain Showers":             "Ligte Reënbuie",
+		"Light Rain Showers":              "Ligte Reënbuie",
+		"Moderate Rain Showers":           "Matige Reënbuie",
+		"Rain Showers":                    "Reënbuie",
+		"Heavy Rain Showers":              "Swaar Reënbuie",
+		"Violent Rain Showers":            "Hewige Reënbuie",
+		"Slight Snow Showers":             "Ligte Sneeubuie",
+		"Light Snow Showers":              "Ligte Sneeubuie",
+		"Snow Showers":                    "Sneeubuie",
+		"Heavy Snow Showers":              "Swaar Sneeubuie",
+		"Light Sleet Showers":             "Ligte Ysreënbuie",
+		"Sleet Showers":                   "Ysreënbuie",
+		"Heavy Sleet Showers":             "Swaar Ysreënbuie",
+		"Light Sleet":                     "Ligte Ysreën",
+		"Sleet":                           "Ysreën",
+		"Heavy Sleet":                     "Swaar Ysreën",
+		"Light Snow":                      "Ligte Sneeu",
+		"Snow":                            "Sneeu",
+		"Heavy Snow":                      "Swaar Sneeu",
+		"Thunderstorm":                    "Donderstorm",
+		"Thunderstorm With Slight Hail":   "Donderstorm Met Ligte Hael",
+		"Thunderstorm With Heavy Hail":    "Donderstorm Met Swaar Hael",
+		"Light Rain Showers And Thunder":  "Ligte Reënbuie En Donderweer",
+		"Rain Showers And Thunder":        "Reënbuie En Donderweer",
+		"Heavy Rain Showers And Thunder":  "Swaar Reënbuie En Donderweer",
+		"Light Sleet Showers And Thunder": "Ligte Ysreënbuie En Donderweer",
+		"Sleet Showers And Thunder":       "Ysreënbuie En Donderweer",
+		"Heavy Sleet Showers And Thunder": "Swaar Ysreënbuie En Donderweer",
+		"Light Snow Showers And Thunder":  "Ligte Sneeubuie En Donderweer",
+		"Snow Showers And Thunder":        "Sneeubuie En Donderweer",
+		"Heavy Snow Showers And Thunder":  "Swaar Sneeubuie En Donderweer",
+		"Light Rain And Thunder":          "Ligte Reën En Donderweer",
+		"Rain And Thunder":                "Reën En Donderweer",
+		"Heavy Rain And Thunder":          "Swaar Reën En Donderweer",
+		"Light Sleet And Thunder":         "Ligte Ysreën En Donderweer",
+		"Sleet And Thunder":               "Ysreën En Donderweer",
+		"Heavy Sleet And Thunder":         "Swaar Ysreën En Donderweer",
+		"Light Snow And Thunder":          "Ligte Sneeu En Donderweer",
+		"Snow And Thunder":                "Sneeu En Donderweer",
+		"Heavy Snow And Thunder":          "Swaar Sneeu En Donderweer",
+
+		// Pages
+		"Current Weather":                  "Huidige Weer",
+		"Difference between the providers": "Verskil tussen die verskaffers",
+		"Feels like":                       "Voel soos",
+		"Dew point":                        "Doupunt",
+		"Cloud cover":                      "Wolkbedekking",
+		"UV index":                         "UV-indeks",
+		"Gusts":                            "Rukwinde",
+		"rising":                           "stygend",
+		"steady":                           "bestendig",
+		"falling":                          "dalend",
+		"Configure Weather Service":        "Stel Weerdiens Op",
+		"Location":                         "Ligging",
+		"Location Name":                    "Naam van Ligging",
+		"Latitude":                         "Breedtegraad",
+		"Longitude":                        "Lengtegraad",
+		"Time Zone":                        "Tydsone",
+		"Provider":                         "Verskaffer",
+		"Weather Provider":                 "Weerverskaffer",
+		"Fallback Providers":               "Rugsteunverskaffers",
+		"None":                             "Geen",
+		"Application ID":                   "Toepassing-ID",
+		"Use the Open Weather One Call API (needs a One Call subscription)": "Gebruik die Open Weather One Call API (benodig 'n One Call-intekening)",
+		"Language":                "Taal",
+		"Unit of Measure":         "Maateenheid",
+		"Unit of Measure default": "Verstek van die maateenheid",
+		"Metric":                  "Metriek",
+		"Imperial":                "Imperiaal",
+		"Temperature":             "Temperatuur",
+		"Celsius":                 "Celsius",
+		"Fahrenheit":              "Fahrenheit",
+		"Wind Speed":              "Windspoed",
+		"Kilometres per hour":     "Kilometer per uur",
+		"Metres per second":       "Meter per sekonde",
+		"Miles per hour":          "Myl per uur",
+		"Knots":                   "Knope",
+		"Beaufort":                "Beaufort",
+		"Pressure":                "Druk",
+		"Hectopascals":            "Hektopascal",
+		"Inches of mercury":       "Duim kwik",
+		"Millimetres of mercury":  "Millimeter kwik",
+		"Precipitation":           "Neerslag",
+		"Millimetres":             "Millimeter",
+		"Inches":                  "Duim",
+		"Visibility":              "Sigbaarheid",
+		"Kilometres":              "Kilometer",
+		"Miles":                   "Myl",
+		"Weather Station":         "Weerstasie",
+		"Station Password":        "Stasiewagwoord",
+		"Save Changes":            "Stoor Veranderinge",
+		"Update was successful.":  "Die opdatering was suksesvol.",
+		"Password or PASSKEY the station uploads with": "Wagwoord of PASSKEY waarmee die stasie oplaai",
+
+		// Alerts
+		"Alerts":      "Waarskuwings",
+		"Alert Feeds": "Waarskuwingsvoere",
+		"until":       "tot",
+		"CAP or Atom feed addresses, one per line": "CAP- of Atom-voeradresse, een per reël",
+
+		// Rules
+		"Humidity":                "Humiditeit",
+		"Chance of precipitation": "Kans op neerslag",
+		"Rules":                   "Reëls",
+		"Rule Name":               "Naam van Reël",
+		"Frost warning":           "Rypwaarskuwing",
+		"Condition":               "Voorwaarde",
+		"Value":                   "Waarde",
+		"Hours ahead":             "Ure vooruit",
+		"Hysteresis":              "Histerese",
+		"Add Rule":                "Voeg Reël By",
+		"Fired":                   "Geaktiveer",
+		"Delete":                  "Verwyder",
+		"hours":                   "ure",
+
+		// MQTT
+		"Broker":       "Makelaar",
+		"User Name":    "Gebruikersnaam",
+		"Password":     "Wagwoord",
+		"Use TLS":      "Gebruik TLS",
+		"Topic Prefix": "Onderwerpvoorvoegsel",
+		"host:port, leave empty to turn MQTT off":   "gasheer:poort, laat leeg om MQTT af te skakel",
+		"Publish Home Assistant discovery messages": "Publiseer Home Assistant-ontdekkingsboodskappe",
+		"Leave empty to keep the password":          "Laat leeg om die wagwoord te behou",
+
+		// Records
+		"Records":             "Rekords",
+		"since":               "sedert",
+		"Highest temperature": "Hoogste temperatuur",
+		"Lowest temperature":  "Laagste temperatuur",
+		"Wettest day":         "Natste dag",
+		"Strongest gust":      "Sterkste rukwind",
+	},
+	"de": {
+		// Days
+		"Monday":    "Montag",
+		"Tuesday":   "Dienstag",
+		"Wednesday": "Mittwoch",
+		"Thursday":  "Donnerstag",
+		"Friday":    "Freitag",
+		"Saturday":  "Samstag",
+		"Sunday":    "Sonntag",
+
+		// Moon phases
+		"New":             "Neumond",
+		"New Moon":        "Neumond",
+		"Waxing Crescent": "Zunehmende Sichel",
+		"First Quarter":   "Erstes Viertel",
+		"Waxing Gibbous":  "Zunehmender Mond",
+		"Full":            "Vollmond",
+		"Full Moon":       "Vollmond",
+		"Waning Gibbous":  "Abnehmender Mond",
+		"Third Quarter":   "Letztes Viertel",
+		"Waning Crescent": "Abnehmende Sichel",
+
+		// Weather
+		"Clear Sky":                       "Klarer Himmel",
+		"Mainly Clear":                    "Überwiegend Klar",
+		"Fair":                            "Heiter",
+		"Partly Cloudy":                   "Teilweise Bewölkt",
+		"Cloudy":                          "Bewölkt",
+		"Overcast":                        "Bedeckt",
+		"Fog":                             "Nebel",
+		"Depositing Rime Fog":             "Gefrierender Nebel",
+		"Light Drizzle":                   "Leichter Nieselregen",
+		"Moderate Drizzle":                "Mäßiger Nieselregen",
+		"Dense Drizzle":                   "Starker Nieselregen",
+		"Light Freezing Drizzle":          "Leichter Gefrierender Nieselregen",
+		"Dense Freezing Drizzle":          "Starker Gefrierender Nieselregen",
+		"Slight Rain":                     "Leichter Regen",
+		"Light Rain":                      "Leichter Regen",
+		"Moderate Rain":                   "Mäßiger Regen",
+		"Rain":                            "Regen",
+		"Heavy Rain":                      "Starker Regen",
+		"Light Freezing Rain":             "Leichter Gefrierender Regen",
+		"Heavy Freezing Rain":             "Starker Gefrierender Regen",
+		"Slight Snow Fall":                "Leichter Schneefall",
+		"Moderate Snow Fall":              "Mäßiger Schneefall",
+		"Heavy Snow Fall":                 "Starker Schneefall",
+		"Snow Grains":                     "Schneegriesel",
+		"Slight Rain Showers":             "Leichte Regenschauer",
+		"Light Rain Showers":              "Leichte Regenschauer",
+		"Moderate Rain Showers":           "Mäßige Regenschauer",
+		"Rain Showers":                    "Regenschauer",
+		"Heavy Rain Showers":              "Starke Regenschauer",
+		"Violent Rain Showers":            "Heftige Regenschauer",
+		"Slight Snow Showers":             "Leichte Schneeschauer",
+		"Light Snow Showers":              "Leichte Schneeschauer",
+		"Snow Showers":                    "Schneeschauer",
+		"Heavy Snow Showers":              "Starke Schneeschauer",
+		"Light Sleet Showers":             "Leichte Schneeregenschauer",
+		"Sleet Showers":                   "Schneeregenschauer",
+		"Heavy Sleet Showers":             "Starke Schneeregenschauer",
+		"Light Sleet":                     "Leichter Schneeregen",
+		"Sleet":                           "Schneeregen",
+		"Heavy Sleet":                     "Starker Schneeregen",
+		"Light Snow":                      "Leichter Schneefall",
+		"Snow":                            "Schneefall",
+		"Heavy Snow":                      "Starker Schneefall",
+		"Thunderstorm":                    "Gewitter",
+		"Thunderstorm With Slight Hail":   "Gewitter Mit Leichtem Hagel",
+		"Thunderstorm With Heavy Hail":    "Gewitter Mit Starkem Hagel",
+		"Light Rain Showers And Thunder":  "Leichte Regenschauer Und Gewitter",
+		"Rain Showers And Thunder":        "Regenschauer Und Gewitter",
+		"Heavy Rain Showers And Thunder":  "Starke Regenschauer Und Gewitter",
+		"Light Sleet Showers And Thunder": "Leichte Schneeregenschauer Und Gewitter",
+		"Sleet Showers And Thunder":       "Schneeregenschauer Und Gewitter",
+		"Heavy Sleet Showers And Thunder": "Starke Schneeregenschauer Und Gewitter",
+		"Light Snow Showers And Thunder":  "Leichte Schneeschauer Und Gewitter",
+		"Snow Showers And Thunder":        "Schneeschauer Und Gewitter",
+		"Heavy Snow Showers And Thunder":  "Starke Schneeschauer Und Gewitter",
+		"Light Rain And Thunder":          "Leichter Regen Und Gewitter",
+		"Rain And Thunder":                "Regen Und Gewitter",
+		"Heavy Rain And Thunder":          "Starker Regen Und Gewitter",
+		"Light Sleet And Thunder":         "Leichter Schneeregen Und Gewitter",
+		"Sleet And Thunder":               "Schneeregen Und Gewitter",
+		"Heavy Sleet And Thunder":         "Starker Schneeregen Und Gewitter",
+		"Light Snow And Thunder":          "Leichter Schneefall Und Gewitter",
+		"Snow And Thunder":                "Schneefall Und Gewitter",
+		"Heavy Snow And Thunder":          "Starker Schneefall Und Gewitter",
+
+		// Pages
+		"Current Weather":                  "Aktuelles Wetter",
+		"Difference between the providers": "Unterschied zwischen den Anbietern",
+		"Feels like":                       "Gefühlt",
+		"Dew point":                        "Taupunkt",
+		"Cloud cover":                      "Bewölkung",
+		"UV index":                         "UV-Index",
+		"Gusts":                            "Böen",
+		"rising":                           "steigend",
+		"steady":                           "gleichbleibend",
+		"falling":                          "fallend",
+		"Configure Weather Service":        "Wetterdienst Konfigurieren",
+		"Location":                         "Standort",
+		"Location Name":                    "Name des Standorts",
+		"Latitude":                         "Breitengrad",
+		"Longitude":                        "Längengrad",
+		"Time Zone":                        "Zeitzone",
+		"Provider":                         "Anbieter",
+		"Weather Provider":                 "Wetteranbieter",
+		"Fallback Providers":               "Ersatzanbieter",
+		"None":                             "Keiner",
+		"Application ID":                   "Anwendungs-ID",
+		"Use the Open Weather One Call API (needs a One Call subscription)": "Die Open Weather One Call API verwenden (erfordert ein One Call-Abonnement)",
+		"Language":                "Sprache",
+		"Unit of Measure":         "Maßeinheit",
+		"Unit of Measure default": "Standard der Maßeinheit",
+		"Metric":                  "Metrisch",
+		"Imperial":                "Imperial",
+		"Temperature":             "Temperatur",
+		"Celsius":                 "Celsius",
+		"Fahrenheit":              "Fahrenheit",
+		"Wind Speed":              "Windgeschwindigkeit",
+		"Kilometres per hour":     "Kilometer pro Stunde",
+		"Metres per second":       "Meter pro Sekunde",
+		"Miles per hour":          "Meilen pro Stunde",
+		"Knots":                   "Knoten",
+		"Beaufort":                "Beaufort",
+		"Pressure":                "Luftdruck",
+		"Hectopascals":            "Hektopascal",
+		"Inches of mercury":       "Zoll Quecksilbersäule",
+		"Millimetres of mercury":  "Millimeter Quecksilbersäule",
+		"Precipitation":           "Niederschlag",
+		"Millimetres":             "Millimeter",
+		"Inches":                  "Zoll",
+		"Visibility":              "Sichtweite",
+		"Kilometres":              "Kilometer",
+		"Miles":                   "Meilen",
+		"Weather Station":         "Wetterstation",
+		"Station Password":        "Stationspasswort",
+		"Save Changes":            "Änderungen Speichern",
+		"Update was successful.":  "Die Änderungen wurden gespeichert.",
+		"Password or PASSKEY the station uploads with": "Passwort oder PASSKEY, mit dem die Station hochlädt",
+
+		// Alerts
+		"Alerts":      "Warnungen",
+		"Alert Feeds": "Warnungs-Feeds",
+		"until":       "bis",
+		"CAP or Atom feed addresses, one per line": "Adressen von CAP- oder Atom-Feeds, eine pro Zeile",
+
+		// Rules
+		"Humidity":                "Luftfeuchtigkeit",
+		"Chance of precipitation": "Niederschlagswahrscheinlichkeit",
+		"Rules":                   "Regeln",
+		"Rule Name":               "Name der Regel",
+		"Frost warning":           "Frostwarnung",
+		"Condition":               "Bedingung",
+		"Value":                   "Wert",
+		"Hours ahead":             "Stunden voraus",
+		"Hysteresis":              "Hysterese",
+		"Add Rule":                "Regel Hinzufügen",
+		"Fired":                   "Ausgelöst",
+		"Delete":                  "Löschen",
+		"hours":                   "Stunden",
+
+		// MQTT
+		"Broker":       "Broker",
+		"User Name":    "Benutzername",
+		"Password":     "Passwort",
+		"Use TLS":      "TLS verwenden",
+		"Topic Prefix": "Themenpräfix",
+		"host:port, leave empty to turn MQTT off":   "Host:Port, leer lassen, um MQTT auszuschalten",
+		"Publish Home Assistant discovery messages": "Home Assistant Discovery-Nachrichten veröffentlichen",
+		"Leave empty to keep the password":          "Leer lassen, um das Passwort zu behalten",
+
+		// Records
+		"Records":             "Rekorde",
+		"since":               "seit",
+		"Highest temperature": "Höchste Temperatur",
+		"Lowest temperature":  "Tiefste Temperatur",
+		"Wettest day":         "Nassester Tag",
+		"Strongest gust":      "Stärkste Böe",
+	},
+}
+
+// T returns the English text translated into the language.
+// The text is returned unchanged if there is no translation.
+func T(lang string, s string) string {
+	if m, ok := messages[lang]; ok {
+		if t, ok := m[s]; ok {
+			return t
+		}
+	}
+	return s
+}
+
+// DayName returns the name of the day of the week of the date in the language
+func DayName(t time.Time, lang string) string {
+	return T(lang, t.Weekday().String())
+}
+
+// ParseLanguage returns the supported language with the code, ignoring any region, e.g. de-CH
+func ParseLanguage(s string) (string, bool) {
+	s = strings.ToLower(s)
+	if n := strings.IndexAny(s, "-_"); n >= 0 {
+		s = s[:n]
+	}
+	for _, l := range Languages {
+		if l.Code == s {
+			return s, true
+		}
+	}
+	return "", false
+}
+
+// templateFuncs returns the functions used by the html pages to translate their text into the language
+func templateFuncs(lang string) template.FuncMap {
+	return template.FuncMap{
+		"T": func(s string) string { return T(lang, s) },
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestTranslate(t *testing.T) {
+	if s := T("de", "Partly Cloudy"); s != "Teilweise Bewölkt" {
+		t.Error("Unexpected translation", s)
+	}
+	if s := T("en", "Partly Cloudy"); s != "Partly Cloudy" {
+		t.Error("English text should not be translated", s)
+	}
+	if s := T("de", "Not a message"); s != "Not a message" {
+		t.Error("Text without a translation should be returned unchanged", s)
+	}
+	d := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	if s := DayName(d, "af"); s != "Sondag" {
+		t.Error("Unexpected day name", s)
+	}
+}
+
+func TestParseLanguage(t *testing.T) {
+	for s, e := range map[string]string{"de": "de", "de-CH": "de", "AF_za": "af", "en": "en"} {
+		if l, ok := ParseLanguage(s); !ok || l != e {
+			t.Error("Unexpected language for", s, l, ok)
+		}
+	}
+	if _, ok := ParseLanguage("xx"); ok {
+		t.Error("Expected xx to be unsupported")
+	}
+}
+
+func TestConfigForLanguage(t *testing.T) {
+	chdirTemp(t)
+
+	c := &Config{Provider: "AccuWeather", Language: "en", Latitude: 1, Longitude: 1}
+	d := c.ForLanguage("de")
+	if d.GetLanguage() != "de" || c.GetLanguage() != "en" {
+		t.Error("Unexpected languages", d.GetLanguage(), c.GetLanguage())
+	}
+
+	// Location identifiers found for the derived configuration are saved to the original
+	d.SetLocationID("AccuWeather", "306633")
+	if c.GetLocationID("AccuWeather") != "306633" {
+		t.Error("The location ID was not set on the original configuration")
+	}
+	if err := d.WriteToFile("config.json"); err != nil {
+		t.Fatal(err)
+	}
+	r := Config{}
+	if err := r.ReadFromFile("config.json"); err != nil {
+		t.Fatal(err)
+	}
+	if r.Language != "en" || r.GetLocationID("AccuWeather") != "306633" {
+		t.Error("The original configuration was not saved", r)
+	}
+}
+
+func TestCanDecodeOpenMeteoForecastInLanguage(t *testing.T) {
+	r, err := os.Open("testdata/openmeteo_forecast.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	p := OpenMeteo{Config: &Config{Language: "de"}}
+	f := Forecast{}
+	if err := p.decodeForecast(&f, r); err != nil {
+		t.Fatal(err)
+	}
+	if f.Current.WeatherDesc != "Teilweise Bewölkt" {
+		t.Error("The weather description was not translated", f.Current.WeatherDesc)
+	}
+	if d := f.Forecast[0]; d.Name != DayName(d.Day, "de") || d.Name == d.Day.Weekday().String() {
+		t.Error("The day name was not translated", d.Name)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// LocationController handles the Web Methods for maintaining the named locations.
+type LocationController struct {
+	Srv *Server
+}
+
+// AddController adds the controller routes to the router
+func (c *LocationController) AddController(router *mux.Router, s *Server) {
+	c.Srv = s
+	router.Methods("GET").Path("/locations/get").Name("GetLocations").
+		Handler(Logger(c, http.HandlerFunc(c.handleGetLocations)))
+	router.Methods("GET").Path("/locations/get/{id}").Name("GetLocation").
+		Handler(Logger(c, http.HandlerFunc(c.handleGetLocation)))
+	router.Methods("POST").Path("/locations/set").Name("SetLocation").
+		Handler(Logger(c, http.HandlerFunc(c.handleSetLocation)))
+	router.Methods("POST").Path("/locations/delete/{id}").Name("DeleteLocation").
+		Handler(Logger(c, http.HandlerFunc(c.handleDeleteLocation)))
+}
+
+// LogInfo is used to log information messages for this controller.
+func (c *LocationController) LogInfo(v ...interface{}) {
+	a := fmt.Sprint(v...)
+	logger.Info("LocationController: [Inf] ", a)
+}
+
+// LogError is used to log error messages for this controller.
+func (c *LocationController) LogError(v ...interface{}) {
+	a := fmt.Sprint(v...)
+	logger.Error("LocationController: [Err] ", a)
+}
+
+// Get all the named locations
+func (c *LocationController) handleGetLocations(w http.ResponseWriter, r *http.Request) {
+	ll := LocationList(c.Srv.Config.GetLocations())
+	if err := ll.WriteTo(w); err != nil {
+		http.Error(w, "Error serializing locations. "+err.Error(), 500)
+	}
+}
+
+// Get a named location
+func (c *LocationController) handleGetLocation(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	for _, l := range c.Srv.Config.GetLocations() {
+		if l.ID == id {
+			if err := l.WriteTo(w); err != nil {
+				http.Error(w, "Error serializing location. "+err.Error(), 500)
+			}
+			return
+		}
+	}
+	http.Error(w, "Location "+id+" does not exist", 404)
+}
+
+// Add a named location, or update the location with the id
+func (c *LocationController) handleSetLocation(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	l := Location{
+		ID:       r.Form.Get("id"),
+		Name:     r.Form.Get("name"),
+		TimeZone: r.Form.Get("timezone"),
+		Provider: r.Form.Get("provider"),
+		Units: Units{
+			Temp:      r.Form.Get("tempunit"),
+			WindSpeed: r.Form.Get("windunit"),
+			Pressure:  r.Form.Get("pressureunit"),
+			Precip:    r.Form.Get("precipunit"),
+			Distance:  r.Form.Get("distanceunit"),
+		},
+	}
+	if l.ID == "" {
+		// A new location is identified by its name
+		l.ID = getLocationSlug(l.Name)
+		if _, ok := c.Srv.Config.ForLocation(l.ID); ok {
+			http.Error(w, "Location "+l.ID+" already exists", 400)
+			return
+		}
+	}
+	lat, err := strconv.ParseFloat(r.Form.Get("latitude"), 32)
+	if err != nil {
+		http.Error(w, "Invalid Latitude value", 400)
+		return
+	}
+	lon, err := strconv.ParseFloat(r.Form.Get("longitude"), 32)
+	if err != nil {
+		http.Error(w, "Invalid Longitude value", 400)
+		return
+	}
+	l.Latitude, l.Longitude = float32(lat), float32(lon)
+	for _, f := range r.Form["fallback"] {
+		if f != "" && f != l.Provider {
+			l.Fallbacks = append(l.Fallbacks, f)
+		}
+	}
+	if u := r.Form.Get("unittype"); u != "" {
+		if l.UnitType, err = strconv.Atoi(u); err != nil {
+			http.Error(w, "Invalid Unit Type value", 400)
+			return
+		}
+	}
+	if err := l.Validate(); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	for _, n := range append([]string{l.Provider}, l.Fallbacks...) {
+		if pi, ok := GetProviderInfo(n); ok && !pi.AppIDOptional && c.Srv.Config.GetAppID(n) == "" {
+			http.Error(w, "The "+pi.Description+" Application ID must be specified on the configuration page", 400)
+			return
+		}
+	}
+	c.LogInfo("Setting location ", l.Name, ".")
+	l = c.Srv.Config.SetLocation(l)
+	c.Srv.Config.WriteToFile("config.json")
+	c.removeCache(l.ID)
+
+	if err := l.WriteTo(w); err != nil {
+		http.Error(w, "Error serializing location. "+err.Error(), 500)
+	}
+}
+
+// Delete the named location with the id
+func (c *LocationController) handleDeleteLocation(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	// A rule on the location would never be evaluated again
+	for _, ru := range c.Srv.Config.GetRules() {
+		if ru.Location == id {
+			http.Error(w, "Location "+id+" is used by the rule "+ru.Name, 400)
+			return
+		}
+	}
+	if !c.Srv.Config.DeleteLocation(id) {
+		http.Error(w, "Location "+id+" does not exist", 404)
+		return
+	}
+	c.LogInfo("Deleted location ", id, ".")
+	c.Srv.Config.WriteToFile("config.json")
+	c.removeCache(id)
+}
+
+// removeCache removes the weather, forecast and alerts cached for the named location in any language,
+// and the forecast cached by MET Norway, so that a changed location is not answered from the cache
+func (c *LocationController) removeCache(id string) {
+	for _, n := range []string{"lastweather", "lastforecast", "lastalerts", strings.TrimSuffix(metCacheFile, ".json")} {
+		fs, _ := filepath.Glob(n + "-" + id + ".*.json")
+		for _, f := range append(fs, n+"-"+id+".json") {
+			if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+				c.LogError("Error removing the cached ", f, ". ", err.Error())
+			}
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Location is a named location the weather is reported for, in addition to the configured location.
+// Its weather is asked for with the location query parameter.
+type Location struct {
+	ID          string            `json:"id"`                    // Identifier of the location, used in the location query parameter
+	Name        string            `json:"name"`                  // Name of the location
+	Latitude    float32           `json:"latitude"`              // Location Latitude
+	Longitude   float32           `json:"longitude"`             // Location Longitude
+	TimeZone    string            `json:"timeZone"`              // IANA time zone of the location, looked up from the coordinates if empty
+	Provider    string            `json:"provider,omitempty"`    // Name of the preferred weather provider, the configured provider if empty
+	Fallbacks   []string          `json:"fallbacks,omitempty"`   // Names of the providers to try, in order, if the preferred provider fails
+	UnitType    int               `json:"unitType"`              // Unit type: 0=Metric, 1=Imperial
+	Units       Units             `json:"units"`                 // Units of particular quantities that replace those of the unit type
+	LocationIDs map[string]string `json:"locationIDs,omitempty"` // Location identifiers cached by each provider
+}
+
+// LocationList holds the named locations
+type LocationList []Location
+
+// locationIDChars are the characters a location identifier can be made of, so that it can be used in file names
+const locationIDChars = "abcdefghijklmnopqrstuvwxyz0123456789-_"
+
+// getLocationSlug returns the identifier of a location with the name, e.g. cape-town for Cape Town
+func getLocationSlug(name string) string {
+	s := []rune{}
+	for _, r := range strings.ToLower(name) {
+		if r != '-' && strings.ContainsRune(locationIDChars, r) {
+			s = append(s, r)
+		} else if len(s) != 0 && s[len(s)-1] != '-' {
+			s = append(s, '-')
+		}
+	}
+	return strings.Trim(string(s), "-")
+}
+
+// Validate checks that the location can be reported on
+func (l Location) Validate() error {
+	if l.Name == "" {
+		return errors.New("The location name must be specified")
+	}
+	if l.ID == "" || strings.Trim(l.ID, locationIDChars) != "" {
+		return errors.New("Invalid location identifier " + l.ID + ", only lower case letters, digits, - and _ can be used")
+	}
+	if l.Latitude == 0 && l.Longitude == 0 {
+		return errors.New("The Latitude and Longitude of the location must be specified")
+	}
+	if l.Latitude < -90 || l.Latitude > 90 {
+		return errors.New("Invalid Latitude value")
+	}
+	if l.Longitude < -180 || l.Longitude > 180 {
+		return errors.New("Invalid Longitude value")
+	}
+	if l.TimeZone != "" {
+		if _, err := time.LoadLocation(l.TimeZone); err != nil {
+			return errors.New("Invalid Time Zone value")
+		}
+	}
+	for _, n := range append([]string{l.Provider}, l.Fallbacks...) {
+		if _, ok := GetProviderInfo(n); n != "" && !ok {
+			return errors.New("Invalid Forecast Provider value " + n)
+		}
+	}
+	if l.UnitType < 0 || l.UnitType > 1 {
+		return errors.New("Invalid Unit Type value")
+	}
+	return l.Units.Validate()
+}
+
+// WriteTo serializes the entity and writes it to the http response
+func (l Location) WriteTo(w http.ResponseWriter) error {
+	b, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("content-type", "application/json")
+	w.Write(b)
+	return nil
+}
+
+// WriteTo serializes the entity and writes it to the http response
+func (c LocationList) WriteTo(w http.ResponseWriter) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("content-type", "application/json")
+	w.Write(b)
+	return nil
+}
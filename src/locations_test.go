@@ -0,0 +1,317 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func newLocationsConfig() *Config {
+	return &Config{
+		LocationName: "Cape Town",
+		Latitude:     -33.92,
+		Longitude:    18.42,
+		TimeZone:     "Africa/Johannesburg",
+		Provider:     "OpenWeather",
+		Fallbacks:    []string{"OpenMeteo"},
+		LocationIDs:  map[string]string{"AccuWeather": "306633"},
+		Locations: []Location{
+			{ID: "kyiv", Name: "Kyiv", Latitude: 50.45, Longitude: 30.52, TimeZone: "Europe/Kyiv", Provider: "MetNorway", UnitType: 1},
+			{ID: "durban", Name: "Durban", Latitude: -29.86, Longitude: 31.03, TimeZone: "Africa/Johannesburg", Units: Units{WindSpeed: "kn"}},
+		},
+	}
+}
+
+func TestLocationSlug(t *testing.T) {
+	for n, exp := range map[string]string{"Cape Town": "cape-town", " Kyiv!": "kyiv", "São Paulo": "s-o-paulo", "A_1 - B": "a_1-b"} {
+		if s := getLocationSlug(n); s != exp {
+			t.Error("Expected", exp, "for", n, "got", s)
+		}
+	}
+}
+
+func TestLocationValidation(t *testing.T) {
+	ok := Location{ID: "kyiv", Name: "Kyiv", Latitude: 50.45, Longitude: 30.52}
+	if err := ok.Validate(); err != nil {
+		t.Error(err)
+	}
+	bad := []Location{
+		{ID: "kyiv", Latitude: 50.45, Longitude: 30.52},
+		{ID: "../kyiv", Name: "Kyiv", Latitude: 50.45, Longitude: 30.52},
+		{ID: "kyiv", Name: "Kyiv"},
+		{ID: "kyiv", Name: "Kyiv", Latitude: 95, Longitude: 30.52},
+		{ID: "kyiv", Name: "Kyiv", Latitude: 50.45, Longitude: 30.52, TimeZone: "Europe/Atlantis"},
+		{ID: "kyiv", Name: "Kyiv", Latitude: 50.45, Longitude: 30.52, Provider: "Nowhere"},
+		{ID: "kyiv", Name: "Kyiv", Latitude: 50.45, Longitude: 30.52, Units: Units{Temp: "K"}},
+	}
+	for _, l := range bad {
+		if err := l.Validate(); err == nil {
+			t.Error("Expected the location to be invalid", l)
+		}
+	}
+}
+
+func TestConfigForLocation(t *testing.T) {
+	c := newLocationsConfig()
+	k, ok := c.ForLocation("Kyiv")
+	if !ok {
+		t.Fatal("Expected the location to be found by its name")
+	}
+	if k.LocationName != "Kyiv" || k.Latitude != 50.45 || k.GetTimeZone().String() != "Europe/Kyiv" || k.GetNamedLocation() != "kyiv" {
+		t.Error("Unexpected location", k)
+	}
+	if p := k.ProviderOrder(); len(p) != 1 || p[0] != "MetNorway" || k.GetUnits() != ImperialUnits {
+		t.Error("Expected the provider and units of the location", p, k.GetUnits())
+	}
+
+	// The location identifiers are cached for the location, also in another language
+	k.ForLanguage("de").SetLocationID("AccuWeather", "324505")
+	if id := k.GetLocationID("AccuWeather"); id != "324505" || c.Locations[0].LocationIDs["AccuWeather"] != "324505" {
+		t.Error("Expected the identifier to be cached for the location", id)
+	}
+	if id := c.GetLocationID("AccuWeather"); id != "306633" {
+		t.Error("Expected the configured location to keep its identifier, got", id)
+	}
+
+	// A location without a provider uses the configured providers
+	d, _ := c.ForLocation("durban")
+	if p := d.ProviderOrder(); len(p) != 2 || p[0] != "OpenWeather" || d.GetUnits().WindSpeed != "kn" || d.GetUnits().Temp != "C" {
+		t.Error("Expected the configured providers", p, d.GetUnits())
+	}
+
+	if _, ok := c.ForLocation("nowhere"); ok {
+		t.Error("Expected an unknown location not to be found")
+	}
+}
+
+func TestLocationIDsAreResetWhenTheLocationMoves(t *testing.T) {
+	c := newLocationsConfig()
+	c.Locations[0].LocationIDs = map[string]string{"AccuWeather": "324505"}
+
+	c.SetLocation(Location{ID: "kyiv", Name: "Kyiv City", Latitude: 50.45, Longitude: 30.52})
+	if c.Locations[0].Name != "Kyiv City" || c.Locations[0].LocationIDs["AccuWeather"] != "324505" {
+		t.Error("Expected the identifiers to be kept", c.Locations[0])
+	}
+	c.SetLocation(Location{ID: "kyiv", Name: "Kyiv", Latitude: 50.4, Longitude: 30.5})
+	if len(c.Locations) != 2 || c.Locations[0].LocationIDs != nil {
+		t.Error("Expected the identifiers to be reset", c.Locations[0])
+	}
+	if !c.DeleteLocation("kyiv") || c.DeleteLocation("kyiv") || len(c.Locations) != 1 {
+		t.Error("Expected the location to be deleted once", c.Locations)
+	}
+}
+
+func TestLocationsCanBeAddedAndDeleted(t *testing.T) {
+	chdirTemp(t)
+
+	s := &Server{Config: newLocationsConfig()}
+	router := mux.NewRouter()
+	c := LocationController{}
+	c.AddController(router, s)
+
+	form := url.Values{"name": {"Port Elizabeth"}, "latitude": {"-33.96"}, "longitude": {"25.6"}, "timezone": {"Africa/Johannesburg"}, "provider": {"OpenMeteo"}, "unittype": {"0"}, "windunit": {"kn"}}
+	post := func(f url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/locations/set", strings.NewReader(f.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	rec := post(form)
+	l := Location{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &l); err != nil {
+		t.Fatal(err, rec.Body.String())
+	}
+	if l.ID != "port-elizabeth" || l.Latitude != -33.96 || l.Units.WindSpeed != "kn" {
+		t.Error("Unexpected location", l)
+	}
+
+	// The location is saved with the configuration
+	cfg := Config{}
+	if err := cfg.ReadFromFile("config.json"); err != nil || len(cfg.Locations) != 3 {
+		t.Error("Expected the location to be saved", cfg.Locations, err)
+	}
+
+	// A second location with the same name is refused, but the location can be updated
+	if rec = post(form); rec.Code != 400 {
+		t.Error("Expected a duplicate location to be refused", rec.Code)
+	}
+	os.WriteFile("lastweather-port-elizabeth.json", []byte("{}"), 0644)
+	os.WriteFile("lastweather-port-elizabeth.af.json", []byte("{}"), 0644)
+	form.Set("id", "port-elizabeth")
+	form.Set("name", "Gqeberha")
+	if rec = post(form); rec.Code != 200 || len(s.Config.Locations) != 3 || s.Config.Locations[2].Name != "Gqeberha" {
+		t.Error("Expected the location to be updated", rec.Code, rec.Body.String())
+	}
+	if _, err := os.Stat("lastweather-port-elizabeth.af.json"); !os.IsNotExist(err) {
+		t.Error("Expected the cached weather of the location to be removed")
+	}
+
+	// Providers that need an Application ID must have one
+	form.Set("provider", "AccuWeather")
+	if rec = post(form); rec.Code != 400 || !strings.Contains(rec.Body.String(), "Application ID") {
+		t.Error("Expected a provider without an Application ID to be refused", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/locations/get", nil))
+	ls := LocationList{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &ls); err != nil || len(ls) != 3 {
+		t.Error("Unexpected locations", rec.Body.String())
+	}
+
+	form.Set("latitude", "south")
+	if rec = post(form); rec.Code != 400 {
+		t.Error("Expected an invalid latitude to be refused", rec.Code)
+	}
+
+	// A location with a rule on it cannot be deleted
+	s.Config.Rules = []Rule{{ID: "frost", Name: "Frost warning", Metric: "temp", Operator: "<", Value: 2, Location: "port-elizabeth"}}
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("POST", "/locations/delete/port-elizabeth", nil))
+	if rec.Code != 400 || len(s.Config.Locations) != 3 {
+		t.Error("Expected a location with a rule not to be deleted", rec.Code)
+	}
+	s.Config.Rules = nil
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("POST", "/locations/delete/port-elizabeth", nil))
+	if rec.Code != 200 || len(s.Config.Locations) != 2 {
+		t.Error("Expected the location to be deleted", rec.Code, rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/locations/get/port-elizabeth", nil))
+	if rec.Code != 404 {
+		t.Error("Expected a deleted location not to be found", rec.Code)
+	}
+}
+
+func TestLocationsAreCachedSeparately(t *testing.T) {
+	chdirTemp(t)
+	cfg := newLocationsConfig()
+	c := WeatherController{Srv: &Server{Config: cfg}}
+	k, _ := cfg.ForLocation("kyiv")
+
+	home := &testProvider{Name: "Good", Temp: 21}
+	away := &testProvider{Name: "Good", Temp: 5}
+	c.getCurrentWeather(cfg, []WeatherProvider{home})
+	c.getCurrentWeather(k, []WeatherProvider{away})
+	w, _ := c.getCurrentWeather(k, []WeatherProvider{away})
+	if w.Temp != 5 || away.Calls != 1 {
+		t.Error("Expected the weather of the location to be cached", w.Temp, away.Calls)
+	}
+	if _, err := os.Stat("lastweather-kyiv.json"); err != nil {
+		t.Error("Expected the location to be cached in its own file", err)
+	}
+	if w, _ = c.getCurrentWeather(cfg, []WeatherProvider{home}); w.Temp != 21 || home.Calls != 1 {
+		t.Error("Expected the configured location to keep its cached weather", w.Temp)
+	}
+}
+
+func TestLocationQueryParameter(t *testing.T) {
+	s := &Server{Config: newLocationsConfig()}
+	router := mux.NewRouter()
+	for _, c := range []Controller{&WeatherController{}, &MoonController{}} {
+		c.AddController(router, s)
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/moon/get?location=kyiv", nil))
+	m := Moon{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &m); err != nil {
+		t.Fatal(err, rec.Body.String())
+	}
+	if _, off := m.Date.Zone(); off < 2*60*60 {
+		t.Error("Expected the date in the time zone of the location", m.Date)
+	}
+
+	for _, p := range []string{"/weather/current?location=nowhere", "/weather/forecast?location=nowhere", "/moon/get?location=nowhere"} {
+		rec = httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("GET", p, nil))
+		if rec.Code != 404 || !strings.Contains(rec.Body.String(), "Unknown location") {
+			t.Error("Expected an unknown location to be refused", p, rec.Code)
+		}
+	}
+}
+
+func TestLocationTimeZoneIsLookedUp(t *testing.T) {
+	chdirTemp(t)
+	calls := useTestTimeZones(t, "Africa/Johannesburg")
+
+	s := &Server{Config: newLocationsConfig()}
+	router := mux.NewRouter()
+	c := LocationController{}
+	c.AddController(router, s)
+
+	form := url.Values{"name": {"Port Elizabeth"}, "latitude": {"-33.96"}, "longitude": {"25.6"}}
+	req := httptest.NewRequest("POST", "/locations/set", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	l := Location{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &l); err != nil || l.TimeZone != "" || *calls != 0 {
+		t.Error("Expected the location to be set without looking up its time zone", rec.Body.String(), *calls)
+	}
+
+	// The time zone is looked up when the weather of the location is first asked for
+	wc := WeatherController{Srv: s}
+	cfg, _, err := wc.getConfig(httptest.NewRequest("GET", "/weather/current?location="+l.ID, nil))
+	if err != nil || cfg.TimeZone != "Africa/Johannesburg" || *calls != 1 {
+		t.Error("Expected the time zone of the location to be looked up", cfg, *calls, err)
+	}
+	if _, _, err := wc.getConfig(httptest.NewRequest("GET", "/weather/current", nil)); err != nil || *calls != 1 {
+		t.Error("Expected the time zone not to be looked up again", *calls, err)
+	}
+	saved := Config{}
+	if err := saved.ReadFromFile("config.json"); err != nil {
+		t.Fatal(err)
+	}
+	if sl, ok := saved.ForLocation(l.ID); !ok || sl.TimeZone != "Africa/Johannesburg" {
+		t.Error("Expected the time zone to be saved", sl)
+	}
+}
+
+func TestNamedLocationsHaveRulesAndWebhooks(t *testing.T) {
+	chdirTemp(t)
+	wr := &webhookRecorder{}
+	srv := httptest.NewServer(wr)
+	defer srv.Close()
+
+	cfg := newLocationsConfig()
+	cfg.Webhooks = []Webhook{{ID: "all", URL: srv.URL}}
+	cfg.Rules = []Rule{
+		{ID: "frost", Name: "Frost warning", Metric: "temp", Operator: "<", Value: 2},
+		{ID: "cold", Name: "Cold", Metric: "temp", Operator: "<", Value: 50, Location: "kyiv"},
+	}
+	n := &testNotifier{}
+	s := &Server{Config: cfg, Webhooks: NewWebhookSender(cfg)}
+	s.Rules = NewRuleEngine("", n, s.Webhooks)
+	c := WeatherController{Srv: s}
+	k, _ := cfg.ForLocation("kyiv")
+
+	// The rule on the location is compared in its units, 5°C being 41°F
+	c.getCurrentWeather(k, []WeatherProvider{&testProvider{Name: "Good", Temp: 5}})
+	s.Webhooks.Wait()
+	if len(n.Sent) != 1 || n.Sent[0].Rule.ID != "cold" || n.Sent[0].Value != 41 || !strings.Contains(n.Sent[0].Message, "(kyiv)") {
+		t.Fatal("Expected only the rule on the location to fire", n.Sent)
+	}
+	if !s.Rules.GetState("frost").Evaluated.IsZero() {
+		t.Error("Expected the rule on the configured location not to be evaluated")
+	}
+
+	// The events are posted with the location
+	evs := map[string]WebhookMessage{}
+	for _, b := range wr.bodies {
+		m := WebhookMessage{}
+		json.Unmarshal(b, &m)
+		evs[m.Event] = m
+	}
+	if len(evs) != 2 || evs["observation"].Location != "kyiv" || evs["rule"].Location != "kyiv" {
+		t.Error("Expected the observation and rule of the location to be posted", evs)
+	}
+}
@@ -3,13 +3,34 @@ package main
 import (
 	"net/http"
 	"time"
+
+	"github.com/gorilla/mux"
 )
 
+// statusRecorder records the status code written to the response
+type statusRecorder struct {
+	http.ResponseWriter
+	Status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.Status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
 // Logger will create a Logger Handler wrapper for the specified handler.
+// The duration of the request is also recorded in the metrics.
 func Logger(c Controller, inner http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		inner.ServeHTTP(w, r)
-		c.LogInfo(r.Method, r.RequestURI, "from", r.RemoteAddr, "took", time.Since(start))
+		sr := &statusRecorder{ResponseWriter: w, Status: http.StatusOK}
+		inner.ServeHTTP(sr, r)
+		d := time.Since(start)
+		h := "unknown"
+		if rt := mux.CurrentRoute(r); rt != nil && rt.GetName() != "" {
+			h = rt.GetName()
+		}
+		metrics.ObserveRequest(h, r.Method, sr.Status, d)
+		c.LogInfo(r.Method, r.RequestURI, "from", r.RemoteAddr, "took", d)
 	})
 }
@@ -0,0 +1,8 @@
+package main
+
+import "github.com/kardianos/service"
+
+func init() {
+	// Controllers log through the service logger
+	logger = service.ConsoleLogger
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// MetNorway is an interface to the MET Norway (yr.no) Locationforecast 2.0 internet API.
+// MET Norway does not require an application ID, but does require requests to identify
+// the client and to honour the Expires and Last-Modified headers of the responses.
+type MetNorway struct {
+	Config *Config // Current Configuration
+}
+
+func init() {
+	RegisterProvider(ProviderInfo{
+		Name:          "MetNorway",
+		Description:   "MET Norway (yr.no)",
+		AppIDOptional: true,
+		New:           func() WeatherProvider { return new(MetNorway) },
+	})
+}
+
+var metURL = "https://api.met.no/weatherapi/locationforecast/2.0/compact"
+var metCacheFile = "metnorway.json"
+
+// getCachePath returns the file the last response is cached in. The response for a named location
+// is cached separately, so that the locations do not replace each other's response.
+func (p *MetNorway) getCachePath() string {
+	if n := p.Config.GetNamedLocation(); n != "" {
+		return strings.TrimSuffix(metCacheFile, ".json") + "-" + n + ".json"
+	}
+	return metCacheFile
+}
+
+// metCache holds the last response received from MET Norway so that it can be reused until it expires
+type metCache struct {
+	URL          string          `json:"url"`          // URL the response was received from
+	LastModified string          `json:"lastModified"` // Last-Modified header of the response
+	Expires      time.Time       `json:"expires"`      // Time the response expires
+	Body         json.RawMessage `json:"body"`         // Response body
+}
+
+type metForecastResponse struct {
+	Properties struct {
+		Meta struct {
+			UpdatedAt time.Time `json:"updated_at"`
+		} `json:"meta"`
+		Timeseries []struct {
+			Time time.Time `json:"time"`
+			Data struct {
+				Instant struct {
+					Details struct {
+						AirPressureAtSeaLevel float32 `json:"air_pressure_at_sea_level"`
+						AirTemperature        float32 `json:"air_temperature"`
+						CloudAreaFraction     float32 `json:"cloud_area_fraction"`
+						RelativeHumidity      float32 `json:"relative_humidity"`
+						WindFromDirection     float32 `json:"wind_from_direction"`
+						WindSpeed             float32 `json:"wind_speed"`
+					} `json:"details"`
+				} `json:"instant"`
+				Next1Hours *metPeriod `json:"next_1_hours"`
+				Next6Hours *metPeriod `json:"next_6_hours"`
+			} `json:"data"`
+		} `json:"timeseries"`
+	} `json:"properties"`
+}
+
+type metPeriod struct {
+	Summary struct {
+		SymbolCode string `json:"symbol_code"`
+	} `json:"summary"`
+	Details struct {
+		PrecipitationAmount float32 `json:"precipitation_amount"`
+	} `json:"details"`
+}
+
+// SetConfig sets the configuration for the provider
+func (p *MetNorway) SetConfig(c *Config) {
+	p.Config = c
+}
+
+// GetProviderName returns the name of the provider
+func (p *MetNorway) GetProviderName() string {
+	return "MetNorway"
+}
+
+// GetWeather returns the current weather for the location
+func (p *MetNorway) GetWeather() (Weather, error) {
+	f, err := p.GetForecast()
+	return f.Current, err
+}
+
+// GetForecast returns the current forecast for the location
+func (p *MetNorway) GetForecast() (Forecast, error) {
+	f := Forecast{
+		Current: Weather{
+			Provider: p.GetProviderName(),
+			Created:  time.Now(),
+			ID:       fmt.Sprintf("%.4f,%.4f", p.Config.Latitude, p.Config.Longitude),
+			Name:     p.Config.LocationName,
+		},
+	}
+	b, err := p.getForecastData()
+	if err == nil {
+		err = p.decodeForecast(&f, b)
+	}
+	return f, err
+}
+
+// getForecastData returns the forecast response from MET Norway, reusing the cached response
+// if it has not expired and asking MET Norway whether it has been modified if it has.
+func (p *MetNorway) getForecastData() ([]byte, error) {
+	// MET Norway asks that coordinates are not specified with more than 4 decimals
+	url := fmt.Sprintf("%s?lat=%.4f&lon=%.4f", metURL, p.Config.Latitude, p.Config.Longitude)
+
+	path := p.getCachePath()
+	mc := metCache{}
+	if b, err := ioutil.ReadFile(path); err == nil {
+		if err := json.Unmarshal(b, &mc); err != nil || mc.URL != url {
+			mc = metCache{}
+		}
+	}
+	if mc.URL != "" && time.Now().Before(mc.Expires) {
+		return mc.Body, nil
+	}
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", providerUserAgent)
+	if mc.URL != "" && mc.LastModified != "" {
+		req.Header.Set("If-Modified-Since", mc.LastModified)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if resp != nil {
+		defer resp.Body.Close()
+		resp.Close = true
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		if mc.URL == "" {
+			return nil, errors.New("MET Norway returned Not Modified for a forecast that has not been cached")
+		}
+	case http.StatusOK, http.StatusNonAuthoritativeInfo:
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		mc.URL = url
+		mc.Body = b
+		mc.LastModified = resp.Header.Get("Last-Modified")
+	default:
+		return nil, fmt.Errorf("MET Norway returned status %s", resp.Status)
+	}
+
+	mc.Expires = time.Now()
+	if e, err := http.ParseTime(resp.Header.Get("Expires")); err == nil {
+		mc.Expires = e
+	}
+	if b, err := json.Marshal(mc); err == nil {
+		ioutil.WriteFile(path, b, 0666)
+	}
+	return mc.Body, nil
+}
+
+func (p *MetNorway) decodeForecast(f *Forecast, b []byte) error {
+	var resp = metForecastResponse{}
+	if err := json.Unmarshal(b, &resp); err != nil {
+		return err
+	}
+	ts := resp.Properties.Timeseries
+	if len(ts) == 0 {
+		return errors.New("MET Norway returned an empty forecast")
+	}
+
+	// Current weather
+	cw := ts[0]
+	cd := cw.Data.Instant.Details
+	f.Current.Temp = cd.AirTemperature
+	f.Current.Humidity = cd.RelativeHumidity
+	f.Current.Pressure = cd.AirPressureAtSeaLevel
+	f.Current.WindSpeed = cd.WindSpeed
+	f.Current.WindDirection = cd.WindFromDirection
+	f.Current.ReadingTime = cw.Time
+	f.Current.WeatherIcon, f.Current.WeatherDesc, f.Current.IsDay = p.getWeatherIconInfo(p.getSymbol(cw.Data.Next1Hours, cw.Data.Next6Hours))
+	f.Current.WeatherDesc = T(p.Config.Language, f.Current.WeatherDesc)
+
+	// Forecast
+	cf := ForecastDay{}
+	loc := p.Config.GetTimeZone()
+	for _, i := range ts {
+		ct := i.Time.In(loc)
+		iDay := time.Date(ct.Year(), ct.Month(), ct.Day(), 0, 0, 0, 0, ct.Location())
+		temp := i.Data.Instant.Details.AirTemperature
+		wi, wd, isDay := p.getWeatherIconInfo(p.getSymbol(i.Data.Next1Hours, i.Data.Next6Hours))
+		wd = T(p.Config.Language, wd)
+
+		if i.Data.Next1Hours != nil {
+			f.Hourly = append(f.Hourly, ForecastHour{
+				Time:          ct,
+				Period:        1,
+				Temp:          temp,
+				WeatherIcon:   wi,
+				WeatherDesc:   wd,
+				IsDay:         isDay,
+				Precip:        i.Data.Next1Hours.Details.PrecipitationAmount,
+				Humidity:      i.Data.Instant.Details.RelativeHumidity,
+				WindSpeed:     i.Data.Instant.Details.WindSpeed,
+				WindDirection: i.Data.Instant.Details.WindFromDirection,
+			})
+		}
+
+		if cf.Name != "" && !iDay.Equal(cf.Day) {
+			// Date has changed
+			f.Forecast = append(f.Forecast, cf)
+			cf = ForecastDay{}
+		}
+		if cf.Name == "" {
+			cf.Day = iDay
+			cf.Name = DayName(iDay, p.Config.Language)
+			cf.TempMin = temp
+			cf.TempMax = temp
+			cf.WeatherIcon = wi
+			cf.WeatherDesc = wd
+		} else {
+			if temp < cf.TempMin {
+				cf.TempMin = temp
+			}
+			if temp > cf.TempMax {
+				cf.TempMax = temp
+			}
+			// Update the current forecast if the weather is more extreme than the current
+			if wi > cf.WeatherIcon {
+				cf.WeatherIcon = wi
+				cf.WeatherDesc = wd
+			}
+		}
+	}
+	f.Forecast = append(f.Forecast, cf)
+	return nil
+}
+
+// getSymbol returns the symbol code for the shortest forecast period available
+func (p *MetNorway) getSymbol(n1 *metPeriod, n6 *metPeriod) string {
+	if n1 != nil && n1.Summary.SymbolCode != "" {
+		return n1.Summary.SymbolCode
+	}
+	if n6 != nil {
+		return n6.Summary.SymbolCode
+	}
+	return ""
+}
+
+// metSymbols holds the descriptions of the MET Norway weather symbols
+var metSymbols = map[string]string{
+	"clearsky":                     "Clear Sky",
+	"fair":                         "Fair",
+	"partlycloudy":                 "Partly Cloudy",
+	"cloudy":                       "Cloudy",
+	"fog":                          "Fog",
+	"lightrainshowers":             "Light Rain Showers",
+	"rainshowers":                  "Rain Showers",
+	"heavyrainshowers":             "Heavy Rain Showers",
+	"lightrainshowersandthunder":   "Light Rain Showers And Thunder",
+	"rainshowersandthunder":        "Rain Showers And Thunder",
+	"heavyrainshowersandthunder":   "Heavy Rain Showers And Thunder",
+	"lightsleetshowers":            "Light Sleet Showers",
+	"sleetshowers":                 "Sleet Showers",
+	"heavysleetshowers":            "Heavy Sleet Showers",
+	"lightssleetshowersandthunder": "Light Sleet Showers And Thunder",
+	"sleetshowersandthunder":       "Sleet Showers And Thunder",
+	"heavysleetshowersandthunder":  "Heavy Sleet Showers And Thunder",
+	"lightsnowshowers":             "Light Snow Showers",
+	"snowshowers":                  "Snow Showers",
+	"heavysnowshowers":             "Heavy Snow Showers",
+	"lightssnowshowersandthunder":  "Light Snow Showers And Thunder",
+	"snowshowersandthunder":        "Snow Showers And Thunder",
+	"heavysnowshowersandthunder":   "Heavy Snow Showers And Thunder",
+	"lightrain":                    "Light Rain",
+	"rain":                         "Rain",
+	"heavyrain":                    "Heavy Rain",
+	"lightrainandthunder":          "Light Rain And Thunder",
+	"rainandthunder":               "Rain And Thunder",
+	"heavyrainandthunder":          "Heavy Rain And Thunder",
+	"lightsleet":                   "Light Sleet",
+	"sleet":                        "Sleet",
+	"heavysleet":                   "Heavy Sleet",
+	"lightsleetandthunder":         "Light Sleet And Thunder",
+	"sleetandthunder":              "Sleet And Thunder",
+	"heavysleetandthunder":         "Heavy Sleet And Thunder",
+	"lightsnow":                    "Light Snow",
+	"snow":                         "Snow",
+	"heavysnow":                    "Heavy Snow",
+	"lightsnowandthunder":          "Light Snow And Thunder",
+	"snowandthunder":               "Snow And Thunder",
+	"heavysnowandthunder":          "Heavy Snow And Thunder",
+}
+
+func (p *MetNorway) getWeatherIconInfo(s string) (int, string, bool) {
+	// Icon numbers:
+	// 1 = Clear sky			> clearsky
+	// 2 = Scattered clouds		> fair
+	// 3 = Partly cloudy		> partlycloudy
+	// 4 = Cloudy				> cloudy
+	// 5 = Scattered Rain		> lightrain, *rainshowers
+	// 6 = Rain					> rain, heavyrain
+	// 7 = Thunderstorms		> *thunder
+	// 8 = Snow					> *snow*, *sleet*
+	// 9 = Mist/ Fog			> fog
+	isDay := !strings.HasSuffix(s, "_night") && !strings.HasSuffix(s, "_polartwilight")
+	if n := strings.Index(s, "_"); n >= 0 {
+		s = s[:n]
+	}
+	d := metSymbols[s]
+	switch {
+	case s == "":
+		return 0, d, isDay
+	case s == "clearsky":
+		return 1, d, isDay
+	case s == "fair":
+		return 2, d, isDay
+	case s == "partlycloudy":
+		return 3, d, isDay
+	case s == "cloudy":
+		return 4, d, isDay
+	case s == "fog":
+		return 9, d, isDay
+	case strings.Contains(s, "thunder"):
+		return 7, d, isDay
+	case strings.Contains(s, "snow"), strings.Contains(s, "sleet"):
+		return 8, d, isDay
+	case strings.Contains(s, "showers"), s == "lightrain":
+		return 5, d, isDay
+	case strings.Contains(s, "rain"):
+		return 6, d, isDay
+	default:
+		return 0, d, isDay
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCanDecodeMetNorwayForecast(t *testing.T) {
+	b, err := ioutil.ReadFile("testdata/metno_compact.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := MetNorway{Config: &Config{}}
+	f := Forecast{}
+	if err := p.decodeForecast(&f, b); err != nil {
+		t.Fatal(err)
+	}
+
+	if f.Current.Temp != 7.9 || f.Current.Humidity != 81.5 || f.Current.Pressure != 1011.8 || f.Current.WindSpeed != 5.3 || f.Current.WindDirection != 214.7 {
+		t.Error("Current conditions were not decoded", f.Current)
+	}
+	if f.Current.WeatherIcon != 3 || f.Current.WeatherDesc != "Partly Cloudy" || !f.Current.IsDay {
+		t.Error("Current weather icon was not mapped", f.Current.WeatherIcon, f.Current.WeatherDesc)
+	}
+	if len(f.Hourly) != 5 {
+		t.Error("Expected 5 hourly entries, got", len(f.Hourly))
+	}
+
+	if len(f.Forecast) != 2 {
+		t.Fatal("Expected 2 forecast days, got", len(f.Forecast))
+	}
+	d := f.Forecast[0]
+	if d.TempMin != 7.1 || d.TempMax != 10.8 || d.WeatherIcon != 6 || d.WeatherDesc != "Rain" {
+		t.Error("Unexpected forecast for the first day", d)
+	}
+	d = f.Forecast[1]
+	if d.TempMin != 3.2 || d.TempMax != 11.5 || d.WeatherIcon != 8 || d.WeatherDesc != "Snow Showers" {
+		t.Error("Unexpected forecast for the second day", d)
+	}
+	if d.Name != d.Day.Weekday().String() || d.Day.Hour() != 0 {
+		t.Error("Unexpected forecast day", d.Day, d.Name)
+	}
+}
+
+func TestMetNorwaySymbols(t *testing.T) {
+	p := MetNorway{}
+	tests := []struct {
+		s     string
+		i     int
+		isDay bool
+	}{
+		{"clearsky_day", 1, true},
+		{"clearsky_night", 1, false},
+		{"fair_polartwilight", 2, false},
+		{"partlycloudy_day", 3, true},
+		{"cloudy", 4, true},
+		{"lightrainshowers_day", 5, true},
+		{"lightrain", 5, true},
+		{"heavyrain", 6, true},
+		{"lightssleetshowersandthunder_day", 7, true},
+		{"heavysnow", 8, true},
+		{"sleetshowers_night", 8, false},
+		{"fog", 9, true},
+	}
+	for _, e := range tests {
+		i, d, isDay := p.getWeatherIconInfo(e.s)
+		if i != e.i || isDay != e.isDay || d == "" {
+			t.Error("Symbol", e.s, "mapped to", i, d, isDay)
+		}
+	}
+}
+
+func TestMetNorwayHonoursExpiresAndLastModified(t *testing.T) {
+	body, err := ioutil.ReadFile("testdata/metno_compact.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lm := "Sat, 18 Oct 2025 07:43:21 GMT"
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.Header.Get("User-Agent") == "" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Expires", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+		if r.Header.Get("If-Modified-Since") == lm {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Last-Modified", lm)
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	ou, oc := metURL, metCacheFile
+	metURL = srv.URL
+	metCacheFile = filepath.Join(t.TempDir(), "metnorway.json")
+	defer func() { metURL, metCacheFile = ou, oc }()
+
+	p := MetNorway{Config: &Config{Latitude: 59.9139, Longitude: 10.7522}}
+
+	// First request is fetched, the second is served from the cache
+	for n := 0; n < 2; n++ {
+		if _, err := p.GetForecast(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls != 1 {
+		t.Error("Expected 1 call to the server before the response expired, got", calls)
+	}
+
+	// Once expired, the request is conditional and the cached response is reused
+	mc := metCache{}
+	b, _ := ioutil.ReadFile(metCacheFile)
+	if err := json.Unmarshal(b, &mc); err != nil {
+		t.Fatal(err)
+	}
+	mc.Expires = time.Now().Add(-time.Minute)
+	b, _ = json.Marshal(mc)
+	ioutil.WriteFile(metCacheFile, b, 0666)
+	f, err := p.GetForecast()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Error("Expected a second call to the server after the response expired, got", calls)
+	}
+	if len(f.Forecast) != 2 {
+		t.Error("The cached forecast was not used for the Not Modified response")
+	}
+
+	// A named location is cached in its own file, so the locations do not replace each other's response
+	k, _ := newLocationsConfig().ForLocation("kyiv")
+	if _, err := (&MetNorway{Config: k}).GetForecast(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.GetForecast(); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 {
+		t.Error("Expected each location to be fetched once, got", calls)
+	}
+	if _, err := os.Stat(strings.TrimSuffix(metCacheFile, ".json") + "-kyiv.json"); err != nil {
+		t.Error("Expected the location to be cached in its own file", err)
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics holds the metrics exposed to Prometheus in the OpenMetrics text format
+type Metrics struct {
+	families []*metricFamily
+	byName   map[string]*metricFamily
+	lock     sync.Mutex
+}
+
+// metricFamily holds the series of a metric, keyed by their label values
+type metricFamily struct {
+	Name    string
+	Help    string
+	Type    string    // gauge, counter or histogram
+	Unit    string    // Unit of the metric, if it has one
+	Labels  []string  // Names of the labels
+	Buckets []float64 // Upper bounds of the histogram buckets
+	series  map[string]*metricSeries
+}
+
+// metricSeries holds the value of one combination of label values
+type metricSeries struct {
+	Labels []string
+	Value  float64  // Value of a gauge or counter, or the sum of a histogram
+	Count  uint64   // Number of observations of a histogram
+	Counts []uint64 // Number of observations in each histogram bucket
+}
+
+// providerBuckets are the buckets of the provider call durations, in seconds
+var providerBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// requestBuckets are the buckets of the HTTP request durations, in seconds
+var requestBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// metrics holds the metrics of the service
+var metrics = NewMetrics()
+
+// NewMetrics creates the metrics of the service
+func NewMetrics() *Metrics {
+	m := &Metrics{byName: map[string]*metricFamily{}}
+	loc := []string{"location", "provider"}
+	m.add(&metricFamily{Name: "weather_temperature_celsius", Type: "gauge", Unit: "celsius", Labels: loc, Help: "Latest temperature."})
+	m.add(&metricFamily{Name: "weather_humidity_percent", Type: "gauge", Unit: "percent", Labels: loc, Help: "Latest relative humidity."})
+	m.add(&metricFamily{Name: "weather_pressure_hectopascals", Type: "gauge", Unit: "hectopascals", Labels: loc, Help: "Latest air pressure."})
+	m.add(&metricFamily{Name: "weather_wind_speed_meters_per_second", Type: "gauge", Unit: "meters_per_second", Labels: loc, Help: "Latest wind speed."})
+	m.add(&metricFamily{Name: "weather_wind_gust_meters_per_second", Type: "gauge", Unit: "meters_per_second", Labels: loc, Help: "Latest wind gust speed."})
+	m.add(&metricFamily{Name: "weather_wind_direction_degrees", Type: "gauge", Unit: "degrees", Labels: loc, Help: "Latest wind direction."})
+	m.add(&metricFamily{Name: "weather_reading_timestamp_seconds", Type: "gauge", Unit: "seconds", Labels: loc, Help: "Time the latest weather was created by the provider."})
+
+	call := []string{"provider", "call"}
+	m.add(&metricFamily{Name: "weather_provider_calls", Type: "counter", Labels: call, Help: "Calls made to the weather providers and alert feeds."})
+	m.add(&metricFamily{Name: "weather_provider_errors", Type: "counter", Labels: call, Help: "Calls to the weather providers and alert feeds that failed."})
+	m.add(&metricFamily{Name: "weather_provider_duration_seconds", Type: "histogram", Unit: "seconds", Labels: call, Buckets: providerBuckets, Help: "Duration of the calls to the weather providers and alert feeds."})
+
+	m.add(&metricFamily{Name: "weather_cache_hits", Type: "counter", Labels: []string{"cache"}, Help: "Requests answered from the cached weather, forecast or alerts."})
+	m.add(&metricFamily{Name: "weather_cache_misses", Type: "counter", Labels: []string{"cache"}, Help: "Requests the cached weather, forecast or alerts could not answer."})
+
+	m.add(&metricFamily{Name: "weather_http_request_duration_seconds", Type: "histogram", Unit: "seconds", Labels: []string{"handler", "method", "code"}, Buckets: requestBuckets, Help: "Duration of the HTTP requests to the service."})
+	return m
+}
+
+func (m *Metrics) add(f *metricFamily) {
+	f.series = map[string]*metricSeries{}
+	m.families = append(m.families, f)
+	m.byName[f.Name] = f
+}
+
+// get returns the series of the metric with the label values, creating it if it does not exist
+func (m *Metrics) get(name string, labels ...string) *metricSeries {
+	f := m.byName[name]
+	k := strings.Join(labels, "\xff")
+	s, ok := f.series[k]
+	if !ok {
+		s = &metricSeries{Labels: labels, Counts: make([]uint64, len(f.Buckets))}
+		f.series[k] = s
+	}
+	return s
+}
+
+// observe records the value in the buckets of the histogram
+func (m *Metrics) observe(name string, v float64, labels ...string) {
+	s := m.get(name, labels...)
+	for i, b := range m.byName[name].Buckets {
+		if v <= b {
+			s.Counts[i]++
+		}
+	}
+	s.Count++
+	s.Value += v
+}
+
+// ObserveWeather records the values of the latest weather at the location. The series of any
+// other provider at the location are removed, so that only the latest weather is reported.
+func (m *Metrics) ObserveWeather(location string, w Weather) {
+	if w.Units.IsSet() {
+		w = SIUnits.ConvertWeather(w)
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	vs := map[string]float64{
+		"weather_temperature_celsius":          float64(w.Temp),
+		"weather_humidity_percent":             float64(w.Humidity),
+		"weather_pressure_hectopascals":        float64(w.Pressure),
+		"weather_wind_speed_meters_per_second": float64(w.WindSpeed),
+		"weather_wind_gust_meters_per_second":  float64(w.WindGust),
+		"weather_wind_direction_degrees":       float64(w.WindDirection),
+		"weather_reading_timestamp_seconds":    float64(w.Created.UnixNano()) / 1e9,
+	}
+	for n, v := range vs {
+		f := m.byName[n]
+		for k, s := range f.series {
+			if s.Labels[0] == location && s.Labels[1] != w.Provider {
+				delete(f.series, k)
+			}
+		}
+		m.get(n, location, w.Provider).Value = v
+	}
+}
+
+// ObserveProviderCall records a call to a weather provider or alert feed
+func (m *Metrics) ObserveProviderCall(provider string, call string, d time.Duration, err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.get("weather_provider_calls", provider, call).Value++
+	if err != nil {
+		m.get("weather_provider_errors", provider, call).Value++
+	}
+	m.observe("weather_provider_duration_seconds", d.Seconds(), provider, call)
+}
+
+// ObserveCache records whether the cache could answer a request
+func (m *Metrics) ObserveCache(cache string, hit bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if hit {
+		m.get("weather_cache_hits", cache).Value++
+	} else {
+		m.get("weather_cache_misses", cache).Value++
+	}
+}
+
+// ObserveRequest records the duration of an HTTP request
+func (m *Metrics) ObserveRequest(handler string, method string, code int, d time.Duration) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.observe("weather_http_request_duration_seconds", d.Seconds(), handler, method, strconv.Itoa(code))
+}
+
+// WriteTo writes the metrics to the http response in the OpenMetrics text format
+func (m *Metrics) WriteTo(w http.ResponseWriter) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	b := &bytes.Buffer{}
+	for _, f := range m.families {
+		fmt.Fprintf(b, "# TYPE %s %s\n", f.Name, f.Type)
+		if f.Unit != "" {
+			fmt.Fprintf(b, "# UNIT %s %s\n", f.Name, f.Unit)
+		}
+		fmt.Fprintf(b, "# HELP %s %s\n", f.Name, f.Help)
+		ks := []string{}
+		for k := range f.series {
+			ks = append(ks, k)
+		}
+		sort.Strings(ks)
+		for _, k := range ks {
+			s := f.series[k]
+			switch f.Type {
+			case "counter":
+				fmt.Fprintf(b, "%s_total%s %s\n", f.Name, f.labels(s.Labels, "", 0), formatMetric(s.Value))
+			case "histogram":
+				for i, u := range f.Buckets {
+					fmt.Fprintf(b, "%s_bucket%s %d\n", f.Name, f.labels(s.Labels, "le", u), s.Counts[i])
+				}
+				fmt.Fprintf(b, "%s_bucket%s %d\n", f.Name, f.labels(s.Labels, "le", math.Inf(1)), s.Count)
+				fmt.Fprintf(b, "%s_count%s %d\n", f.Name, f.labels(s.Labels, "", 0), s.Count)
+				fmt.Fprintf(b, "%s_sum%s %s\n", f.Name, f.labels(s.Labels, "", 0), formatMetric(s.Value))
+			default:
+				fmt.Fprintf(b, "%s%s %s\n", f.Name, f.labels(s.Labels, "", 0), formatMetric(s.Value))
+			}
+		}
+	}
+	b.WriteString("# EOF\n")
+	w.Header().Set("content-type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// labels returns the label set of the series, with the extra label if one is named
+func (f *metricFamily) labels(vs []string, extra string, v float64) string {
+	ls := []string{}
+	for i, n := range f.Labels {
+		ls = append(ls, n+`="`+escapeLabel(vs[i])+`"`)
+	}
+	if extra != "" {
+		ls = append(ls, extra+`="`+formatMetric(v)+`"`)
+	}
+	if len(ls) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(ls, ",") + "}"
+}
+
+// escapeLabel escapes the backslashes, quotes and line feeds of a label value
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+// formatMetric formats the value as OpenMetrics expects
+func formatMetric(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// getLocationLabel returns the name the location of the configuration is labelled with
+func getLocationLabel(cfg *Config) string {
+	if cfg.LocationName != "" {
+		return cfg.LocationName
+	}
+	return fmt.Sprintf("%.4f,%.4f", cfg.Latitude, cfg.Longitude)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// useTestMetrics replaces the metrics of the service with empty metrics for the test
+func useTestMetrics(t *testing.T) {
+	m := metrics
+	metrics = NewMetrics()
+	t.Cleanup(func() { metrics = m })
+}
+
+func getMetricsText(t *testing.T, m *Metrics) string {
+	rec := httptest.NewRecorder()
+	if err := m.WriteTo(rec); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(rec.Header().Get("content-type"), "application/openmetrics-text") {
+		t.Error("Unexpected content type", rec.Header().Get("content-type"))
+	}
+	return rec.Body.String()
+}
+
+func expectMetrics(t *testing.T, s string, lines ...string) {
+	for _, l := range lines {
+		if !strings.Contains("\n"+s, "\n"+l+"\n") {
+			t.Error("Expected the metric line", l)
+		}
+	}
+}
+
+func TestMetricsAreWrittenInOpenMetricsFormat(t *testing.T) {
+	m := NewMetrics()
+	m.ObserveWeather("Cape Town", Weather{Provider: "OpenMeteo", Temp: 21.5, Humidity: 60, WindSpeed: 36, Units: MetricUnits})
+	m.ObserveProviderCall("OpenMeteo", "weather", 300*time.Millisecond, nil)
+	m.ObserveProviderCall("OpenMeteo", "weather", 3*time.Second, errors.New("timeout"))
+	m.ObserveCache("forecast", true)
+	m.ObserveRequest("GetCurrent", "GET", 200, 20*time.Millisecond)
+
+	s := getMetricsText(t, m)
+	expectMetrics(t, s,
+		"# TYPE weather_temperature_celsius gauge",
+		"# UNIT weather_temperature_celsius celsius",
+		`weather_temperature_celsius{location="Cape Town",provider="OpenMeteo"} 21.5`,
+		`weather_wind_speed_meters_per_second{location="Cape Town",provider="OpenMeteo"} 10`,
+		"# TYPE weather_provider_calls counter",
+		`weather_provider_calls_total{provider="OpenMeteo",call="weather"} 2`,
+		`weather_provider_errors_total{provider="OpenMeteo",call="weather"} 1`,
+		`weather_provider_duration_seconds_bucket{provider="OpenMeteo",call="weather",le="0.25"} 0`,
+		`weather_provider_duration_seconds_bucket{provider="OpenMeteo",call="weather",le="0.5"} 1`,
+		`weather_provider_duration_seconds_bucket{provider="OpenMeteo",call="weather",le="+Inf"} 2`,
+		`weather_provider_duration_seconds_count{provider="OpenMeteo",call="weather"} 2`,
+		`weather_provider_duration_seconds_sum{provider="OpenMeteo",call="weather"} 3.3`,
+		`weather_cache_hits_total{cache="forecast"} 1`,
+		`weather_http_request_duration_seconds_bucket{handler="GetCurrent",method="GET",code="200",le="0.025"} 1`,
+	)
+	if !strings.HasSuffix(s, "\n# EOF\n") {
+		t.Error("Expected the metrics to end with EOF")
+	}
+
+	// Only the latest provider of the location is reported
+	m.ObserveWeather("Cape Town", Weather{Provider: "MetNorway", Temp: 20, Units: SIUnits})
+	m.ObserveWeather("Kyiv", Weather{Provider: "OpenMeteo", Temp: 5, Units: SIUnits})
+	s = getMetricsText(t, m)
+	if strings.Contains(s, `location="Cape Town",provider="OpenMeteo"`) {
+		t.Error("Expected the previous provider to be removed")
+	}
+	expectMetrics(t, s,
+		`weather_temperature_celsius{location="Cape Town",provider="MetNorway"} 20`,
+		`weather_temperature_celsius{location="Kyiv",provider="OpenMeteo"} 5`,
+	)
+}
+
+func TestLabelValuesAreEscaped(t *testing.T) {
+	if v := escapeLabel("Cape \"Town\"\\\n"); v != `Cape \"Town\"\\\n` {
+		t.Error("Unexpected escaped label", v)
+	}
+}
+
+func TestWeatherControllerRecordsMetrics(t *testing.T) {
+	chdirTemp(t)
+	useTestMetrics(t)
+
+	bad := &testProvider{Name: "Bad", Err: errors.New("invalid api key")}
+	good := &testProvider{Name: "Good", Temp: 21}
+	cfg := &Config{LocationName: "Cape Town"}
+	c := WeatherController{Srv: &Server{Config: cfg}}
+	ps := []WeatherProvider{bad, good}
+
+	c.getCurrentWeather(cfg, ps)
+	c.getCurrentWeather(cfg, ps)
+	expectMetrics(t, getMetricsText(t, metrics),
+		`weather_temperature_celsius{location="Cape Town",provider="Good"} 21`,
+		`weather_provider_calls_total{provider="Bad",call="weather"} 1`,
+		`weather_provider_errors_total{provider="Bad",call="weather"} 1`,
+		`weather_provider_calls_total{provider="Good",call="weather"} 1`,
+		`weather_cache_hits_total{cache="weather"} 1`,
+		`weather_cache_misses_total{cache="weather"} 1`,
+	)
+}
+
+func TestRequestDurationsAreRecorded(t *testing.T) {
+	useTestMetrics(t)
+
+	s := &Server{Config: &Config{}}
+	router := mux.NewRouter()
+	for _, c := range []Controller{&MoonController{}, &MetricsController{}} {
+		c.AddController(router, s)
+	}
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/moon/get", nil))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	expectMetrics(t, rec.Body.String(), `weather_http_request_duration_seconds_count{handler="GetMoonCurrent",method="GET",code="200"} 1`)
+	if strings.Contains(rec.Body.String(), `handler="GetMetrics"`) {
+		t.Error("Expected the scrapes not to be recorded")
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// MetricsController handles the Web Methods for scraping the metrics of the service.
+type MetricsController struct {
+	Srv *Server
+}
+
+// AddController adds the controller routes to the router
+func (c *MetricsController) AddController(router *mux.Router, s *Server) {
+	c.Srv = s
+	// The metrics are scraped every few seconds, so the requests are not logged
+	router.Methods("GET").Path("/metrics").Name("GetMetrics").
+		Handler(http.HandlerFunc(c.handleGetMetrics))
+}
+
+// LogInfo is used to log information messages for this controller.
+func (c *MetricsController) LogInfo(v ...interface{}) {
+	a := fmt.Sprint(v...)
+	logger.Info("MetricsController: [Inf] ", a)
+}
+
+func (c *MetricsController) handleGetMetrics(w http.ResponseWriter, r *http.Request) {
+	if err := metrics.WriteTo(w); err != nil {
+		c.LogInfo("Error writing metrics. ", err.Error())
+	}
+}
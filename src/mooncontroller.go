@@ -26,10 +26,22 @@ func (c *MoonController) LogInfo(v ...interface{}) {
 	logger.Info("MoonController: ", a)
 }
 
-// Get the current weather information
+// Get the current moon phase, dated in the time zone of the named location if one is given
 func (c *MoonController) handleGetCurrent(w http.ResponseWriter, r *http.Request) {
+	t := time.Now()
+	if n := r.URL.Query().Get("location"); n != "" {
+		cfg, ok := c.Srv.Config.ForLocation(n)
+		if !ok {
+			http.Error(w, "Unknown location "+n, 404)
+			return
+		}
+		t = t.In(cfg.GetTimeZone())
+	}
 	m := Moon{}
-	m.ForDate(time.Now())
+	m.ForDate(t)
+	if l, ok := ParseLanguage(r.URL.Query().Get("lang")); ok {
+		m.PhaseName = T(l, m.PhaseName)
+	}
 	if err := m.WriteTo(w); err != nil {
 		http.Error(w, "Error serializing moon information. "+err.Error(), 500)
 	}
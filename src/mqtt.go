@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MQTTConfig holds the settings of the MQTT broker the weather is published to
+type MQTTConfig struct {
+	Broker          string `json:"broker"`                    // Address of the broker as host:port, publishing is off if empty
+	Username        string `json:"username,omitempty"`        // User name to connect with, if the broker needs one
+	Password        string `json:"password,omitempty"`        // Password to connect with
+	TLS             bool   `json:"tls"`                       // Connect to the broker using TLS
+	ClientID        string `json:"clientID,omitempty"`        // Client identifier, weather- followed by the host name and topic prefix if empty
+	Prefix          string `json:"prefix,omitempty"`          // Prefix of the topics the weather is published to, weather if empty
+	Discovery       bool   `json:"discovery"`                 // Publish Home Assistant MQTT discovery messages
+	DiscoveryPrefix string `json:"discoveryPrefix,omitempty"` // Home Assistant discovery prefix, homeassistant if empty
+}
+
+// MQTTPublisher publishes the current weather, the daily forecast and the moon phase to an MQTT broker
+// as retained messages, along with the Home Assistant discovery messages of the weather sensors.
+// The weather of a named location is published under its own topics, as a device of its own.
+type MQTTPublisher struct {
+	Config     *Config               // Current Configuration
+	Timeout    time.Duration         // Timeout connecting to and writing to the broker
+	discovered map[string]MQTTConfig // Settings the discovery messages of each location were last published with
+	lock       sync.Mutex
+	wg         sync.WaitGroup
+}
+
+// mqttSensor describes a sensor announced to Home Assistant
+type mqttSensor struct {
+	Key         string // Key of the value in the current weather
+	Name        string // Name of the sensor
+	DeviceClass string // Home Assistant device class, if there is one
+	Unit        string // Unit of measure
+}
+
+// mqttMessage is a message published to the broker
+type mqttMessage struct {
+	Topic   string
+	Payload []byte
+}
+
+// haForecast is a day of the forecast as the Home Assistant weather entity expects it
+type haForecast struct {
+	Datetime                 time.Time `json:"datetime"`
+	Condition                string    `json:"condition"`
+	Temperature              float32   `json:"temperature"`
+	TempLow                  float32   `json:"templow"`
+	Precipitation            float32   `json:"precipitation"`
+	PrecipitationProbability float32   `json:"precipitation_probability"`
+	WindSpeed                float32   `json:"wind_speed"`
+	Humidity                 float32   `json:"humidity,omitempty"`
+	UVIndex                  float32   `json:"uv_index,omitempty"`
+}
+
+// haConditions maps the weather icons onto the Home Assistant weather conditions
+var haConditions = map[int]string{1: "sunny", 2: "partlycloudy", 3: "partlycloudy", 4: "cloudy", 5: "rainy", 6: "rainy", 7: "lightning-rainy", 8: "snowy", 9: "fog"}
+
+// NewMQTTPublisher creates a publisher for the broker of the configuration
+func NewMQTTPublisher(c *Config) *MQTTPublisher {
+	return &MQTTPublisher{Config: c, Timeout: 10 * time.Second}
+}
+
+// IsEnabled indicates whether a broker is configured
+func (p *MQTTPublisher) IsEnabled() bool {
+	return p.Config.MQTT.Broker != ""
+}
+
+// getPrefix returns the prefix of the topics
+func (p *MQTTPublisher) getPrefix() string {
+	if p.Config.MQTT.Prefix == "" {
+		return "weather"
+	}
+	return strings.TrimSuffix(p.Config.MQTT.Prefix, "/")
+}
+
+// getTopic returns the topic the weather of the location of the configuration is published under,
+// which is the prefix for the configured location and the prefix followed by the identifier for a named location
+func (p *MQTTPublisher) getTopic(cfg *Config) string {
+	if n := cfg.GetNamedLocation(); n != "" {
+		return p.getPrefix() + "/" + n
+	}
+	return p.getPrefix()
+}
+
+// getClientID returns the client identifier. A broker disconnects a client when another connects
+// with the same identifier, so by default it is made unique to the host and the topic prefix.
+func (p *MQTTPublisher) getClientID() string {
+	if p.Config.MQTT.ClientID != "" {
+		return p.Config.MQTT.ClientID
+	}
+	id := "weather"
+	if h, err := os.Hostname(); err == nil && h != "" {
+		id += "-" + h
+	}
+	if pf := p.getPrefix(); pf != "weather" {
+		id += "-" + strings.Replace(pf, "/", "_", -1)
+	}
+	return id
+}
+
+// PublishWeather publishes the current weather of the location of the configuration in the background.
+// The weather is published in the units and time zone of the location.
+func (p *MQTTPublisher) PublishWeather(cfg *Config, w Weather) {
+	if !p.IsEnabled() {
+		return
+	}
+	w = cfg.GetUnits().ConvertWeather(w.WithDerived()).In(cfg.GetTimeZone())
+	ms := []mqttMessage{}
+	if b, err := json.Marshal(w); err == nil {
+		ms = append(ms, mqttMessage{p.getTopic(cfg) + "/current", b})
+	}
+	c := haConditions[w.WeatherIcon]
+	if c == "sunny" && !w.IsDay {
+		c = "clear-night"
+	}
+	ms = append(ms, mqttMessage{p.getTopic(cfg) + "/condition", []byte(c)})
+	m := Moon{}
+	m.ForDate(time.Now().In(cfg.GetTimeZone()))
+	m.PhaseName = T(cfg.GetLanguage(), m.PhaseName)
+	if b, err := json.Marshal(m); err == nil {
+		ms = append(ms, mqttMessage{p.getTopic(cfg) + "/moon", b})
+	}
+	p.publish(cfg, ms, w.Units)
+}
+
+// PublishForecast publishes the daily forecast of the location of the configuration in the background
+func (p *MQTTPublisher) PublishForecast(cfg *Config, f Forecast) {
+	if !p.IsEnabled() {
+		return
+	}
+	f = cfg.GetUnits().ConvertForecast(f.WithDerived()).In(cfg.GetTimeZone())
+	b, err := json.Marshal(f.Forecast)
+	if err != nil {
+		return
+	}
+	ms := []mqttMessage{{p.getTopic(cfg) + "/forecast", b}}
+	// The forecast is also published in the form the Home Assistant weather entity expects
+	hs := []haForecast{}
+	for _, d := range f.Forecast {
+		hs = append(hs, haForecast{
+			Datetime:                 d.Day,
+			Condition:                haConditions[d.WeatherIcon],
+			Temperature:              d.TempMax,
+			TempLow:                  d.TempMin,
+			Precipitation:            d.Precip,
+			PrecipitationProbability: d.PrecipProb,
+			WindSpeed:                d.WindSpeed,
+			Humidity:                 d.Humidity,
+			UVIndex:                  d.UVIndex,
+		})
+	}
+	if b, err := json.Marshal(hs); err == nil {
+		ms = append(ms, mqttMessage{p.getTopic(cfg) + "/haforecast", b})
+	}
+	p.publish(cfg, ms, f.Units)
+}
+
+// Wait waits for the messages being published to be sent
+func (p *MQTTPublisher) Wait() {
+	p.wg.Wait()
+}
+
+// publish sends the messages to the broker in the background, along with the discovery messages
+// of the location the first time the broker is published to with the current settings
+func (p *MQTTPublisher) publish(lc *Config, ms []mqttMessage, u Units) {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		p.lock.Lock()
+		defer p.lock.Unlock()
+		cfg := p.Config.MQTT
+		n := lc.GetNamedLocation()
+		if cfg.Discovery && cfg != p.discovered[n] {
+			ms = append(p.getDiscovery(lc, u), ms...)
+		}
+		if err := p.send(ms); err != nil {
+			logger.Error("MQTT: [Err] ", "Error publishing to "+p.Config.MQTT.Broker+". "+err.Error())
+			return
+		}
+		if cfg.Discovery {
+			if p.discovered == nil {
+				p.discovered = map[string]MQTTConfig{}
+			}
+			p.discovered[n] = cfg
+		}
+	}()
+}
+
+// getDiscovery returns the Home Assistant discovery messages of the weather sensors of the location
+// of the configuration
+func (p *MQTTPublisher) getDiscovery(lc *Config, u Units) []mqttMessage {
+	dp := p.Config.MQTT.DiscoveryPrefix
+	if dp == "" {
+		dp = "homeassistant"
+	}
+	id := strings.Replace(p.getTopic(lc), "/", "_", -1)
+	dev := map[string]interface{}{
+		"identifiers":  []string{id},
+		"name":         strings.TrimSpace("Weather " + lc.LocationName),
+		"manufacturer": "Brumawen",
+		"model":        "Weather Service",
+	}
+	ss := []mqttSensor{
+		{"temp", "Temperature", "temperature", "°" + u.Temp},
+		{"feelsLike", "Feels Like", "temperature", "°" + u.Temp},
+		{"dewPoint", "Dew Point", "temperature", "°" + u.Temp},
+		{"humidity", "Humidity", "humidity", "%"},
+		{"pressure", "Pressure", "atmospheric_pressure", u.Pressure},
+		{"windSpeed", "Wind Speed", "wind_speed", u.WindSpeed},
+		{"windGust", "Wind Gust", "wind_speed", u.WindSpeed},
+		{"windDirection", "Wind Direction", "", "°"},
+		{"visibility", "Visibility", "distance", u.Distance},
+		{"cloudCover", "Cloud Cover", "", "%"},
+		{"uvIndex", "UV Index", "", ""},
+	}
+	ms := []mqttMessage{}
+	for _, s := range ss {
+		c := map[string]interface{}{
+			"name":           s.Name,
+			"unique_id":      id + "_" + s.Key,
+			"object_id":      id + "_" + s.Key,
+			"state_topic":    p.getTopic(lc) + "/current",
+			"value_template": "{{ value_json." + s.Key + " }}",
+			"state_class":    "measurement",
+			"device":         dev,
+		}
+		if s.DeviceClass != "" {
+			c["device_class"] = s.DeviceClass
+		}
+		if s.Unit != "" && s.Unit != "bft" {
+			c["unit_of_measurement"] = s.Unit
+		}
+		ms = append(ms, p.discoveryMessage(dp, id, s.Key, c))
+	}
+	// The condition carries the forecast as attributes, so that a template weather entity can be built on it
+	ms = append(ms, p.discoveryMessage(dp, id, "condition", map[string]interface{}{
+		"name":                     "Condition",
+		"unique_id":                id + "_condition",
+		"object_id":                id + "_condition",
+		"state_topic":              p.getTopic(lc) + "/condition",
+		"json_attributes_topic":    p.getTopic(lc) + "/haforecast",
+		"json_attributes_template": "{{ {'forecast': value_json} | tojson }}",
+		"device":                   dev,
+	}))
+	ms = append(ms, p.discoveryMessage(dp, id, "moon", map[string]interface{}{
+		"name":           "Moon Phase",
+		"unique_id":      id + "_moon",
+		"object_id":      id + "_moon",
+		"state_topic":    p.getTopic(lc) + "/moon",
+		"value_template": "{{ value_json.PhaseName }}",
+		"device":         dev,
+	}))
+	return ms
+}
+
+func (p *MQTTPublisher) discoveryMessage(prefix string, id string, key string, c map[string]interface{}) mqttMessage {
+	b, _ := json.Marshal(c)
+	return mqttMessage{fmt.Sprintf("%s/sensor/%s/%s/config", prefix, id, key), b}
+}
+
+// send connects to the broker, publishes the messages as retained messages and disconnects
+func (p *MQTTPublisher) send(ms []mqttMessage) error {
+	cfg := p.Config.MQTT
+	d := &net.Dialer{Timeout: p.Timeout}
+	var conn net.Conn
+	var err error
+	if cfg.TLS {
+		h, _, _ := net.SplitHostPort(cfg.Broker)
+		conn, err = tls.DialWithDialer(d, "tcp", cfg.Broker, &tls.Config{ServerName: h})
+	} else {
+		conn, err = d.Dial("tcp", cfg.Broker)
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(p.Timeout))
+
+	if _, err := conn.Write(mqttConnect(p.getClientID(), cfg.Username, cfg.Password)); err != nil {
+		return err
+	}
+	if err := mqttReadConnAck(bufio.NewReader(conn)); err != nil {
+		return err
+	}
+	for _, m := range ms {
+		if _, err := conn.Write(mqttPublish(m.Topic, m.Payload, true)); err != nil {
+			return err
+		}
+	}
+	_, err = conn.Write([]byte{0xE0, 0})
+	return err
+}
+
+// mqttString encodes the string with its length as MQTT requires
+func mqttString(s string) []byte {
+	return append([]byte{byte(len(s) >> 8), byte(len(s))}, s...)
+}
+
+// mqttPacket returns the packet of the type with the remaining length encoded in front of the body
+func mqttPacket(header byte, body []byte) []byte {
+	b := []byte{header}
+	n := len(body)
+	for {
+		e := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			e |= 128
+		}
+		b = append(b, e)
+		if n == 0 {
+			break
+		}
+	}
+	return append(b, body...)
+}
+
+// mqttConnect returns an MQTT 3.1.1 CONNECT packet with a clean session
+func mqttConnect(id string, user string, password string) []byte {
+	flags := byte(0x02)
+	if user != "" {
+		flags |= 0x80
+		if password != "" {
+			flags |= 0x40
+		}
+	}
+	b := append(mqttString("MQTT"), 4, flags, 0, 60)
+	b = append(b, mqttString(id)...)
+	if user != "" {
+		b = append(b, mqttString(user)...)
+		if password != "" {
+			b = append(b, mqttString(password)...)
+		}
+	}
+	return mqttPacket(0x10, b)
+}
+
+// mqttPublish returns a PUBLISH packet with quality of service 0
+func mqttPublish(topic string, payload []byte, retain bool) []byte {
+	h := byte(0x30)
+	if retain {
+		h |= 0x01
+	}
+	return mqttPacket(h, append(mqttString(topic), payload...))
+}
+
+// mqttReadConnAck reads the broker's CONNACK and returns an error if the connection was refused
+func mqttReadConnAck(r io.Reader) error {
+	b := make([]byte, 4)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return err
+	}
+	if b[0] != 0x20 || b[1] != 2 {
+		return errors.New("Unexpected response from the MQTT broker")
+	}
+	switch b[3] {
+	case 0:
+		return nil
+	case 4, 5:
+		return errors.New("The MQTT broker refused the user name or password")
+	}
+	return fmt.Errorf("The MQTT broker refused the connection, return code %d", b[3])
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// mqttBroker is an in-process MQTT broker that accepts connections and records the messages published to it
+type mqttBroker struct {
+	Username string // User name and password clients must connect with, if set
+	Password string
+	ln       net.Listener
+	retained map[string][]byte
+	connects int
+	closed   chan struct{}
+	lock     sync.Mutex
+}
+
+func newMQTTBroker(t *testing.T) *mqttBroker {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &mqttBroker{ln: ln, retained: map[string][]byte{}, closed: make(chan struct{}, 10)}
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(c)
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return b
+}
+
+func (b *mqttBroker) Addr() string {
+	return b.ln.Addr().String()
+}
+
+// Message returns the retained message of the topic
+func (b *mqttBroker) Message(topic string) []byte {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.retained[topic]
+}
+
+// Topics returns the topics that have a retained message and start with the prefix
+func (b *mqttBroker) Topics(prefix string) []string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	ts := []string{}
+	for t := range b.retained {
+		if strings.HasPrefix(t, prefix) {
+			ts = append(ts, t)
+		}
+	}
+	return ts
+}
+
+// WaitFor waits for the number of connections to be closed
+func (b *mqttBroker) WaitFor(n int) {
+	for i := 0; i < n; i++ {
+		<-b.closed
+	}
+}
+
+func (b *mqttBroker) serve(c net.Conn) {
+	defer func() { b.closed <- struct{}{} }()
+	defer c.Close()
+	r := bufio.NewReader(c)
+	for {
+		h, body, err := readMQTTPacket(r)
+		if err != nil {
+			return
+		}
+		switch h >> 4 {
+		case 1: // CONNECT
+			code := byte(0)
+			if b.Username != "" && !mqttHasCredentials(body, b.Username, b.Password) {
+				code = 5
+			}
+			b.lock.Lock()
+			b.connects++
+			b.lock.Unlock()
+			c.Write([]byte{0x20, 2, 0, code})
+			if code != 0 {
+				return
+			}
+		case 3: // PUBLISH
+			n := int(body[0])<<8 | int(body[1])
+			if h&0x01 != 0 {
+				b.lock.Lock()
+				b.retained[string(body[2:2+n])] = body[2+n:]
+				b.lock.Unlock()
+			}
+		case 14: // DISCONNECT
+			return
+		}
+	}
+}
+
+func readMQTTPacket(r *bufio.Reader) (byte, []byte, error) {
+	h, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	n, m := 0, 1
+	for {
+		e, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		n += int(e&127) * m
+		m *= 128
+		if e&128 == 0 {
+			break
+		}
+	}
+	body := make([]byte, n)
+	_, err = io.ReadFull(r, body)
+	return h, body, err
+}
+
+// mqttHasCredentials checks the user name and password at the end of the CONNECT packet
+func mqttHasCredentials(body []byte, user string, password string) bool {
+	return strings.HasSuffix(string(body), string(append(mqttString(user), mqttString(password)...)))
+}
+
+func TestMQTTPacketLengthIsEncoded(t *testing.T) {
+	p := mqttPublish("weather/forecast", make([]byte, 300), true)
+	// 2 bytes of topic length, 16 of topic and 300 of payload take 2 bytes to encode
+	if p[0] != 0x31 || p[1] != 0xBE || p[2] != 0x02 || len(p) != 321 {
+		t.Error("Unexpected packet header", p[:3], len(p))
+	}
+}
+
+func TestWeatherIsPublishedToMQTT(t *testing.T) {
+	b := newMQTTBroker(t)
+	b.Username, b.Password = "weather", "s3cret"
+	cfg := &Config{LocationName: "Cape Town", MQTT: MQTTConfig{Broker: b.Addr(), Username: "weather", Password: "s3cret", Prefix: "home/weather", Discovery: true}}
+	p := NewMQTTPublisher(cfg)
+
+	p.PublishWeather(cfg, Weather{Provider: "OpenMeteo", Temp: 21, WindSpeed: 5, WeatherIcon: 1, Units: SIUnits})
+	p.PublishForecast(cfg, Forecast{Forecast: []ForecastDay{{TempMin: 10, TempMax: 18, WeatherIcon: 6}}, Units: SIUnits})
+	p.Wait()
+	b.WaitFor(2)
+
+	w := Weather{}
+	if err := json.Unmarshal(b.Message("home/weather/current"), &w); err != nil || w.Temp != 21 || w.WindSpeed != 18 || w.Units.WindSpeed != "km/h" {
+		t.Error("Expected the weather in the configured units", string(b.Message("home/weather/current")), err)
+	}
+	if c := string(b.Message("home/weather/condition")); c != "clear-night" {
+		t.Error("Expected a clear night, got", c)
+	}
+	hs := []haForecast{}
+	if err := json.Unmarshal(b.Message("home/weather/haforecast"), &hs); err != nil || len(hs) != 1 || hs[0].Temperature != 18 || hs[0].TempLow != 10 || hs[0].Condition != "rainy" {
+		t.Error("Unexpected Home Assistant forecast", string(b.Message("home/weather/haforecast")), err)
+	}
+	ds := []ForecastDay{}
+	if err := json.Unmarshal(b.Message("home/weather/forecast"), &ds); err != nil || len(ds) != 1 || ds[0].TempMax != 18 {
+		t.Error("Unexpected forecast", string(b.Message("home/weather/forecast")), err)
+	}
+	m := Moon{}
+	if err := json.Unmarshal(b.Message("home/weather/moon"), &m); err != nil || m.PhaseName == "" {
+		t.Error("Unexpected moon", string(b.Message("home/weather/moon")), err)
+	}
+
+	// The discovery messages are only published on the first connection
+	if ts := b.Topics("homeassistant/sensor/home_weather/"); len(ts) != 13 {
+		t.Error("Expected 13 sensors to be discovered, got", len(ts), ts)
+	}
+	c := map[string]interface{}{}
+	json.Unmarshal(b.Message("homeassistant/sensor/home_weather/temp/config"), &c)
+	if c["state_topic"] != "home/weather/current" || c["unit_of_measurement"] != "°C" || c["device_class"] != "temperature" || c["unique_id"] != "home_weather_temp" || c["object_id"] != "home_weather_temp" {
+		t.Error("Unexpected temperature sensor", c)
+	}
+	if p.discovered[""] != cfg.MQTT || b.connects != 2 {
+		t.Error("Expected the publisher to connect once per refresh", b.connects)
+	}
+}
+
+func TestNamedLocationIsPublishedToMQTT(t *testing.T) {
+	b := newMQTTBroker(t)
+	cfg := newLocationsConfig()
+	cfg.MQTT = MQTTConfig{Broker: b.Addr(), Discovery: true}
+	p := NewMQTTPublisher(cfg)
+	k, _ := cfg.ForLocation("kyiv")
+
+	p.PublishWeather(cfg, Weather{Temp: 21, Units: SIUnits})
+	p.PublishWeather(k, Weather{Temp: 5, Units: SIUnits})
+	p.Wait()
+	b.WaitFor(2)
+
+	// The location is published under its own topics in its own units, as a device of its own
+	w := Weather{}
+	if err := json.Unmarshal(b.Message("weather/kyiv/current"), &w); err != nil || w.Temp != 41 || w.Units.Temp != "F" {
+		t.Error("Expected the weather of the location in its units", string(b.Message("weather/kyiv/current")), err)
+	}
+	if err := json.Unmarshal(b.Message("weather/current"), &w); err != nil || w.Temp != 21 {
+		t.Error("Expected the configured location to keep its topics", string(b.Message("weather/current")), err)
+	}
+	c := map[string]interface{}{}
+	json.Unmarshal(b.Message("homeassistant/sensor/weather_kyiv/temp/config"), &c)
+	if c["state_topic"] != "weather/kyiv/current" || c["unique_id"] != "weather_kyiv_temp" || c["unit_of_measurement"] != "°F" {
+		t.Error("Unexpected temperature sensor of the location", c)
+	}
+	if d, _ := c["device"].(map[string]interface{}); d["name"] != "Weather Kyiv" {
+		t.Error("Expected a device for the location", c["device"])
+	}
+	if len(b.Topics("homeassistant/sensor/weather/")) != 13 || len(p.discovered) != 2 {
+		t.Error("Expected both locations to be discovered", p.discovered)
+	}
+}
+
+func TestMQTTClientIDIsUnique(t *testing.T) {
+	p := NewMQTTPublisher(&Config{MQTT: MQTTConfig{Prefix: "home/weather"}})
+	h, _ := os.Hostname()
+	if id := p.getClientID(); id != "weather-"+h+"-home_weather" {
+		t.Error("Expected the client identifier to include the host and prefix, got", id)
+	}
+	p.Config.MQTT.ClientID = "station"
+	if id := p.getClientID(); id != "station" {
+		t.Error("Expected the configured client identifier, got", id)
+	}
+}
+
+func TestMQTTRejectedCredentials(t *testing.T) {
+	b := newMQTTBroker(t)
+	b.Username, b.Password = "weather", "s3cret"
+	p := NewMQTTPublisher(&Config{MQTT: MQTTConfig{Broker: b.Addr(), Username: "weather", Password: "wrong", Discovery: true}})
+
+	if err := p.send([]mqttMessage{{"weather/current", []byte("{}")}}); err == nil || !strings.Contains(err.Error(), "user name or password") {
+		t.Error("Expected the credentials to be refused", err)
+	}
+	p.PublishWeather(p.Config, Weather{Units: SIUnits})
+	p.Wait()
+	b.WaitFor(2)
+	if p.discovered[""].Discovery || len(b.Topics("")) != 0 {
+		t.Error("Expected nothing to be published")
+	}
+}
+
+func TestMQTTIsOffWithoutABroker(t *testing.T) {
+	p := NewMQTTPublisher(&Config{})
+	p.PublishWeather(p.Config, Weather{Units: SIUnits})
+	p.Wait()
+	if p.IsEnabled() {
+		t.Error("Expected publishing to be off")
+	}
+}
@@ -0,0 +1,462 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NWS is an interface to the US National Weather Service (api.weather.gov) internet API.
+// The NWS does not require an application ID, but only covers the United States.
+type NWS struct {
+	Config *Config // Current Configuration
+	office string  // Forecast office for the location
+	gridX  int     // Forecast grid X coordinate
+	gridY  int     // Forecast grid Y coordinate
+	statn  string  // Observation station identifier
+}
+
+func init() {
+	RegisterProvider(ProviderInfo{
+		Name:          "NWS",
+		Description:   "US National Weather Service",
+		AppIDOptional: true,
+		New:           func() WeatherProvider { return new(NWS) },
+	})
+}
+
+var nwsURL = "https://api.weather.gov"
+
+type nwsValue struct {
+	UnitCode string   `json:"unitCode"`
+	Value    *float64 `json:"value"`
+}
+
+type nwsPointResponse struct {
+	Properties struct {
+		GridID   string `json:"gridId"`
+		GridX    int    `json:"gridX"`
+		GridY    int    `json:"gridY"`
+		TimeZone string `json:"timeZone"`
+	} `json:"properties"`
+}
+
+type nwsStationsResponse struct {
+	Features []struct {
+		Properties struct {
+			StationIdentifier string `json:"stationIdentifier"`
+			Name              string `json:"name"`
+		} `json:"properties"`
+	} `json:"features"`
+}
+
+type nwsObservationResponse struct {
+	Properties struct {
+		Timestamp          time.Time `json:"timestamp"`
+		TextDescription    string    `json:"textDescription"`
+		Icon               string    `json:"icon"`
+		Temperature        nwsValue  `json:"temperature"`
+		WindDirection      nwsValue  `json:"windDirection"`
+		WindSpeed          nwsValue  `json:"windSpeed"`
+		BarometricPressure nwsValue  `json:"barometricPressure"`
+		SeaLevelPressure   nwsValue  `json:"seaLevelPressure"`
+		RelativeHumidity   nwsValue  `json:"relativeHumidity"`
+	} `json:"properties"`
+}
+
+type nwsForecastResponse struct {
+	Properties struct {
+		Periods []struct {
+			Number           int       `json:"number"`
+			Name             string    `json:"name"`
+			StartTime        time.Time `json:"startTime"`
+			IsDaytime        bool      `json:"isDaytime"`
+			Temperature      float32   `json:"temperature"`
+			TemperatureUnit  string    `json:"temperatureUnit"`
+			Icon             string    `json:"icon"`
+			ShortForecast    string    `json:"shortForecast"`
+			DetailedForecast string    `json:"detailedForecast"`
+		} `json:"periods"`
+	} `json:"properties"`
+}
+
+type nwsAlertsResponse struct {
+	Features []struct {
+		Properties struct {
+			ID          string     `json:"id"`
+			AreaDesc    string     `json:"areaDesc"`
+			Onset       *time.Time `json:"onset"`
+			Effective   *time.Time `json:"effective"`
+			Expires     *time.Time `json:"expires"`
+			Ends        *time.Time `json:"ends"`
+			Status      string     `json:"status"`
+			MessageType string     `json:"messageType"`
+			Severity    string     `json:"severity"`
+			Event       string     `json:"event"`
+			SenderName  string     `json:"senderName"`
+			Description string     `json:"description"`
+		} `json:"properties"`
+	} `json:"features"`
+}
+
+type nwsErrorResponse struct {
+	Title  string `json:"title"`
+	Detail string `json:"detail"`
+}
+
+// SetConfig sets the configuration for the provider
+func (p *NWS) SetConfig(c *Config) {
+	p.Config = c
+}
+
+// GetProviderName returns the name of the provider
+func (p *NWS) GetProviderName() string {
+	return "NWS"
+}
+
+// GetWeather returns the current weather for the location
+func (p *NWS) GetWeather() (Weather, error) {
+	w := Weather{
+		Provider: p.GetProviderName(),
+		Created:  time.Now(),
+	}
+	if err := p.checkConfig(); err != nil {
+		return w, err
+	}
+	w.ID = p.Config.GetLocationID(p.GetProviderName())
+	w.Name = p.Config.LocationName
+
+	r := nwsObservationResponse{}
+	err := p.get(fmt.Sprintf("%s/stations/%s/observations/latest", nwsURL, p.statn), &r)
+	if err == nil {
+		p.decodeWeather(&w, r)
+
+		// Load the sunrise and sunset times
+		if sr, ss, err := GetSunriseSunset(p.Config, time.Now()); err == nil {
+			w.Sunrise = sr
+			w.Sunset = ss
+		}
+	}
+	return w, err
+}
+
+// GetForecast returns the current forecast for the location
+func (p *NWS) GetForecast() (Forecast, error) {
+	f := Forecast{
+		Current: Weather{
+			Provider: p.GetProviderName(),
+			Created:  time.Now(),
+		},
+	}
+	if err := p.checkConfig(); err != nil {
+		return f, err
+	}
+
+	r := nwsForecastResponse{}
+	err := p.get(fmt.Sprintf("%s/gridpoints/%s/%d,%d/forecast?units=si", nwsURL, p.office, p.gridX, p.gridY), &r)
+	if err == nil {
+		p.decodeForecast(&f, r)
+
+		// Get the current weather as well
+		if w, err := p.GetWeather(); err == nil {
+			f.Current = w
+		}
+	}
+	return f, err
+}
+
+// GetAlerts returns the alerts in force for the location
+func (p *NWS) GetAlerts() ([]Alert, error) {
+	r := nwsAlertsResponse{}
+	err := p.get(fmt.Sprintf("%s/alerts/active?point=%.4f,%.4f", nwsURL, p.Config.Latitude, p.Config.Longitude), &r)
+	if err != nil {
+		return nil, err
+	}
+	as := []Alert{}
+	for _, f := range r.Features {
+		a := f.Properties
+		if !isActualAlert(a.Status, a.MessageType) {
+			continue
+		}
+		as = append(as, Alert{
+			ID:          a.ID,
+			Source:      p.GetProviderName(),
+			Sender:      a.SenderName,
+			Event:       a.Event,
+			Severity:    a.Severity,
+			Area:        a.AreaDesc,
+			Start:       nwsTime(a.Onset, a.Effective),
+			End:         nwsTime(a.Ends, a.Expires),
+			Description: a.Description,
+		})
+	}
+	return as, nil
+}
+
+func (p *NWS) decodeWeather(w *Weather, r nwsObservationResponse) {
+	o := r.Properties
+	w.ReadingTime = o.Timestamp
+	w.WeatherDesc = T(p.Config.Language, o.TextDescription)
+	w.WeatherIcon, w.IsDay = p.getWeatherIcon(o.Icon)
+	w.Temp = o.Temperature.value()
+	w.Humidity = o.RelativeHumidity.value()
+	w.WindDirection = o.WindDirection.value()
+	w.WindSpeed = p.getWindSpeed(o.WindSpeed.value())
+	pr := o.SeaLevelPressure
+	if pr.Value == nil {
+		pr = o.BarometricPressure
+	}
+	w.Pressure = p.getPressure(pr.value())
+}
+
+func (p *NWS) decodeForecast(f *Forecast, r nwsForecastResponse) {
+	// The forecast is split into day time and night time periods, collapse these into days
+	cf := ForecastDay{}
+	hasMin, hasMax := []bool{}, []bool{}
+	for _, i := range r.Properties.Periods {
+		ct := i.StartTime
+		iDay := time.Date(ct.Year(), ct.Month(), ct.Day(), 0, 0, 0, 0, ct.Location())
+		// Overnight periods belong to the day on which they started
+		if !i.IsDaytime && ct.Hour() < 6 {
+			iDay = iDay.AddDate(0, 0, -1)
+		}
+		temp := float32(i.Temperature)
+		if i.TemperatureUnit == "F" {
+			temp = fahrenheitToCelsius(temp)
+		}
+		wi, _ := p.getWeatherIcon(i.Icon)
+
+		if cf.Name != "" && !iDay.Equal(cf.Day) {
+			// Date has changed
+			f.Forecast = append(f.Forecast, cf)
+			cf = ForecastDay{}
+		}
+		if cf.Name == "" {
+			hasMin, hasMax = append(hasMin, false), append(hasMax, false)
+			cf.Day = iDay
+			cf.Name = DayName(iDay, p.Config.Language)
+			cf.WeatherIcon = wi
+			cf.WeatherDesc = T(p.Config.Language, i.ShortForecast)
+			cf.Detail = i.Name + ": " + i.DetailedForecast
+		} else {
+			cf.Detail = cf.Detail + " " + i.Name + ": " + i.DetailedForecast
+			if wi > cf.WeatherIcon {
+				cf.WeatherIcon = wi
+				cf.WeatherDesc = T(p.Config.Language, i.ShortForecast)
+			}
+		}
+		// The day time period has the high and the night time period the low
+		if i.IsDaytime {
+			cf.TempMax = temp
+			hasMax[len(hasMax)-1] = true
+		} else {
+			cf.TempMin = temp
+			hasMin[len(hasMin)-1] = true
+		}
+	}
+	if cf.Name != "" {
+		f.Forecast = append(f.Forecast, cf)
+	}
+	p.fillMissingTemps(f.Forecast, hasMin, hasMax)
+}
+
+// fillMissingTemps fills in the high of a day that starts at night, as the first day does each evening,
+// and the low of a day that ends before its night, so that they are not taken to be 0°. The high is taken
+// from the next day and the low from the previous day, or the other way round at the ends of the forecast,
+// without crossing the temperature the day does have.
+func (p *NWS) fillMissingTemps(ds []ForecastDay, hasMin []bool, hasMax []bool) {
+	for i := range ds {
+		d := &ds[i]
+		if !hasMax[i] {
+			d.TempMax = d.TempMin
+			if i+1 < len(ds) && hasMax[i+1] {
+				d.TempMax = float32(math.Max(float64(d.TempMin), float64(ds[i+1].TempMax)))
+			} else if i > 0 && hasMax[i-1] {
+				d.TempMax = float32(math.Max(float64(d.TempMin), float64(ds[i-1].TempMax)))
+			}
+		}
+		if !hasMin[i] {
+			d.TempMin = d.TempMax
+			if i > 0 && hasMin[i-1] {
+				d.TempMin = float32(math.Min(float64(d.TempMax), float64(ds[i-1].TempMin)))
+			} else if i+1 < len(ds) && hasMin[i+1] {
+				d.TempMin = float32(math.Min(float64(d.TempMax), float64(ds[i+1].TempMin)))
+			}
+		}
+	}
+}
+
+// checkConfig resolves the location to a forecast gridpoint and an observation station.
+// These are cached in the configuration location ID as office/x,y/station.
+func (p *NWS) checkConfig() error {
+	if p.parseLocationID(p.Config.GetLocationID(p.GetProviderName())) {
+		return nil
+	}
+
+	pr := nwsPointResponse{}
+	if err := p.get(fmt.Sprintf("%s/points/%.4f,%.4f", nwsURL, p.Config.Latitude, p.Config.Longitude), &pr); err != nil {
+		return errors.New("Error getting NWS gridpoint information. " + err.Error())
+	}
+	sr := nwsStationsResponse{}
+	if err := p.get(fmt.Sprintf("%s/gridpoints/%s/%d,%d/stations", nwsURL, pr.Properties.GridID, pr.Properties.GridX, pr.Properties.GridY), &sr); err != nil {
+		return errors.New("Error getting NWS observation stations. " + err.Error())
+	}
+	if len(sr.Features) == 0 {
+		return errors.New("No NWS observation stations found for the location")
+	}
+	id := fmt.Sprintf("%s/%d,%d/%s", pr.Properties.GridID, pr.Properties.GridX, pr.Properties.GridY, sr.Features[0].Properties.StationIdentifier)
+	if !p.parseLocationID(id) {
+		return errors.New("Invalid NWS location " + id)
+	}
+	p.Config.SetLocationID(p.GetProviderName(), id)
+
+	p.Config.WriteToFile("config.json")
+	return nil
+}
+
+// parseLocationID loads the gridpoint and station from a location ID in the form office/x,y/station
+func (p *NWS) parseLocationID(id string) bool {
+	s := strings.Split(id, "/")
+	if len(s) != 3 || s[0] == "" || s[2] == "" {
+		return false
+	}
+	xy := strings.Split(s[1], ",")
+	if len(xy) != 2 {
+		return false
+	}
+	x, err := strconv.Atoi(xy[0])
+	if err != nil {
+		return false
+	}
+	y, err := strconv.Atoi(xy[1])
+	if err != nil {
+		return false
+	}
+	p.office, p.gridX, p.gridY, p.statn = s[0], x, y, s[2]
+	return true
+}
+
+// get calls the NWS API and deserializes the response into the provided value
+func (p *NWS) get(url string, v interface{}) error {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	// The NWS rejects requests that do not identify the client application
+	req.Header.Set("User-Agent", providerUserAgent)
+	req.Header.Set("Accept", "application/geo+json")
+	resp, err := http.DefaultClient.Do(req)
+	if resp != nil {
+		defer resp.Body.Close()
+		resp.Close = true
+	}
+	if err != nil {
+		return err
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		e := nwsErrorResponse{}
+		if json.Unmarshal(b, &e) == nil && e.Detail != "" {
+			return errors.New(e.Title + ". " + e.Detail)
+		}
+		return fmt.Errorf("NWS returned status %s", resp.Status)
+	}
+	return json.Unmarshal(b, v)
+}
+
+// nwsTime returns the first of the times that is set
+func nwsTime(ts ...*time.Time) time.Time {
+	for _, t := range ts {
+		if t != nil {
+			return *t
+		}
+	}
+	return time.Time{}
+}
+
+// value returns the value or zero if it is not available
+func (v nwsValue) value() float32 {
+	if v.Value == nil {
+		return 0
+	}
+	return float32(*v.Value)
+}
+
+func (p *NWS) getWindSpeed(v float32) float32 {
+	// km/h to m/s
+	return v / 3.6
+}
+
+func (p *NWS) getPressure(v float32) float32 {
+	// Pa to hPa
+	return v / 100
+}
+
+func (p *NWS) getWeatherIcon(i string) (int, bool) {
+	// Icon numbers:
+	// 1 = Clear sky			> skc, few, hot, cold
+	// 2 = Scattered clouds		> sct
+	// 3 = Partly cloudy		> bkn
+	// 4 = Cloudy				> ovc
+	// 5 = Scattered Rain		> rain_showers, rain_showers_hi
+	// 6 = Rain					> rain
+	// 7 = Thunderstorms		> tsra, tsra_sct, tsra_hi, tornado, hurricane, tropical_storm
+	// 8 = Snow					> snow, sleet, blizzard, fzra and mixes
+	// 9 = Mist/ Fog			> fog, haze, smoke, dust
+	// The icon URLs are in the form .../icons/land/{day|night}/{condition[,pop]}[/{condition[,pop]}]?size=...
+	// The most extreme of the conditions is used.
+	u, err := url.Parse(i)
+	if err != nil {
+		return 0, true
+	}
+	s := strings.Split(strings.Trim(u.Path, "/"), "/")
+	n := 0
+	for ; n < len(s); n++ {
+		if s[n] == "day" || s[n] == "night" {
+			break
+		}
+	}
+	if n >= len(s) {
+		return 0, true
+	}
+	isDay := s[n] == "day"
+	icon := 0
+	for _, c := range s[n+1:] {
+		c = strings.TrimPrefix(strings.Split(c, ",")[0], "wind_")
+		ci := 0
+		switch c {
+		case "skc", "few", "hot", "cold":
+			ci = 1
+		case "sct":
+			ci = 2
+		case "bkn":
+			ci = 3
+		case "ovc":
+			ci = 4
+		case "rain_showers", "rain_showers_hi":
+			ci = 5
+		case "rain":
+			ci = 6
+		case "tsra", "tsra_sct", "tsra_hi", "tornado", "hurricane", "tropical_storm":
+			ci = 7
+		case "snow", "rain_snow", "rain_sleet", "snow_sleet", "fzra", "rain_fzra", "snow_fzra", "sleet", "blizzard":
+			ci = 8
+		case "fog", "haze", "smoke", "dust":
+			ci = 9
+		}
+		if ci > icon {
+			icon = ci
+		}
+	}
+	return icon, isDay
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newNWSTestServer(t *testing.T) (*httptest.Server, *int) {
+	files := map[string]string{
+		"/points/39.0473,-95.6752":           "nws_points.json",
+		"/gridpoints/TOP/32,81/stations":     "nws_stations.json",
+		"/gridpoints/TOP/32,81/forecast":     "nws_forecast.json",
+		"/stations/KTOP/observations/latest": "nws_observation.json",
+		"/alerts/active":                     "nws_alerts.json",
+	}
+	data := map[string][]byte{}
+	for p, f := range files {
+		b, err := ioutil.ReadFile(filepath.Join("testdata", f))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data[p] = b
+	}
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.Header.Get("User-Agent") == "" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		b, ok := data[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"title":"Not Found","detail":"No data for ` + r.URL.Path + `"}`))
+			return
+		}
+		w.Write(b)
+	}))
+	return srv, &calls
+}
+
+func TestCanGetNWSForecast(t *testing.T) {
+	srv, calls := newNWSTestServer(t)
+	defer srv.Close()
+	ou := nwsURL
+	nwsURL = srv.URL
+	defer func() { nwsURL = ou }()
+
+	// The resolved location is written to the configuration file
+	chdirTemp(t)
+
+	c := Config{Latitude: 39.0473, Longitude: -95.6752, LocationName: "Topeka"}
+	p := NWS{Config: &c}
+	f, err := p.GetForecast()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := c.GetLocationID("NWS"); id != "TOP/32,81/KTOP" {
+		t.Error("Unexpected location ID", id)
+	}
+
+	w := f.Current
+	if w.Temp != 17.2 || w.Humidity != 60.31 || w.WindDirection != 170 {
+		t.Error("Current conditions were not decoded", w)
+	}
+	if w.Pressure != 1015.2 {
+		t.Error("Barometric pressure was not used when sea level pressure is missing", w.Pressure)
+	}
+	if w.WeatherIcon != 2 || !w.IsDay || w.WeatherDesc != "Partly Cloudy" {
+		t.Error("Current weather icon was not mapped", w.WeatherIcon, w.IsDay, w.WeatherDesc)
+	}
+
+	if len(f.Forecast) != 3 {
+		t.Fatal("Expected 3 forecast days, got", len(f.Forecast))
+	}
+	d := f.Forecast[0]
+	if d.TempMax != 24 || d.TempMin != 14 || d.WeatherIcon != 7 || d.Name != "Saturday" {
+		t.Error("Unexpected forecast for the first day", d)
+	}
+	if d.Detail == "" {
+		t.Error("The detailed forecast text was not returned")
+	}
+	d = f.Forecast[1]
+	if d.TempMax != 19 || d.TempMin != 6 || d.WeatherIcon != 5 {
+		t.Error("Unexpected forecast for the second day", d)
+	}
+
+	// The gridpoint and station are cached in the location ID
+	n := *calls
+	if _, err := p.GetWeather(); err != nil {
+		t.Fatal(err)
+	}
+	if *calls != n+1 {
+		t.Error("Expected a single call once the location was resolved, got", *calls-n)
+	}
+}
+
+func TestNWSForecastStartingAtNight(t *testing.T) {
+	r := nwsForecastResponse{}
+	err := json.Unmarshal([]byte(`{"properties":{"periods":[
+		{"name":"Tonight","startTime":"2025-10-18T18:00:00-05:00","isDaytime":false,"temperature":50,"temperatureUnit":"F"},
+		{"name":"Sunday","startTime":"2025-10-19T06:00:00-05:00","isDaytime":true,"temperature":77,"temperatureUnit":"F"},
+		{"name":"Sunday Night","startTime":"2025-10-19T18:00:00-05:00","isDaytime":false,"temperature":59,"temperatureUnit":"F"}]}}`), &r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NWS{Config: &Config{}}
+	f := Forecast{}
+	p.decodeForecast(&f, r)
+	if len(f.Forecast) != 2 {
+		t.Fatal("Expected 2 forecast days, got", len(f.Forecast))
+	}
+	// The overnight low is not the high of the day, which is taken from the next day rather than left at 0
+	if d := f.Forecast[0]; d.TempMin != 10 || d.TempMax != 25 {
+		t.Error("Unexpected temperatures for the night only day", d.TempMin, d.TempMax)
+	}
+	if d := f.Forecast[1]; d.TempMin != 15 || d.TempMax != 25 {
+		t.Error("Unexpected temperatures for the second day", d.TempMin, d.TempMax)
+	}
+}
+
+func TestNWSForecastEndingInTheDay(t *testing.T) {
+	r := nwsForecastResponse{}
+	err := json.Unmarshal([]byte(`{"properties":{"periods":[
+		{"name":"Today","startTime":"2025-10-18T06:00:00-05:00","isDaytime":true,"temperature":77,"temperatureUnit":"F"},
+		{"name":"Tonight","startTime":"2025-10-18T18:00:00-05:00","isDaytime":false,"temperature":59,"temperatureUnit":"F"},
+		{"name":"Sunday","startTime":"2025-10-19T06:00:00-05:00","isDaytime":true,"temperature":50,"temperatureUnit":"F"}]}}`), &r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NWS{Config: &Config{}}
+	f := Forecast{}
+	p.decodeForecast(&f, r)
+	if len(f.Forecast) != 2 {
+		t.Fatal("Expected 2 forecast days, got", len(f.Forecast))
+	}
+	// The low of the last day is taken from the previous night, but is not above the high of the day
+	if d := f.Forecast[1]; d.TempMin != 10 || d.TempMax != 10 {
+		t.Error("Unexpected temperatures for the day only day", d.TempMin, d.TempMax)
+	}
+}
+
+func TestNWSIcons(t *testing.T) {
+	p := NWS{}
+	tests := []struct {
+		u     string
+		i     int
+		isDay bool
+	}{
+		{"https://api.weather.gov/icons/land/day/skc?size=medium", 1, true},
+		{"https://api.weather.gov/icons/land/night/wind_bkn?size=medium", 3, false},
+		{"https://api.weather.gov/icons/land/day/rain_showers,40/ovc?size=medium", 5, true},
+		{"https://api.weather.gov/icons/land/night/rain,70?size=small", 6, false},
+		{"https://api.weather.gov/icons/land/day/sct/tsra_hi,30?size=medium", 7, true},
+		{"https://api.weather.gov/icons/land/day/blizzard?size=medium", 8, true},
+		{"https://api.weather.gov/icons/land/day/fog?size=medium", 9, true},
+		{"", 0, true},
+	}
+	for _, e := range tests {
+		if i, isDay := p.getWeatherIcon(e.u); i != e.i || isDay != e.isDay {
+			t.Error("Icon", e.u, "mapped to", i, isDay)
+		}
+	}
+}
+
+func TestCanGetNWSAlerts(t *testing.T) {
+	srv, _ := newNWSTestServer(t)
+	defer srv.Close()
+	ou := nwsURL
+	nwsURL = srv.URL
+	defer func() { nwsURL = ou }()
+
+	p := NWS{Config: &Config{Latitude: 39.0473, Longitude: -95.6752}}
+	as, err := p.GetAlerts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The cancellation is not an alert in force
+	if len(as) != 2 {
+		t.Fatal("Expected 2 alerts, got", len(as))
+	}
+	a := as[0]
+	if a.ID != "urn:oid:2.49.0.1.840.0.7c1e4d3e5f.001.1" || a.Source != "NWS" || a.Event != "Tornado Warning" || a.Severity != "Extreme" || a.Area != "Shawnee; Jackson; Jefferson" {
+		t.Error("Unexpected alert", a)
+	}
+	if a.End.Unix() != time.Date(2024, 6, 1, 20, 0, 0, 0, time.UTC).Unix() {
+		t.Error("Expected the alert to end at 3PM CDT, got", a.End)
+	}
+	// The onset is not known, so the alert starts when it is effective
+	if as[1].Start.Unix() != time.Date(2024, 6, 1, 18, 0, 0, 0, time.UTC).Unix() {
+		t.Error("Expected the advisory to start when it is effective, got", as[1].Start)
+	}
+}
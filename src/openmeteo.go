@@ -0,0 +1,334 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// OpenMeteo is an interface to the Open-Meteo internet API.
+// Open-Meteo does not require an application ID.
+type OpenMeteo struct {
+	Config *Config // Current Configuration
+}
+
+func init() {
+	RegisterProvider(ProviderInfo{
+		Name:          "OpenMeteo",
+		Description:   "Open-Meteo",
+		AppIDOptional: true,
+		New:           func() WeatherProvider { return new(OpenMeteo) },
+	})
+}
+
+// omURL is the address of the Open-Meteo API
+var omURL = "https://api.open-meteo.com"
+
+type omForecastResponse struct {
+	Error            bool    `json:"error"`
+	Reason           string  `json:"reason"`
+	Latitude         float32 `json:"latitude"`
+	Longitude        float32 `json:"longitude"`
+	UtcOffsetSeconds int     `json:"utc_offset_seconds"`
+	Timezone         string  `json:"timezone"`
+	Current          struct {
+		Time             int64   `json:"time"`
+		Temperature      float32 `json:"temperature_2m"`
+		RelativeHumidity float32 `json:"relative_humidity_2m"`
+		IsDay            int     `json:"is_day"`
+		WeatherCode      int     `json:"weather_code"`
+		PressureMsl      float32 `json:"pressure_msl"`
+		WindSpeed        float32 `json:"wind_speed_10m"`
+		WindDirection    float32 `json:"wind_direction_10m"`
+	} `json:"current"`
+	Hourly struct {
+		Time        []int64   `json:"time"`
+		Temperature []float32 `json:"temperature_2m"`
+		WeatherCode []int     `json:"weather_code"`
+		IsDay       []int     `json:"is_day"`
+		Humidity    []float32 `json:"relative_humidity_2m"`
+		PrecipProb  []float32 `json:"precipitation_probability"`
+		Precip      []float32 `json:"precipitation"`
+		WindSpeed   []float32 `json:"wind_speed_10m"`
+		WindDir     []float32 `json:"wind_direction_10m"`
+	} `json:"hourly"`
+	Daily struct {
+		Time           []int64   `json:"time"`
+		WeatherCode    []int     `json:"weather_code"`
+		TemperatureMax []float32 `json:"temperature_2m_max"`
+		TemperatureMin []float32 `json:"temperature_2m_min"`
+		Sunrise        []int64   `json:"sunrise"`
+		Sunset         []int64   `json:"sunset"`
+		PrecipProb     []float32 `json:"precipitation_probability_max"`
+		Precip         []float32 `json:"precipitation_sum"`
+		Rain           []float32 `json:"rain_sum"`
+		Showers        []float32 `json:"showers_sum"`
+		WindSpeed      []float32 `json:"wind_speed_10m_max"`
+		WindGust       []float32 `json:"wind_gusts_10m_max"`
+		Humidity       []float32 `json:"relative_humidity_2m_mean"`
+		UVIndex        []float32 `json:"uv_index_max"`
+	} `json:"daily"`
+}
+
+// SetConfig sets the configuration for the provider
+func (p *OpenMeteo) SetConfig(c *Config) {
+	p.Config = c
+}
+
+// GetProviderName returns the name of the provider
+func (p *OpenMeteo) GetProviderName() string {
+	return "OpenMeteo"
+}
+
+// GetWeather returns the current weather for the location
+func (p *OpenMeteo) GetWeather() (Weather, error) {
+	f, err := p.GetForecast()
+	return f.Current, err
+}
+
+// GetForecast returns the current forecast for the location
+func (p *OpenMeteo) GetForecast() (Forecast, error) {
+	f := Forecast{
+		Current: Weather{
+			Provider: p.GetProviderName(),
+			Created:  time.Now(),
+			ID:       fmt.Sprintf("%.4f,%.4f", p.Config.Latitude, p.Config.Longitude),
+			Name:     p.Config.LocationName,
+		},
+	}
+
+	resp, err := http.Get(p.getURL())
+	if resp != nil {
+		defer resp.Body.Close()
+		resp.Close = true
+	}
+	if err == nil {
+		err = p.decodeForecast(&f, resp.Body)
+	}
+	return f, err
+}
+
+func (p *OpenMeteo) getURL() string {
+	url := fmt.Sprintf("%s/v1/forecast?latitude=%f&longitude=%f&timezone=auto&timeformat=unixtime", omURL, p.Config.Latitude, p.Config.Longitude) +
+		"&current=temperature_2m,relative_humidity_2m,is_day,weather_code,pressure_msl,wind_speed_10m,wind_direction_10m" +
+		"&hourly=temperature_2m,relative_humidity_2m,weather_code,is_day,precipitation_probability,precipitation,wind_speed_10m,wind_direction_10m" +
+		"&daily=weather_code,temperature_2m_max,temperature_2m_min,sunrise,sunset,precipitation_probability_max,precipitation_sum,rain_sum,showers_sum" +
+		",wind_speed_10m_max,wind_gusts_10m_max,relative_humidity_2m_mean,uv_index_max" +
+		"&wind_speed_unit=ms"
+	return url
+}
+
+func (p *OpenMeteo) decodeForecast(f *Forecast, r io.Reader) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil || len(b) == 0 {
+		return err
+	}
+	var resp = omForecastResponse{}
+	if err := json.Unmarshal(b, &resp); err != nil {
+		return err
+	}
+	if resp.Error {
+		return errors.New("Open-Meteo error. " + resp.Reason)
+	}
+
+	// The daily times are midnight in the location
+	loc := p.Config.GetTimeZone()
+
+	// Current weather
+	cw := resp.Current
+	f.Current.Temp = cw.Temperature
+	f.Current.Humidity = cw.RelativeHumidity
+	f.Current.Pressure = cw.PressureMsl
+	f.Current.WindSpeed = cw.WindSpeed
+	f.Current.WindDirection = cw.WindDirection
+	f.Current.IsDay = cw.IsDay != 0
+	f.Current.ReadingTime = time.Unix(cw.Time, 0).In(loc)
+	f.Current.WeatherIcon, f.Current.WeatherDesc = p.getWeatherIconInfo(cw.WeatherCode)
+	f.Current.WeatherDesc = T(p.Config.Language, f.Current.WeatherDesc)
+
+	// Hourly forecast
+	h := resp.Hourly
+	for n, t := range h.Time {
+		if n >= len(h.Temperature) || n >= len(h.WeatherCode) {
+			break
+		}
+		fh := ForecastHour{
+			Time:   time.Unix(t, 0).In(loc),
+			Period: 1,
+			Temp:   h.Temperature[n],
+			IsDay:  n >= len(h.IsDay) || h.IsDay[n] != 0,
+		}
+		if n < len(h.Humidity) {
+			fh.Humidity = h.Humidity[n]
+		}
+		if n < len(h.PrecipProb) {
+			fh.PrecipProb = h.PrecipProb[n]
+		}
+		if n < len(h.Precip) {
+			fh.Precip = h.Precip[n]
+		}
+		if n < len(h.WindSpeed) && n < len(h.WindDir) {
+			fh.WindSpeed = h.WindSpeed[n]
+			fh.WindDirection = h.WindDir[n]
+		}
+		fh.WeatherIcon, fh.WeatherDesc = p.getWeatherIconInfo(h.WeatherCode[n])
+		fh.WeatherDesc = T(p.Config.Language, fh.WeatherDesc)
+		f.Hourly = append(f.Hourly, fh)
+	}
+	// The precipitation of an hour is that of the hour before its time, so the hour in progress is the first one after the reading
+	for _, fh := range f.Hourly {
+		if !fh.Time.Before(f.Current.ReadingTime) {
+			f.Current.Precip = fh.Precip
+			break
+		}
+	}
+
+	// Daily forecast
+	d := resp.Daily
+	for n, t := range d.Time {
+		if n >= len(d.TemperatureMin) || n >= len(d.TemperatureMax) || n >= len(d.WeatherCode) {
+			break
+		}
+		day := time.Unix(t, 0).In(loc)
+		fd := ForecastDay{
+			Day:     day,
+			Name:    DayName(day, p.Config.Language),
+			TempMin: d.TemperatureMin[n],
+			TempMax: d.TemperatureMax[n],
+		}
+		fd.WeatherIcon, fd.WeatherDesc = p.getWeatherIconInfo(d.WeatherCode[n])
+		fd.WeatherDesc = T(p.Config.Language, fd.WeatherDesc)
+		if n < len(d.Sunrise) && n < len(d.Sunset) {
+			fd.Sunrise = time.Unix(d.Sunrise[n], 0).In(loc)
+			fd.Sunset = time.Unix(d.Sunset[n], 0).In(loc)
+		}
+		if n < len(d.PrecipProb) {
+			fd.PrecipProb = d.PrecipProb[n]
+		}
+		if n < len(d.Precip) && n < len(d.Rain) && n < len(d.Showers) {
+			// The rest of the precipitation is snow
+			fd.Precip = d.Precip[n]
+			fd.Rain = d.Rain[n] + d.Showers[n]
+			fd.Snow = fd.Precip - fd.Rain
+		}
+		if n < len(d.WindSpeed) && n < len(d.WindGust) {
+			fd.WindSpeed = d.WindSpeed[n]
+			fd.WindGust = d.WindGust[n]
+		}
+		if n < len(d.Humidity) {
+			fd.Humidity = d.Humidity[n]
+		}
+		if n < len(d.UVIndex) {
+			fd.UVIndex = d.UVIndex[n]
+		}
+		f.Forecast = append(f.Forecast, fd)
+	}
+	if len(d.Sunrise) != 0 && len(d.Sunset) != 0 {
+		f.Current.Sunrise = time.Unix(d.Sunrise[0], 0).In(loc)
+		f.Current.Sunset = time.Unix(d.Sunset[0], 0).In(loc)
+	}
+	return nil
+}
+
+func (p *OpenMeteo) getWeatherIconInfo(i int) (int, string) {
+	// Icon numbers:
+	// 1 = Clear sky			> 0
+	// 2 = Scattered clouds		> 1
+	// 3 = Partly cloudy		> 2
+	// 4 = Cloudy				> 3
+	// 5 = Scattered Rain		> 51-57, 80-82
+	// 6 = Rain					> 61-67
+	// 7 = Thunderstorms		> 95-99
+	// 8 = Snow					> 71-77, 85, 86
+	// 9 = Mist/ Fog			> 45, 48
+	switch i {
+	case 0:
+		return 1, "Clear Sky"
+	case 1:
+		return 2, "Mainly Clear"
+	case 2:
+		return 3, "Partly Cloudy"
+	case 3:
+		return 4, "Overcast"
+	case 45:
+		return 9, "Fog"
+	case 48:
+		return 9, "Depositing Rime Fog"
+	case 51:
+		return 5, "Light Drizzle"
+	case 53:
+		return 5, "Moderate Drizzle"
+	case 55:
+		return 5, "Dense Drizzle"
+	case 56:
+		return 5, "Light Freezing Drizzle"
+	case 57:
+		return 5, "Dense Freezing Drizzle"
+	case 61:
+		return 6, "Slight Rain"
+	case 63:
+		return 6, "Moderate Rain"
+	case 65:
+		return 6, "Heavy Rain"
+	case 66:
+		return 6, "Light Freezing Rain"
+	case 67:
+		return 6, "Heavy Freezing Rain"
+	case 71:
+		return 8, "Slight Snow Fall"
+	case 73:
+		return 8, "Moderate Snow Fall"
+	case 75:
+		return 8, "Heavy Snow Fall"
+	case 77:
+		return 8, "Snow Grains"
+	case 80:
+		return 5, "Slight Rain Showers"
+	case 81:
+		return 5, "Moderate Rain Showers"
+	case 82:
+		return 5, "Violent Rain Showers"
+	case 85:
+		return 8, "Slight Snow Showers"
+	case 86:
+		return 8, "Heavy Snow Showers"
+	case 95:
+		return 7, "Thunderstorm"
+	case 96:
+		return 7, "Thunderstorm With Slight Hail"
+	case 99:
+		return 7, "Thunderstorm With Heavy Hail"
+	default:
+		return 0, ""
+	}
+}
+
+// tzClient looks up time zones without holding up the weather for long if Open-Meteo does not answer
+var tzClient = &http.Client{Timeout: 10 * time.Second}
+
+// LookupTimeZone returns the IANA time zone of the coordinates, as reported by Open-Meteo
+func LookupTimeZone(lat float32, lon float32) (string, error) {
+	resp, err := tzClient.Get(fmt.Sprintf("%s/v1/forecast?latitude=%f&longitude=%f&timezone=auto", omURL, lat, lon))
+	if resp != nil {
+		defer resp.Body.Close()
+		resp.Close = true
+	}
+	if err != nil {
+		return "", err
+	}
+	r := omForecastResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return "", err
+	}
+	if r.Error {
+		return "", errors.New("Open-Meteo error. " + r.Reason)
+	}
+	if _, err := time.LoadLocation(r.Timezone); err != nil || r.Timezone == "" || r.Timezone == "GMT" {
+		return "", errors.New("Unknown time zone " + r.Timezone)
+	}
+	return r.Timezone, nil
+}
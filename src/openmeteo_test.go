@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCanDecodeOpenMeteoForecast(t *testing.T) {
+	r, err := os.Open("testdata/openmeteo_forecast.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	p := OpenMeteo{Config: &Config{}}
+	f := Forecast{}
+	if err := p.decodeForecast(&f, r); err != nil {
+		t.Fatal(err)
+	}
+
+	if f.Current.Temp != 18.4 || f.Current.Humidity != 72 || f.Current.Pressure != 1016.3 {
+		t.Error("Current conditions were not decoded", f.Current)
+	}
+	if f.Current.WeatherIcon != 3 || f.Current.WeatherDesc != "Partly Cloudy" || !f.Current.IsDay {
+		t.Error("Current weather icon was not mapped", f.Current.WeatherIcon, f.Current.WeatherDesc)
+	}
+	if !f.Current.ReadingTime.Equal(time.Unix(1760774400, 0)) {
+		t.Error("Unexpected reading time", f.Current.ReadingTime)
+	}
+	if !f.Current.Sunrise.Equal(time.Unix(1760761440, 0)) || !f.Current.Sunset.Equal(time.Unix(1760808060, 0)) {
+		t.Error("Sunrise and sunset were not taken from the daily block", f.Current.Sunrise, f.Current.Sunset)
+	}
+
+	if len(f.Hourly) != 6 {
+		t.Fatal("Expected 6 hourly entries, got", len(f.Hourly))
+	}
+	if f.Hourly[4].WeatherIcon != 6 || f.Hourly[5].WeatherIcon != 5 {
+		t.Error("Hourly weather icons were not mapped", f.Hourly[4].WeatherIcon, f.Hourly[5].WeatherIcon)
+	}
+	if h := f.Hourly[5]; h.PrecipProb != 85 || h.Precip != 2.1 || h.WindSpeed != 8.8 || h.WindDirection != 225 || h.Period != 1 || h.Humidity != 84 {
+		t.Error("Hourly precipitation and wind were not decoded", h)
+	}
+
+	if len(f.Forecast) != 3 {
+		t.Fatal("Expected 3 forecast days, got", len(f.Forecast))
+	}
+	exp := []struct {
+		min, max float32
+		icon     int
+	}{{12.1, 21.3, 5}, {13.4, 24.9, 1}, {14.0, 19.2, 7}}
+	for n, e := range exp {
+		d := f.Forecast[n]
+		if d.TempMin != e.min || d.TempMax != e.max || d.WeatherIcon != e.icon {
+			t.Error("Unexpected forecast for day", n, d)
+		}
+		if d.Name != d.Day.Weekday().String() {
+			t.Error("Unexpected day name", d.Name)
+		}
+	}
+	d := f.Forecast[0]
+	if d.PrecipProb != 85 || d.Precip != 2.5 || d.Rain != 2.5 || d.Snow != 0 || d.WindSpeed != 8.8 || d.WindGust != 14.3 || d.Humidity != 74 || d.UVIndex != 5.4 {
+		t.Error("Unexpected precipitation, wind, humidity or UV index for the first day", d)
+	}
+	if d := f.Forecast[2]; d.Rain != 5 || d.Snow != 1 || !d.Sunrise.Equal(time.Unix(1760934120, 0)) {
+		t.Error("Unexpected snow or sunrise for the last day", d)
+	}
+}
+
+func TestOpenMeteoErrorResponse(t *testing.T) {
+	r := strings.NewReader(`{"error":true,"reason":"Latitude must be in range of -90 to 90°."}`)
+
+	p := OpenMeteo{Config: &Config{}}
+	f := Forecast{}
+	if err := p.decodeForecast(&f, r); err == nil {
+		t.Error("Expected an error from the error response")
+	}
+}
+
+func TestOpenMeteoWeatherCodes(t *testing.T) {
+	p := OpenMeteo{}
+	for c, i := range map[int]int{0: 1, 1: 2, 2: 3, 3: 4, 45: 9, 53: 5, 65: 6, 75: 8, 81: 5, 86: 8, 99: 7, 42: 0} {
+		if n, _ := p.getWeatherIconInfo(c); n != i {
+			t.Error("WMO code", c, "mapped to", n, "expected", i)
+		}
+	}
+}
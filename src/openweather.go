@@ -2,12 +2,14 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -16,6 +18,133 @@ type OpenWeather struct {
 	Config *Config // Current Configuration
 }
 
+func init() {
+	RegisterProvider(ProviderInfo{
+		Name:        "OpenWeather",
+		Description: "Open Weather",
+		Precip:      "precip",
+		New:         func() WeatherProvider { return new(OpenWeather) },
+	})
+}
+
+// owURL is the address of the OpenWeatherMap API
+var owURL = "http://api.openweathermap.org"
+
+// errOneCallDenied is returned when the Application ID is not subscribed to the One Call API
+var errOneCallDenied = errors.New("The Application ID is not subscribed to the One Call API")
+
+// oneCallRetry is how long the One Call API is not asked again once it denied an Application ID
+const oneCallRetry = 6 * time.Hour
+
+// oneCallReuse is how long a One Call response is used for the alerts, which are reported with the forecast
+const oneCallReuse = 15 * time.Minute
+
+// oneCallLast holds the last One Call response for each request, so that getting the alerts
+// after the forecast does not ask the One Call API again
+var oneCallLast = struct {
+	sync.Mutex
+	forecasts map[string]Forecast
+}{forecasts: map[string]Forecast{}}
+
+// oneCallDenied holds until when each denied Application ID is not used with the One Call API
+var oneCallDenied = struct {
+	sync.Mutex
+	until map[string]time.Time
+}{until: map[string]time.Time{}}
+
+type owCondition struct {
+	ID          int    `json:"id"`
+	Main        string `json:"main"`
+	Description string `json:"description"`
+	Icon        string `json:"icon"`
+}
+
+type owOneCallResponse struct {
+	Lat            float32 `json:"lat"`
+	Lon            float32 `json:"lon"`
+	Timezone       string  `json:"timezone"`
+	TimezoneOffset int     `json:"timezone_offset"`
+	Current        struct {
+		Dt         int64         `json:"dt"`
+		Sunrise    int64         `json:"sunrise"`
+		Sunset     int64         `json:"sunset"`
+		Temp       float32       `json:"temp"`
+		Pressure   float32       `json:"pressure"`
+		Humidity   float32       `json:"humidity"`
+		FeelsLike  float32       `json:"feels_like"`
+		DewPoint   float32       `json:"dew_point"`
+		Clouds     float32       `json:"clouds"`
+		Uvi        float32       `json:"uvi"`
+		Visibility float32       `json:"visibility"`
+		WindSpeed  float32       `json:"wind_speed"`
+		WindDeg    float32       `json:"wind_deg"`
+		WindGust   float32       `json:"wind_gust"`
+		Rain       owPrecip      `json:"rain"`
+		Snow       owPrecip      `json:"snow"`
+		Weather    []owCondition `json:"weather"`
+	} `json:"current"`
+	Hourly []struct {
+		Dt        int64         `json:"dt"`
+		Temp      float32       `json:"temp"`
+		Pop       float32       `json:"pop"`
+		Humidity  float32       `json:"humidity"`
+		WindSpeed float32       `json:"wind_speed"`
+		WindDeg   float32       `json:"wind_deg"`
+		Rain      owPrecip      `json:"rain"`
+		Snow      owPrecip      `json:"snow"`
+		Weather   []owCondition `json:"weather"`
+	} `json:"hourly"`
+	Daily []struct {
+		Dt      int64  `json:"dt"`
+		Sunrise int64  `json:"sunrise"`
+		Sunset  int64  `json:"sunset"`
+		Summary string `json:"summary"`
+		Temp    struct {
+			Min float32 `json:"min"`
+			Max float32 `json:"max"`
+		} `json:"temp"`
+		Pop       float32       `json:"pop"`
+		Rain      float32       `json:"rain"`
+		Snow      float32       `json:"snow"`
+		Humidity  float32       `json:"humidity"`
+		WindSpeed float32       `json:"wind_speed"`
+		WindGust  float32       `json:"wind_gust"`
+		Uvi       float32       `json:"uvi"`
+		Weather   []owCondition `json:"weather"`
+	} `json:"daily"`
+	Alerts []struct {
+		SenderName  string `json:"sender_name"`
+		Event       string `json:"event"`
+		Start       int64  `json:"start"`
+		End         int64  `json:"end"`
+		Description string `json:"description"`
+	} `json:"alerts"`
+}
+
+type owErrorResponse struct {
+	Cod     interface{} `json:"cod"`
+	Message string      `json:"message"`
+}
+
+// owResponseError returns the error of a response whose status is not successful, or whose body
+// holds the cod and message of an error in place of the weather, e.g. for a revoked Application ID
+func owResponseError(status int, b []byte) error {
+	e := owErrorResponse{}
+	// The message of a successful forecast is a number, so only the cod may be decoded
+	json.Unmarshal(b, &e)
+	cod := fmt.Sprint(e.Cod)
+	if status/100 == 2 && (e.Cod == nil || cod == "200") {
+		return nil
+	}
+	if e.Message == "" {
+		e.Message = http.StatusText(status)
+		if e.Cod != nil {
+			e.Message = "Code " + cod
+		}
+	}
+	return errors.New("OpenWeather error. " + e.Message)
+}
+
 type owWeatherResponse struct {
 	Coord struct {
 		Lon float32 `json:"lon"`
@@ -29,17 +158,21 @@ type owWeatherResponse struct {
 	} `json:"weather"`
 	Base string `json:"base"`
 	Main struct {
-		Temp     float32 `json:"temp"`
-		Pressure float32 `json:"pressure"`
-		Humidity float32 `json:"humidity"`
-		TempMin  float32 `json:"temp_min"`
-		TempMax  float32 `json:"temp_max"`
+		Temp      float32 `json:"temp"`
+		FeelsLike float32 `json:"feels_like"`
+		Pressure  float32 `json:"pressure"`
+		Humidity  float32 `json:"humidity"`
+		TempMin   float32 `json:"temp_min"`
+		TempMax   float32 `json:"temp_max"`
 	} `json:"main"`
 	Visibility int `json:"visibility"`
 	Wind       struct {
 		Speed float32 `json:"speed"`
 		Deg   float32 `json:"deg"`
+		Gust  float32 `json:"gust"`
 	} `json:"wind"`
+	Rain   owPrecip `json:"rain"`
+	Snow   owPrecip `json:"snow"`
 	Clouds struct {
 		All int `json:"all"`
 	} `json:"clouds"`
@@ -57,6 +190,12 @@ type owWeatherResponse struct {
 	Cod  int    `json:"cod"`
 }
 
+// owPrecip holds the volume of rain or snow in mm over the last or next hour or 3 hours
+type owPrecip struct {
+	OneHour   float32 `json:"1h"`
+	ThreeHour float32 `json:"3h"`
+}
+
 type owForecastResponse struct {
 	Cod     string  `json:"cod"`
 	Message float32 `json:"message"`
@@ -65,6 +204,7 @@ type owForecastResponse struct {
 		Dt   int `json:"dt"`
 		Main struct {
 			Temp      float32 `json:"temp"`
+			FeelsLike float32 `json:"feels_like"`
 			TempMin   float32 `json:"temp_min"`
 			TempMax   float32 `json:"temp_max"`
 			Pressure  float32 `json:"pressure"`
@@ -85,11 +225,16 @@ type owForecastResponse struct {
 		Wind struct {
 			Speed float32 `json:"speed"`
 			Deg   float32 `json:"deg"`
+			Gust  float32 `json:"gust"`
 		} `json:"wind"`
-		Sys struct {
+		Rain owPrecip `json:"rain"`
+		Snow owPrecip `json:"snow"`
+		Pop  float32  `json:"pop"`
+		Sys  struct {
 			Pod string `json:"pod"`
 		} `json:"sys"`
-		DtTxt string `json:"dt_txt"`
+		Visibility int    `json:"visibility"`
+		DtTxt      string `json:"dt_txt"`
 	} `json:"list"`
 	City struct {
 		ID    int    `json:"id"`
@@ -114,26 +259,40 @@ func (o *OpenWeather) GetProviderName() string {
 
 // GetWeather returns the current weather for the location
 func (o *OpenWeather) GetWeather() (Weather, error) {
+	if o.Config.OneCall {
+		f, err := o.getOneCall()
+		if err != errOneCallDenied {
+			return f.Current, err
+		}
+	}
+
 	w := Weather{
 		Provider: o.GetProviderName(),
 		Created:  time.Now(),
 		Name:     o.Config.LocationName,
 	}
 
-	url := fmt.Sprintf("http://api.openweathermap.org/data/2.5/weather?lat=%f&lon=%f&appid=%s&units=metric", o.Config.Latitude, o.Config.Longitude, o.Config.AppID)
+	url := fmt.Sprintf("%s/data/2.5/weather?lat=%f&lon=%f&appid=%s&units=metric&lang=%s", owURL, o.Config.Latitude, o.Config.Longitude, o.Config.GetAppID(o.GetProviderName()), o.Config.GetLanguage())
 	var resp, err = http.Get(url)
 	if resp != nil {
 		defer resp.Body.Close()
 		resp.Close = true
 	}
 	if err == nil {
-		err = o.decodeWeather(&w, resp.Body)
+		err = o.decodeWeather(&w, resp.StatusCode, resp.Body)
 	}
 	return w, err
 }
 
 // GetForecast returns the current forecast for the location
 func (o *OpenWeather) GetForecast() (Forecast, error) {
+	if o.Config.OneCall {
+		f, err := o.getOneCall()
+		if err != errOneCallDenied {
+			return f, err
+		}
+	}
+
 	f := Forecast{
 		Current: Weather{
 			Provider: o.GetProviderName(),
@@ -142,116 +301,359 @@ func (o *OpenWeather) GetForecast() (Forecast, error) {
 		},
 	}
 
-	url := fmt.Sprintf("http://api.openweathermap.org/data/2.5/forecast?lat=%f&lon=%f&appid=%s&units=metric", o.Config.Latitude, o.Config.Longitude, o.Config.AppID)
+	url := fmt.Sprintf("%s/data/2.5/forecast?lat=%f&lon=%f&appid=%s&units=metric&lang=%s", owURL, o.Config.Latitude, o.Config.Longitude, o.Config.GetAppID(o.GetProviderName()), o.Config.GetLanguage())
 	var resp, err = http.Get(url)
 	if resp != nil {
 		defer resp.Body.Close()
 		resp.Close = true
 	}
 	if err == nil {
-		err = o.decodeForecast(&f, resp.Body)
+		err = o.decodeForecast(&f, resp.StatusCode, resp.Body)
 	}
 	return f, err
 }
 
+// GetAlerts returns the alerts issued for the location, which are only reported by the One Call API
+func (o *OpenWeather) GetAlerts() ([]Alert, error) {
+	if !o.Config.OneCall {
+		return nil, errAlertsNotSupported
+	}
+	oneCallLast.Lock()
+	lf, ok := oneCallLast.forecasts[o.getOneCallURL()]
+	oneCallLast.Unlock()
+	if ok && time.Since(lf.Current.Created) <= oneCallReuse {
+		return lf.Alerts, nil
+	}
+	f, err := o.getOneCall()
+	if err == errOneCallDenied {
+		return nil, errAlertsNotSupported
+	}
+	return f.Alerts, err
+}
+
+// getOneCallURL returns the address of the One Call API request for the location
+func (o *OpenWeather) getOneCallURL() string {
+	return fmt.Sprintf("%s/data/3.0/onecall?lat=%f&lon=%f&exclude=minutely&appid=%s&units=metric&lang=%s", owURL, o.Config.Latitude, o.Config.Longitude, o.Config.GetAppID(o.GetProviderName()), o.Config.GetLanguage())
+}
+
+// getOneCall returns the current weather, hourly and daily forecast and alerts from the One Call API.
+// errOneCallDenied is returned if the Application ID is not subscribed to the One Call API,
+// without asking again for a while once the API has denied it. An invalid Application ID is reported as an error.
+func (o *OpenWeather) getOneCall() (Forecast, error) {
+	f := Forecast{
+		Current: Weather{
+			Provider: o.GetProviderName(),
+			Created:  time.Now(),
+			Name:     o.Config.LocationName,
+		},
+	}
+
+	appID := o.Config.GetAppID(o.GetProviderName())
+	oneCallDenied.Lock()
+	until := oneCallDenied.until[appID]
+	oneCallDenied.Unlock()
+	if time.Now().Before(until) {
+		return f, errOneCallDenied
+	}
+
+	url := o.getOneCallURL()
+	resp, err := http.Get(url)
+	if err != nil {
+		return f, err
+	}
+	defer resp.Body.Close()
+	resp.Close = true
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if err := o.decodeOneCall(&f, resp.Body); err != nil {
+			return f, err
+		}
+		oneCallLast.Lock()
+		oneCallLast.forecasts[url] = f
+		oneCallLast.Unlock()
+		return f, nil
+	case http.StatusUnauthorized:
+		// The One Call API also denies an invalid Application ID, which the 2.5 API accepts if it is only not subscribed
+		if err := o.checkAppID(); err != nil {
+			return f, err
+		}
+		oneCallDenied.Lock()
+		oneCallDenied.until[appID] = time.Now().Add(oneCallRetry)
+		oneCallDenied.Unlock()
+		return f, errOneCallDenied
+	default:
+		e := owErrorResponse{}
+		json.NewDecoder(resp.Body).Decode(&e)
+		if e.Message == "" {
+			e.Message = resp.Status
+		}
+		return f, errors.New("One Call API error. " + e.Message)
+	}
+}
+
+// checkAppID returns an error if the 2.5 API does not accept the Application ID
+func (o *OpenWeather) checkAppID() error {
+	url := fmt.Sprintf("%s/data/2.5/weather?lat=%f&lon=%f&appid=%s", owURL, o.Config.Latitude, o.Config.Longitude, o.Config.GetAppID(o.GetProviderName()))
+	resp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	resp.Close = true
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	return owResponseError(resp.StatusCode, b)
+}
+
+func (o *OpenWeather) decodeOneCall(f *Forecast, r io.Reader) error {
+	resp := owOneCallResponse{}
+	if err := json.NewDecoder(r).Decode(&resp); err != nil {
+		return err
+	}
+	// Days are bucketed in the location's time zone, which follows daylight saving time
+	// unlike the offset reported for today
+	loc, err := time.LoadLocation(resp.Timezone)
+	if err != nil || resp.Timezone == "" {
+		loc = o.Config.GetTimeZone()
+	}
+
+	cw := resp.Current
+	f.Current.Temp = cw.Temp
+	f.Current.Humidity = cw.Humidity
+	f.Current.Pressure = cw.Pressure
+	f.Current.WindSpeed = cw.WindSpeed
+	f.Current.WindDirection = cw.WindDeg
+	f.Current.WindGust = cw.WindGust
+	f.Current.FeelsLike = cw.FeelsLike
+	f.Current.DewPoint = cw.DewPoint
+	f.Current.CloudCover = cw.Clouds
+	f.Current.UVIndex = cw.Uvi
+	f.Current.Precip = cw.Rain.OneHour + cw.Snow.OneHour
+	// Visibility is in metres
+	f.Current.Visibility = cw.Visibility / 1000
+	f.Current.ReadingTime = time.Unix(cw.Dt, 0)
+	f.Current.Sunrise = time.Unix(cw.Sunrise, 0)
+	f.Current.Sunset = time.Unix(cw.Sunset, 0)
+	if len(cw.Weather) != 0 {
+		cwi := cw.Weather[0]
+		f.Current.WeatherIcon, f.Current.WeatherDesc, f.Current.IsDay = o.getWeatherIconInfo(cwi.Icon, cwi.Description)
+	}
+
+	for _, h := range resp.Hourly {
+		fh := ForecastHour{
+			Time:          time.Unix(h.Dt, 0).In(loc),
+			Period:        1,
+			Temp:          h.Temp,
+			PrecipProb:    h.Pop * 100,
+			Precip:        h.Rain.OneHour + h.Snow.OneHour,
+			Humidity:      h.Humidity,
+			WindSpeed:     h.WindSpeed,
+			WindDirection: h.WindDeg,
+		}
+		if len(h.Weather) != 0 {
+			fh.WeatherIcon, fh.WeatherDesc, fh.IsDay = o.getWeatherIconInfo(h.Weather[0].Icon, h.Weather[0].Description)
+		}
+		f.Hourly = append(f.Hourly, fh)
+	}
+
+	for _, d := range resp.Daily {
+		ct := time.Unix(d.Dt, 0).In(loc)
+		fd := ForecastDay{
+			Day:        time.Date(ct.Year(), ct.Month(), ct.Day(), 0, 0, 0, 0, loc),
+			Name:       DayName(ct, o.Config.Language),
+			TempMin:    d.Temp.Min,
+			TempMax:    d.Temp.Max,
+			Detail:     d.Summary,
+			PrecipProb: d.Pop * 100,
+			Precip:     d.Rain + d.Snow,
+			Rain:       d.Rain,
+			Snow:       d.Snow,
+			WindSpeed:  d.WindSpeed,
+			WindGust:   d.WindGust,
+			Humidity:   d.Humidity,
+			UVIndex:    d.Uvi,
+			Sunrise:    time.Unix(d.Sunrise, 0).In(loc),
+			Sunset:     time.Unix(d.Sunset, 0).In(loc),
+		}
+		if len(d.Weather) != 0 {
+			fd.WeatherIcon, fd.WeatherDesc, _ = o.getWeatherIconInfo(d.Weather[0].Icon, d.Weather[0].Description)
+		}
+		f.Forecast = append(f.Forecast, fd)
+	}
+
+	for _, a := range resp.Alerts {
+		f.Alerts = append(f.Alerts, Alert{
+			Source:      o.GetProviderName(),
+			Sender:      a.SenderName,
+			Event:       a.Event,
+			Start:       time.Unix(a.Start, 0),
+			End:         time.Unix(a.End, 0),
+			Description: a.Description,
+		})
+	}
+	return nil
+}
+
 // ReadFrom reads the string from the reader and deserializes it into the entity values
-func (o *OpenWeather) decodeWeather(w *Weather, r io.ReadCloser) error {
+func (o *OpenWeather) decodeWeather(w *Weather, status int, r io.ReadCloser) error {
 	b, err := ioutil.ReadAll(r)
 	if err == nil {
-		if b != nil && len(b) != 0 {
-			ioutil.WriteFile("lastweatherresp.json", b, 0666)
-			var resp = owWeatherResponse{}
-			err = json.Unmarshal(b, &resp)
-			if err == nil {
-				w.ID = strconv.Itoa(resp.ID)
-				w.Name = resp.Name
-				if len(resp.Weather) != 0 {
-					cwi := resp.Weather[0]
-					w.WeatherIcon, w.WeatherDesc, w.IsDay = o.getWeatherIconInfo(cwi.Icon, cwi.Description)
-				}
-				w.Temp = resp.Main.Temp
-				w.Humidity = resp.Main.Humidity
-				w.Pressure = resp.Main.Pressure
-				w.ReadingTime = time.Unix(int64(resp.Dt), 0)
-				w.Sunrise = time.Unix(int64(resp.Sys.Sunrise), 0)
-				w.Sunset = time.Unix(int64(resp.Sys.Sunset), 0)
-				w.WindSpeed = resp.Wind.Speed
-				w.WindDirection = resp.Wind.Deg
+		err = owResponseError(status, b)
+	}
+	if err == nil && len(b) == 0 {
+		err = errors.New("OpenWeather returned an empty response")
+	}
+	if err == nil {
+		ioutil.WriteFile("lastweatherresp.json", b, 0666)
+		var resp = owWeatherResponse{}
+		err = json.Unmarshal(b, &resp)
+		if err == nil {
+			w.ID = strconv.Itoa(resp.ID)
+			w.Name = resp.Name
+			if len(resp.Weather) != 0 {
+				cwi := resp.Weather[0]
+				w.WeatherIcon, w.WeatherDesc, w.IsDay = o.getWeatherIconInfo(cwi.Icon, cwi.Description)
 			}
+			w.Temp = resp.Main.Temp
+			w.Humidity = resp.Main.Humidity
+			w.Pressure = resp.Main.Pressure
+			loc := o.Config.GetTimeZone()
+			w.ReadingTime = time.Unix(int64(resp.Dt), 0).In(loc)
+			w.Sunrise = time.Unix(int64(resp.Sys.Sunrise), 0).In(loc)
+			w.Sunset = time.Unix(int64(resp.Sys.Sunset), 0).In(loc)
+			w.WindSpeed = resp.Wind.Speed
+			w.WindDirection = resp.Wind.Deg
+			w.WindGust = resp.Wind.Gust
+			w.FeelsLike = resp.Main.FeelsLike
+			w.CloudCover = float32(resp.Clouds.All)
+			w.Precip = resp.Rain.OneHour + resp.Snow.OneHour
+			// Visibility is in metres
+			w.Visibility = float32(resp.Visibility) / 1000
 		}
 	}
 	return err
 }
 
-func (o *OpenWeather) decodeForecast(f *Forecast, r io.Reader) error {
+func (o *OpenWeather) decodeForecast(f *Forecast, status int, r io.Reader) error {
 	b, err := ioutil.ReadAll(r)
 	if err == nil {
-		if b != nil && len(b) != 0 {
-			ioutil.WriteFile("lastforecastresp.json", b, 0666)
-			var resp = owForecastResponse{}
-			err = json.Unmarshal(b, &resp)
-			if err == nil {
-				if len(resp.List) != 0 {
-					// Current weather
-					cw := resp.List[0]
-					f.Current.ID = strconv.Itoa(resp.City.ID)
-					f.Current.Name = resp.City.Name
-					if len(cw.Weather) != 0 {
-						cwi := cw.Weather[0]
-						f.Current.WeatherIcon, f.Current.WeatherDesc, f.Current.IsDay = o.getWeatherIconInfo(cwi.Icon, cwi.Description)
+		err = owResponseError(status, b)
+	}
+	if err == nil && len(b) == 0 {
+		err = errors.New("OpenWeather returned an empty response")
+	}
+	if err == nil {
+		ioutil.WriteFile("lastforecastresp.json", b, 0666)
+		var resp = owForecastResponse{}
+		err = json.Unmarshal(b, &resp)
+		if err == nil {
+			if len(resp.List) != 0 {
+				// Current weather
+				cw := resp.List[0]
+				f.Current.ID = strconv.Itoa(resp.City.ID)
+				f.Current.Name = resp.City.Name
+				if len(cw.Weather) != 0 {
+					cwi := cw.Weather[0]
+					f.Current.WeatherIcon, f.Current.WeatherDesc, f.Current.IsDay = o.getWeatherIconInfo(cwi.Icon, cwi.Description)
+				}
+				f.Current.Temp = cw.Main.Temp
+				f.Current.Humidity = cw.Main.Humidity
+				f.Current.Pressure = cw.Main.Pressure
+				// Days start at midnight in the location, not on the server
+				loc := o.Config.GetTimeZone()
+				ct := time.Unix(int64(cw.Dt), 0).In(loc)
+				f.Current.ReadingTime = ct
+				f.Current.WindSpeed = cw.Wind.Speed
+				f.Current.WindDirection = cw.Wind.Deg
+				f.Current.WindGust = cw.Wind.Gust
+				f.Current.FeelsLike = cw.Main.FeelsLike
+				f.Current.CloudCover = float32(cw.Clouds.All)
+				f.Current.Visibility = float32(cw.Visibility) / 1000
+
+				// Forecast
+				cf := ForecastDay{}
+				cf.Day = time.Date(ct.Year(), ct.Month(), ct.Day(), 0, 0, 0, 0, ct.Location())
+				n := 0
+				for _, i := range resp.List {
+					ct = time.Unix(int64(i.Dt), 0).In(loc)
+
+					// Each item is a 3 hour slot
+					fh := ForecastHour{
+						Time:          ct,
+						Period:        3,
+						Temp:          i.Main.Temp,
+						PrecipProb:    i.Pop * 100,
+						Precip:        i.Rain.ThreeHour + i.Snow.ThreeHour,
+						Humidity:      i.Main.Humidity,
+						WindSpeed:     i.Wind.Speed,
+						WindDirection: i.Wind.Deg,
+					}
+					if len(i.Weather) != 0 {
+						fh.WeatherIcon, fh.WeatherDesc, fh.IsDay = o.getWeatherIconInfo(i.Weather[0].Icon, i.Weather[0].Description)
+					}
+					f.Hourly = append(f.Hourly, fh)
+					iDay := time.Date(ct.Year(), ct.Month(), ct.Day(), 0, 0, 0, 0, ct.Location())
+					if iDay.Year() != cf.Day.Year() || iDay.YearDay() != cf.Day.YearDay() {
+						// Date has changed
+						f.Forecast = append(f.Forecast, cf)
+						cf = ForecastDay{}
+						cf.Day = time.Date(ct.Year(), ct.Month(), ct.Day(), 0, 0, 0, 0, ct.Location())
+						n = 0
+					}
+
+					// Precipitation and wind over the day
+					n++
+					cf.Humidity += (i.Main.Humidity - cf.Humidity) / float32(n)
+					cf.Rain += i.Rain.ThreeHour
+					cf.Snow += i.Snow.ThreeHour
+					cf.Precip = cf.Rain + cf.Snow
+					if i.Pop*100 > cf.PrecipProb {
+						cf.PrecipProb = i.Pop * 100
+					}
+					if i.Wind.Speed > cf.WindSpeed {
+						cf.WindSpeed = i.Wind.Speed
+					}
+					if i.Wind.Gust > cf.WindGust {
+						cf.WindGust = i.Wind.Gust
 					}
-					f.Current.Temp = cw.Main.Temp
-					f.Current.Humidity = cw.Main.Humidity
-					f.Current.Pressure = cw.Main.Pressure
-					ct := time.Unix(int64(cw.Dt), 0)
-					f.Current.ReadingTime = ct
-					f.Current.WindSpeed = cw.Wind.Speed
-					f.Current.WindDirection = cw.Wind.Deg
-
-					// Forecast
-					cf := ForecastDay{}
-					cf.Day = time.Date(ct.Year(), ct.Month(), ct.Day(), 0, 0, 0, 0, ct.Location())
-					for _, i := range resp.List {
-						ct = time.Unix(int64(i.Dt), 0)
-						iDay := time.Date(ct.Year(), ct.Month(), ct.Day(), 0, 0, 0, 0, ct.Location())
-						if iDay.Year() != cf.Day.Year() || iDay.YearDay() != cf.Day.YearDay() {
-							// Date has changed
-							f.Forecast = append(f.Forecast, cf)
-							cf = ForecastDay{}
-							cf.Day = time.Date(ct.Year(), ct.Month(), ct.Day(), 0, 0, 0, 0, ct.Location())
+
+					if cf.Name == "" {
+						cf.TempMin = i.Main.Temp
+						cf.TempMax = i.Main.Temp
+						cf.Day = ct
+						cf.Name = DayName(ct, o.Config.Language)
+						if sr, ss, err := GetSunriseSunset(o.Config, ct); err == nil {
+							cf.Sunrise = sr
+							cf.Sunset = ss
+						}
+						if len(i.Weather) != 0 {
+							cwi := i.Weather[0]
+							cf.WeatherIcon, cf.WeatherDesc, _ = o.getWeatherIconInfo(cwi.Icon, cwi.Description)
+						} else {
+							cf.WeatherIcon = 0
 						}
-						if cf.Name == "" {
+					} else {
+						if i.Main.Temp < cf.TempMin {
 							cf.TempMin = i.Main.Temp
+						}
+						if i.Main.Temp > cf.TempMax {
 							cf.TempMax = i.Main.Temp
-							cf.Day = ct
-							cf.Name = ct.Weekday().String()
-							if len(i.Weather) != 0 {
-								cwi := i.Weather[0]
-								cf.WeatherIcon, cf.WeatherDesc, _ = o.getWeatherIconInfo(cwi.Icon, cwi.Description)
-							} else {
-								cf.WeatherIcon = 0
-							}
-						} else {
-							if i.Main.Temp < cf.TempMin {
-								cf.TempMin = i.Main.Temp
-							}
-							if i.Main.Temp > cf.TempMax {
-								cf.TempMax = i.Main.Temp
-							}
-							if len(i.Weather) != 0 {
-								// Update the current forecast if the weather is more extreem that the current
-								cwi := i.Weather[0]
-								ci, cd, _ := o.getWeatherIconInfo(cwi.Icon, cwi.Description)
-								if ci > cf.WeatherIcon {
-									cf.WeatherIcon = ci
-									cf.WeatherDesc = cd
-								}
+						}
+						if len(i.Weather) != 0 {
+							// Update the current forecast if the weather is more extreem that the current
+							cwi := i.Weather[0]
+							ci, cd, _ := o.getWeatherIconInfo(cwi.Icon, cwi.Description)
+							if ci > cf.WeatherIcon {
+								cf.WeatherIcon = ci
+								cf.WeatherDesc = cd
 							}
 						}
-
 					}
-					f.Forecast = append(f.Forecast, cf)
+
 				}
+				f.Forecast = append(f.Forecast, cf)
 			}
 		}
 	}
@@ -270,11 +672,14 @@ func (o *OpenWeather) getWeatherIconInfo(i string, d string) (int, string, bool)
 	// 7 = Thunderstorms		> 11
 	// 8 = Snow					> 13
 	// 9 = Mist/ Fog			> 50
-	d = strings.Title(d)
+	// English descriptions are shown in title case, those in other languages as Open Weather wrote them
+	if o.Config.GetLanguage() == "en" {
+		d = strings.Title(d)
+	}
 	if i == "" || len(i) != 3 {
 		return 0, d, true
 	}
-	isDay := strings.ToLower(i[2:2]) == "d"
+	isDay := strings.ToLower(i[2:3]) == "d"
 	switch i[:2] {
 	case "01":
 		return 1, d, isDay
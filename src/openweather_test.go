@@ -1,9 +1,15 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestGetOpenWeather(t *testing.T) {
@@ -23,7 +29,7 @@ func TestGetOpenWeather(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	err = ioutil.WriteFile("test.json", data, 0666)
+	err = ioutil.WriteFile(filepath.Join(t.TempDir(), "test.json"), data, 0666)
 	if err != nil {
 		t.Error(err)
 	}
@@ -46,8 +52,228 @@ func TestGetOpenWeatherForecast(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	err = ioutil.WriteFile("test.json", data, 0666)
+	err = ioutil.WriteFile(filepath.Join(t.TempDir(), "test.json"), data, 0666)
 	if err != nil {
 		t.Error(err)
 	}
 }
+
+func newOpenWeatherTestServer(t *testing.T, oneCall bool) (*httptest.Server, *[]string) {
+	b, err := ioutil.ReadFile(filepath.Join("testdata", "openweather_onecall.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := []string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if r.URL.Query().Get("appid") == "invalid" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"cod":401,"message":"Invalid API key. Please see https://openweathermap.org/faq#error401 for more info."}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/data/3.0/onecall":
+			if !oneCall {
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(`{"cod":401,"message":"Please note that using One Call 3.0 requires a separate subscription"}`))
+				return
+			}
+			w.Write(b)
+		case "/data/2.5/weather":
+			w.Write([]byte(`{"cod":200,"id":3369157,"name":"Cape Town","main":{"temp":14.6,"humidity":72,"pressure":1019},"weather":[{"description":"few clouds","icon":"02d"}]}`))
+		case "/data/2.5/forecast":
+			w.Write([]byte(`{"cod":"200","list":[{"dt":1717232400,"main":{"temp":14.6,"humidity":72,"pressure":1019},"weather":[{"description":"few clouds","icon":"02d"}]}],"city":{"id":3369157,"name":"Cape Town"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return srv, &paths
+}
+
+func TestCanGetOpenWeatherOneCall(t *testing.T) {
+	srv, paths := newOpenWeatherTestServer(t, true)
+	defer srv.Close()
+	ou := owURL
+	owURL = srv.URL
+	defer func() { owURL = ou }()
+
+	o := OpenWeather{Config: &Config{LocationName: "Cape Town", OneCall: true, AppID: "key"}}
+	f, err := o.GetForecast()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := f.Current
+	if w.Temp != 14.6 || w.WeatherIcon != 2 || !w.IsDay || w.Sunrise.Unix() != 1717220164 || w.WeatherDesc != "Few Clouds" {
+		t.Error("Current conditions were not decoded", w)
+	}
+	if w.FeelsLike != 13.9 || w.DewPoint != 9.6 || w.UVIndex != 1.8 || w.CloudCover != 20 || w.Visibility != 10 || w.WindGust != 7.2 {
+		t.Error("The extra current conditions were not decoded", w)
+	}
+	if len(f.Hourly) != 3 || f.Hourly[2].PrecipProb != 65 || f.Hourly[2].WeatherIcon != 5 {
+		t.Error("Hourly forecast was not decoded", f.Hourly)
+	} else if h := f.Hourly[2]; h.Precip != 0.8 || h.WindSpeed != 6.2 || h.WindDirection != 310 {
+		t.Error("Hourly precipitation and wind were not decoded", h)
+	}
+	if len(f.Forecast) != 2 {
+		t.Fatal("Expected 2 forecast days, got", len(f.Forecast))
+	}
+	d := f.Forecast[0]
+	if d.TempMin != 10.1 || d.TempMax != 16.8 || d.PrecipProb != 65 || d.Name != "Saturday" || d.Detail == "" {
+		t.Error("Unexpected forecast for the first day", d)
+	}
+	if d.Precip != 4.2 || d.Rain != 4.2 || d.Humidity != 78 || d.WindSpeed != 7.1 || d.WindGust != 12.4 || d.UVIndex != 3.2 || d.Sunrise.Unix() != 1717220164 {
+		t.Error("Unexpected precipitation, wind or sun times for the first day", d)
+	}
+	if d.Day.Hour() != 0 || d.Day.Day() != 1 {
+		t.Error("The day was not set to midnight in the location's time zone", d.Day)
+	}
+	if len(f.Alerts) != 1 || f.Alerts[0].Sender != "South African Weather Service" || f.Alerts[0].End.Unix() != 1717304400 || f.Alerts[0].Source != "OpenWeather" {
+		t.Error("Alerts were not decoded", f.Alerts)
+	}
+
+	// The alerts are taken from the forecast rather than asking the One Call API again
+	as, err := o.GetAlerts()
+	if err != nil || len(as) != 1 || len(*paths) != 1 {
+		t.Error("Expected the alerts of the forecast, got", as, *paths, err)
+	}
+}
+
+func TestOpenWeatherOneCallFallsBackWithoutSubscription(t *testing.T) {
+	srv, paths := newOpenWeatherTestServer(t, false)
+	defer srv.Close()
+	ou := owURL
+	owURL = srv.URL
+	defer func() { owURL = ou }()
+
+	// The forecast response is written to the working directory
+	chdirTemp(t)
+
+	o := OpenWeather{Config: &Config{OneCall: true, AppID: "denied"}}
+	defer func() { delete(oneCallDenied.until, "denied") }()
+	f, err := o.GetForecast()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The Application ID is checked against the 2.5 API before the One Call API is taken to be unsubscribed
+	if len(*paths) != 3 || (*paths)[1] != "/data/2.5/weather" || (*paths)[2] != "/data/2.5/forecast" {
+		t.Error("Expected the 2.5 forecast to be used, got", *paths)
+	}
+	if f.Current.Name != "Cape Town" || len(f.Forecast) != 1 {
+		t.Error("The 2.5 forecast was not returned", f)
+	}
+
+	// The One Call API is not asked again once it denied the Application ID
+	if _, err := o.GetForecast(); err != nil || len(*paths) != 4 || (*paths)[3] != "/data/2.5/forecast" {
+		t.Error("Expected the One Call API to be skipped, got", *paths, err)
+	}
+}
+
+func TestOpenWeatherOneCallReportsInvalidAppID(t *testing.T) {
+	srv, _ := newOpenWeatherTestServer(t, true)
+	defer srv.Close()
+	ou := owURL
+	owURL = srv.URL
+	defer func() { owURL = ou }()
+
+	o := OpenWeather{Config: &Config{OneCall: true, AppID: "invalid"}}
+	defer func() { delete(oneCallDenied.until, "invalid") }()
+	if _, err := o.GetForecast(); err == nil || !strings.Contains(err.Error(), "Invalid API key") {
+		t.Error("Expected the invalid Application ID to be reported, got", err)
+	}
+	if _, ok := oneCallDenied.until["invalid"]; ok {
+		t.Error("The invalid Application ID was taken to be unsubscribed from the One Call API")
+	}
+}
+
+func TestOpenWeatherOneCallDaysFollowDaylightSavingTime(t *testing.T) {
+	// British Summer Time ends on 25 October 2026, after the forecast was made
+	b := `{"timezone":"Europe/London","timezone_offset":3600,"current":{"dt":1792832400},"daily":[
+		{"dt":1792839600,"temp":{"min":8,"max":14}},
+		{"dt":1793016000,"temp":{"min":7,"max":12}}]}`
+	o := OpenWeather{Config: &Config{}}
+	f := Forecast{}
+	if err := o.decodeOneCall(&f, strings.NewReader(b)); err != nil {
+		t.Fatal(err)
+	}
+	loc, _ := time.LoadLocation("Europe/London")
+	if len(f.Forecast) != 2 {
+		t.Fatal("Expected 2 forecast days, got", len(f.Forecast))
+	}
+	if d := f.Forecast[0].Day; !d.Equal(time.Date(2026, 10, 24, 0, 0, 0, 0, loc)) {
+		t.Error("Unexpected first day", d)
+	}
+	if d := f.Forecast[1].Day; !d.Equal(time.Date(2026, 10, 26, 0, 0, 0, 0, loc)) || d.Location().String() != "Europe/London" {
+		t.Error("The day after the clocks change was not at midnight in the location", d)
+	}
+}
+
+func TestOpenWeatherForecastDaysAreInLocationTimeZone(t *testing.T) {
+	chdirTemp(t)
+
+	// 3 hour slots from 21:00 to 03:00 UTC are 06:00 to 12:00 on the same day in Tokyo
+	b := []byte(`{"cod":"200","list":[
+		{"dt":1781989200,"main":{"temp":20,"humidity":80},"pop":0.1,"wind":{"speed":2.4,"deg":80,"gust":4.0}},
+		{"dt":1782000000,"main":{"temp":24,"humidity":70},"snow":{"3h":0.5}},
+		{"dt":1782010800,"main":{"temp":27,"humidity":60},"pop":0.4,"rain":{"3h":1.5},"wind":{"speed":3.1,"deg":90}}],"city":{"id":1850147,"name":"Tokyo"}}`)
+	o := OpenWeather{Config: &Config{TimeZone: "Asia/Tokyo"}}
+	f := Forecast{}
+	if err := o.decodeForecast(&f, http.StatusOK, bytes.NewReader(b)); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Forecast) != 1 {
+		t.Fatal("Expected the slots to fall on a single day, got", len(f.Forecast))
+	}
+	d := f.Forecast[0]
+	if d.TempMin != 20 || d.TempMax != 27 || d.Day.Location().String() != "Asia/Tokyo" {
+		t.Error("Unexpected forecast day", d)
+	}
+	if d.Rain != 1.5 || d.Snow != 0.5 || d.Precip != 2 || d.PrecipProb != 40 || d.WindSpeed != 3.1 || d.WindGust != 4 || d.Humidity != 70 {
+		t.Error("The slots were not summarized for the day", d)
+	}
+
+	// The 3 hour slots are kept as the hourly forecast
+	if len(f.Hourly) != 3 {
+		t.Fatal("Expected 3 hourly slots, got", len(f.Hourly))
+	}
+	if h := f.Hourly[2]; h.Period != 3 || h.Temp != 27 || h.PrecipProb != 40 || h.Precip != 1.5 || h.WindSpeed != 3.1 || h.WindDirection != 90 {
+		t.Error("Unexpected hourly slot", h)
+	}
+}
+
+func TestOpenWeatherReportsErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"cod":401,"message":"Invalid API key. Please see https://openweathermap.org/faq#error401 for more info."}`))
+	}))
+	defer srv.Close()
+	ou := owURL
+	owURL = srv.URL
+	defer func() { owURL = ou }()
+	chdirTemp(t)
+
+	o := OpenWeather{Config: &Config{AppID: "revoked"}}
+	if _, err := o.GetWeather(); err == nil || !strings.Contains(err.Error(), "Invalid API key") {
+		t.Error("Expected the weather to fail with the message of the error, got", err)
+	}
+	if _, err := o.GetForecast(); err == nil || !strings.Contains(err.Error(), "Invalid API key") {
+		t.Error("Expected the forecast to fail with the message of the error, got", err)
+	}
+
+	// An error in the body is reported even if the status is successful
+	f := Forecast{}
+	if err := o.decodeForecast(&f, http.StatusOK, strings.NewReader(`{"cod":"404","message":"city not found"}`)); err == nil || !strings.Contains(err.Error(), "city not found") {
+		t.Error("Expected the error in the forecast body, got", err)
+	}
+	w := Weather{}
+	if err := o.decodeWeather(&w, http.StatusOK, ioutil.NopCloser(strings.NewReader(`{"cod":429,"message":"Your account is temporary blocked"}`))); err == nil {
+		t.Error("Expected the error in the weather body")
+	}
+
+	// A failed status without a body and an empty body are errors too
+	if err := o.decodeForecast(&f, http.StatusBadGateway, strings.NewReader("")); err == nil {
+		t.Error("Expected an error for the failed status")
+	}
+	if err := o.decodeWeather(&w, http.StatusOK, ioutil.NopCloser(strings.NewReader(""))); err == nil {
+		t.Error("Expected an error for the empty response")
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// RuleController handles the Web Methods for maintaining the threshold rules and reading their state.
+type RuleController struct {
+	Srv *Server
+}
+
+// AddController adds the controller routes to the router
+func (c *RuleController) AddController(router *mux.Router, s *Server) {
+	c.Srv = s
+	router.Methods("GET").Path("/rules/get").Name("GetRules").
+		Handler(Logger(c, http.HandlerFunc(c.handleGetRules)))
+	router.Methods("GET").Path("/rules/get/{id}").Name("GetRule").
+		Handler(Logger(c, http.HandlerFunc(c.handleGetRule)))
+	router.Methods("POST").Path("/rules/set").Name("SetRule").
+		Handler(Logger(c, http.HandlerFunc(c.handleSetRule)))
+	router.Methods("POST").Path("/rules/delete/{id}").Name("DeleteRule").
+		Handler(Logger(c, http.HandlerFunc(c.handleDeleteRule)))
+}
+
+// LogInfo is used to log information messages for this controller.
+func (c *RuleController) LogInfo(v ...interface{}) {
+	a := fmt.Sprint(v...)
+	logger.Info("RuleController: [Inf] ", a)
+}
+
+// LogError is used to log error messages for this controller.
+func (c *RuleController) LogError(v ...interface{}) {
+	a := fmt.Sprint(v...)
+	logger.Error("RuleController: [Err] ", a)
+}
+
+// Get all the rules and their states
+func (c *RuleController) handleGetRules(w http.ResponseWriter, r *http.Request) {
+	rl := c.getRuleList()
+	if err := rl.WriteTo(w); err != nil {
+		http.Error(w, "Error serializing rules. "+err.Error(), 500)
+	}
+}
+
+// Get a rule and its state
+func (c *RuleController) handleGetRule(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	for _, rs := range c.getRuleList() {
+		if rs.ID == id {
+			if err := rs.WriteTo(w); err != nil {
+				http.Error(w, "Error serializing rule. "+err.Error(), 500)
+			}
+			return
+		}
+	}
+	http.Error(w, "Rule "+id+" does not exist", 404)
+}
+
+// Add a rule, or update the rule with the id
+func (c *RuleController) handleSetRule(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	ru := Rule{
+		ID:       r.Form.Get("id"),
+		Name:     r.Form.Get("name"),
+		Metric:   r.Form.Get("metric"),
+		Operator: r.Form.Get("operator"),
+	}
+	if n := r.Form.Get("location"); n != "" {
+		lc, ok := c.Srv.Config.ForLocation(n)
+		if !ok {
+			http.Error(w, "Unknown location "+n, 400)
+			return
+		}
+		ru.Location = lc.GetNamedLocation()
+	}
+	v, err := strconv.ParseFloat(r.Form.Get("value"), 32)
+	if err != nil {
+		http.Error(w, "Invalid rule value", 400)
+		return
+	}
+	ru.Value = float32(v)
+	if h := r.Form.Get("hours"); h != "" {
+		if ru.Hours, err = strconv.Atoi(h); err != nil {
+			http.Error(w, "Invalid rule hours value", 400)
+			return
+		}
+	}
+	if h := r.Form.Get("hysteresis"); h != "" {
+		hy, err := strconv.ParseFloat(h, 32)
+		if err != nil {
+			http.Error(w, "Invalid rule hysteresis value", 400)
+			return
+		}
+		ru.Hysteresis = float32(hy)
+	}
+	if err := ru.Validate(); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	c.LogInfo("Setting rule ", ru.Name, ".")
+	ru = c.Srv.Config.SetRule(ru)
+	// A changed rule starts again from being clear
+	if c.Srv.Rules != nil {
+		c.Srv.Rules.Remove(ru.ID)
+	}
+	c.Srv.Config.WriteToFile("config.json")
+
+	rs := RuleStatus{Rule: ru}
+	if err := rs.WriteTo(w); err != nil {
+		http.Error(w, "Error serializing rule. "+err.Error(), 500)
+	}
+}
+
+// Delete the rule with the id
+func (c *RuleController) handleDeleteRule(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if !c.Srv.Config.DeleteRule(id) {
+		http.Error(w, "Rule "+id+" does not exist", 404)
+		return
+	}
+	c.LogInfo("Deleted rule ", id, ".")
+	if c.Srv.Rules != nil {
+		c.Srv.Rules.Remove(id)
+	}
+	c.Srv.Config.WriteToFile("config.json")
+}
+
+// getRuleList returns the rules along with their states
+func (c *RuleController) getRuleList() RuleList {
+	rl := RuleList{}
+	for _, ru := range c.Srv.Config.GetRules() {
+		rs := RuleStatus{Rule: ru}
+		if c.Srv.Rules != nil {
+			rs.State = c.Srv.Rules.GetState(ru.ID)
+		}
+		rl = append(rl, rs)
+	}
+	return rl
+}
@@ -0,0 +1,443 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Rule is a threshold on a weather quantity that fires a notification when it is crossed,
+// e.g. temp < 2 in the next 24 hours.
+type Rule struct {
+	ID         string  `json:"id"`                 // Identifier of the rule
+	Name       string  `json:"name"`               // Name of the notification, e.g. Frost warning
+	Metric     string  `json:"metric"`             // Quantity that is compared, one of RuleMetrics
+	Operator   string  `json:"operator"`           // Comparison: <, <=, > or >=
+	Value      float32 `json:"value"`              // Threshold, in the units of the location
+	Hours      int     `json:"hours"`              // Hours of the forecast to look ahead over, 0 for the current weather
+	Hysteresis float32 `json:"hysteresis"`         // Distance the value must move back past the threshold before the rule clears
+	Location   string  `json:"location,omitempty"` // Identifier of the named location whose weather is compared, the configured location if empty
+}
+
+// RuleState holds whether a rule has fired
+type RuleState struct {
+	Fired     bool      `json:"fired"`     // Indicates if the rule has fired and not yet cleared
+	Value     float32   `json:"value"`     // Value the rule was last evaluated against
+	Changed   time.Time `json:"changed"`   // Date and time the rule last fired or cleared
+	Evaluated time.Time `json:"evaluated"` // Date and time the rule was last evaluated
+}
+
+// RuleStatus holds a rule along with its state
+type RuleStatus struct {
+	Rule
+	State RuleState `json:"state"` // State of the rule
+}
+
+// RuleList holds the rules and their states
+type RuleList []RuleStatus
+
+// ruleStateFile is the file the state of the rules is kept in
+const ruleStateFile = "rulestate.json"
+
+// RuleMetric describes a quantity rules can compare
+type RuleMetric struct {
+	Name        string // Name of the metric in a rule
+	Description string // Description shown on the configuration page
+	Current     bool   // Indicates the metric can be compared against the current weather
+	Forecast    bool   // Indicates the metric can be compared against the forecast
+}
+
+// RuleMetrics are the quantities rules can compare
+var RuleMetrics = []RuleMetric{
+	{"temp", "Temperature", true, true},
+	{"feelsLike", "Feels like", true, true},
+	{"dewPoint", "Dew point", true, true},
+	{"humidity", "Humidity", true, true},
+	{"pressure", "Pressure", true, false},
+	{"windSpeed", "Wind Speed", true, true},
+	{"windGust", "Gusts", true, true},
+	{"precip", "Precipitation", true, true},
+	{"precipProb", "Chance of precipitation", false, true},
+	{"uvIndex", "UV index", true, true},
+	{"visibility", "Visibility", true, false},
+}
+
+// Notification is sent when a rule fires or clears
+type Notification struct {
+	Rule    Rule      `json:"rule"`    // Rule that fired or cleared
+	Fired   bool      `json:"fired"`   // True if the rule fired, false if it cleared
+	Value   float32   `json:"value"`   // Value that crossed the threshold
+	Units   Units     `json:"units"`   // Units of measure of the value
+	Time    time.Time `json:"time"`    // Date and time the rule fired or cleared
+	Message string    `json:"message"` // Description of the notification
+}
+
+// Notifier is implemented by the services that notifications can be sent through
+type Notifier interface {
+	Notify(n Notification) error
+}
+
+// LogNotifier writes the notifications to the log
+type LogNotifier struct{}
+
+// Notify writes the notification to the log
+func (l LogNotifier) Notify(n Notification) error {
+	logger.Info("Rules: [Inf] ", n.Message)
+	return nil
+}
+
+// RuleEngine evaluates the rules against the weather and forecast and keeps the state of each rule.
+// Notifications are sent through each of the notifiers when a rule fires or clears.
+type RuleEngine struct {
+	Notifiers []Notifier // Services the notifications are sent through
+	path      string
+	states    map[string]RuleState
+	lock      sync.Mutex
+}
+
+// NewRuleEngine creates a rule engine that keeps the state of the rules in the file at path
+func NewRuleEngine(path string, ns ...Notifier) *RuleEngine {
+	e := &RuleEngine{Notifiers: ns, path: path, states: map[string]RuleState{}}
+	if b, err := ioutil.ReadFile(path); err == nil {
+		json.Unmarshal(b, &e.states)
+	}
+	return e
+}
+
+// Validate checks that the rule can be evaluated
+func (r Rule) Validate() error {
+	if r.Name == "" {
+		return errors.New("The rule name must be specified")
+	}
+	var rm *RuleMetric
+	for i, m := range RuleMetrics {
+		if m.Name == r.Metric {
+			rm = &RuleMetrics[i]
+		}
+	}
+	if rm == nil {
+		return errors.New("Invalid rule metric " + r.Metric)
+	}
+	switch r.Operator {
+	case "<", "<=", ">", ">=":
+	default:
+		return errors.New("Invalid rule operator " + r.Operator)
+	}
+	if r.Hours < 0 {
+		return errors.New("Invalid rule hours value")
+	}
+	if r.Hours == 0 && !rm.Current {
+		return errors.New("The rule metric " + r.Metric + " can only look ahead over the forecast")
+	}
+	if r.Hours != 0 && !rm.Forecast {
+		return errors.New("The rule metric " + r.Metric + " can only be compared against the current weather")
+	}
+	if r.Hysteresis < 0 {
+		return errors.New("Invalid rule hysteresis value")
+	}
+	return nil
+}
+
+// isBelow indicates whether the rule fires when the value is below the threshold
+func (r Rule) isBelow() bool {
+	return r.Operator == "<" || r.Operator == "<="
+}
+
+// next returns whether the rule is fired for the value, given whether it was fired before.
+// A fired rule only clears once the value is the hysteresis back past the threshold.
+func (r Rule) next(fired bool, v float32) bool {
+	if fired {
+		if r.isBelow() {
+			return v < r.Value+r.Hysteresis
+		}
+		return v > r.Value-r.Hysteresis
+	}
+	switch r.Operator {
+	case "<":
+		return v < r.Value
+	case "<=":
+		return v <= r.Value
+	case ">":
+		return v > r.Value
+	}
+	return v >= r.Value
+}
+
+// message returns the description of the rule firing or clearing
+func (r Rule) message(fired bool, v float32, u Units) string {
+	n := r.Name
+	if r.Location != "" {
+		n += " (" + r.Location + ")"
+	}
+	s := fmt.Sprintf("%s: %s is %s%s", n, r.Metric, strconv.FormatFloat(float64(roundTo(v, 1)), 'f', -1, 32), ruleUnit(r.Metric, u))
+	if r.Hours > 0 {
+		s += fmt.Sprintf(" in the next %d hours", r.Hours)
+	}
+	if !fired {
+		return s + ", cleared"
+	}
+	return s + fmt.Sprintf(" (%s %s)", r.Operator, strconv.FormatFloat(float64(r.Value), 'f', -1, 32))
+}
+
+// ruleUnit returns the unit of measure of the metric
+func ruleUnit(metric string, u Units) string {
+	switch metric {
+	case "temp", "feelsLike", "dewPoint":
+		return " " + u.Temp
+	case "humidity", "precipProb":
+		return "%"
+	case "pressure":
+		return " " + u.Pressure
+	case "windSpeed", "windGust":
+		return " " + u.WindSpeed
+	case "precip":
+		return " " + u.Precip
+	case "visibility":
+		return " " + u.Distance
+	}
+	return ""
+}
+
+// GetState returns the state of the rule
+func (e *RuleEngine) GetState(id string) RuleState {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.states[id]
+}
+
+// Remove forgets the state of the rule
+func (e *RuleEngine) Remove(id string) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	delete(e.states, id)
+	e.writeToFile()
+}
+
+// EvaluateWeather evaluates the rules on the current weather against the weather.
+// The weather is converted into the units the rule thresholds are in.
+func (e *RuleEngine) EvaluateWeather(rs []Rule, w Weather, u Units) {
+	w = u.ConvertWeather(w.WithDerived())
+	e.evaluate(rs, u, func(r Rule) (float32, bool) {
+		if r.Hours != 0 {
+			return 0, false
+		}
+		return weatherValue(w, r.Metric)
+	})
+}
+
+// EvaluateForecast evaluates the rules that look ahead against the forecast from t.
+// The forecast is converted into the units the rule thresholds are in.
+func (e *RuleEngine) EvaluateForecast(rs []Rule, f Forecast, u Units, t time.Time) {
+	f = u.ConvertForecast(f.WithDerived())
+	e.evaluate(rs, u, func(r Rule) (float32, bool) {
+		if r.Hours == 0 {
+			return 0, false
+		}
+		return forecastValue(f, r, t)
+	})
+}
+
+// evaluate updates the state of each rule that value returns a value for, and sends a
+// notification for each rule that fired or cleared
+func (e *RuleEngine) evaluate(rs []Rule, u Units, value func(Rule) (float32, bool)) {
+	ns := []Notification{}
+	e.lock.Lock()
+	now := time.Now()
+	for _, r := range rs {
+		v, ok := value(r)
+		if !ok {
+			continue
+		}
+		s := e.states[r.ID]
+		f := r.next(s.Fired, v)
+		if f != s.Fired {
+			s.Changed = now
+			ns = append(ns, Notification{Rule: r, Fired: f, Value: v, Units: u, Time: now, Message: r.message(f, v, u)})
+		}
+		s.Fired = f
+		s.Value = v
+		s.Evaluated = now
+		e.states[r.ID] = s
+	}
+	e.writeToFile()
+	e.lock.Unlock()
+
+	for _, n := range ns {
+		for _, nt := range e.Notifiers {
+			if err := nt.Notify(n); err != nil {
+				logger.Error("Rules: [Err] ", "Error sending notification. "+err.Error())
+			}
+		}
+	}
+}
+
+func (e *RuleEngine) writeToFile() {
+	if e.path == "" {
+		return
+	}
+	if b, err := json.Marshal(e.states); err == nil {
+		ioutil.WriteFile(e.path, b, 0666)
+	}
+}
+
+// weatherValue returns the value of the metric in the weather. The feels like temperature
+// and dew point computed from the weather are used if the provider does not report them.
+func weatherValue(w Weather, metric string) (float32, bool) {
+	switch metric {
+	case "temp":
+		return w.Temp, true
+	case "feelsLike":
+		if w.FeelsLike == 0 && w.Derived != nil {
+			return w.Derived.ApparentTemp, true
+		}
+		return w.FeelsLike, w.FeelsLike != 0
+	case "dewPoint":
+		if w.DewPoint == 0 && w.Derived != nil {
+			return w.Derived.DewPoint, true
+		}
+		return w.DewPoint, w.DewPoint != 0
+	case "humidity":
+		return w.Humidity, w.Humidity != 0
+	case "pressure":
+		return w.Pressure, w.Pressure != 0
+	case "windSpeed":
+		return w.WindSpeed, true
+	case "windGust":
+		return w.WindGust, w.WindGust != 0
+	case "precip":
+		// A weather station reports the rate, the precipitation that would fall over an hour
+		if w.Precip == 0 && w.PrecipRate != 0 {
+			return w.PrecipRate, true
+		}
+		return w.Precip, true
+	case "uvIndex":
+		return w.UVIndex, true
+	case "visibility":
+		return w.Visibility, w.Visibility != 0
+	}
+	return 0, false
+}
+
+// forecastValue returns the most extreme value of the metric in the direction of the rule
+// over the rule's hours from t. The hourly forecast is used if the provider has one,
+// otherwise the forecast of the days the hours fall on.
+func forecastValue(f Forecast, r Rule, t time.Time) (float32, bool) {
+	vs := []float32{}
+	for _, h := range f.NextHours(t, r.Hours).Hourly {
+		if v, ok := hourValue(h, r.Metric); ok {
+			vs = append(vs, v)
+		}
+	}
+	if len(vs) == 0 {
+		end := t.Add(time.Duration(r.Hours) * time.Hour)
+		for _, d := range f.Forecast {
+			if d.Day.After(end) || d.Day.Add(24*time.Hour).Before(t) {
+				continue
+			}
+			if v, ok := dayValue(d, r.Metric, r.isBelow(), f.Units); ok {
+				vs = append(vs, v)
+			}
+		}
+	}
+	if len(vs) == 0 {
+		return 0, false
+	}
+	x := vs[0]
+	for _, v := range vs[1:] {
+		if r.isBelow() {
+			x = float32(math.Min(float64(x), float64(v)))
+		} else {
+			x = float32(math.Max(float64(x), float64(v)))
+		}
+	}
+	return x, true
+}
+
+// hourValue returns the value of the metric in the hourly forecast
+func hourValue(h ForecastHour, metric string) (float32, bool) {
+	switch metric {
+	case "temp":
+		return h.Temp, true
+	case "feelsLike":
+		if h.Derived != nil {
+			return h.Derived.ApparentTemp, true
+		}
+	case "dewPoint":
+		if h.Derived != nil {
+			return h.Derived.DewPoint, true
+		}
+	case "humidity":
+		return h.Humidity, h.Humidity != 0
+	case "windSpeed":
+		return h.WindSpeed, true
+	case "precip":
+		return h.Precip, true
+	case "precipProb":
+		return h.PrecipProb, true
+	}
+	return 0, false
+}
+
+// dayValue returns the value of the metric in the day's forecast, in the units. For the temperature
+// this is the minimum if the rule fires below the threshold, otherwise the maximum. The feels like
+// temperature is derived from that temperature and the dew point from the mean temperature,
+// along with the day's humidity and wind.
+func dayValue(d ForecastDay, metric string, below bool, u Units) (float32, bool) {
+	temp := d.TempMax
+	if below {
+		temp = d.TempMin
+	}
+	switch metric {
+	case "temp":
+		return temp, true
+	case "feelsLike":
+		if m := deriveMetrics(temp, d.Humidity, d.WindSpeed, u); m != nil {
+			return m.ApparentTemp, true
+		}
+	case "dewPoint":
+		if m := deriveMetrics((d.TempMin+d.TempMax)/2, d.Humidity, d.WindSpeed, u); m != nil {
+			return m.DewPoint, true
+		}
+	case "humidity":
+		return d.Humidity, d.Humidity != 0
+	case "windSpeed":
+		return d.WindSpeed, true
+	case "windGust":
+		return d.WindGust, d.WindGust != 0
+	case "precip":
+		return d.Precip, true
+	case "precipProb":
+		return d.PrecipProb, true
+	case "uvIndex":
+		return d.UVIndex, true
+	}
+	return 0, false
+}
+
+// WriteTo serializes the entity and writes it to the http response
+func (c *RuleStatus) WriteTo(w http.ResponseWriter) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("content-type", "application/json")
+	w.Write(b)
+	return nil
+}
+
+// WriteTo serializes the entity and writes it to the http response
+func (c RuleList) WriteTo(w http.ResponseWriter) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("content-type", "application/json")
+	w.Write(b)
+	return nil
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// testNotifier records the notifications sent to it
+type testNotifier struct {
+	Sent []Notification
+}
+
+func (n *testNotifier) Notify(nt Notification) error {
+	n.Sent = append(n.Sent, nt)
+	return nil
+}
+
+func TestRuleHysteresis(t *testing.T) {
+	r := Rule{Name: "Frost warning", Metric: "temp", Operator: "<", Value: 2, Hysteresis: 1}
+	fired := false
+	for _, c := range []struct {
+		v    float32
+		want bool
+	}{{3, false}, {1.5, true}, {2.5, true}, {2.9, true}, {3, false}, {2.5, false}, {1.9, true}} {
+		fired = r.next(fired, c.v)
+		if fired != c.want {
+			t.Error("Value", c.v, "expected fired", c.want, "got", fired)
+		}
+	}
+
+	r = Rule{Name: "Gale", Metric: "windGust", Operator: ">=", Value: 60, Hysteresis: 10}
+	if !r.next(false, 60) || !r.next(true, 51) || r.next(true, 50) {
+		t.Error("Unexpected state of the rule above the threshold")
+	}
+}
+
+func TestRuleValidation(t *testing.T) {
+	ok := Rule{Name: "Frost warning", Metric: "temp", Operator: "<", Value: 2, Hours: 24}
+	if err := ok.Validate(); err != nil {
+		t.Error(err)
+	}
+	for _, r := range []Rule{
+		{Metric: "temp", Operator: "<"},
+		{Name: "x", Metric: "snowDepth", Operator: "<"},
+		{Name: "x", Metric: "temp", Operator: "=="},
+		{Name: "x", Metric: "temp", Operator: "<", Hours: -1},
+		{Name: "x", Metric: "temp", Operator: "<", Hysteresis: -1},
+		{Name: "x", Metric: "precipProb", Operator: ">"},
+		{Name: "x", Metric: "pressure", Operator: "<", Hours: 12},
+		{Name: "x", Metric: "visibility", Operator: "<", Hours: 12},
+	} {
+		if r.Validate() == nil {
+			t.Error("Expected the rule to be invalid", r)
+		}
+	}
+}
+
+func TestEveryValidRuleIsEvaluated(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	w := Weather{Temp: 20, Pressure: 1013, Humidity: 60, WindSpeed: 5, WindGust: 9, FeelsLike: 19, DewPoint: 12,
+		Visibility: 10, UVIndex: 4, Precip: 0.5, Units: SIUnits}
+	day := ForecastDay{Day: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), TempMin: 12, TempMax: 22, PrecipProb: 40,
+		Precip: 2, WindSpeed: 6, WindGust: 11, Humidity: 70, UVIndex: 5}
+	daily := Forecast{Current: w, Forecast: []ForecastDay{day}, Units: SIUnits}
+	hourly := daily
+	hourly.Hourly = []ForecastHour{{Time: now, Period: 1, Temp: 18, PrecipProb: 30, Precip: 0.4, Humidity: 65, WindSpeed: 4}}
+
+	for _, m := range RuleMetrics {
+		for _, hours := range []int{0, 24} {
+			r := Rule{ID: m.Name, Name: m.Name, Metric: m.Name, Operator: ">", Value: -100, Hours: hours}
+			if r.Validate() != nil {
+				continue
+			}
+			if hours == 0 {
+				n := &testNotifier{}
+				NewRuleEngine("", n).EvaluateWeather([]Rule{r}, w, MetricUnits)
+				if len(n.Sent) != 1 {
+					t.Error("Expected the rule to be evaluated against the weather", r)
+				}
+				continue
+			}
+			for _, f := range []Forecast{hourly, daily} {
+				n := &testNotifier{}
+				NewRuleEngine("", n).EvaluateForecast([]Rule{r}, f, MetricUnits, now)
+				if len(n.Sent) != 1 {
+					t.Error("Expected the rule to be evaluated against the forecast", r, len(f.Hourly))
+				}
+			}
+		}
+	}
+}
+
+func TestRuleEngineNotifiesWhenRulesFireAndClear(t *testing.T) {
+	n := &testNotifier{}
+	e := NewRuleEngine("", n)
+	rs := []Rule{
+		{ID: "gust", Name: "Gale", Metric: "windGust", Operator: ">", Value: 60, Hysteresis: 5},
+		{ID: "frost", Name: "Frost warning", Metric: "temp", Operator: "<", Value: 2, Hours: 24},
+	}
+
+	// 20 m/s is 72 km/h, the rule thresholds are in the configured units
+	e.EvaluateWeather(rs, Weather{Temp: 10, WindGust: 20, Units: SIUnits}, MetricUnits)
+	if len(n.Sent) != 1 || !n.Sent[0].Fired || n.Sent[0].Rule.ID != "gust" {
+		t.Fatal("Expected the gust rule to fire", n.Sent)
+	}
+	if n.Sent[0].Message != "Gale: windGust is 72 km/h (> 60)" {
+		t.Error("Unexpected message", n.Sent[0].Message)
+	}
+	if s := e.GetState("frost"); !s.Evaluated.IsZero() {
+		t.Error("Expected the forecast rule not to be evaluated against the current weather")
+	}
+
+	// Still above the threshold less the hysteresis
+	e.EvaluateWeather(rs, Weather{Temp: 10, WindGust: 16, Units: SIUnits}, MetricUnits)
+	if len(n.Sent) != 1 || !e.GetState("gust").Fired {
+		t.Error("Expected the gust rule to stay fired", n.Sent)
+	}
+
+	e.EvaluateWeather(rs, Weather{Temp: 10, WindGust: 10, Units: SIUnits}, MetricUnits)
+	if len(n.Sent) != 2 || n.Sent[1].Fired || e.GetState("gust").Fired {
+		t.Error("Expected the gust rule to clear", n.Sent)
+	}
+}
+
+func TestForecastRulesLookAhead(t *testing.T) {
+	n := &testNotifier{}
+	e := NewRuleEngine("", n)
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	f := Forecast{Hourly: []ForecastHour{
+		{Time: now, Period: 1, Temp: 8},
+		{Time: now.Add(10 * time.Hour), Period: 1, Temp: 1.2},
+		{Time: now.Add(30 * time.Hour), Period: 1, Temp: -4},
+	}}
+	rs := []Rule{
+		{ID: "frost", Name: "Frost warning", Metric: "temp", Operator: "<", Value: 2, Hours: 24},
+		{ID: "hard", Name: "Hard frost", Metric: "temp", Operator: "<", Value: -2, Hours: 24},
+		{ID: "gust", Name: "Gale", Metric: "windGust", Operator: ">", Value: 60},
+	}
+	e.EvaluateForecast(rs, f, MetricUnits, now)
+	if len(n.Sent) != 1 || n.Sent[0].Rule.ID != "frost" || n.Sent[0].Value != 1.2 {
+		t.Error("Expected only the frost rule to fire on the coldest hour", n.Sent)
+	}
+	if !strings.HasSuffix(n.Sent[0].Message, "in the next 24 hours (< 2)") {
+		t.Error("Unexpected message", n.Sent[0].Message)
+	}
+
+	// Without an hourly forecast the days the hours fall on are used
+	d := Forecast{Forecast: []ForecastDay{
+		{Day: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), TempMin: 5, TempMax: 15},
+		{Day: time.Date(2024, 6, 2, 0, 0, 0, 0, time.UTC), TempMin: -3, TempMax: 9},
+		{Day: time.Date(2024, 6, 3, 0, 0, 0, 0, time.UTC), TempMin: -8, TempMax: 4},
+	}}
+	if v, ok := forecastValue(d, rs[0], now); !ok || v != -3 {
+		t.Error("Expected the minimum of the next day, got", v, ok)
+	}
+	r := Rule{Metric: "temp", Operator: ">", Hours: 6}
+	if v, ok := forecastValue(d, r, now); !ok || v != 15 {
+		t.Error("Expected the maximum of today, got", v, ok)
+	}
+}
+
+func TestRuleStateIsKept(t *testing.T) {
+	chdirTemp(t)
+
+	e := NewRuleEngine(ruleStateFile)
+	rs := []Rule{{ID: "frost", Name: "Frost warning", Metric: "temp", Operator: "<", Value: 2}}
+	e.EvaluateWeather(rs, Weather{Temp: 0, Units: SIUnits}, MetricUnits)
+
+	// The rule does not fire again after a restart
+	n := &testNotifier{}
+	e = NewRuleEngine(ruleStateFile, n)
+	e.EvaluateWeather(rs, Weather{Temp: 0, Units: SIUnits}, MetricUnits)
+	if !e.GetState("frost").Fired || len(n.Sent) != 0 {
+		t.Error("Expected the fired state to be kept", e.GetState("frost"), n.Sent)
+	}
+}
+
+func TestRulesCanBeAddedAndDeleted(t *testing.T) {
+	chdirTemp(t)
+
+	s := &Server{Config: &Config{}, Rules: NewRuleEngine(ruleStateFile)}
+	router := mux.NewRouter()
+	c := RuleController{}
+	c.AddController(router, s)
+
+	form := url.Values{"name": {"Frost warning"}, "metric": {"temp"}, "operator": {"<"}, "value": {"2"}, "hours": {"24"}, "hysteresis": {"1"}}
+	req := httptest.NewRequest("POST", "/rules/set", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	rs := RuleStatus{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &rs); err != nil {
+		t.Fatal(err, rec.Body.String())
+	}
+	if rs.ID == "" || rs.Name != "Frost warning" || rs.Hours != 24 || rs.Hysteresis != 1 {
+		t.Error("Unexpected rule", rs)
+	}
+
+	// The rule is saved with the configuration
+	cfg := Config{}
+	if err := cfg.ReadFromFile("config.json"); err != nil || len(cfg.Rules) != 1 {
+		t.Error("Expected the rule to be saved", cfg.Rules, err)
+	}
+
+	s.Rules.EvaluateForecast(s.Config.GetRules(), Forecast{Hourly: []ForecastHour{{Time: time.Now(), Period: 1, Temp: 0}}}, MetricUnits, time.Now())
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/rules/get/"+rs.ID, nil))
+	if err := json.Unmarshal(rec.Body.Bytes(), &rs); err != nil || !rs.State.Fired {
+		t.Error("Expected the rule to have fired", rec.Body.String())
+	}
+
+	form.Set("operator", "!")
+	req = httptest.NewRequest("POST", "/rules/set", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != 400 || len(s.Config.Rules) != 1 {
+		t.Error("Expected an invalid rule to be rejected", rec.Code)
+	}
+	form.Set("operator", "<")
+	form.Set("value", "cold")
+	req = httptest.NewRequest("POST", "/rules/set", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != 400 || len(s.Config.Rules) != 1 {
+		t.Error("Expected an invalid value to be rejected", rec.Code)
+	}
+
+	// A rule on a named location is kept with the location's identifier
+	s.Config.Locations = newLocationsConfig().Locations
+	form.Set("id", rs.ID)
+	form.Set("value", "2")
+	form.Set("location", "Kyiv")
+	req = httptest.NewRequest("POST", "/rules/set", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if err := json.Unmarshal(rec.Body.Bytes(), &rs); err != nil || rs.Location != "kyiv" {
+		t.Error("Expected the rule to be on the location", rec.Body.String())
+	}
+	form.Set("location", "nowhere")
+	req = httptest.NewRequest("POST", "/rules/set", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != 400 || len(s.Config.Rules) != 1 {
+		t.Error("Expected an unknown location to be rejected", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("POST", "/rules/delete/"+rs.ID, nil))
+	if rec.Code != 200 || len(s.Config.Rules) != 0 {
+		t.Error("Expected the rule to be deleted", rec.Code, rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/rules/get/"+rs.ID, nil))
+	if rec.Code != 404 {
+		t.Error("Expected a deleted rule not to be found", rec.Code)
+	}
+}
+
+func TestFreshWeatherIsEvaluatedAgainstRules(t *testing.T) {
+	chdirTemp(t)
+
+	n := &testNotifier{}
+	cfg := &Config{Rules: []Rule{{ID: "heat", Name: "Heat", Metric: "temp", Operator: ">", Value: 30}}}
+	c := WeatherController{Srv: &Server{Config: cfg, Rules: NewRuleEngine("", n)}}
+	ps := []WeatherProvider{&testProvider{Name: "Hot", Temp: 35}}
+
+	c.getCurrentWeather(cfg, ps)
+	// The cached weather is not evaluated again
+	c.getCurrentWeather(cfg, ps)
+	if len(n.Sent) != 1 || !n.Sent[0].Fired {
+		t.Error("Expected the rule to fire once", n.Sent)
+	}
+}
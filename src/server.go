@@ -19,6 +19,10 @@ type Server struct {
 	VerboseLogging bool              // Verbose logging on/ off
 	Timeout        int               // Timeout waiting for a response from an IP probe.  Defaults to 2 seconds.
 	Config         *Config           // Configuration settings
+	Rules          *RuleEngine       // Evaluates the threshold rules and keeps their state
+	Webhooks       *WebhookSender    // Posts weather events to the webhooks
+	MQTT           *MQTTPublisher    // Publishes the weather to an MQTT broker
+	History        *HistoryStore     // Keeps the weather observations
 	Reg            bool              // Register with the finder server
 	Finder         gopifinder.Finder // Finder client - used to find other devices
 	exit           chan struct{}     // Exit flag
@@ -82,6 +86,11 @@ func (s *Server) run() {
 	}
 	s.Config.ReadFromFile("config.json")
 	s.Config.SetDefaults()
+	s.Webhooks = NewWebhookSender(s.Config)
+	s.Rules = NewRuleEngine(ruleStateFile, LogNotifier{}, s.Webhooks)
+	go s.Webhooks.Run(s.exit)
+	s.MQTT = NewMQTTPublisher(s.Config)
+	s.History = NewHistoryStore("history")
 
 	// Create a router
 	s.router = mux.NewRouter().StrictSlash(true)
@@ -92,6 +101,11 @@ func (s *Server) run() {
 	s.addController(new(ConfigController))
 	s.addController(new(WeatherController))
 	s.addController(new(MoonController))
+	s.addController(new(StationController))
+	s.addController(new(RuleController))
+	s.addController(new(WebhookController))
+	s.addController(new(LocationController))
+	s.addController(new(MetricsController))
 
 	// Create an HTTP server
 	s.http = &http.Server{
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StationReading holds the latest reading uploaded by a personal weather station.
+// The values are converted to metric units when the reading is received.
+type StationReading struct {
+	StationID      string    `json:"stationID"`      // Station identifier
+	Software       string    `json:"software"`       // Station software or model
+	Received       time.Time `json:"received"`       // Date and time the reading was received
+	ReadingTime    time.Time `json:"readingTime"`    // Date and time the reading was taken
+	Temp           float32   `json:"temp"`           // Outdoor temperature (°C)
+	Humidity       float32   `json:"humidity"`       // Outdoor humidity (%)
+	DewPoint       float32   `json:"dewPoint"`       // Dew point (°C)
+	Pressure       float32   `json:"pressure"`       // Relative barometric pressure (hPa)
+	WindSpeed      float32   `json:"windSpeed"`      // Wind speed (km/h)
+	WindGust       float32   `json:"windGust"`       // Wind gust (km/h)
+	WindDirection  float32   `json:"windDirection"`  // Wind direction (degrees)
+	RainRate       float32   `json:"rainRate"`       // Rain rate (mm/h)
+	DailyRain      float32   `json:"dailyRain"`      // Rain since midnight (mm)
+	SolarRadiation float32   `json:"solarRadiation"` // Solar radiation (W/m²)
+	UVIndex        float32   `json:"uvIndex"`        // UV Index
+}
+
+// stationFile is the file the latest station reading is kept in
+var stationFile = "laststation.json"
+
+// stationMaxAge is the age after which a station reading is no longer considered current
+const stationMaxAge = 30 * time.Minute
+
+// ParseStationReading converts the values uploaded using either the Weather Underground
+// or the Ecowitt upload protocol into a station reading.
+func ParseStationReading(v url.Values) (StationReading, error) {
+	// Parameter names are not consistently cased between the protocols and stations
+	l := url.Values{}
+	for k, a := range v {
+		l[strings.ToLower(k)] = a
+	}
+	r := StationReading{
+		StationID: l.Get("id"),
+		Software:  l.Get("softwaretype"),
+		Received:  time.Now(),
+	}
+	if r.StationID == "" {
+		r.StationID = l.Get("stationtype")
+	}
+	if m := l.Get("model"); m != "" {
+		r.Software = m
+	}
+
+	r.ReadingTime = r.Received
+	if d := l.Get("dateutc"); d != "" && d != "now" {
+		t, err := time.Parse("2006-01-02 15:04:05", d)
+		if err != nil {
+			return r, errors.New("Invalid dateutc value " + d)
+		}
+		r.ReadingTime = t
+	}
+
+	var err error
+	get := func(k ...string) (float32, bool) {
+		for _, n := range k {
+			s := l.Get(n)
+			if s == "" {
+				continue
+			}
+			f, e := strconv.ParseFloat(s, 32)
+			if e != nil {
+				err = errors.New("Invalid " + n + " value " + s)
+				return 0, false
+			}
+			// Weather Underground uses -9999 for values that are not available
+			if f <= -9999 {
+				return 0, false
+			}
+			return float32(f), true
+		}
+		return 0, false
+	}
+	t, hasTemp := get("tempf")
+	if hasTemp {
+		r.Temp = fahrenheitToCelsius(t)
+	}
+	if f, ok := get("humidity"); ok {
+		r.Humidity = f
+	}
+	if f, ok := get("dewptf"); ok {
+		r.DewPoint = fahrenheitToCelsius(f)
+	}
+	if f, ok := get("baromin", "baromrelin", "baromabsin"); ok {
+		r.Pressure = f * 33.863886
+	}
+	if f, ok := get("windspeedmph"); ok {
+		r.WindSpeed = f * 1.609344
+	}
+	if f, ok := get("windgustmph"); ok {
+		r.WindGust = f * 1.609344
+	}
+	if f, ok := get("winddir"); ok {
+		r.WindDirection = f
+	}
+	if f, ok := get("rainratein", "rainin"); ok {
+		r.RainRate = f * 25.4
+	}
+	if f, ok := get("dailyrainin"); ok {
+		r.DailyRain = f * 25.4
+	}
+	if f, ok := get("solarradiation"); ok {
+		r.SolarRadiation = f
+	}
+	if f, ok := get("uv"); ok {
+		r.UVIndex = f
+	}
+	if err != nil {
+		return r, err
+	}
+	if !hasTemp {
+		return r, errors.New("The reading does not contain an outdoor temperature")
+	}
+	return r, nil
+}
+
+// ReadFromFile will read the station reading from the specified file
+func (r *StationReading) ReadFromFile(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(b, r)
+	}
+	return err
+}
+
+// WriteToFile will write the station reading to the specified file
+func (r *StationReading) WriteToFile(path string) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0666)
+}
+
+// WriteTo serializes the entity and writes it to the http response
+func (r *StationReading) WriteTo(w http.ResponseWriter) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("content-type", "application/json")
+	w.Write(b)
+	return nil
+}
+
+func fahrenheitToCelsius(f float32) float32 {
+	return (f - 32) * 5 / 9
+}
+
+// Station is a weather provider that returns the latest reading uploaded by a personal weather station.
+type Station struct {
+	Config *Config // Current Configuration
+}
+
+func init() {
+	RegisterProvider(ProviderInfo{
+		Name:          "Station",
+		Description:   "Personal Weather Station",
+		AppIDOptional: true,
+		Precip:        "precipRate",
+		New:           func() WeatherProvider { return new(Station) },
+	})
+}
+
+// SetConfig sets the configuration for the provider
+func (p *Station) SetConfig(c *Config) {
+	p.Config = c
+}
+
+// GetProviderName returns the name of the provider
+func (p *Station) GetProviderName() string {
+	return "Station"
+}
+
+// GetWeather returns the latest reading received from the weather station
+func (p *Station) GetWeather() (Weather, error) {
+	w := Weather{
+		Provider: p.GetProviderName(),
+		Created:  time.Now(),
+		Name:     p.Config.LocationName,
+	}
+	r := StationReading{}
+	if err := r.ReadFromFile(stationFile); err != nil {
+		if os.IsNotExist(err) {
+			return w, errors.New("No readings have been received from the weather station")
+		}
+		return w, err
+	}
+	if time.Since(r.Received) > stationMaxAge {
+		return w, errors.New("The last weather station reading was received at " + r.Received.Format(time.RFC3339))
+	}
+	p.decodeWeather(&w, r)
+
+	// Load the sunrise and sunset times
+	if sr, ss, err := GetSunriseSunset(p.Config, time.Now()); err == nil {
+		w.Sunrise = sr
+		w.Sunset = ss
+		w.IsDay = time.Now().After(sr) && time.Now().Before(ss)
+	}
+	return w, nil
+}
+
+// GetForecast returns the latest reading received from the weather station as the current weather.
+// A weather station cannot provide a forecast so an error is always returned.
+func (p *Station) GetForecast() (Forecast, error) {
+	w, err := p.GetWeather()
+	f := Forecast{Current: w}
+	if err != nil {
+		return f, err
+	}
+	return f, errors.New("The weather station does not provide a forecast")
+}
+
+func (p *Station) decodeWeather(w *Weather, r StationReading) {
+	w.ID = r.StationID
+	w.ReadingTime = r.ReadingTime
+	w.Temp = r.Temp
+	w.Humidity = r.Humidity
+	// The measured dew point is kept rather than calculated from the temperature and humidity
+	w.DewPoint = r.DewPoint
+	w.Pressure = r.Pressure
+	// km/h to m/s
+	w.WindSpeed = r.WindSpeed / 3.6
+	w.WindGust = r.WindGust / 3.6
+	w.WindDirection = r.WindDirection
+	w.UVIndex = r.UVIndex
+	w.PrecipRate = r.RainRate
+
+	// A station cannot tell how cloudy it is, only whether it is raining
+	switch {
+	case r.RainRate >= 2.5:
+		w.WeatherIcon, w.WeatherDesc = 6, T(p.Config.Language, "Rain")
+	case r.RainRate > 0:
+		w.WeatherIcon, w.WeatherDesc = 5, T(p.Config.Language, "Light Rain")
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCanParseWundergroundReading(t *testing.T) {
+	v, err := url.ParseQuery("ID=KTXHOUST123&PASSWORD=secret&dateutc=2025-10-18+14%3A52%3A00&tempf=68.0&humidity=55&dewptf=51.3&windspeedmph=10&windgustmph=15.5&winddir=225&baromin=29.92&rainin=0.1&dailyrainin=0.25&solarradiation=512.3&UV=4&softwaretype=EasyWeatherV1.6.4&action=updateraw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := ParseStationReading(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.StationID != "KTXHOUST123" || r.Software != "EasyWeatherV1.6.4" {
+		t.Error("Unexpected station", r.StationID, r.Software)
+	}
+	if !r.ReadingTime.Equal(time.Date(2025, 10, 18, 14, 52, 0, 0, time.UTC)) {
+		t.Error("Unexpected reading time", r.ReadingTime)
+	}
+	checkClose(t, "Temp", r.Temp, 20)
+	checkClose(t, "DewPoint", r.DewPoint, 10.72)
+	checkClose(t, "Pressure", r.Pressure, 1013.2)
+	checkClose(t, "WindSpeed", r.WindSpeed, 16.09)
+	checkClose(t, "WindGust", r.WindGust, 24.94)
+	checkClose(t, "RainRate", r.RainRate, 2.54)
+	checkClose(t, "DailyRain", r.DailyRain, 6.35)
+	if r.Humidity != 55 || r.WindDirection != 225 || r.UVIndex != 4 {
+		t.Error("Unexpected reading", r)
+	}
+}
+
+func TestCanParseEcowittReading(t *testing.T) {
+	v, err := url.ParseQuery("PASSKEY=ABCDEF0123456789&stationtype=GW1000B_V1.7.3&dateutc=2025-10-18+14:52:16&tempinf=72.3&humidityin=48&baromrelin=30.012&baromabsin=29.285&tempf=50.0&humidity=91&winddir=12&windspeedmph=2.5&windgustmph=4.5&rainratein=0.000&dailyrainin=0.118&solarradiation=0.00&uv=0&freq=868M&model=GW1000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := ParseStationReading(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.StationID != "GW1000B_V1.7.3" || r.Software != "GW1000" {
+		t.Error("Unexpected station", r.StationID, r.Software)
+	}
+	checkClose(t, "Temp", r.Temp, 10)
+	checkClose(t, "Pressure", r.Pressure, 1016.32)
+	checkClose(t, "DailyRain", r.DailyRain, 3.0)
+	if r.Humidity != 91 {
+		t.Error("The outdoor humidity was not used", r.Humidity)
+	}
+}
+
+func TestInvalidStationReadingFails(t *testing.T) {
+	for _, q := range []string{"ID=KTX&humidity=50", "tempf=abc", "tempf=60&dateutc=yesterday"} {
+		v, _ := url.ParseQuery(q)
+		if _, err := ParseStationReading(v); err == nil {
+			t.Error("Expected an error for", q)
+		}
+	}
+	v, _ := url.ParseQuery("tempf=60&humidity=-9999")
+	if r, err := ParseStationReading(v); err != nil || r.Humidity != 0 {
+		t.Error("Missing values were not ignored", r.Humidity, err)
+	}
+}
+
+func TestStationUploadAndProvider(t *testing.T) {
+	of := stationFile
+	stationFile = filepath.Join(t.TempDir(), "laststation.json")
+	defer func() { stationFile = of }()
+
+	s := &Server{Config: &Config{Latitude: 29.76, Longitude: -95.37, StationKey: "secret"}}
+	c := StationController{Srv: s}
+
+	// Wrong password
+	rec := httptest.NewRecorder()
+	c.handleWundergroundUpload(rec, httptest.NewRequest("GET", "/weatherstation/updateweatherstation.php?ID=K1&PASSWORD=wrong&dateutc=now&tempf=77", nil))
+	if rec.Code != 401 {
+		t.Error("Expected the upload to be rejected, got", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	c.handleWundergroundUpload(rec, httptest.NewRequest("GET", "/weatherstation/updateweatherstation.php?ID=K1&PASSWORD=secret&dateutc=now&tempf=77&dewptf=59&windspeedmph=11.18&windgustmph=22.37&UV=6&rainin=0.2", nil))
+	if rec.Code != 200 || rec.Body.String() != "success\n" {
+		t.Error("Unexpected response", rec.Code, rec.Body.String())
+	}
+
+	p := Station{Config: s.Config}
+	w, err := p.GetWeather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkClose(t, "Temp", w.Temp, 25)
+	checkClose(t, "DewPoint", w.DewPoint, 15)
+	checkClose(t, "WindSpeed", w.WindSpeed, 5)
+	checkClose(t, "WindGust", w.WindGust, 10)
+	if w.ID != "K1" || w.WeatherIcon != 6 || w.UVIndex != 6 {
+		t.Error("Unexpected weather", w)
+	}
+
+	// The gust and UV index of the station can fire rules
+	if v, ok := weatherValue(w, "windGust"); !ok || v != w.WindGust {
+		t.Error("Expected the gust of the station to be compared", v, ok)
+	}
+	if v, _ := weatherValue(w.WithDerived(), "dewPoint"); v != w.DewPoint {
+		t.Error("Expected the measured dew point to be compared, got", v)
+	}
+
+	req := httptest.NewRequest("POST", "/data/report/", strings.NewReader("PASSKEY=secret&stationtype=GW1000&tempf=32"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	c.handleEcowittUpload(rec, req)
+	if rec.Code != 200 {
+		t.Error("Unexpected response", rec.Code, rec.Body.String())
+	}
+	w, _ = p.GetWeather()
+	checkClose(t, "Temp", w.Temp, 0)
+
+	if _, err := p.GetForecast(); err == nil {
+		t.Error("Expected an error as a station cannot forecast")
+	}
+}
+
+func TestStaleStationReadingFails(t *testing.T) {
+	of := stationFile
+	stationFile = filepath.Join(t.TempDir(), "laststation.json")
+	defer func() { stationFile = of }()
+
+	p := Station{Config: &Config{}}
+	if _, err := p.GetWeather(); err == nil {
+		t.Error("Expected an error when no reading has been received")
+	}
+	r := StationReading{Received: time.Now().Add(-time.Hour), Temp: 20}
+	r.WriteToFile(stationFile)
+	if _, err := p.GetWeather(); err == nil {
+		t.Error("Expected an error for a stale reading")
+	}
+}
+
+func checkClose(t *testing.T, n string, v float32, e float32) {
+	t.Helper()
+	if d := v - e; d > 0.01 || d < -0.01 {
+		t.Error(n, "is", v, "expected", e)
+	}
+}
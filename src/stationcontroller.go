@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/mux"
+)
+
+// StationController handles the Web Methods used by personal weather stations to upload their readings.
+// Stations can upload using either the Weather Underground or the Ecowitt custom server protocol.
+type StationController struct {
+	Srv *Server
+}
+
+// AddController adds the controller routes to the router
+func (c *StationController) AddController(router *mux.Router, s *Server) {
+	c.Srv = s
+	router.Methods("GET").Path("/weatherstation/updateweatherstation.php").Name("StationUploadWunderground").
+		Handler(Logger(c, http.HandlerFunc(c.handleWundergroundUpload)))
+	router.Methods("POST").PathPrefix("/data/report").Name("StationUploadEcowitt").
+		Handler(Logger(c, http.HandlerFunc(c.handleEcowittUpload)))
+	router.Methods("GET").Path("/station/get").Name("GetStation").
+		Handler(Logger(c, http.HandlerFunc(c.handleGetStation)))
+}
+
+// LogInfo is used to log information messages for this controller.
+func (c *StationController) LogInfo(v ...interface{}) {
+	a := fmt.Sprint(v...)
+	logger.Info("StationController: [Inf] ", a)
+}
+
+// LogError is used to log error messages for this controller.
+func (c *StationController) LogError(v ...interface{}) {
+	a := fmt.Sprint(v...)
+	logger.Error("StationController: [Err] ", a)
+}
+
+// Receive a reading using the Weather Underground protocol
+func (c *StationController) handleWundergroundUpload(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	if !c.saveReading(w, r.Form, r.Form.Get("PASSWORD")) {
+		return
+	}
+	// Weather Underground clients expect this response
+	w.Write([]byte("success\n"))
+}
+
+// Receive a reading using the Ecowitt protocol
+func (c *StationController) handleEcowittUpload(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	c.saveReading(w, r.PostForm, r.PostForm.Get("PASSKEY"))
+}
+
+// Get the latest reading received from the station
+func (c *StationController) handleGetStation(w http.ResponseWriter, r *http.Request) {
+	sr := StationReading{}
+	if err := sr.ReadFromFile(stationFile); err != nil {
+		http.Error(w, "No readings have been received from the weather station", 404)
+		return
+	}
+	if err := sr.WriteTo(w); err != nil {
+		http.Error(w, "Error serializing station reading. "+err.Error(), 500)
+	}
+}
+
+func (c *StationController) saveReading(w http.ResponseWriter, v url.Values, key string) bool {
+	if c.Srv.Config.StationKey != "" && key != c.Srv.Config.StationKey {
+		c.LogError("Station reading rejected, invalid station key.")
+		http.Error(w, "Invalid station key", 401)
+		return false
+	}
+	sr, err := ParseStationReading(v)
+	if err != nil {
+		c.LogError("Invalid station reading. " + err.Error())
+		http.Error(w, "Invalid station reading. "+err.Error(), 400)
+		return false
+	}
+	if err := sr.WriteToFile(stationFile); err != nil {
+		c.LogError("Error saving station reading. " + err.Error())
+		http.Error(w, "Error saving station reading. "+err.Error(), 500)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DayStats holds the statistics of the observations of a day.
+// The values are in SI units until they are converted.
+type DayStats struct {
+	Date     string   `json:"date"`     // Date in the location, as yyyy-mm-dd
+	TempMin  float64  `json:"tempMin"`  // Lowest temperature
+	TempMax  float64  `json:"tempMax"`  // Highest temperature
+	TempMean float64  `json:"tempMean"` // Mean of the temperatures observed
+	Precip   *float64 `json:"precip"`   // Total precipitation, or null if no provider that reports it was observed
+	MaxGust  float64  `json:"maxGust"`  // Strongest gust, or the strongest wind if no gusts were reported
+	Icon     int      `json:"icon"`     // Weather icon observed most often, or 0 if none was observed
+	Count    int      `json:"count"`    // Number of observations
+	Hours    int      `json:"hours"`    // Number of hours of the day with a temperature observation
+}
+
+// MonthStats summarises the days of a month
+type MonthStats struct {
+	Month      string  `json:"month"`      // Month, as yyyy-mm
+	Days       int     `json:"days"`       // Number of days with observations
+	TempMin    float64 `json:"tempMin"`    // Lowest temperature
+	TempMax    float64 `json:"tempMax"`    // Highest temperature
+	MeanMin    float64 `json:"meanMin"`    // Mean of the lowest temperatures of the days
+	MeanMax    float64 `json:"meanMax"`    // Mean of the highest temperatures of the days
+	TempMean   float64 `json:"tempMean"`   // Mean of the mean temperatures of the days
+	Precip     float64 `json:"precip"`     // Total precipitation of the days it was reported on
+	PrecipDays int     `json:"precipDays"` // Number of days the precipitation was reported on
+	RainDays   int     `json:"rainDays"`   // Number of days with at least 1mm of precipitation
+	MaxGust    float64 `json:"maxGust"`    // Strongest gust
+}
+
+// Record is the highest or lowest value recorded, and the day it was recorded on
+type Record struct {
+	Value float64 `json:"value"` // Value of the record
+	Date  string  `json:"date"`  // Date the record was set, as yyyy-mm-dd
+}
+
+// Records holds the records of the location since the observations started
+type Records struct {
+	Since         string  `json:"since,omitempty"`         // Date of the first observation
+	HighestTemp   *Record `json:"highestTemp,omitempty"`   // Hottest day
+	LowestTemp    *Record `json:"lowestTemp,omitempty"`    // Coldest night
+	WettestDay    *Record `json:"wettestDay,omitempty"`    // Most precipitation in a day
+	StrongestGust *Record `json:"strongestGust,omitempty"` // Strongest gust
+}
+
+// ClimateStats holds the daily statistics, monthly summaries and records of a location
+type ClimateStats struct {
+	Name    string       `json:"locationName"` // Location Name
+	Units   Units        `json:"units"`        // Units of measure of the values
+	Days    []DayStats   `json:"days"`         // Statistics of the days of the range asked for
+	Months  []MonthStats `json:"months"`       // Summaries of every month with observations
+	Records Records      `json:"records"`      // Records since the observations started
+}
+
+// dailyStatsCache holds the statistics of the days that are over, so that the history
+// does not have to be read again each time the statistics are asked for
+type dailyStatsCache struct {
+	Version  int        `json:"version"`  // Version of the statistics, see dailyStatsVersion
+	TimeZone string     `json:"timeZone"` // Time zone the days were calculated in
+	Days     []DayStats `json:"days"`     // Statistics of the days, the oldest first
+}
+
+// dailyStatsFile is the name of the file the statistics of the days are cached in
+const dailyStatsFile = "daily.json"
+
+// dailyStatsVersion is changed when the statistics are calculated differently, so that the cached days are calculated again
+const dailyStatsVersion = 2
+
+// ComputeDailyStats calculates the statistics of each day of the observations, the days starting
+// at midnight in the location. The precipitation over the last hour of an observation is taken to
+// have fallen evenly over the hour, so it is added for the time since the previous observation, up to
+// an hour. A station's rate of precipitation is taken to hold until its next observation, up to an hour.
+// Observations without either are left out of the precipitation, since their provider does not report it.
+func ComputeDailyStats(obs []Observation, loc *time.Location) []DayStats {
+	ds := []DayStats{}
+	icons := []map[int]int{}
+	hours := []map[int]bool{}
+	var prev time.Time
+	prevRate := -1.0
+	for _, o := range obs {
+		date := o.Time.In(loc).Format("2006-01-02")
+		if len(ds) == 0 || ds[len(ds)-1].Date != date {
+			ds = append(ds, DayStats{Date: date, TempMin: math.Inf(1), TempMax: math.Inf(-1)})
+			icons = append(icons, map[int]int{})
+			hours = append(hours, map[int]bool{})
+		}
+		d := &ds[len(ds)-1]
+		if i, ok := o.Values["weatherIcon"]; ok {
+			icons[len(icons)-1][int(i)]++
+		}
+		if t, ok := o.Values["temp"]; ok {
+			d.TempMin = math.Min(d.TempMin, t)
+			d.TempMax = math.Max(d.TempMax, t)
+			d.TempMean += t
+			d.Count++
+			hours[len(hours)-1][o.Time.In(loc).Hour()] = true
+		}
+		d.MaxGust = math.Max(d.MaxGust, math.Max(o.Values["windGust"], o.Values["windSpeed"]))
+		dt := time.Hour
+		if !prev.IsZero() && o.Time.Sub(prev) < dt {
+			dt = o.Time.Sub(prev)
+		}
+		if p, ok := o.Values["precip"]; ok {
+			d.addPrecip(p * dt.Hours())
+		}
+		if r, ok := o.Values["precipRate"]; ok {
+			if prevRate >= 0 {
+				d.addPrecip(prevRate * dt.Hours())
+			} else {
+				d.addPrecip(0)
+			}
+			prevRate = r
+		} else {
+			prevRate = -1
+		}
+		prev = o.Time
+	}
+
+	// Days without a temperature are left out
+	r := []DayStats{}
+	for i, d := range ds {
+		if d.Count != 0 {
+			d.TempMean /= float64(d.Count)
+			d.Icon = getMostFrequentIcon(icons[i])
+			d.Hours = len(hours[i])
+			r = append(r, d)
+		}
+	}
+	return r
+}
+
+// addPrecip adds the precipitation to the total of the day
+func (d *DayStats) addPrecip(p float64) {
+	if d.Precip == nil {
+		d.Precip = new(float64)
+	}
+	*d.Precip += p
+}
+
+// SummariseMonths returns the summary of each month of the days
+func SummariseMonths(ds []DayStats) []MonthStats {
+	ms := []MonthStats{}
+	for _, d := range ds {
+		mon := d.Date[:7]
+		if len(ms) == 0 || ms[len(ms)-1].Month != mon {
+			ms = append(ms, MonthStats{Month: mon, TempMin: math.Inf(1), TempMax: math.Inf(-1)})
+		}
+		m := &ms[len(ms)-1]
+		m.Days++
+		m.TempMin = math.Min(m.TempMin, d.TempMin)
+		m.TempMax = math.Max(m.TempMax, d.TempMax)
+		m.MeanMin += d.TempMin
+		m.MeanMax += d.TempMax
+		m.TempMean += d.TempMean
+		if d.Precip != nil {
+			m.Precip += *d.Precip
+			m.PrecipDays++
+			if *d.Precip >= 1 {
+				m.RainDays++
+			}
+		}
+		m.MaxGust = math.Max(m.MaxGust, d.MaxGust)
+	}
+	for i := range ms {
+		n := float64(ms[i].Days)
+		ms[i].MeanMin /= n
+		ms[i].MeanMax /= n
+		ms[i].TempMean /= n
+	}
+	return ms
+}
+
+// GetRecords returns the records set on the days
+func GetRecords(ds []DayStats) Records {
+	r := Records{}
+	if len(ds) == 0 {
+		return r
+	}
+	r.Since = ds[0].Date
+	for _, d := range ds {
+		if r.HighestTemp == nil || d.TempMax > r.HighestTemp.Value {
+			r.HighestTemp = &Record{d.TempMax, d.Date}
+		}
+		if r.LowestTemp == nil || d.TempMin < r.LowestTemp.Value {
+			r.LowestTemp = &Record{d.TempMin, d.Date}
+		}
+		if d.Precip != nil && *d.Precip > 0 && (r.WettestDay == nil || *d.Precip > r.WettestDay.Value) {
+			r.WettestDay = &Record{*d.Precip, d.Date}
+		}
+		if d.MaxGust > 0 && (r.StrongestGust == nil || d.MaxGust > r.StrongestGust.Value) {
+			r.StrongestGust = &Record{d.MaxGust, d.Date}
+		}
+	}
+	return r
+}
+
+// GetDailyStats returns the statistics of each day of the history of the location of the configuration,
+// the oldest first. The statistics of the days that are over are cached, so only the history since
+// the last of these is read.
+func (s *HistoryStore) GetDailyStats(cfg *Config) ([]DayStats, error) {
+	s.statsLock.Lock()
+	defer s.statsLock.Unlock()
+
+	key := getLocationKey(cfg)
+	loc := cfg.GetTimeZone()
+	path := filepath.Join(s.Dir, key, dailyStatsFile)
+	c := dailyStatsCache{}
+	if b, err := ioutil.ReadFile(path); err == nil {
+		if json.Unmarshal(b, &c) != nil || c.TimeZone != loc.String() || c.Version != dailyStatsVersion {
+			c = dailyStatsCache{}
+		}
+	}
+
+	// The days after the last cached day are calculated. The observations of the hour before are also
+	// read, for the precipitation of the first observation of the day.
+	var from time.Time
+	start, err := s.firstDay(key)
+	if err != nil || start.IsZero() {
+		return nil, err
+	}
+	if n := len(c.Days); n != 0 {
+		d, _ := time.ParseInLocation("2006-01-02", c.Days[n-1].Date, loc)
+		from = d.AddDate(0, 0, 1)
+		start = from.Add(-time.Hour)
+	}
+	now := time.Now()
+	obs, err := s.Query(cfg, start, now.Add(time.Minute))
+	if err != nil {
+		return nil, err
+	}
+	ds := c.Days
+	for _, d := range ComputeDailyStats(obs, loc) {
+		if dt, _ := time.ParseInLocation("2006-01-02", d.Date, loc); !dt.Before(from) {
+			ds = append(ds, d)
+		}
+	}
+
+	// Cache the days that are over
+	today := now.In(loc).Format("2006-01-02")
+	c = dailyStatsCache{Version: dailyStatsVersion, TimeZone: loc.String()}
+	for _, d := range ds {
+		if d.Date < today {
+			c.Days = append(c.Days, d)
+		}
+	}
+	if b, err := json.Marshal(c); err == nil {
+		ioutil.WriteFile(path, b, 0644)
+	}
+	return ds, nil
+}
+
+// firstDay returns the first day there are observations of the location for, or a zero time if there are none
+func (s *HistoryStore) firstDay(key string) (time.Time, error) {
+	fs, err := ioutil.ReadDir(filepath.Join(s.Dir, key))
+	if os.IsNotExist(err) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	ns := []string{}
+	for _, f := range fs {
+		if strings.HasSuffix(f.Name(), ".jsonl") {
+			ns = append(ns, strings.TrimSuffix(f.Name(), ".jsonl"))
+		}
+	}
+	if len(ns) == 0 {
+		return time.Time{}, nil
+	}
+	sort.Strings(ns)
+	return time.Parse("2006-01-02", ns[0])
+}
+
+// Convert returns the statistics of the day with the values converted from SI to the units
+func (d DayStats) Convert(u Units) DayStats {
+	d.TempMin = convertStat(d.TempMin, "temp", u)
+	d.TempMax = convertStat(d.TempMax, "temp", u)
+	d.TempMean = convertStat(d.TempMean, "temp", u)
+	if d.Precip != nil {
+		p := convertStat(*d.Precip, "precip", u)
+		d.Precip = &p
+	}
+	d.MaxGust = convertStat(d.MaxGust, "speed", u)
+	return d
+}
+
+// Convert returns the summary of the month with the values converted from SI to the units
+func (m MonthStats) Convert(u Units) MonthStats {
+	m.TempMin = convertStat(m.TempMin, "temp", u)
+	m.TempMax = convertStat(m.TempMax, "temp", u)
+	m.MeanMin = convertStat(m.MeanMin, "temp", u)
+	m.MeanMax = convertStat(m.MeanMax, "temp", u)
+	m.TempMean = convertStat(m.TempMean, "temp", u)
+	m.Precip = convertStat(m.Precip, "precip", u)
+	m.MaxGust = convertStat(m.MaxGust, "speed", u)
+	return m
+}
+
+// Convert returns the records with the values converted from SI to the units
+func (r Records) Convert(u Units) Records {
+	cr := func(v *Record, q string) *Record {
+		if v == nil {
+			return nil
+		}
+		return &Record{convertStat(v.Value, q, u), v.Date}
+	}
+	r.HighestTemp = cr(r.HighestTemp, "temp")
+	r.LowestTemp = cr(r.LowestTemp, "temp")
+	r.WettestDay = cr(r.WettestDay, "precip")
+	r.StrongestGust = cr(r.StrongestGust, "speed")
+	return r
+}
+
+// convertStat converts the value of the quantity from SI to the units, rounded to a decimal place
+func convertStat(v float64, quantity string, u Units) float64 {
+	f := float32(v)
+	switch quantity {
+	case "temp":
+		f = convertTemp(f, SIUnits.Temp, u.Temp)
+	case "tempDiff":
+		f = convertTemp(f, SIUnits.Temp, u.Temp) - convertTemp(0, SIUnits.Temp, u.Temp)
+	case "speed":
+		f = convertSpeed(f, SIUnits.WindSpeed, u.WindSpeed)
+	case "precip":
+		f = convertUnit(f, precipUnits, SIUnits.Precip, u.Precip)
+	}
+	return math.Round(float64(f)*10) / 10
+}
+
+// WriteTo serializes the entity and writes it to the http response
+func (c *ClimateStats) WriteTo(w http.ResponseWriter) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("content-type", "application/json")
+	w.Write(b)
+	return nil
+}
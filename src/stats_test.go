@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestDailyStats(t *testing.T) {
+	loc, _ := time.LoadLocation("Africa/Johannesburg")
+	at := func(h int, m int) time.Time { return time.Date(2024, 6, 1, h, m, 0, 0, time.UTC) }
+	obs := []Observation{
+		{Time: at(21, 0), Values: map[string]float64{"temp": 10, "precip": 2, "windSpeed": 3}},
+		// Midnight in Johannesburg
+		{Time: at(22, 0), Values: map[string]float64{"temp": 8, "precip": 2, "windSpeed": 4, "windGust": 9}},
+		{Time: at(22, 30), Values: map[string]float64{"temp": 6, "precip": 4, "windSpeed": 2}},
+		{Time: at(23, 30), Values: map[string]float64{"precip": 0}},
+		// A day without a temperature is left out
+		{Time: at(23, 30).Add(24 * time.Hour), Values: map[string]float64{"precip": 1}},
+	}
+	ds := ComputeDailyStats(obs, loc)
+	if len(ds) != 2 {
+		t.Fatal("Expected 2 days, got", ds)
+	}
+	if d := ds[0]; d.Date != "2024-06-01" || d.TempMin != 10 || d.TempMax != 10 || d.Precip == nil || *d.Precip != 2 || d.MaxGust != 3 || d.Count != 1 {
+		t.Error("Unexpected first day", d)
+	}
+	// The 4mm over the last hour only counts for the half hour since the previous observation
+	if d := ds[1]; d.Date != "2024-06-02" || d.TempMin != 6 || d.TempMax != 8 || d.TempMean != 7 || d.Precip == nil || *d.Precip != 4 || d.MaxGust != 9 || d.Count != 2 {
+		t.Error("Unexpected second day", d)
+	}
+}
+
+func TestDailyPrecipOnlyComesFromProvidersThatReportIt(t *testing.T) {
+	at := func(h int, m int) time.Time { return time.Date(2024, 6, 1, h, m, 0, 0, time.UTC) }
+	obs := []Observation{
+		// A station reports the rate, which holds until the next observation
+		{Time: at(10, 0), Values: map[string]float64{"temp": 10, "precipRate": 6}},
+		{Time: at(10, 10), Values: map[string]float64{"temp": 10, "precipRate": 12}},
+		{Time: at(10, 20), Values: map[string]float64{"temp": 10, "precipRate": 0}},
+		{Time: at(10, 50), Values: map[string]float64{"temp": 10, "precipRate": 0}},
+		// A provider that does not report the precipitation adds nothing
+		{Time: at(11, 0).Add(24 * time.Hour), Values: map[string]float64{"temp": 12}},
+	}
+	ds := ComputeDailyStats(obs, time.UTC)
+	if len(ds) != 2 {
+		t.Fatal("Expected 2 days, got", ds)
+	}
+	if d := ds[0]; d.Precip == nil || *d.Precip != 3 {
+		t.Error("Expected the rate to be integrated, got", d.Precip)
+	}
+	if d := ds[1]; d.Precip != nil {
+		t.Error("Expected no precipitation without a provider that reports it, got", *d.Precip)
+	}
+	m := SummariseMonths(ds)[0]
+	if m.Precip != 3 || m.PrecipDays != 1 || m.RainDays != 1 {
+		t.Error("Expected the month to count only the day the precipitation was reported on", m)
+	}
+
+	// Only the providers that report the precipitation keep a dry spell
+	if o := NewObservation(Weather{Provider: "OpenWeather", Created: at(12, 0), Units: SIUnits}); o.Values["precip"] != 0 {
+		t.Error("Expected a dry spell to be kept", o.Values)
+	} else if _, ok := o.Values["precip"]; !ok {
+		t.Error("Expected a dry spell to be kept", o.Values)
+	}
+	if o := NewObservation(Weather{Provider: "OpenMeteo", Created: at(12, 0), Units: SIUnits}); len(o.Values) != 3 {
+		t.Error("Expected the unreported precipitation to be left out", o.Values)
+	}
+}
+
+func precip(v float64) *float64 {
+	return &v
+}
+
+func TestMonthsAreSummarised(t *testing.T) {
+	ds := []DayStats{
+		{Date: "2024-05-31", TempMin: 5, TempMax: 15, TempMean: 10, Precip: precip(0.5), MaxGust: 10},
+		{Date: "2024-06-01", TempMin: 8, TempMax: 12, TempMean: 10, Precip: precip(3), MaxGust: 20},
+		{Date: "2024-06-02", TempMin: 2, TempMax: 18, TempMean: 10, Precip: precip(1), MaxGust: 5},
+	}
+	ms := SummariseMonths(ds)
+	if len(ms) != 2 || ms[0].Month != "2024-05" || ms[0].Days != 1 || ms[0].RainDays != 0 {
+		t.Fatal("Unexpected months", ms)
+	}
+	if m := ms[1]; m.Days != 2 || m.TempMin != 2 || m.TempMax != 18 || m.MeanMin != 5 || m.MeanMax != 15 || m.Precip != 4 || m.RainDays != 2 || m.MaxGust != 20 {
+		t.Error("Unexpected June", m)
+	}
+
+	r := GetRecords(ds)
+	if r.Since != "2024-05-31" || *r.HighestTemp != (Record{18, "2024-06-02"}) || *r.LowestTemp != (Record{2, "2024-06-02"}) ||
+		*r.WettestDay != (Record{3, "2024-06-01"}) || *r.StrongestGust != (Record{20, "2024-06-01"}) {
+		t.Error("Unexpected records", r)
+	}
+	if r := GetRecords(nil); r.HighestTemp != nil || r.Since != "" {
+		t.Error("Expected no records without days", r)
+	}
+}
+
+func TestDailyStatsAreCached(t *testing.T) {
+	s := NewHistoryStore(t.TempDir())
+	cfg := &Config{Latitude: -33.92, Longitude: 18.42, TimeZone: "UTC"}
+	s.Append(cfg, Weather{Created: time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC), Temp: 10, Units: SIUnits})
+	s.Append(cfg, Weather{Created: time.Date(2024, 6, 2, 10, 0, 0, 0, time.UTC), Temp: 20, Units: SIUnits})
+
+	ds, err := s.GetDailyStats(cfg)
+	if err != nil || len(ds) != 2 || ds[1].TempMax != 20 {
+		t.Fatal("Unexpected days", ds, err)
+	}
+
+	// The cached days are not calculated again
+	path := filepath.Join(s.Dir, getLocationKey(cfg), dailyStatsFile)
+	c := dailyStatsCache{}
+	b, err := ioutil.ReadFile(path)
+	if err != nil || json.Unmarshal(b, &c) != nil || len(c.Days) != 2 || c.TimeZone != "UTC" {
+		t.Fatal("Expected the days to be cached", string(b), err)
+	}
+	c.Days[0].TempMax = 99
+	b, _ = json.Marshal(c)
+	ioutil.WriteFile(path, b, 0644)
+	if ds, _ = s.GetDailyStats(cfg); len(ds) != 2 || ds[0].TempMax != 99 {
+		t.Error("Expected the cached days to be used", ds)
+	}
+
+	// The days are calculated again in another time zone
+	cfg.TimeZone = "Africa/Johannesburg"
+	if ds, _ = s.GetDailyStats(cfg); len(ds) != 2 || ds[0].TempMax != 10 {
+		t.Error("Expected the cache to be discarded", ds)
+	}
+
+	if ds, err = s.GetDailyStats(&Config{Latitude: 50.45, Longitude: 30.52}); err != nil || len(ds) != 0 {
+		t.Error("Expected no days without a history", ds, err)
+	}
+}
+
+func TestGetStats(t *testing.T) {
+	chdirTemp(t)
+	cfg := &Config{LocationName: "Cape Town", Latitude: -33.92, Longitude: 18.42, TimeZone: "UTC"}
+	s := &Server{Config: cfg, History: NewHistoryStore("history")}
+	start := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		// 25.4mm of precipitation each day
+		s.History.Append(cfg, Weather{Created: start.AddDate(0, 0, i), Temp: float32(10 * i), Precip: 25.4, WindSpeed: 10, Units: SIUnits})
+	}
+	router := mux.NewRouter()
+	c := WeatherController{}
+	c.AddController(router, s)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/weather/stats?from=2024-06-02&to=2024-06-03&units=imperial", nil))
+	st := ClimateStats{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &st); err != nil {
+		t.Fatal(err, rec.Body.String())
+	}
+	if st.Name != "Cape Town" || st.Units.Temp != "F" || len(st.Days) != 2 || len(st.Months) != 1 {
+		t.Fatal("Unexpected statistics", rec.Body.String())
+	}
+	if d := st.Days[0]; d.Date != "2024-06-02" || d.TempMax != 50 || d.Precip == nil || *d.Precip != 1 || d.MaxGust != 22.4 {
+		t.Error("Unexpected day", d)
+	}
+	if m := st.Months[0]; m.Precip != 3 || m.RainDays != 3 {
+		t.Error("Unexpected month", m)
+	}
+	if r := st.Records; r.Since != "2024-06-01" || r.HighestTemp.Value != 68 || r.LowestTemp.Value != 32 {
+		t.Error("Unexpected records", r)
+	}
+
+	for _, q := range []string{"from=yesterday", "to=tomorrow", "from=2024-06-03&to=2024-06-02"} {
+		rec = httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("GET", "/weather/stats?"+q, nil))
+		if rec.Code != 400 {
+			t.Error("Expected the query to be rejected with 400", q, rec.Code)
+		}
+	}
+}
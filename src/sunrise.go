@@ -1,19 +1,20 @@
 package main
 
 import (
-	"fmt"
 	"time"
 
 	"github.com/kelvins/sunrisesunset"
 )
 
-// GetSunriseSunset returns the Sunset and Sunrise times for the provided date and the location specified in the provided configuration
+// GetSunriseSunset returns the Sunrise and Sunset times for the provided date at the location specified in the provided configuration.
+// The date and the times returned are in the time zone of the location.
 func GetSunriseSunset(c *Config, t time.Time) (time.Time, time.Time, error) {
+	loc := c.GetTimeZone()
+	t = t.In(loc)
 	y := t.Year()
 	m := t.Month()
 	d := t.Day()
-	n, o := t.Zone()
-	fmt.Println(n, o)
+	_, o := t.Zone()
 
 	p := sunrisesunset.Parameters{
 		Latitude:  float64(c.Latitude),
@@ -26,12 +27,12 @@ func GetSunriseSunset(c *Config, t time.Time) (time.Time, time.Time, error) {
 		h := sr.Hour()
 		n := sr.Minute()
 		s := sr.Second()
-		sr = time.Date(y, m, d, h, n, s, 0, time.Local)
+		sr = time.Date(y, m, d, h, n, s, 0, loc)
 
 		h = ss.Hour()
 		n = ss.Minute()
 		s = ss.Second()
-		ss = time.Date(y, m, d, h, n, s, 0, time.Local)
+		ss = time.Date(y, m, d, h, n, s, 0, loc)
 	}
 	return sr, ss, err
 }
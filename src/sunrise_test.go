@@ -18,3 +18,20 @@ func TestCanGetSunriseSunset(t *testing.T) {
 	fmt.Println("Sunrise =", sr.String())
 	fmt.Println("Sunset =", ss.String())
 }
+
+func TestSunriseSunsetInLocationTimeZone(t *testing.T) {
+	// Cape Town, whatever the time zone of the server
+	c := &Config{Latitude: -33.92, Longitude: 18.42, TimeZone: "Africa/Johannesburg"}
+	d := time.Date(2026, 6, 21, 23, 30, 0, 0, time.UTC) // 01:30 on the 22nd in Cape Town
+
+	sr, ss, err := GetSunriseSunset(c, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sr.Location().String() != "Africa/Johannesburg" || ss.Location().String() != "Africa/Johannesburg" {
+		t.Error("Expected the times in the location's time zone", sr, ss)
+	}
+	if sr.Day() != 22 || sr.Hour() != 7 || ss.Hour() != 17 {
+		t.Error("Unexpected sunrise or sunset", sr, ss)
+	}
+}
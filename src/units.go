@@ -0,0 +1,260 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"strings"
+
+	"github.com/brumawen/weather/derived"
+)
+
+// Units holds the units of measure of the values in a weather payload
+type Units struct {
+	Temp      string `json:"temp"`      // Temperature: C or F
+	WindSpeed string `json:"windSpeed"` // Wind speed: m/s, km/h, mph, kn or bft (Beaufort)
+	Pressure  string `json:"pressure"`  // Pressure: hPa, inHg or mmHg
+	Precip    string `json:"precip"`    // Precipitation: mm or in
+	Distance  string `json:"distance"`  // Visibility: km or mi
+}
+
+// SIUnits are the units the weather providers return their values in
+var SIUnits = Units{Temp: "C", WindSpeed: "m/s", Pressure: "hPa", Precip: "mm", Distance: "km"}
+
+// MetricUnits are the units used for UnitType 0
+var MetricUnits = Units{Temp: "C", WindSpeed: "km/h", Pressure: "hPa", Precip: "mm", Distance: "km"}
+
+// ImperialUnits are the units used for UnitType 1
+var ImperialUnits = Units{Temp: "F", WindSpeed: "mph", Pressure: "inHg", Precip: "in", Distance: "mi"}
+
+// speedUnits holds the value of each wind speed unit in m/s.
+// The Beaufort scale is not linear and is converted separately.
+var speedUnits = map[string]float64{"m/s": 1, "km/h": 1 / 3.6, "mph": 0.44704, "kn": 1852.0 / 3600}
+
+// pressureUnits holds the value of each pressure unit in hPa
+var pressureUnits = map[string]float64{"hPa": 1, "inHg": 33.863886, "mmHg": 1.333224}
+
+// precipUnits holds the value of each precipitation unit in mm
+var precipUnits = map[string]float64{"mm": 1, "in": 25.4}
+
+// distanceUnits holds the value of each distance unit in km
+var distanceUnits = map[string]float64{"km": 1, "mi": 1.609344}
+
+// unitPresets holds the unit systems that can be requested by name
+var unitPresets = map[string]Units{"metric": MetricUnits, "imperial": ImperialUnits, "si": SIUnits}
+
+// unitTokens holds the names each unit can be requested by
+var unitTokens = map[string]Units{
+	"c":    {Temp: "C"},
+	"f":    {Temp: "F"},
+	"ms":   {WindSpeed: "m/s"},
+	"m/s":  {WindSpeed: "m/s"},
+	"kmh":  {WindSpeed: "km/h"},
+	"km/h": {WindSpeed: "km/h"},
+	"mph":  {WindSpeed: "mph"},
+	"kn":   {WindSpeed: "kn"},
+	"kt":   {WindSpeed: "kn"},
+	"bft":  {WindSpeed: "bft"},
+	"hpa":  {Pressure: "hPa"},
+	"mb":   {Pressure: "hPa"},
+	"inhg": {Pressure: "inHg"},
+	"mmhg": {Pressure: "mmHg"},
+	"mm":   {Precip: "mm"},
+	"in":   {Precip: "in"},
+	"km":   {Distance: "km"},
+	"mi":   {Distance: "mi"},
+}
+
+// ParseUnits applies a comma separated list of unit names to the units, e.g. "imperial,kmh" or "C,kn,hPa".
+// A preset (metric, imperial or si) replaces all the units, the other names replace a single unit.
+func ParseUnits(s string, u Units) (Units, error) {
+	for _, t := range strings.Split(s, ",") {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" {
+			continue
+		}
+		if p, ok := unitPresets[t]; ok {
+			u = p
+		} else if p, ok := unitTokens[t]; ok {
+			u = u.Merge(p)
+		} else {
+			return u, errors.New("Unknown unit " + t)
+		}
+	}
+	return u, nil
+}
+
+// Merge returns the units with any units set in o replacing them
+func (u Units) Merge(o Units) Units {
+	if o.Temp != "" {
+		u.Temp = o.Temp
+	}
+	if o.WindSpeed != "" {
+		u.WindSpeed = o.WindSpeed
+	}
+	if o.Pressure != "" {
+		u.Pressure = o.Pressure
+	}
+	if o.Precip != "" {
+		u.Precip = o.Precip
+	}
+	if o.Distance != "" {
+		u.Distance = o.Distance
+	}
+	return u
+}
+
+// Validate checks that each unit that is set is a known unit for its quantity
+func (u Units) Validate() error {
+	if u.Temp != "" && u.Temp != "C" && u.Temp != "F" {
+		return errors.New("Invalid temperature unit " + u.Temp)
+	}
+	if _, ok := speedUnits[u.WindSpeed]; u.WindSpeed != "" && u.WindSpeed != "bft" && !ok {
+		return errors.New("Invalid wind speed unit " + u.WindSpeed)
+	}
+	if _, ok := pressureUnits[u.Pressure]; u.Pressure != "" && !ok {
+		return errors.New("Invalid pressure unit " + u.Pressure)
+	}
+	if _, ok := precipUnits[u.Precip]; u.Precip != "" && !ok {
+		return errors.New("Invalid precipitation unit " + u.Precip)
+	}
+	if _, ok := distanceUnits[u.Distance]; u.Distance != "" && !ok {
+		return errors.New("Invalid distance unit " + u.Distance)
+	}
+	return nil
+}
+
+// IsSet indicates whether the units of the payload are known
+func (u Units) IsSet() bool {
+	return u != Units{}
+}
+
+// ConvertWeather returns the weather with its values converted to these units
+func (u Units) ConvertWeather(w Weather) Weather {
+	f := w.Units
+	w.Temp = convertTemp(w.Temp, f.Temp, u.Temp)
+	w.FeelsLike = convertTemp(w.FeelsLike, f.Temp, u.Temp)
+	w.DewPoint = convertTemp(w.DewPoint, f.Temp, u.Temp)
+	w.WindGust = convertSpeed(w.WindGust, f.WindSpeed, u.WindSpeed)
+	w.Visibility = convertUnit(w.Visibility, distanceUnits, f.Distance, u.Distance)
+	w.Precip = convertUnit(w.Precip, precipUnits, f.Precip, u.Precip)
+	w.PrecipRate = convertUnit(w.PrecipRate, precipUnits, f.Precip, u.Precip)
+	w.Derived = convertDerived(w.Derived, f.Temp, u.Temp)
+	w.Pressure = convertUnit(w.Pressure, pressureUnits, f.Pressure, u.Pressure)
+	w.WindSpeed = convertSpeed(w.WindSpeed, f.WindSpeed, u.WindSpeed)
+	w.Units = u
+	return w
+}
+
+// ConvertForecast returns the forecast with its values converted to these units
+func (u Units) ConvertForecast(f Forecast) Forecast {
+	from := f.Units
+	f.Current = u.ConvertWeather(f.Current)
+
+	// The days and hours are copied so that the original forecast is left untouched
+	ds := make([]ForecastDay, len(f.Forecast))
+	for i, d := range f.Forecast {
+		d.TempMin = convertTemp(d.TempMin, from.Temp, u.Temp)
+		d.TempMax = convertTemp(d.TempMax, from.Temp, u.Temp)
+		d.Precip = convertUnit(d.Precip, precipUnits, from.Precip, u.Precip)
+		d.Rain = convertUnit(d.Rain, precipUnits, from.Precip, u.Precip)
+		d.Snow = convertUnit(d.Snow, precipUnits, from.Precip, u.Precip)
+		d.WindSpeed = convertSpeed(d.WindSpeed, from.WindSpeed, u.WindSpeed)
+		d.WindGust = convertSpeed(d.WindGust, from.WindSpeed, u.WindSpeed)
+		if d.Spread != nil {
+			s := *d.Spread
+			s.TempMinLow = convertTemp(s.TempMinLow, from.Temp, u.Temp)
+			s.TempMinHigh = convertTemp(s.TempMinHigh, from.Temp, u.Temp)
+			s.TempMaxLow = convertTemp(s.TempMaxLow, from.Temp, u.Temp)
+			s.TempMaxHigh = convertTemp(s.TempMaxHigh, from.Temp, u.Temp)
+			d.Spread = &s
+		}
+		ds[i] = d
+	}
+	f.Forecast = ds
+
+	hs := make([]ForecastHour, len(f.Hourly))
+	for i, h := range f.Hourly {
+		h.Temp = convertTemp(h.Temp, from.Temp, u.Temp)
+		h.WindSpeed = convertSpeed(h.WindSpeed, from.WindSpeed, u.WindSpeed)
+		h.Precip = convertUnit(h.Precip, precipUnits, from.Precip, u.Precip)
+		h.Derived = convertDerived(h.Derived, from.Temp, u.Temp)
+		hs[i] = h
+	}
+	if len(hs) != 0 {
+		f.Hourly = hs
+	}
+	f.Units = u
+	return f
+}
+
+// convertDerived returns a copy of the derived metrics with the temperatures converted
+func convertDerived(m *derived.Metrics, from string, to string) *derived.Metrics {
+	if m == nil {
+		return nil
+	}
+	c := *m
+	c.DewPoint = convertTemp(c.DewPoint, from, to)
+	c.HeatIndex = convertTemp(c.HeatIndex, from, to)
+	c.WindChill = convertTemp(c.WindChill, from, to)
+	c.Humidex = convertTemp(c.Humidex, from, to)
+	c.ApparentTemp = convertTemp(c.ApparentTemp, from, to)
+	return &c
+}
+
+// convertTemp converts the temperature between Celsius and Fahrenheit, rounded to a tenth of a degree
+func convertTemp(v float32, from string, to string) float32 {
+	switch {
+	case from == to:
+		return v
+	case from == "C" && to == "F":
+		return roundTo(v*9/5+32, 1)
+	case from == "F" && to == "C":
+		return roundTo((v-32)*5/9, 1)
+	}
+	return v
+}
+
+// convertSpeed converts the wind speed between the units, including the Beaufort scale,
+// rounded to a tenth of the unit
+func convertSpeed(v float32, from string, to string) float32 {
+	if from == to {
+		return v
+	}
+	if from == "bft" {
+		// Beaufort to m/s using v = 0.836 B^3/2
+		v = float32(0.836 * math.Pow(float64(v), 1.5))
+		from = "m/s"
+	}
+	if to == "bft" {
+		ms := convertUnit(v, speedUnits, from, "m/s")
+		return float32(math.Min(12, math.Round(math.Pow(float64(ms)/0.836, 2.0/3))))
+	}
+	return roundTo(convertUnit(v, speedUnits, from, to), 1)
+}
+
+// convertUnit converts the value between two of the units, each given by its value in a base unit.
+// The value is rounded to two decimal places, which keeps inches of mercury and of rain meaningful.
+func convertUnit(v float32, units map[string]float64, from string, to string) float32 {
+	f, ok1 := units[from]
+	t, ok2 := units[to]
+	if from == to || !ok1 || !ok2 {
+		return v
+	}
+	return roundTo(float32(float64(v)*f/t), 2)
+}
+
+// roundTo rounds the value to the number of decimal places, since converted values rarely are
+func roundTo(v float32, places int) float32 {
+	p := math.Pow(10, float64(places))
+	return float32(math.Round(float64(v)*p) / p)
+}
+
+// GetUnits returns the units the weather is reported in, which are those of the
+// unit type with any units configured for a particular quantity replacing them
+func (c *Config) GetUnits() Units {
+	u := MetricUnits
+	if c.UnitType != 0 {
+		u = ImperialUnits
+	}
+	return u.Merge(c.Units)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConvertWeather(t *testing.T) {
+	w := Weather{Temp: 20, Pressure: 1013.25, WindSpeed: 10, FeelsLike: 15, DewPoint: 10, WindGust: 20, Visibility: 16.09344, Units: SIUnits}
+	i := ImperialUnits.ConvertWeather(w)
+	checkClose(t, "Temp", i.Temp, 68)
+	checkClose(t, "Pressure", i.Pressure, 29.92)
+	checkClose(t, "WindSpeed", i.WindSpeed, 22.4)
+	checkClose(t, "FeelsLike", i.FeelsLike, 59)
+	checkClose(t, "DewPoint", i.DewPoint, 50)
+	checkClose(t, "WindGust", i.WindGust, 44.7)
+	checkClose(t, "Visibility", i.Visibility, 10)
+	if i.Units != ImperialUnits {
+		t.Error("The units were not recorded", i.Units)
+	}
+
+	m := MetricUnits.ConvertWeather(i)
+	checkClose(t, "Temp", m.Temp, 20)
+	checkClose(t, "Pressure", m.Pressure, 1013.21)
+	checkClose(t, "WindSpeed", m.WindSpeed, 36)
+
+	// Converted values are rounded
+	if c := MetricUnits.ConvertWeather(Weather{Temp: 62, Pressure: 30, Units: ImperialUnits}); c.Temp != 16.7 || c.Pressure != 1015.92 {
+		t.Error("Expected the converted values to be rounded", c.Temp, c.Pressure)
+	}
+
+	// Converting to the same units leaves the values alone
+	if s := SIUnits.ConvertWeather(w); s.Temp != w.Temp || s.Pressure != w.Pressure || s.WindSpeed != w.WindSpeed {
+		t.Error("Expected the weather to be unchanged", s)
+	}
+}
+
+func TestConvertForecast(t *testing.T) {
+	f := Forecast{
+		Current: Weather{Temp: 10, Units: SIUnits},
+		Forecast: []ForecastDay{
+			{Day: time.Now(), TempMin: 0, TempMax: 100, Precip: 25.4, WindGust: 10, Spread: &ForecastSpread{TempMinLow: -10, TempMaxHigh: 30}},
+		},
+		Hourly: []ForecastHour{{Temp: 25}},
+		Units:  SIUnits,
+	}
+	i := ImperialUnits.ConvertForecast(f)
+	d := i.Forecast[0]
+	if d.TempMin != 32 || d.TempMax != 212 || d.Spread.TempMinLow != 14 || d.Spread.TempMaxHigh != 86 {
+		t.Error("The forecast days were not converted", d, d.Spread)
+	}
+	checkClose(t, "Precip", d.Precip, 1)
+	checkClose(t, "WindGust", d.WindGust, 22.4)
+	if i.Current.Temp != 50 || i.Hourly[0].Temp != 77 || i.Units != ImperialUnits {
+		t.Error("The forecast was not converted", i)
+	}
+
+	// The original forecast is left untouched
+	if f.Forecast[0].TempMax != 100 || f.Forecast[0].Spread.TempMaxHigh != 30 || f.Hourly[0].Temp != 25 {
+		t.Error("The original forecast was changed", f)
+	}
+}
+
+func TestConfigUnits(t *testing.T) {
+	c := Config{}
+	if c.GetUnits() != MetricUnits {
+		t.Error("Expected metric units by default")
+	}
+	c.UnitType = 1
+	if c.GetUnits() != ImperialUnits {
+		t.Error("Expected imperial units")
+	}
+}
+
+func TestParseUnits(t *testing.T) {
+	tests := []struct {
+		s string
+		u Units
+	}{
+		{"imperial", ImperialUnits},
+		{"imperial,kmh", Units{Temp: "F", WindSpeed: "km/h", Pressure: "inHg", Precip: "in", Distance: "mi"}},
+		{"C, kn, MMHG", Units{Temp: "C", WindSpeed: "kn", Pressure: "mmHg", Precip: "in", Distance: "mi"}},
+		{"bft,metric", MetricUnits},
+	}
+	for _, e := range tests {
+		u, err := ParseUnits(e.s, ImperialUnits)
+		if err != nil || u != e.u {
+			t.Error("Units", e.s, "were parsed as", u, err)
+		}
+	}
+	if _, err := ParseUnits("metric,furlongs", MetricUnits); err == nil {
+		t.Error("Expected an error for an unknown unit")
+	}
+}
+
+func TestConvertWindSpeed(t *testing.T) {
+	checkClose(t, "Knots", convertSpeed(10, "m/s", "kn"), 19.4)
+	tests := map[float32]float32{0: 0, 1: 1, 5: 3, 10.5: 5, 20: 8, 40: 12}
+	for ms, b := range tests {
+		if v := convertSpeed(ms, "m/s", "bft"); v != b {
+			t.Error(ms, "m/s was converted to", v, "Beaufort, expected", b)
+		}
+	}
+	checkClose(t, "Beaufort", convertSpeed(4, "bft", "m/s"), 6.69)
+}
+
+func TestConfiguredUnitsReplaceUnitType(t *testing.T) {
+	c := Config{UnitType: 1, Units: Units{WindSpeed: "kn"}}
+	if u := c.GetUnits(); u.WindSpeed != "kn" || u.Temp != "F" || u.Pressure != "inHg" {
+		t.Error("Unexpected units", u)
+	}
+	if err := (Units{Pressure: "psi"}).Validate(); err == nil {
+		t.Error("Expected an error for an unknown pressure unit")
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// maxVerifiedLead is the number of days ahead the forecasts are verified for
+const maxVerifiedLead = 5
+
+// minVerifiedHours is the number of hours of a day that must have been observed for its forecasts
+// to be scored, so that a day missing its night or afternoon does not score a partial low or high
+const minVerifiedHours = 18
+
+// ForecastSnapshot is a daily forecast as a provider issued it, archived so that it can be
+// verified once its days have passed. The temperatures are kept in SI units.
+type ForecastSnapshot struct {
+	Issued   time.Time       `json:"issued"`   // Date and time the forecast was issued
+	Provider string          `json:"provider"` // Provider of the forecast
+	Days     []ForecastedDay `json:"days"`     // Forecast of each day
+}
+
+// ForecastedDay is the forecast of a day in a snapshot
+type ForecastedDay struct {
+	Date    string  `json:"date"`    // Date of the day, as yyyy-mm-dd
+	TempMin float64 `json:"tempMin"` // Forecast minimum temperature
+	TempMax float64 `json:"tempMax"` // Forecast maximum temperature
+	Icon    int     `json:"icon"`    // Forecast weather icon
+}
+
+// Verification holds how well the providers forecast the days that have passed
+type Verification struct {
+	Name   string          `json:"locationName"` // Location Name
+	From   string          `json:"from"`         // First day of the range, as yyyy-mm-dd
+	To     string          `json:"to"`           // Last day of the range, as yyyy-mm-dd
+	Units  Units           `json:"units"`        // Units of measure of the values
+	Scores []ForecastScore `json:"scores"`       // Scores of each provider and lead time
+	Days   []VerifiedDay   `json:"days"`         // Forecasts of each day of the range and what was observed
+}
+
+// ForecastScore holds the errors of the forecasts a provider made a number of days ahead
+type ForecastScore struct {
+	Provider    string  `json:"provider"`    // Provider of the forecasts
+	Lead        int     `json:"lead"`        // Number of days ahead the forecasts were made
+	Days        int     `json:"days"`        // Number of days verified
+	TempMinMAE  float64 `json:"tempMinMae"`  // Mean absolute error of the minimum temperature
+	TempMinBias float64 `json:"tempMinBias"` // Mean error of the minimum temperature, positive if forecast too warm
+	TempMaxMAE  float64 `json:"tempMaxMae"`  // Mean absolute error of the maximum temperature
+	TempMaxBias float64 `json:"tempMaxBias"` // Mean error of the maximum temperature, positive if forecast too warm
+	IconDays    int     `json:"iconDays"`    // Number of days an icon was observed
+	IconHits    float64 `json:"iconHits"`    // Percentage of these days the icon forecast was the icon observed most often
+}
+
+// VerifiedDay holds how the forecasts of a day changed as it approached, and what was observed
+type VerifiedDay struct {
+	Date      string        `json:"date"`               // Date of the day, as yyyy-mm-dd
+	Observed  *DayStats     `json:"observed,omitempty"` // Statistics of the day, once it has passed
+	Forecasts []DayForecast `json:"forecasts"`          // Forecasts of the day, the oldest first
+}
+
+// DayForecast is a forecast of a day issued by a provider
+type DayForecast struct {
+	Provider string    `json:"provider"` // Provider of the forecast
+	Issued   time.Time `json:"issued"`   // Date and time the forecast was issued
+	Lead     int       `json:"lead"`     // Number of days ahead the forecast was made
+	TempMin  float64   `json:"tempMin"`  // Forecast minimum temperature
+	TempMax  float64   `json:"tempMax"`  // Forecast maximum temperature
+	Icon     int       `json:"icon"`     // Forecast weather icon
+}
+
+// NewForecastSnapshot returns the snapshot of the daily forecast, with its temperatures in SI units
+func NewForecastSnapshot(f Forecast, provider string, issued time.Time) ForecastSnapshot {
+	if f.Units.IsSet() {
+		f = SIUnits.ConvertForecast(f)
+	}
+	s := ForecastSnapshot{Issued: issued.UTC(), Provider: provider, Days: []ForecastedDay{}}
+	for _, d := range f.Forecast {
+		// Providers place the day in the location's time zone, so the date is taken as is
+		s.Days = append(s.Days, ForecastedDay{
+			Date:    d.Day.Format("2006-01-02"),
+			TempMin: float64(d.TempMin),
+			TempMax: float64(d.TempMax),
+			Icon:    d.WeatherIcon,
+		})
+	}
+	return s
+}
+
+// getForecastPath returns the file the forecasts issued for the location on the day are archived in
+func (s *HistoryStore) getForecastPath(key string, t time.Time) string {
+	return filepath.Join(s.Dir, key, "forecasts", t.UTC().Format("2006-01-02")+".jsonl")
+}
+
+// ArchiveForecast adds the daily forecast to the archive of the location of the configuration.
+// The forecasts of the providers blended into a consensus are archived along with it.
+func (s *HistoryStore) ArchiveForecast(cfg *Config, f Forecast) error {
+	issued := f.Current.Created
+	if issued.IsZero() {
+		issued = time.Now()
+	}
+	ss := []ForecastSnapshot{NewForecastSnapshot(f, f.Current.Provider, issued)}
+	for _, src := range f.Sources {
+		ss = append(ss, NewForecastSnapshot(src, src.Current.Provider, issued))
+	}
+	b := []byte{}
+	for _, sn := range ss {
+		l, err := json.Marshal(sn)
+		if err != nil {
+			return err
+		}
+		b = append(append(b, l...), '\n')
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	path := s.getForecastPath(getLocationKey(cfg), issued)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	fl, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer fl.Close()
+	_, err = fl.Write(b)
+	return err
+}
+
+// ReadForecasts returns the forecasts archived for the location of the configuration that were issued
+// from the start of the range up to, but not including, its end. The oldest forecast is returned first.
+func (s *HistoryStore) ReadForecasts(cfg *Config, from time.Time, to time.Time) ([]ForecastSnapshot, error) {
+	key := getLocationKey(cfg)
+	ss := []ForecastSnapshot{}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for d := from.UTC().Truncate(24 * time.Hour); d.Before(to); d = d.Add(24 * time.Hour) {
+		err := readLines(s.getForecastPath(key, d), func(b []byte) {
+			sn := ForecastSnapshot{}
+			if err := json.Unmarshal(b, &sn); err == nil && !sn.Issued.Before(from) && sn.Issued.Before(to) {
+				ss = append(ss, sn)
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(ss, func(i, j int) bool { return ss[i].Issued.Before(ss[j].Issued) })
+	return ss, nil
+}
+
+// getLead returns the number of days between the day the forecast was issued in the location and the date
+func getLead(issued time.Time, date string, loc *time.Location) int {
+	i, _ := time.Parse("2006-01-02", issued.In(loc).Format("2006-01-02"))
+	d, _ := time.Parse("2006-01-02", date)
+	return int(math.Round(d.Sub(i).Hours() / 24))
+}
+
+// VerifyForecasts compares the forecasts of the days from the first date to the last with the statistics
+// of the days observed. Only the last forecast a provider issued on a day is scored, so that each day
+// counts once for each lead time, but every forecast that changed is kept to show how the days' forecasts changed.
+func VerifyForecasts(ss []ForecastSnapshot, ds []DayStats, from string, to string, loc *time.Location) ([]ForecastScore, []VerifiedDay) {
+	observed := map[string]DayStats{}
+	for _, d := range ds {
+		observed[d.Date] = d
+	}
+
+	// The forecasts of each day, and the last forecast of each provider, day and lead time
+	type scoreKey struct {
+		Provider string
+		Lead     int
+		Date     string
+	}
+	days := map[string][]DayForecast{}
+	last := map[scoreKey]DayForecast{}
+	for _, sn := range ss {
+		for _, d := range sn.Days {
+			lead := getLead(sn.Issued, d.Date, loc)
+			if d.Date < from || d.Date > to || lead < 0 || lead > maxVerifiedLead {
+				continue
+			}
+			f := DayForecast{Provider: sn.Provider, Issued: sn.Issued, Lead: lead, TempMin: d.TempMin, TempMax: d.TempMax, Icon: d.Icon}
+			last[scoreKey{sn.Provider, lead, d.Date}] = f
+			fs := days[d.Date]
+			changed := true
+			for i := len(fs) - 1; i >= 0; i-- {
+				if fs[i].Provider == f.Provider {
+					changed = fs[i].TempMin != f.TempMin || fs[i].TempMax != f.TempMax || fs[i].Icon != f.Icon
+					break
+				}
+			}
+			if changed {
+				days[d.Date] = append(fs, f)
+			}
+		}
+	}
+
+	// Score the forecasts of the days that were observed
+	type scoreSums struct {
+		ForecastScore
+		hits int
+	}
+	sums := map[scoreKey]*scoreSums{}
+	for k, f := range last {
+		o, ok := observed[k.Date]
+		if !ok || f.Lead == 0 || o.Hours < minVerifiedHours {
+			continue
+		}
+		sk := scoreKey{Provider: k.Provider, Lead: k.Lead}
+		sc, ok := sums[sk]
+		if !ok {
+			sc = &scoreSums{ForecastScore: ForecastScore{Provider: k.Provider, Lead: k.Lead}}
+			sums[sk] = sc
+		}
+		sc.Days++
+		sc.TempMinMAE += math.Abs(f.TempMin - o.TempMin)
+		sc.TempMinBias += f.TempMin - o.TempMin
+		sc.TempMaxMAE += math.Abs(f.TempMax - o.TempMax)
+		sc.TempMaxBias += f.TempMax - o.TempMax
+		if o.Icon != 0 {
+			sc.IconDays++
+			if f.Icon == o.Icon {
+				sc.hits++
+			}
+		}
+	}
+	scores := []ForecastScore{}
+	for _, sc := range sums {
+		n := float64(sc.Days)
+		sc.TempMinMAE /= n
+		sc.TempMinBias /= n
+		sc.TempMaxMAE /= n
+		sc.TempMaxBias /= n
+		if sc.IconDays != 0 {
+			sc.IconHits = math.Round(float64(sc.hits)*1000/float64(sc.IconDays)) / 10
+		}
+		scores = append(scores, sc.ForecastScore)
+	}
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].Provider != scores[j].Provider {
+			return scores[i].Provider < scores[j].Provider
+		}
+		return scores[i].Lead < scores[j].Lead
+	})
+
+	vs := []VerifiedDay{}
+	for date, fs := range days {
+		v := VerifiedDay{Date: date, Forecasts: fs}
+		if o, ok := observed[date]; ok {
+			v.Observed = &o
+		}
+		vs = append(vs, v)
+	}
+	sort.Slice(vs, func(i, j int) bool { return vs[i].Date < vs[j].Date })
+	return scores, vs
+}
+
+// Convert returns the score with the errors converted from SI to the units
+func (s ForecastScore) Convert(u Units) ForecastScore {
+	s.TempMinMAE = convertStat(s.TempMinMAE, "tempDiff", u)
+	s.TempMinBias = convertStat(s.TempMinBias, "tempDiff", u)
+	s.TempMaxMAE = convertStat(s.TempMaxMAE, "tempDiff", u)
+	s.TempMaxBias = convertStat(s.TempMaxBias, "tempDiff", u)
+	return s
+}
+
+// Convert returns the day with its forecasts and observations converted from SI to the units
+func (v VerifiedDay) Convert(u Units) VerifiedDay {
+	if v.Observed != nil {
+		o := v.Observed.Convert(u)
+		v.Observed = &o
+	}
+	fs := make([]DayForecast, len(v.Forecasts))
+	for i, f := range v.Forecasts {
+		f.TempMin = convertStat(f.TempMin, "temp", u)
+		f.TempMax = convertStat(f.TempMax, "temp", u)
+		fs[i] = f
+	}
+	v.Forecasts = fs
+	return v
+}
+
+// In returns the day with the times its forecasts were issued in the location
+func (v VerifiedDay) In(loc *time.Location) VerifiedDay {
+	fs := make([]DayForecast, len(v.Forecasts))
+	for i, f := range v.Forecasts {
+		f.Issued = f.Issued.In(loc)
+		fs[i] = f
+	}
+	v.Forecasts = fs
+	return v
+}
+
+// WriteTo serializes the entity and writes it to the http response
+func (v *Verification) WriteTo(w http.ResponseWriter) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("content-type", "application/json")
+	w.Write(b)
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestForecastsAreArchived(t *testing.T) {
+	s := NewHistoryStore(t.TempDir())
+	cfg := &Config{Latitude: -33.92, Longitude: 18.42}
+	issued := time.Date(2024, 6, 1, 6, 0, 0, 0, time.UTC)
+	day := time.Date(2024, 6, 2, 0, 0, 0, 0, time.UTC)
+	f := Forecast{
+		Current:  Weather{Provider: "Consensus", Created: issued},
+		Forecast: []ForecastDay{{Day: day, TempMin: 50, TempMax: 68, WeatherIcon: 5}},
+		Units:    ImperialUnits,
+		Sources:  []Forecast{{Current: Weather{Provider: "OpenMeteo"}, Forecast: []ForecastDay{{Day: day, TempMin: 9, TempMax: 21, WeatherIcon: 6}}, Units: SIUnits}},
+	}
+	if err := s.ArchiveForecast(cfg, f); err != nil {
+		t.Fatal(err)
+	}
+	f.Current.Created = issued.Add(-time.Hour)
+	s.ArchiveForecast(cfg, f)
+
+	ss, err := s.ReadForecasts(cfg, issued, issued.Add(time.Hour))
+	if err != nil || len(ss) != 2 {
+		t.Fatal("Expected the forecasts issued in the range", ss, err)
+	}
+	if sn := ss[0]; sn.Provider != "Consensus" || !sn.Issued.Equal(issued) || len(sn.Days) != 1 || sn.Days[0] != (ForecastedDay{"2024-06-02", 10, 20, 5}) {
+		t.Error("Expected the forecast in SI units", sn)
+	}
+	if sn := ss[1]; sn.Provider != "OpenMeteo" || sn.Days[0].TempMax != 21 {
+		t.Error("Expected the forecast of the blended provider", sn)
+	}
+}
+
+func TestForecastsAreVerified(t *testing.T) {
+	at := func(d int, h int) time.Time { return time.Date(2024, 6, d, h, 0, 0, 0, time.UTC) }
+	ss := []ForecastSnapshot{
+		{Issued: at(1, 6), Provider: "OpenWeather", Days: []ForecastedDay{{"2024-06-03", 12, 18, 5}}},
+		{Issued: at(1, 18), Provider: "OpenWeather", Days: []ForecastedDay{{"2024-06-03", 11, 19, 5}}},
+		{Issued: at(2, 6), Provider: "OpenWeather", Days: []ForecastedDay{{"2024-06-03", 11, 19, 5}}},
+		{Issued: at(2, 6), Provider: "AccuWeather", Days: []ForecastedDay{{"2024-06-03", 8, 23, 6}, {"2024-06-10", 8, 23, 6}}},
+	}
+	ds := []DayStats{{Date: "2024-06-03", TempMin: 10, TempMax: 20, Icon: 5, Hours: 24}}
+	scores, days := VerifyForecasts(ss, ds, "2024-06-01", "2024-06-05", time.UTC)
+
+	exp := []ForecastScore{
+		{Provider: "AccuWeather", Lead: 1, Days: 1, TempMinMAE: 2, TempMinBias: -2, TempMaxMAE: 3, TempMaxBias: 3, IconDays: 1, IconHits: 0},
+		// Only the last forecast issued on the 1st is scored
+		{Provider: "OpenWeather", Lead: 1, Days: 1, TempMinMAE: 1, TempMinBias: 1, TempMaxMAE: 1, TempMaxBias: -1, IconDays: 1, IconHits: 100},
+		{Provider: "OpenWeather", Lead: 2, Days: 1, TempMinMAE: 1, TempMinBias: 1, TempMaxMAE: 1, TempMaxBias: -1, IconDays: 1, IconHits: 100},
+	}
+	if len(scores) != len(exp) {
+		t.Fatal("Unexpected scores", scores)
+	}
+	for i, s := range scores {
+		if s != exp[i] {
+			t.Error("Expected", exp[i], "got", s)
+		}
+	}
+
+	// The forecast that did not change is left out
+	if len(days) != 1 || days[0].Date != "2024-06-03" || days[0].Observed == nil || len(days[0].Forecasts) != 3 {
+		t.Fatal("Unexpected days", days)
+	}
+	if f := days[0].Forecasts[1]; f.Provider != "OpenWeather" || f.Lead != 2 || f.TempMin != 11 || !f.Issued.Equal(at(1, 18)) {
+		t.Error("Unexpected change of forecast", f)
+	}
+
+	// A day that was only observed for part of the day is shown, but not scored
+	ds[0].Hours = minVerifiedHours - 1
+	scores, days = VerifyForecasts(ss, ds, "2024-06-01", "2024-06-05", time.UTC)
+	if len(scores) != 0 || len(days) != 1 || days[0].Observed == nil {
+		t.Error("Expected the partly observed day not to be scored", scores, days)
+	}
+}
+
+func TestForecastsAreArchivedWhenFetched(t *testing.T) {
+	chdirTemp(t)
+	cfg := &Config{}
+	c := WeatherController{Srv: &Server{Config: cfg, History: NewHistoryStore("history")}}
+	c.getCurrentForecast(cfg, []WeatherProvider{&testProvider{Name: "Good", Temp: 20}})
+
+	ss, _ := c.Srv.History.ReadForecasts(cfg, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	if len(ss) != 1 || ss[0].Provider != "Good" || ss[0].Days[0].TempMax != 25 {
+		t.Error("Expected the forecast to be archived", ss)
+	}
+}
+
+func TestGetVerification(t *testing.T) {
+	chdirTemp(t)
+	cfg := &Config{LocationName: "Cape Town", Latitude: -33.92, Longitude: 18.42, TimeZone: "UTC"}
+	s := &Server{Config: cfg, History: NewHistoryStore("history")}
+	for h := 0; h < 24; h++ {
+		s.History.Append(cfg, Weather{Created: time.Date(2024, 6, 3, h, 0, 0, 0, time.UTC), Temp: float32(10 + h/6*3), WeatherIcon: 1, Units: SIUnits})
+	}
+	s.History.ArchiveForecast(cfg, Forecast{
+		Current:  Weather{Provider: "OpenMeteo", Created: time.Date(2024, 6, 2, 6, 0, 0, 0, time.UTC)},
+		Forecast: []ForecastDay{{Day: time.Date(2024, 6, 3, 0, 0, 0, 0, time.UTC), TempMin: 11, TempMax: 18, WeatherIcon: 1}},
+		Units:    SIUnits,
+	})
+	router := mux.NewRouter()
+	c := WeatherController{}
+	c.AddController(router, s)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/weather/verification?from=2024-06-03&to=2024-06-03&units=imperial", nil))
+	v := Verification{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &v); err != nil {
+		t.Fatal(err, rec.Body.String())
+	}
+	if v.Name != "Cape Town" || v.From != "2024-06-03" || v.Units.Temp != "F" || len(v.Scores) != 1 || len(v.Days) != 1 {
+		t.Fatal("Unexpected verification", rec.Body.String())
+	}
+	// The observed temperatures ranged from 10°C to 19°C
+	if sc := v.Scores[0]; sc.Lead != 1 || sc.TempMinMAE != 1.8 || sc.TempMinBias != 1.8 || sc.TempMaxBias != -1.8 || sc.IconHits != 100 {
+		t.Error("Unexpected score", sc)
+	}
+	if d := v.Days[0]; d.Observed.TempMax != 66.2 || d.Forecasts[0].TempMax != 64.4 {
+		t.Error("Expected the day in Fahrenheit", d)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/weather/verification?to=tomorrow", nil))
+	if rec.Code != 400 {
+		t.Error("Expected the query to be rejected")
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/weather/verification?from=2024-06-04&to=2024-06-03", nil))
+	if rec.Code != 400 {
+		t.Error("Expected a from after the to to be rejected")
+	}
+}
@@ -6,41 +6,126 @@ import (
 	"net/http"
 	"os"
 	"time"
+
+	"github.com/brumawen/weather/derived"
 )
 
 // Weather holds the current weather information
 type Weather struct {
-	Provider      string    `json:"provider"`      // Provider
-	Created       time.Time `json:"created"`       // Date and time the information was created by the provider
-	ID            string    `json:"locationID"`    // Location ID
-	Name          string    `json:"locationName"`  // Location Name
-	Temp          float32   `json:"temp"`          // Current Temperature
-	Pressure      float32   `json:"pressure"`      // Current Pressure
-	Humidity      float32   `json:"humidity"`      // Current Humidity
-	WindSpeed     float32   `json:"windSpeed"`     // Current Wind Speed
-	WindDirection float32   `json:"windDirection"` // Current Wind Direction
-	WeatherIcon   int       `json:"weatherIcon"`   // Weather Icon
-	WeatherDesc   string    `json:"weatherDesc"`   // Weather Description
-	IsDay         bool      `json:"isDay"`         // Indicates if the weather report is for the day time
-	ReadingTime   time.Time `json:"readingTime"`   // Date and Time the reading was taken
-	Sunrise       time.Time `json:"sunrise"`       // Time of Sunrise
-	Sunset        time.Time `json:"sunset"`        // Time of Sunset
+	Provider      string    `json:"provider"`          // Provider
+	Created       time.Time `json:"created"`           // Date and time the information was created by the provider
+	Stale         bool      `json:"stale,omitempty"`   // Indicates the providers failed and this is the last weather received, as of Created
+	ID            string    `json:"locationID"`        // Location ID
+	Name          string    `json:"locationName"`      // Location Name
+	Temp          float32   `json:"temp"`              // Current Temperature
+	Pressure      float32   `json:"pressure"`          // Current Pressure
+	Humidity      float32   `json:"humidity"`          // Current Humidity
+	WindSpeed     float32   `json:"windSpeed"`         // Current Wind Speed
+	WindDirection float32   `json:"windDirection"`     // Current Wind Direction
+	WindGust      float32   `json:"windGust"`          // Current Wind Gust
+	FeelsLike     float32   `json:"feelsLike"`         // Temperature it feels like, as reported by the provider
+	DewPoint      float32   `json:"dewPoint"`          // Dew Point, as reported by the provider
+	Visibility    float32   `json:"visibility"`        // Visibility
+	CloudCover    float32   `json:"cloudCover"`        // Cloud Cover (%)
+	UVIndex       float32   `json:"uvIndex"`           // UV Index
+	Precip        float32   `json:"precip"`            // Precipitation over the last hour, if reported
+	PrecipRate    float32   `json:"precipRate"`        // Rate of precipitation per hour, if reported by a weather station
+	PressureTrend string    `json:"pressureTrend"`     // Pressure tendency: rising, steady or falling, if known
+	WeatherIcon   int       `json:"weatherIcon"`       // Weather Icon
+	WeatherDesc   string    `json:"weatherDesc"`       // Weather Description
+	IsDay         bool      `json:"isDay"`             // Indicates if the weather report is for the day time
+	ReadingTime   time.Time `json:"readingTime"`       // Date and Time the reading was taken
+	Sunrise       time.Time `json:"sunrise"`           // Time of Sunrise
+	Sunset        time.Time `json:"sunset"`            // Time of Sunset
+	Sources       []string  `json:"sources,omitempty"` // Providers blended into a consensus
+	Units         Units     `json:"units"`             // Units of measure of the values
+	Language      string    `json:"language"`          // Language of the descriptions
+
+	// Metrics computed from the temperature, humidity and wind speed, whichever provider reported them
+	Derived *derived.Metrics `json:"derived,omitempty"`
 }
 
 // Forecast holds the current weather and the forecast weather information
 type Forecast struct {
-	Current  Weather       `json:"current"`  // Current Weather
-	Forecast []ForecastDay `json:"forecast"` // Weather Forecast
+	Current  Weather        `json:"current"`          // Current Weather
+	Forecast []ForecastDay  `json:"forecast"`         // Weather Forecast
+	Hourly   []ForecastHour `json:"hourly,omitempty"` // Hourly Weather Forecast, if supported by the provider
+	Alerts   []Alert        `json:"alerts,omitempty"` // Weather alerts issued for the location, if supported by the provider
+	Units    Units          `json:"units"`            // Units of measure of the forecast values
+	Language string         `json:"language"`         // Language of the descriptions and day names
+	Stale    bool           `json:"stale,omitempty"`  // Indicates the providers failed and this is the last forecast received, as of Current.Created
+	Sources  []Forecast     `json:"-"`                // Daily forecasts of the providers blended into a consensus
+}
+
+// Alert holds a weather warning issued for the location
+type Alert struct {
+	ID          string    `json:"id,omitempty"` // Identifier of the alert, used to remove duplicates
+	Source      string    `json:"source"`       // Provider or feed the alert was received from
+	Sender      string    `json:"sender"`       // Name of the agency that issued the alert
+	Event       string    `json:"event"`        // Name of the alert event
+	Severity    string    `json:"severity"`     // Severity: Extreme, Severe, Moderate, Minor or Unknown
+	Area        string    `json:"area"`         // Description of the area the alert applies to
+	Start       time.Time `json:"start"`        // Date and time the alert starts (onset)
+	End         time.Time `json:"end"`          // Date and time the alert expires
+	Description string    `json:"description"`  // Description of the alert
 }
 
 // ForecastDay holds the temperature and weather forecase for a particular day
 type ForecastDay struct {
-	Day         time.Time `json:"day"`         // Forecast date
-	Name        string    `json:"name"`        // Name of the day
-	TempMin     float32   `json:"tempMin"`     // Minimum Temperature
-	TempMax     float32   `json:"tempMax"`     // Maximum Temperature
-	WeatherIcon int       `json:"weatherIcon"` // Weather Icon
-	WeatherDesc string    `json:"weatherDesc"` // Weather description
+	Day         time.Time       `json:"day"`              // Forecast date
+	Name        string          `json:"name"`             // Name of the day
+	TempMin     float32         `json:"tempMin"`          // Minimum Temperature
+	TempMax     float32         `json:"tempMax"`          // Maximum Temperature
+	WeatherIcon int             `json:"weatherIcon"`      // Weather Icon
+	WeatherDesc string          `json:"weatherDesc"`      // Weather description
+	Detail      string          `json:"detail,omitempty"` // Detailed forecast text, if supported by the provider
+	PrecipProb  float32         `json:"precipProb"`       // Probability of precipitation (%)
+	Precip      float32         `json:"precip"`           // Amount of precipitation expected
+	Rain        float32         `json:"rain"`             // Amount of rain expected
+	Snow        float32         `json:"snow"`             // Amount of snow expected, as water
+	WindSpeed   float32         `json:"windSpeed"`        // Maximum Wind Speed
+	WindGust    float32         `json:"windGust"`         // Maximum Wind Gust
+	Humidity    float32         `json:"humidity"`         // Mean Humidity
+	UVIndex     float32         `json:"uvIndex"`          // Maximum UV Index
+	Sunrise     time.Time       `json:"sunrise"`          // Time of Sunrise
+	Sunset      time.Time       `json:"sunset"`           // Time of Sunset
+	Spread      *ForecastSpread `json:"spread,omitempty"` // Range of the temperatures forecast by the providers in a consensus
+}
+
+// ForecastSpread holds the range of the temperatures forecast for a day by the providers blended into a consensus
+type ForecastSpread struct {
+	TempMinLow  float32  `json:"tempMinLow"`  // Lowest forecast minimum temperature
+	TempMinHigh float32  `json:"tempMinHigh"` // Highest forecast minimum temperature
+	TempMaxLow  float32  `json:"tempMaxLow"`  // Lowest forecast maximum temperature
+	TempMaxHigh float32  `json:"tempMaxHigh"` // Highest forecast maximum temperature
+	Sources     []string `json:"sources"`     // Providers that forecast the day
+}
+
+// ForecastHour holds the temperature and weather forecast for a particular hour
+type ForecastHour struct {
+	Time          time.Time `json:"time"`          // Forecast date and time
+	Period        int       `json:"period"`        // Number of hours the forecast covers
+	Temp          float32   `json:"temp"`          // Temperature
+	WeatherIcon   int       `json:"weatherIcon"`   // Weather Icon
+	WeatherDesc   string    `json:"weatherDesc"`   // Weather description
+	IsDay         bool      `json:"isDay"`         // Indicates if the forecast is for the day time
+	PrecipProb    float32   `json:"precipProb"`    // Probability of precipitation (%)
+	Precip        float32   `json:"precip"`        // Amount of precipitation expected over the period
+	Humidity      float32   `json:"humidity"`      // Humidity
+	WindSpeed     float32   `json:"windSpeed"`     // Wind Speed
+	WindDirection float32   `json:"windDirection"` // Wind Direction
+
+	// Metrics computed from the temperature, humidity and wind speed, whichever provider reported them
+	Derived *derived.Metrics `json:"derived,omitempty"`
+}
+
+// HourlyForecast holds the hourly weather forecast for the coming hours
+type HourlyForecast struct {
+	Provider string         `json:"provider"`     // Provider
+	Name     string         `json:"locationName"` // Location Name
+	Hourly   []ForecastHour `json:"hourly"`       // Hourly Weather Forecast
+	Units    Units          `json:"units"`        // Units of measure of the forecast values
+	Language string         `json:"language"`     // Language of the descriptions
 }
 
 // ReadFromFile will read the weather information from the specified file
@@ -106,3 +191,123 @@ func (c *Forecast) WriteTo(w http.ResponseWriter) error {
 	w.Write(b)
 	return nil
 }
+
+// WriteTo serializes the entity and writes it to the http response
+func (c *HourlyForecast) WriteTo(w http.ResponseWriter) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("content-type", "application/json")
+	w.Write(b)
+	return nil
+}
+
+// NextHours returns the hourly forecast from the hour that includes the time until the number of hours later.
+// All the remaining hours are returned if hours is 0.
+func (c Forecast) NextHours(t time.Time, hours int) HourlyForecast {
+	h := HourlyForecast{
+		Provider: c.Current.Provider,
+		Name:     c.Current.Name,
+		Hourly:   []ForecastHour{},
+		Units:    c.Units,
+		Language: c.Language,
+	}
+	var end time.Time
+	for _, fh := range c.Hourly {
+		p := fh.Period
+		if p < 1 {
+			p = 1
+		}
+		if !fh.Time.Add(time.Duration(p) * time.Hour).After(t) {
+			// Already past
+			continue
+		}
+		if len(h.Hourly) == 0 {
+			// The hours are counted from the start of the current period
+			end = fh.Time.Add(time.Duration(hours) * time.Hour)
+		}
+		if hours > 0 && !fh.Time.Before(end) {
+			break
+		}
+		h.Hourly = append(h.Hourly, fh)
+	}
+	return h
+}
+
+// WithDerived returns the weather with the metrics derived from its temperature, humidity and wind speed.
+// Nothing is derived if the humidity is not known.
+func (c Weather) WithDerived() Weather {
+	c.Derived = deriveMetrics(c.Temp, c.Humidity, c.WindSpeed, c.Units)
+	return c
+}
+
+// WithDerived returns the forecast with the metrics derived for the current weather and each hour.
+// The hours are copied so that the original forecast is left untouched.
+func (c Forecast) WithDerived() Forecast {
+	c.Current = c.Current.WithDerived()
+	if len(c.Hourly) != 0 {
+		hs := make([]ForecastHour, len(c.Hourly))
+		for i, h := range c.Hourly {
+			h.Derived = deriveMetrics(h.Temp, h.Humidity, h.WindSpeed, c.Units)
+			hs[i] = h
+		}
+		c.Hourly = hs
+	}
+	return c
+}
+
+// deriveMetrics computes the derived metrics from values in the units, returning the temperatures in the same units
+func deriveMetrics(temp float32, humidity float32, windSpeed float32, u Units) *derived.Metrics {
+	if humidity <= 0 {
+		return nil
+	}
+	m := derived.Compute(convertTemp(temp, u.Temp, "C"), humidity, convertSpeed(windSpeed, u.WindSpeed, "m/s"))
+	m.DewPoint = convertTemp(m.DewPoint, "C", u.Temp)
+	m.HeatIndex = convertTemp(m.HeatIndex, "C", u.Temp)
+	m.WindChill = convertTemp(m.WindChill, "C", u.Temp)
+	m.Humidex = convertTemp(m.Humidex, "C", u.Temp)
+	m.ApparentTemp = convertTemp(m.ApparentTemp, "C", u.Temp)
+	return &m
+}
+
+// In returns the weather with its times in the time zone
+func (c Weather) In(loc *time.Location) Weather {
+	c.Created = c.Created.In(loc)
+	c.ReadingTime = c.ReadingTime.In(loc)
+	c.Sunrise = c.Sunrise.In(loc)
+	c.Sunset = c.Sunset.In(loc)
+	return c
+}
+
+// In returns the forecast with its times in the time zone.
+// The days, hours and alerts are copied so that the original forecast is left untouched.
+func (c Forecast) In(loc *time.Location) Forecast {
+	c.Current = c.Current.In(loc)
+	ds := make([]ForecastDay, len(c.Forecast))
+	for i, d := range c.Forecast {
+		d.Day = d.Day.In(loc)
+		d.Sunrise = d.Sunrise.In(loc)
+		d.Sunset = d.Sunset.In(loc)
+		ds[i] = d
+	}
+	c.Forecast = ds
+	if len(c.Hourly) != 0 {
+		hs := make([]ForecastHour, len(c.Hourly))
+		for i, h := range c.Hourly {
+			h.Time = h.Time.In(loc)
+			hs[i] = h
+		}
+		c.Hourly = hs
+	}
+	if len(c.Alerts) != 0 {
+		as := make([]Alert, len(c.Alerts))
+		for i, a := range c.Alerts {
+			a.Start = a.Start.In(loc)
+			a.End = a.End.In(loc)
+			as[i] = a
+		}
+		c.Alerts = as
+	}
+	return c
+}
@@ -6,11 +6,23 @@ import (
 	"html/template"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
 )
 
+// The last weather and forecast received are returned when all the providers fail, marked as stale,
+// for as long as they are of use
+const (
+	maxStaleWeather  = 6 * time.Hour
+	maxStaleForecast = 24 * time.Hour
+)
+
+// maxHourlyHours is the most hours of the hourly forecast that can be asked for, the 16 days the providers forecast at most
+const maxHourlyHours = 16 * 24
+
 // WeatherController handles the Web Methods for retrieving weather and forecast information.
 type WeatherController struct {
 	Srv *Server
@@ -19,11 +31,21 @@ type WeatherController struct {
 // WeatherPageData holds the data used to populate the weather html page
 type WeatherPageData struct {
 	UnitIcon      string             // Unit of measure icon
+	WindUnit      string             // Wind speed unit of measure
+	PressureUnit  string             // Pressure unit of measure
 	Temp          float32            // Current Temperature
 	Pressure      float32            // Current Pressure
 	Humidity      float32            // Current Humidity
 	WindSpeed     float32            // Wind Speed
 	WindDirection float32            // Wind Direction
+	WindGust      float32            // Wind Gust
+	FeelsLike     float32            // Temperature it feels like
+	DewPoint      float32            // Dew Point
+	Visibility    float32            // Visibility
+	DistanceUnit  string             // Visibility unit of measure
+	CloudCover    float32            // Cloud Cover
+	UVIndex       float32            // UV Index
+	PressureTrend string             // Pressure tendency: rising, steady or falling, if known
 	Sunrise       string             // Time of sunrise
 	Sunset        string             // Time of sunset
 	ReadTime      time.Time          // Time reading was taken
@@ -32,6 +54,26 @@ type WeatherPageData struct {
 	MoonIcon      string             // Moon Icon
 	MoonDesc      string             // Moon Description
 	Forecast      []ForecastPageData // Forecast
+	Language      string             // Language of the page
+	LocationName  string             // Name of the location
+	Alerts        []AlertPageData    // Weather alerts in force
+	Records       []RecordPageData   // Records since the observations started
+	RecordsSince  string             // Date of the first observation
+}
+
+// RecordPageData holds the record data used to populate the records panel of the weather html page
+type RecordPageData struct {
+	Name  string // Name of the record
+	Value string // Value of the record, with its unit
+	Date  string // Date the record was set
+}
+
+// AlertPageData holds the alert data used to populate the warning banner of the weather html page
+type AlertPageData struct {
+	Event string // Name of the alert event
+	Area  string // Area the alert applies to
+	Class string // Banner style: danger for severe alerts, otherwise warning
+	Until string // Day and time the alert expires, if known
 }
 
 // ForecastPageData holds the forecast data used to populate the weather html page
@@ -41,6 +83,9 @@ type ForecastPageData struct {
 	TempMax     int    // Maximum temperature
 	WeatherIcon string // Weather Icon
 	WeatherDesc string // Weather description
+	Spread      string // Uncertainty of the temperatures of a consensus forecast
+	PrecipProb  int    // Probability of precipitation (%)
+	Precip      string // Amount of precipitation expected, with its unit
 }
 
 // AddController adds the controller routes to the router
@@ -52,6 +97,16 @@ func (c *WeatherController) AddController(router *mux.Router, s *Server) {
 		Handler(Logger(c, http.HandlerFunc(c.handleGetCurrent)))
 	router.Methods("GET").Path("/weather/forecast").Name("GetForecast").
 		Handler(Logger(c, http.HandlerFunc(c.handleGetForecast)))
+	router.Methods("GET").Path("/weather/hourly").Name("GetHourly").
+		Handler(Logger(c, http.HandlerFunc(c.handleGetHourly)))
+	router.Methods("GET").Path("/weather/alerts").Name("GetAlerts").
+		Handler(Logger(c, http.HandlerFunc(c.handleGetAlerts)))
+	router.Methods("GET").Path("/weather/history").Name("GetHistory").
+		Handler(Logger(c, http.HandlerFunc(c.handleGetHistory)))
+	router.Methods("GET").Path("/weather/stats").Name("GetStats").
+		Handler(Logger(c, http.HandlerFunc(c.handleGetStats)))
+	router.Methods("GET").Path("/weather/verification").Name("GetVerification").
+		Handler(Logger(c, http.HandlerFunc(c.handleGetVerification)))
 }
 
 // LogInfo is used to log information messages for this controller.
@@ -67,32 +122,60 @@ func (c *WeatherController) LogError(v ...interface{}) {
 }
 
 func (c *WeatherController) handleWeatherWebPage(w http.ResponseWriter, r *http.Request) {
-	p, err := c.getWeatherProvider()
+	cfg, code, err := c.getConfig(r)
+	if err != nil {
+		http.Error(w, err.Error(), code)
+		return
+	}
+	u, err := c.getUnits(cfg, r)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	ps, err := c.getWeatherProviders(cfg)
 	if err != nil {
 		c.LogError("Error getting weather provider." + err.Error())
 		http.Error(w, "Error getting weather prvider. "+err.Error(), 500)
 		return
 	}
 
-	cf := c.getCurrentForecast(p)
+	cf, _ := c.getCurrentForecast(cfg, ps)
+	// The provider that answers with the current weather may not be the one that provided the forecast
+	if cw, err := c.getCurrentWeather(cfg, ps); err == nil || cw.Provider != "" {
+		cf.Current = cw
+	}
+	cf = u.ConvertForecast(cf.WithDerived()).In(cfg.GetTimeZone())
 
 	v := WeatherPageData{
-		Temp:          cf.Current.Temp,
-		Pressure:      cf.Current.Pressure,
-		Humidity:      cf.Current.Humidity,
-		WindSpeed:     cf.Current.WindSpeed,
-		WindDirection: cf.Current.WindDirection,
+		Temp:          roundTo(cf.Current.Temp, 1),
+		Pressure:      roundTo(cf.Current.Pressure, 2),
+		Humidity:      roundTo(cf.Current.Humidity, 0),
+		WindSpeed:     roundTo(cf.Current.WindSpeed, 1),
+		WindDirection: roundTo(cf.Current.WindDirection, 0),
+		WindGust:      roundTo(cf.Current.WindGust, 1),
+		FeelsLike:     roundTo(cf.Current.FeelsLike, 1),
+		DewPoint:      roundTo(cf.Current.DewPoint, 1),
+		Visibility:    roundTo(cf.Current.Visibility, 1),
+		DistanceUnit:  u.Distance,
+		CloudCover:    roundTo(cf.Current.CloudCover, 0),
+		UVIndex:       roundTo(cf.Current.UVIndex, 0),
+		PressureTrend: cf.Current.PressureTrend,
 		Sunrise:       cf.Current.Sunrise.Format("3:04PM"),
 		Sunset:        cf.Current.Sunset.Format("3:04PM"),
 		WeatherIcon:   c.getWeatherIconInfo(cf.Current.WeatherIcon, cf.Current.IsDay),
 		WeatherDesc:   cf.Current.WeatherDesc,
+		WindUnit:      u.WindSpeed,
+		PressureUnit:  u.Pressure,
+		Language:      cfg.GetLanguage(),
+		LocationName:  cfg.LocationName,
 	}
-	if c.Srv.Config.UnitType == 0 {
-		v.UnitIcon = "wi-celsius"
-	} else {
+	if u.Temp == "F" {
 		v.UnitIcon = "wi-fahrenheit"
+	} else {
+		v.UnitIcon = "wi-celsius"
 	}
 	v.MoonIcon, v.MoonDesc = c.getMoonIconInfo()
+	v.MoonDesc = T(cfg.GetLanguage(), v.MoonDesc)
 	for _, d := range cf.Forecast {
 		v.Forecast = append(v.Forecast, ForecastPageData{
 			DayName:     d.Name,
@@ -100,105 +183,669 @@ func (c *WeatherController) handleWeatherWebPage(w http.ResponseWriter, r *http.
 			TempMax:     int(d.TempMax),
 			WeatherIcon: c.getWeatherIconInfo(d.WeatherIcon, true),
 			WeatherDesc: d.WeatherDesc,
+			Spread:      c.getSpreadInfo(d.Spread),
+			PrecipProb:  int(roundTo(d.PrecipProb, 0)),
+			Precip:      c.getPrecipInfo(d.Precip, u.Precip),
 		})
 	}
 
-	t := template.Must(template.ParseFiles("./html/weather.html"))
+	ar, _ := c.getAlerts(cfg, ps)
+	ar = ar.In(cfg.GetTimeZone())
+	for _, a := range ar.Alerts {
+		if !a.IsActive(time.Now()) {
+			continue
+		}
+		ap := AlertPageData{Event: a.Event, Area: a.Area, Class: "warning"}
+		if severityRank[a.Severity] >= severityRank["Severe"] {
+			ap.Class = "danger"
+		}
+		if !a.End.IsZero() {
+			ap.Until = DayName(a.End, cfg.GetLanguage()) + " " + a.End.Format("3:04PM")
+		}
+		v.Alerts = append(v.Alerts, ap)
+	}
+
+	if c.Srv.History != nil {
+		if ds, err := c.Srv.History.GetDailyStats(cfg); err == nil && len(ds) != 0 {
+			rs := GetRecords(ds).Convert(u)
+			v.RecordsSince = rs.Since
+			v.Records = c.getRecordsInfo(rs, u, cfg.GetLanguage())
+		}
+	}
+
+	t := template.Must(template.New("weather.html").Funcs(templateFuncs(cfg.GetLanguage())).ParseFiles("./html/weather.html"))
 	t.Execute(w, v)
 }
 
 // Get the current weather information
 func (c *WeatherController) handleGetCurrent(w http.ResponseWriter, r *http.Request) {
-	if p, err := c.getWeatherProvider(); err != nil {
+	cfg, code, err := c.getConfig(r)
+	if err != nil {
+		http.Error(w, err.Error(), code)
+		return
+	}
+	u, err := c.getUnits(cfg, r)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	ps, err := c.getWeatherProviders(cfg)
+	if err != nil {
 		c.LogError("Error getting weather provider. " + err.Error())
 		http.Error(w, "Error getting weather provider. "+err.Error(), 500)
-	} else {
-		// Check to see if we have already downloaded the latest weather
-		lw := Weather{}
-		if _, err := os.Stat("lastweather.json"); err == nil {
-			// File exists, check if this provider created it
-			// and whether it was created less than 1 hour ago and, if so, return this record
-			if err = lw.ReadFromFile("lastweather.json"); err == nil {
-				if lw.Provider == p.GetProviderName() && time.Since(lw.Created).Minutes() <= 60 {
-					c.LogInfo("Returning cached weather.")
-					if err := lw.WriteTo(w); err != nil {
-						c.LogError("Error serializing weather information. " + err.Error())
-					} else {
-						return
-					}
-				}
-			}
-		}
-
-		// Get the weather information from the weather site
-		cw, err := p.GetWeather()
-		if err != nil {
-			c.LogError("Error getting weather information. " + err.Error())
-			cw = lw
-		} else {
-			cw.WriteToFile("lastweather.json")
-		}
-		if err := cw.WriteTo(w); err != nil {
-			c.LogError("Error serializing weather information. " + err.Error())
-			http.Error(w, "Error serializing weather information. "+err.Error(), 500)
-		}
+		return
+	}
+	cw, err := c.getCurrentWeather(cfg, ps)
+	if err != nil && cw.Provider == "" {
+		http.Error(w, "Error getting weather information. "+err.Error(), 500)
+		return
+	}
+	cw = u.ConvertWeather(cw.WithDerived()).In(cfg.GetTimeZone())
+	if err := cw.WriteTo(w); err != nil {
+		c.LogError("Error serializing weather information. " + err.Error())
+		http.Error(w, "Error serializing weather information. "+err.Error(), 500)
 	}
 }
 
 // Get the current forecast information
 func (c *WeatherController) handleGetForecast(w http.ResponseWriter, r *http.Request) {
-	if p, err := c.getWeatherProvider(); err != nil {
+	cfg, code, err := c.getConfig(r)
+	if err != nil {
+		http.Error(w, err.Error(), code)
+		return
+	}
+	u, err := c.getUnits(cfg, r)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	ps, err := c.getWeatherProviders(cfg)
+	if err != nil {
 		c.LogError("Error getting weather provider. " + err.Error())
 		http.Error(w, "Error getting weather provider. "+err.Error(), 500)
-	} else {
-		cf := c.getCurrentForecast(p)
-		if err := cf.WriteTo(w); err != nil {
-			c.LogError("Error serializing forecast information. " + err.Error())
-			http.Error(w, "Error serializing forecast information. "+err.Error(), 500)
+		return
+	}
+	cf, err := c.getCurrentForecast(cfg, ps)
+	if err != nil && cf.Current.Provider == "" {
+		http.Error(w, "Error getting forecast information. "+err.Error(), 500)
+		return
+	}
+	cf = u.ConvertForecast(cf.WithDerived()).In(cfg.GetTimeZone())
+	if err := cf.WriteTo(w); err != nil {
+		c.LogError("Error serializing forecast information. " + err.Error())
+		http.Error(w, "Error serializing forecast information. "+err.Error(), 500)
+	}
+}
+
+// Get the hourly forecast for the coming hours
+func (c *WeatherController) handleGetHourly(w http.ResponseWriter, r *http.Request) {
+	hrs := 0
+	if q := r.URL.Query().Get("hours"); q != "" {
+		n, err := strconv.Atoi(q)
+		if err != nil || n < 1 || n > maxHourlyHours {
+			http.Error(w, "Invalid hours value, expected 1 to "+strconv.Itoa(maxHourlyHours), 400)
+			return
 		}
+		hrs = n
+	}
+	cfg, code, err := c.getConfig(r)
+	if err != nil {
+		http.Error(w, err.Error(), code)
+		return
+	}
+	u, err := c.getUnits(cfg, r)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	ps, err := c.getWeatherProviders(cfg)
+	if err != nil {
+		c.LogError("Error getting weather provider. " + err.Error())
+		http.Error(w, "Error getting weather provider. "+err.Error(), 500)
+		return
+	}
+	cf, err := c.getCurrentForecast(cfg, ps)
+	if err != nil && cf.Current.Provider == "" {
+		http.Error(w, "Error getting forecast information. "+err.Error(), 500)
+		return
+	}
+	hf := u.ConvertForecast(cf.WithDerived()).In(cfg.GetTimeZone()).NextHours(time.Now(), hrs)
+	if err := hf.WriteTo(w); err != nil {
+		c.LogError("Error serializing hourly forecast information. " + err.Error())
+		http.Error(w, "Error serializing hourly forecast information. "+err.Error(), 500)
 	}
 }
 
-func (c *WeatherController) getWeatherProvider() (WeatherProvider, error) {
-	switch c.Srv.Config.Provider {
-	case 0:
-		// OpenWeather
-		ow := new(OpenWeather)
-		ow.SetConfig(c.Srv.Config)
-		return ow, nil
-	case 1:
-		// Accuweather
-		aw := new(AccuWeather)
-		aw.SetConfig(c.Srv.Config)
-		return aw, nil
-	default:
-		return nil, errors.New("Invalid Weather provider")
+// Get the weather alerts for the location
+func (c *WeatherController) handleGetAlerts(w http.ResponseWriter, r *http.Request) {
+	cfg, code, err := c.getConfig(r)
+	if err != nil {
+		http.Error(w, err.Error(), code)
+		return
+	}
+	ps, err := c.getWeatherProviders(cfg)
+	if err != nil {
+		c.LogError("Error getting weather provider. " + err.Error())
+		http.Error(w, "Error getting weather provider. "+err.Error(), 500)
+		return
+	}
+	ar, err := c.getAlerts(cfg, ps)
+	if err != nil && ar.Created.IsZero() {
+		http.Error(w, "Error getting alerts. "+err.Error(), 500)
+		return
+	}
+	ar = ar.In(cfg.GetTimeZone())
+	if err := ar.WriteTo(w); err != nil {
+		c.LogError("Error serializing alerts. " + err.Error())
+		http.Error(w, "Error serializing alerts. "+err.Error(), 500)
 	}
 }
 
-func (c *WeatherController) getCurrentForecast(p WeatherProvider) Forecast {
+// Get the weather observations of a range of time, averaged over an interval if one is given
+func (c *WeatherController) handleGetHistory(w http.ResponseWriter, r *http.Request) {
+	if c.Srv.History == nil {
+		http.Error(w, "The history is not kept", 500)
+		return
+	}
+	cfg, code, err := c.getConfig(r)
+	if err != nil {
+		http.Error(w, err.Error(), code)
+		return
+	}
+	u, err := c.getUnits(cfg, r)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	loc := cfg.GetTimeZone()
+	q := r.URL.Query()
+
+	// The last week is returned if no range is given
+	to := time.Now()
+	if s := q.Get("to"); s != "" {
+		if to, err = parseHistoryTime(s, loc); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+	}
+	from := to.AddDate(0, 0, -7)
+	if s := q.Get("from"); s != "" {
+		if from, err = parseHistoryTime(s, loc); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+	}
+	if !from.Before(to) {
+		http.Error(w, "The from time must be before the to time", 400)
+		return
+	}
+	fs, err := ParseHistoryFields(q.Get("fields"))
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	d, err := ParseInterval(q.Get("interval"))
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	obs, err := c.Srv.History.Query(cfg, from, to)
+	if err != nil {
+		c.LogError("Error reading the history. " + err.Error())
+		http.Error(w, "Error reading the history. "+err.Error(), 500)
+		return
+	}
+	h := History{Name: cfg.LocationName, From: from, To: to, Units: u}
+	if d > 0 {
+		h.Interval = strings.ToLower(q.Get("interval"))
+	}
+	h.Observations = ConvertObservations(Downsample(obs, d, loc), u, fs)
+	h = h.In(loc)
+	if err := h.WriteTo(w); err != nil {
+		c.LogError("Error serializing the history. " + err.Error())
+		http.Error(w, "Error serializing the history. "+err.Error(), 500)
+	}
+}
+
+// Get the statistics of the days of a range of time, the monthly summaries and the records
+func (c *WeatherController) handleGetStats(w http.ResponseWriter, r *http.Request) {
+	if c.Srv.History == nil {
+		http.Error(w, "The history is not kept", 500)
+		return
+	}
+	cfg, code, err := c.getConfig(r)
+	if err != nil {
+		http.Error(w, err.Error(), code)
+		return
+	}
+	u, err := c.getUnits(cfg, r)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	loc := cfg.GetTimeZone()
+	q := r.URL.Query()
+
+	// The days of the last month are returned if no range is given
+	to := time.Now()
+	if s := q.Get("to"); s != "" {
+		if to, err = parseHistoryTime(s, loc); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+	}
+	from := to.AddDate(0, -1, 0)
+	if s := q.Get("from"); s != "" {
+		if from, err = parseHistoryTime(s, loc); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+	}
+	if to.Before(from) {
+		http.Error(w, "The from time must not be after the to time", 400)
+		return
+	}
+
+	ds, err := c.Srv.History.GetDailyStats(cfg)
+	if err != nil {
+		c.LogError("Error calculating the statistics. " + err.Error())
+		http.Error(w, "Error calculating the statistics. "+err.Error(), 500)
+		return
+	}
+	st := ClimateStats{Name: cfg.LocationName, Units: u, Days: []DayStats{}, Months: []MonthStats{}}
+	fd, td := from.In(loc).Format("2006-01-02"), to.In(loc).Format("2006-01-02")
+	for _, d := range ds {
+		if d.Date >= fd && d.Date <= td {
+			st.Days = append(st.Days, d.Convert(u))
+		}
+	}
+	for _, m := range SummariseMonths(ds) {
+		st.Months = append(st.Months, m.Convert(u))
+	}
+	st.Records = GetRecords(ds).Convert(u)
+	if err := st.WriteTo(w); err != nil {
+		c.LogError("Error serializing the statistics. " + err.Error())
+		http.Error(w, "Error serializing the statistics. "+err.Error(), 500)
+	}
+}
+
+// Get the errors of the providers' forecasts, and how the forecasts of the days of a range changed
+func (c *WeatherController) handleGetVerification(w http.ResponseWriter, r *http.Request) {
+	if c.Srv.History == nil {
+		http.Error(w, "The history is not kept", 500)
+		return
+	}
+	cfg, code, err := c.getConfig(r)
+	if err != nil {
+		http.Error(w, err.Error(), code)
+		return
+	}
+	u, err := c.getUnits(cfg, r)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	loc := cfg.GetTimeZone()
+	q := r.URL.Query()
+
+	// The days of the last month are verified if no range is given
+	now := time.Now()
+	to := now
+	if s := q.Get("to"); s != "" {
+		if to, err = parseHistoryTime(s, loc); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+	}
+	from := to.AddDate(0, -1, 0)
+	if s := q.Get("from"); s != "" {
+		if from, err = parseHistoryTime(s, loc); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+	}
+	if to.Before(from) {
+		http.Error(w, "The from time must not be after the to time", 400)
+		return
+	}
+	fd, td := from.In(loc).Format("2006-01-02"), to.In(loc).Format("2006-01-02")
+
+	// Only the days that are over have been observed
+	ds, err := c.Srv.History.GetDailyStats(cfg)
+	if err != nil {
+		c.LogError("Error calculating the statistics. " + err.Error())
+		http.Error(w, "Error calculating the statistics. "+err.Error(), 500)
+		return
+	}
+	today := now.In(loc).Format("2006-01-02")
+	obs := []DayStats{}
+	for _, d := range ds {
+		if d.Date < today {
+			obs = append(obs, d)
+		}
+	}
+	start, _ := time.ParseInLocation("2006-01-02", fd, loc)
+	end, _ := time.ParseInLocation("2006-01-02", td, loc)
+	ss, err := c.Srv.History.ReadForecasts(cfg, start.AddDate(0, 0, -maxVerifiedLead), end.AddDate(0, 0, 1))
+	if err != nil {
+		c.LogError("Error reading the archived forecasts. " + err.Error())
+		http.Error(w, "Error reading the archived forecasts. "+err.Error(), 500)
+		return
+	}
+
+	scores, days := VerifyForecasts(ss, obs, fd, td, loc)
+	v := Verification{Name: cfg.LocationName, From: fd, To: td, Units: u, Scores: []ForecastScore{}, Days: []VerifiedDay{}}
+	for _, s := range scores {
+		v.Scores = append(v.Scores, s.Convert(u))
+	}
+	for _, d := range days {
+		v.Days = append(v.Days, d.Convert(u).In(loc))
+	}
+	if err := v.WriteTo(w); err != nil {
+		c.LogError("Error serializing the verification. " + err.Error())
+		http.Error(w, "Error serializing the verification. "+err.Error(), 500)
+	}
+}
+
+// getUnits returns the units of the configuration, overridden by those in the units query parameter
+func (c *WeatherController) getUnits(cfg *Config, r *http.Request) (Units, error) {
+	u := cfg.GetUnits()
+	if q := r.URL.Query().Get("units"); q != "" {
+		var err error
+		if u, err = ParseUnits(q, u); err != nil {
+			return u, errors.New("Invalid units. " + err.Error())
+		}
+	}
+	return u, nil
+}
+
+// getConfig returns the configuration for the request, which reports the weather for the named location
+// of the location query parameter, and in the language of the lang query parameter, if these are given.
+// If the configuration cannot be derived, the HTTP status to answer with is returned with the error.
+func (c *WeatherController) getConfig(r *http.Request) (*Config, int, error) {
+	// The time zones of locations entered without one are looked up when their weather is first asked for
+	if c.Srv.Config.LookupTimeZones() {
+		c.Srv.Config.WriteToFile("config.json")
+	}
+	return getRequestConfig(c.Srv.Config, r)
+}
+
+// getRequestConfig returns the configuration derived from the configuration for the location and lang
+// query parameters of the request, or the HTTP status to answer with and the error. An unknown location
+// is not found and an unsupported language is a bad request.
+func getRequestConfig(cfg *Config, r *http.Request) (*Config, int, error) {
+	if n := r.URL.Query().Get("location"); n != "" {
+		lc, ok := cfg.ForLocation(n)
+		if !ok {
+			return nil, 404, errors.New("Unknown location " + n)
+		}
+		cfg = lc
+	}
+	q := r.URL.Query().Get("lang")
+	if q == "" {
+		return cfg, 200, nil
+	}
+	l, ok := ParseLanguage(q)
+	if !ok {
+		return nil, 400, errors.New("Unsupported language " + q)
+	}
+	if l == cfg.GetLanguage() {
+		return cfg, 200, nil
+	}
+	return cfg.ForLanguage(l), 200, nil
+}
+
+// getCachePath returns the file the weather for the configuration is cached in. Weather for a
+// named location, or in a language other than the configured one, is cached separately.
+func (c *WeatherController) getCachePath(cfg *Config, name string) string {
+	if n := cfg.GetNamedLocation(); n != "" {
+		name += "-" + n
+	}
+	if l := cfg.GetLanguage(); l != c.Srv.Config.GetLanguage() {
+		return name + "." + l + ".json"
+	}
+	return name + ".json"
+}
+
+// isConfiguredLanguage indicates whether the configuration reports the weather in the configured language.
+// Only its weather is published, so that the weather of a location is not repeated for each language.
+func (c *WeatherController) isConfiguredLanguage(cfg *Config) bool {
+	return cfg.GetLanguage() == c.Srv.Config.GetLanguage()
+}
+
+// getLocationRules returns the rules on the weather of the location of the configuration
+func getLocationRules(cfg *Config) []Rule {
+	rs := []Rule{}
+	for _, r := range cfg.GetRules() {
+		if r.Location == cfg.GetNamedLocation() {
+			rs = append(rs, r)
+		}
+	}
+	return rs
+}
+
+// getWeatherProviders returns the configured weather providers in order of preference
+func (c *WeatherController) getWeatherProviders(cfg *Config) ([]WeatherProvider, error) {
+	ps := []WeatherProvider{}
+	for _, n := range cfg.ProviderOrder() {
+		p, err := NewWeatherProvider(n, cfg)
+		if err != nil {
+			return nil, err
+		}
+		ps = append(ps, p)
+	}
+	return ps, nil
+}
+
+// getCurrentWeather returns the latest weather from the first provider that succeeds.
+// If all the providers fail, the last weather received is returned, marked as stale, along with the error,
+// unless it is too old to be of use.
+func (c *WeatherController) getCurrentWeather(cfg *Config, ps []WeatherProvider) (Weather, error) {
+	// Check to see if we have already downloaded the latest weather
+	lw := Weather{}
+	path := c.getCachePath(cfg, "lastweather")
+	lang := cfg.GetLanguage()
+	if _, err := os.Stat(path); err == nil {
+		// File exists, check if one of the providers created it
+		// and whether it was created less than 1 hour ago and, if so, return this record
+		// Weather cached before the units were recorded, or in another language, cannot be used
+		if err = lw.ReadFromFile(path); err != nil || !lw.Units.IsSet() || lw.Language != lang {
+			lw = Weather{}
+		} else if isProviderOf(ps, lw.Provider) && time.Since(lw.Created).Minutes() <= 60 {
+			c.LogInfo("Returning cached weather.")
+			metrics.ObserveCache("weather", true)
+			metrics.ObserveWeather(getLocationLabel(cfg), lw)
+			return lw, nil
+		}
+	}
+	metrics.ObserveCache("weather", false)
+
+	// Get the weather information from the weather sites
+	errs := []string{}
+	for _, p := range ps {
+		start := time.Now()
+		cw, err := p.GetWeather()
+		metrics.ObserveProviderCall(p.GetProviderName(), "weather", time.Since(start), err)
+		if err == nil {
+			cw.Units = SIUnits
+			cw.Language = lang
+			cw.WriteToFile(path)
+			metrics.ObserveWeather(getLocationLabel(cfg), cw)
+			if c.Srv.Rules != nil {
+				c.Srv.Rules.EvaluateWeather(getLocationRules(cfg), cw, cfg.GetUnits())
+			}
+			c.dispatch(cfg, "observation", cfg.GetUnits().ConvertWeather(cw.WithDerived()).In(cfg.GetTimeZone()))
+			if c.Srv.MQTT != nil && c.isConfiguredLanguage(cfg) {
+				c.Srv.MQTT.PublishWeather(cfg, cw)
+			}
+			if c.Srv.History != nil && lang == c.Srv.Config.GetLanguage() {
+				if err := c.Srv.History.Append(cfg, cw); err != nil {
+					c.LogError("Error adding the weather to the history. ", err.Error())
+				}
+			}
+			return cw, nil
+		}
+		c.LogError("Error getting weather information from ", p.GetProviderName(), ". ", err.Error())
+		errs = append(errs, p.GetProviderName()+": "+err.Error())
+	}
+	if lw.Provider == "" || time.Since(lw.Created) > maxStaleWeather {
+		return Weather{}, errors.New(strings.Join(errs, "; "))
+	}
+	lw.Stale = true
+	return lw, errors.New(strings.Join(errs, "; "))
+}
+
+// getCurrentForecast returns the latest forecast from the first provider that succeeds.
+// If all the providers fail, the last forecast received is returned, marked as stale, along with the error,
+// unless it is too old to be of use.
+func (c *WeatherController) getCurrentForecast(cfg *Config, ps []WeatherProvider) (Forecast, error) {
 	// Check to see if we have already downloaded the latest forecast
 	lf := Forecast{}
-	if _, err := os.Stat("lastforecast.json"); err == nil {
-		// File exists, check if this provider created it
+	path := c.getCachePath(cfg, "lastforecast")
+	lang := cfg.GetLanguage()
+	if _, err := os.Stat(path); err == nil {
+		// File exists, check if one of the providers created it
 		// and whether it was created less than 1 hour ago and, if so, return this record
-		if err = lf.ReadFromFile("lastforecast.json"); err == nil {
-			if lf.Current.Provider == p.GetProviderName() && time.Since(lf.Current.Created).Minutes() <= 60 {
-				c.LogInfo("Returning cached forecast.")
-				return lf
+		// Forecasts cached before the units were recorded, or in another language, cannot be used
+		if err = lf.ReadFromFile(path); err != nil || !lf.Units.IsSet() || lf.Language != lang {
+			lf = Forecast{}
+		} else if isProviderOf(ps, lf.Current.Provider) && time.Since(lf.Current.Created).Minutes() <= 60 {
+			c.LogInfo("Returning cached forecast.")
+			metrics.ObserveCache("forecast", true)
+			return lf, nil
+		}
+	}
+	metrics.ObserveCache("forecast", false)
+
+	errs := []string{}
+	for _, p := range ps {
+		c.LogInfo("Getting fresh forecast from ", p.GetProviderName(), ".")
+		start := time.Now()
+		cf, err := p.GetForecast()
+		metrics.ObserveProviderCall(p.GetProviderName(), "forecast", time.Since(start), err)
+		if err == nil {
+			// Record which provider answered, even if it did not fill in the current weather
+			cf.Current.Provider = p.GetProviderName()
+			cf.Units = SIUnits
+			cf.Current.Units = SIUnits
+			cf.Language = lang
+			cf.Current.Language = lang
+			cf.WriteToFile(path)
+			if c.Srv.History != nil && lang == c.Srv.Config.GetLanguage() {
+				if err := c.Srv.History.ArchiveForecast(cfg, cf); err != nil {
+					c.LogError("Error archiving the forecast. ", err.Error())
+				}
 			}
+			if c.Srv.Rules != nil {
+				c.Srv.Rules.EvaluateForecast(getLocationRules(cfg), cf, cfg.GetUnits(), time.Now())
+			}
+			if forecastChanged(lf, cf) {
+				c.dispatch(cfg, "forecast", cfg.GetUnits().ConvertForecast(cf.WithDerived()).In(cfg.GetTimeZone()))
+			}
+			if c.Srv.MQTT != nil && c.isConfiguredLanguage(cfg) {
+				c.Srv.MQTT.PublishForecast(cfg, cf)
+			}
+			return cf, nil
 		}
+		c.LogError("Error getting forecast information from ", p.GetProviderName(), ". ", err.Error())
+		errs = append(errs, p.GetProviderName()+": "+err.Error())
+	}
+	if lf.Current.Provider == "" || time.Since(lf.Current.Created) > maxStaleForecast {
+		return Forecast{}, errors.New(strings.Join(errs, "; "))
 	}
+	lf.Stale = true
+	return lf, errors.New(strings.Join(errs, "; "))
+}
 
-	c.LogInfo("Getting fresh forecast from the provider.")
-	cf, err := p.GetForecast()
-	if err != nil {
-		c.LogError("Error getting forecast information. " + err.Error())
-		cf = lf
-	} else {
-		cf.WriteToFile("lastforecast.json")
+// getAlerts returns the alerts of the first provider that reports them, merged with those of the
+// configured alert feeds. If all of these fail, the last alerts received are returned along with the error.
+func (c *WeatherController) getAlerts(cfg *Config, ps []WeatherProvider) (AlertReport, error) {
+	la := AlertReport{}
+	path := c.getCachePath(cfg, "lastalerts")
+	lang := cfg.GetLanguage()
+	if _, err := os.Stat(path); err == nil {
+		// Alerts are issued and lifted at short notice, so they are only cached for 15 minutes
+		if err = la.ReadFromFile(path); err != nil || la.Language != lang {
+			la = AlertReport{}
+		} else if time.Since(la.Created).Minutes() <= 15 {
+			c.LogInfo("Returning cached alerts.")
+			metrics.ObserveCache("alerts", true)
+			la.Alerts = MergeAlerts(time.Now(), la.Alerts)
+			return la, nil
+		}
 	}
-	return cf
+	metrics.ObserveCache("alerts", false)
+
+	lists := [][]Alert{}
+	errs := []string{}
+	for _, p := range ps {
+		ap, ok := p.(AlertProvider)
+		if !ok {
+			continue
+		}
+		start := time.Now()
+		as, err := ap.GetAlerts()
+		if err == errAlertsNotSupported {
+			continue
+		}
+		metrics.ObserveProviderCall(p.GetProviderName(), "alerts", time.Since(start), err)
+		if err == nil {
+			lists = append(lists, as)
+			break
+		}
+		c.LogError("Error getting alerts from ", p.GetProviderName(), ". ", err.Error())
+		errs = append(errs, p.GetProviderName()+": "+err.Error())
+	}
+	for _, u := range cfg.AlertFeeds {
+		f := CAPFeed{URL: u, Config: cfg}
+		start := time.Now()
+		as, err := f.GetAlerts()
+		metrics.ObserveProviderCall("CAP", "alerts", time.Since(start), err)
+		if err == nil {
+			lists = append(lists, as)
+			continue
+		}
+		c.LogError("Error getting alerts from ", u, ". ", err.Error())
+		errs = append(errs, u+": "+err.Error())
+	}
+	if len(lists) == 0 && len(errs) != 0 {
+		la.Alerts = MergeAlerts(time.Now(), la.Alerts)
+		return la, errors.New(strings.Join(errs, "; "))
+	}
+
+	ar := AlertReport{Created: time.Now(), Alerts: MergeAlerts(time.Now(), lists...), Language: lang}
+	ar.WriteToFile(path)
+	// Alerts that were not received before have been issued since
+	seen := map[string]bool{}
+	for _, a := range la.Alerts {
+		seen[a.key()] = true
+	}
+	for _, a := range ar.Alerts {
+		if !seen[a.key()] {
+			c.dispatch(cfg, "alert", a)
+		}
+	}
+	return ar, nil
+}
+
+// dispatch posts the event of the location of the configuration to the webhooks. Events are only posted
+// for the configured language, so that the same weather fetched in another language is not posted again.
+func (c *WeatherController) dispatch(cfg *Config, event string, data interface{}) {
+	if c.Srv.Webhooks == nil || !c.isConfiguredLanguage(cfg) {
+		return
+	}
+	c.Srv.Webhooks.DispatchFor(cfg.GetNamedLocation(), event, data)
+}
+
+// isProviderOf indicates whether the named provider is one of the providers
+func isProviderOf(ps []WeatherProvider, name string) bool {
+	for _, p := range ps {
+		if p.GetProviderName() == name {
+			return true
+		}
+	}
+	return false
 }
 
 func (c *WeatherController) getWeatherIconInfo(i int, day bool) string {
@@ -322,3 +969,48 @@ func (c *WeatherController) getMoonIconInfo() (string, string) {
 		return "wi-moon-alt-waning-crescent-6", "Waning Crescent"
 	}
 }
+
+// getSpreadInfo returns the uncertainty of a consensus forecast as plus or minus half
+// the widest range of the forecast temperatures
+func (c *WeatherController) getSpreadInfo(s *ForecastSpread) string {
+	if s == nil || len(s.Sources) < 2 {
+		return ""
+	}
+	r := s.TempMaxHigh - s.TempMaxLow
+	if m := s.TempMinHigh - s.TempMinLow; m > r {
+		r = m
+	}
+	return fmt.Sprintf("±%.0f", r/2)
+}
+
+// getPrecipInfo returns the amount of precipitation to show on the page, if any is expected
+func (c *WeatherController) getPrecipInfo(v float32, unit string) string {
+	if v <= 0 {
+		return ""
+	}
+	if unit == "in" {
+		return fmt.Sprintf("%.2f in", v)
+	}
+	return fmt.Sprintf("%.1f %s", v, unit)
+}
+
+// getRecordsInfo returns the records to show on the weather html page
+func (c *WeatherController) getRecordsInfo(rs Records, u Units, lang string) []RecordPageData {
+	t := "°" + u.Temp
+	ps := []RecordPageData{}
+	for _, r := range []struct {
+		Name   string
+		Record *Record
+		Unit   string
+	}{
+		{"Highest temperature", rs.HighestTemp, t},
+		{"Lowest temperature", rs.LowestTemp, t},
+		{"Wettest day", rs.WettestDay, u.Precip},
+		{"Strongest gust", rs.StrongestGust, u.WindSpeed},
+	} {
+		if r.Record != nil {
+			ps = append(ps, RecordPageData{Name: T(lang, r.Name), Value: fmt.Sprintf("%g %s", r.Record.Value, r.Unit), Date: r.Record.Date})
+		}
+	}
+	return ps
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+// testProvider is a weather provider that returns canned weather for the controller tests
+type testProvider struct {
+	Name  string
+	Err   error
+	Temp  float32
+	Calls int
+}
+
+func (p *testProvider) GetProviderName() string { return p.Name }
+func (p *testProvider) SetConfig(c *Config)     {}
+func (p *testProvider) GetWeather() (Weather, error) {
+	p.Calls++
+	return Weather{Provider: p.Name, Created: time.Now(), Temp: p.Temp}, p.Err
+}
+func (p *testProvider) GetForecast() (Forecast, error) {
+	p.Calls++
+	f := Forecast{Current: Weather{Provider: p.Name, Created: time.Now(), Temp: p.Temp}}
+	f.Forecast = []ForecastDay{{Day: time.Now(), TempMin: p.Temp - 5, TempMax: p.Temp + 5, WeatherIcon: 1}}
+	return f, p.Err
+}
+
+// chdirTemp changes the working directory to a temporary directory for the duration of the test
+func chdirTemp(t *testing.T) {
+	wd, _ := os.Getwd()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestWeatherFallsBackToNextProvider(t *testing.T) {
+	chdirTemp(t)
+
+	bad := &testProvider{Name: "Bad", Err: errors.New("invalid api key")}
+	good := &testProvider{Name: "Good", Temp: 21}
+	c := WeatherController{Srv: &Server{Config: &Config{}}}
+	ps := []WeatherProvider{bad, good}
+
+	w, err := c.getCurrentWeather(c.Srv.Config, ps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Provider != "Good" || w.Temp != 21 {
+		t.Error("Expected the weather from the fallback provider, got", w.Provider, w.Temp)
+	}
+
+	// The cached weather from the fallback provider is used next time
+	w, err = c.getCurrentWeather(c.Srv.Config, ps)
+	if err != nil || w.Provider != "Good" || bad.Calls != 1 || good.Calls != 1 {
+		t.Error("Expected the cached weather to be returned", w.Provider, bad.Calls, good.Calls, err)
+	}
+
+	f, err := c.getCurrentForecast(c.Srv.Config, ps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Current.Provider != "Good" || len(f.Forecast) != 1 {
+		t.Error("Expected the forecast from the fallback provider, got", f.Current.Provider)
+	}
+}
+
+func TestWeatherReturnsLastWeatherWhenAllProvidersFail(t *testing.T) {
+	chdirTemp(t)
+
+	c := WeatherController{Srv: &Server{Config: &Config{}}}
+	ps := []WeatherProvider{
+		&testProvider{Name: "Bad", Err: errors.New("invalid api key")},
+		&testProvider{Name: "Worse", Err: errors.New("quota exceeded")},
+	}
+
+	// Nothing to fall back on
+	if _, err := c.getCurrentWeather(c.Srv.Config, ps); err == nil {
+		t.Error("Expected an error when all the providers fail")
+	}
+
+	// A stale reading from one of the providers is better than nothing
+	old := Weather{Provider: "Worse", Created: time.Now().Add(-3 * time.Hour), Temp: 12, Units: SIUnits, Language: "en"}
+	old.WriteToFile("lastweather.json")
+	w, err := c.getCurrentWeather(c.Srv.Config, ps)
+	if err == nil || w.Provider != "Worse" || w.Temp != 12 || !w.Stale {
+		t.Error("Expected the last weather to be returned with the error", w, err)
+	}
+
+	// But not once it is too old to be of use
+	old.Created = time.Now().Add(-maxStaleWeather - time.Minute)
+	old.WriteToFile("lastweather.json")
+	if w, err = c.getCurrentWeather(c.Srv.Config, ps); err == nil || w.Provider != "" {
+		t.Error("Expected the old weather not to be returned", w)
+	}
+	f := Forecast{Current: Weather{Provider: "Worse", Created: time.Now().Add(-12 * time.Hour)}, Units: SIUnits, Language: "en"}
+	f.WriteToFile("lastforecast.json")
+	if f, err = c.getCurrentForecast(c.Srv.Config, ps); err == nil || f.Current.Provider != "Worse" || !f.Stale {
+		t.Error("Expected the last forecast to be returned with the error", f, err)
+	}
+}
+
+func TestProviderOrder(t *testing.T) {
+	c := Config{Provider: "AccuWeather", Fallbacks: []string{"OpenMeteo", "AccuWeather", "NWS"}}
+	o := c.ProviderOrder()
+	if len(o) != 3 || o[0] != "AccuWeather" || o[1] != "OpenMeteo" || o[2] != "NWS" {
+		t.Error("Unexpected provider order", o)
+	}
+}
+
+func TestWeatherCachedWithoutUnitsIsNotUsed(t *testing.T) {
+	chdirTemp(t)
+
+	// Weather cached by an earlier version in Fahrenheit
+	old := Weather{Provider: "Good", Created: time.Now(), Temp: 70}
+	old.WriteToFile("lastweather.json")
+
+	c := WeatherController{Srv: &Server{Config: &Config{}}}
+	p := &testProvider{Name: "Good", Temp: 21}
+	w, err := c.getCurrentWeather(c.Srv.Config, []WeatherProvider{p})
+	if err != nil || w.Temp != 21 || p.Calls != 1 || w.Units != SIUnits {
+		t.Error("Expected fresh weather in SI units", w, err)
+	}
+}
+
+func TestCurrentWeatherUnitsCanBeRequested(t *testing.T) {
+	chdirTemp(t)
+
+	cached := Weather{Provider: "OpenMeteo", Created: time.Now(), Temp: 20, WindSpeed: 10, Units: SIUnits, Language: "en"}
+	cached.WriteToFile("lastweather.json")
+	c := WeatherController{Srv: &Server{Config: &Config{Provider: "OpenMeteo"}}}
+
+	for q, e := range map[string]Weather{
+		"":                 {Temp: 20, WindSpeed: 36, Units: MetricUnits},
+		"?units=imperial":  {Temp: 68, WindSpeed: 22.4, Units: ImperialUnits},
+		"?units=metric,kn": {Temp: 20, WindSpeed: 19.4, Units: Units{Temp: "C", WindSpeed: "kn", Pressure: "hPa", Precip: "mm", Distance: "km"}},
+	} {
+		rec := httptest.NewRecorder()
+		c.handleGetCurrent(rec, httptest.NewRequest("GET", "/weather/current"+q, nil))
+		w := Weather{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &w); err != nil {
+			t.Fatal(q, err, rec.Body.String())
+		}
+		checkClose(t, "Temp"+q, w.Temp, e.Temp)
+		checkClose(t, "WindSpeed"+q, w.WindSpeed, e.WindSpeed)
+		if w.Units != e.Units {
+			t.Error("Units", q, "returned", w.Units)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	c.handleGetCurrent(rec, httptest.NewRequest("GET", "/weather/current?units=cubits", nil))
+	if rec.Code != 400 {
+		t.Error("Expected an error for unknown units, got", rec.Code)
+	}
+}
+
+func TestWeatherInAnotherLanguageIsCachedSeparately(t *testing.T) {
+	chdirTemp(t)
+
+	en := Weather{Provider: "OpenMeteo", Created: time.Now(), WeatherDesc: "Clear", Units: SIUnits, Language: "en"}
+	en.WriteToFile("lastweather.json")
+	de := Weather{Provider: "OpenMeteo", Created: time.Now(), WeatherDesc: "Klar", Units: SIUnits, Language: "de"}
+	de.WriteToFile("lastweather.de.json")
+	c := WeatherController{Srv: &Server{Config: &Config{Provider: "OpenMeteo", Language: "en"}}}
+
+	for q, e := range map[string]string{"": "Clear", "?lang=en": "Clear", "?lang=de-DE": "Klar"} {
+		rec := httptest.NewRecorder()
+		c.handleGetCurrent(rec, httptest.NewRequest("GET", "/weather/current"+q, nil))
+		w := Weather{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &w); err != nil {
+			t.Fatal(q, err, rec.Body.String())
+		}
+		if w.WeatherDesc != e {
+			t.Error("Unexpected description for", q, w.WeatherDesc)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	c.handleGetCurrent(rec, httptest.NewRequest("GET", "/weather/current?lang=xx", nil))
+	if rec.Code != 400 {
+		t.Error("Expected an error for an unsupported language, got", rec.Code)
+	}
+}
+
+func TestForecastTimesAreInLocationTimeZone(t *testing.T) {
+	chdirTemp(t)
+
+	rt := time.Date(2026, 10, 18, 22, 0, 0, 0, time.UTC)
+	cached := Forecast{
+		Current:  Weather{Provider: "OpenMeteo", Created: time.Now(), ReadingTime: rt, Units: SIUnits, Language: "en"},
+		Forecast: []ForecastDay{{Day: rt}},
+		Units:    SIUnits,
+		Language: "en",
+	}
+	cached.WriteToFile("lastforecast.json")
+	c := WeatherController{Srv: &Server{Config: &Config{Provider: "OpenMeteo", TimeZone: "Pacific/Auckland"}}}
+
+	rec := httptest.NewRecorder()
+	c.handleGetForecast(rec, httptest.NewRequest("GET", "/weather/forecast", nil))
+	f := Forecast{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &f); err != nil {
+		t.Fatal(err, rec.Body.String())
+	}
+	// The timestamps are written with the location's UTC offset
+	if _, o := f.Current.ReadingTime.Zone(); o != 13*3600 || f.Current.ReadingTime.Hour() != 11 {
+		t.Error("Expected the reading time in New Zealand daylight time", f.Current.ReadingTime)
+	}
+	if len(f.Forecast) != 1 || f.Forecast[0].Day.Day() != 19 {
+		t.Error("Expected the forecast day in the location's time zone", f.Forecast)
+	}
+}
+
+func TestHourlyForecastCanBeLimited(t *testing.T) {
+	chdirTemp(t)
+
+	now := time.Now().Truncate(time.Hour)
+	cached := Forecast{Current: Weather{Provider: "OpenMeteo", Created: time.Now(), Units: SIUnits, Language: "en"}, Units: SIUnits, Language: "en"}
+	for n := -2; n < 24; n++ {
+		cached.Hourly = append(cached.Hourly, ForecastHour{Time: now.Add(time.Duration(n) * time.Hour), Period: 1, Temp: float32(n), WindSpeed: 10})
+	}
+	cached.WriteToFile("lastforecast.json")
+	c := WeatherController{Srv: &Server{Config: &Config{Provider: "OpenMeteo"}}}
+
+	for q, e := range map[string]int{"": 24, "?hours=12": 12, "?hours=1": 1} {
+		rec := httptest.NewRecorder()
+		c.handleGetHourly(rec, httptest.NewRequest("GET", "/weather/hourly"+q, nil))
+		h := HourlyForecast{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &h); err != nil {
+			t.Fatal(q, err, rec.Body.String())
+		}
+		if len(h.Hourly) != e {
+			t.Error("Expected", e, "hours for", q, "got", len(h.Hourly))
+			continue
+		}
+		// The hours that have passed are left out
+		if h.Hourly[0].Temp != 0 || !h.Hourly[0].Time.Equal(now) {
+			t.Error("Expected the forecast to start with the current hour", q, h.Hourly[0])
+		}
+		if h.Provider != "OpenMeteo" || h.Units != MetricUnits || h.Hourly[0].WindSpeed != 36 {
+			t.Error("Expected the hourly forecast in the configured units", h.Units, h.Hourly[0].WindSpeed)
+		}
+	}
+
+	for _, q := range []string{"soon", "0", "1000"} {
+		rec := httptest.NewRecorder()
+		c.handleGetHourly(rec, httptest.NewRequest("GET", "/weather/hourly?hours="+q, nil))
+		if rec.Code != 400 {
+			t.Error("Expected an error for an invalid number of hours", q, "got", rec.Code)
+		}
+	}
+}
+
+func TestWeatherHasDerivedMetrics(t *testing.T) {
+	chdirTemp(t)
+
+	cached := Weather{Provider: "OpenMeteo", Created: time.Now(), Temp: 30, Humidity: 50, WindSpeed: 2, Units: SIUnits, Language: "en"}
+	cached.WriteToFile("lastweather.json")
+	c := WeatherController{Srv: &Server{Config: &Config{Provider: "OpenMeteo"}}}
+
+	rec := httptest.NewRecorder()
+	c.handleGetCurrent(rec, httptest.NewRequest("GET", "/weather/current?units=imperial", nil))
+	w := Weather{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &w); err != nil {
+		t.Fatal(err, rec.Body.String())
+	}
+	if w.Derived == nil {
+		t.Fatal("Expected the derived metrics to be returned")
+	}
+	// Computed in Celsius and returned in the units requested
+	checkClose(t, "DewPoint", w.Derived.DewPoint, 65.2)
+	checkClose(t, "ApparentTemp", w.Derived.ApparentTemp, 88.8)
+	checkClose(t, "WindChill", w.Derived.WindChill, 86)
+
+	// Nothing is derived without the humidity
+	if w := (Weather{Temp: 20, Units: SIUnits}).WithDerived(); w.Derived != nil {
+		t.Error("Expected no derived metrics without the humidity", w.Derived)
+	}
+}
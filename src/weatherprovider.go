@@ -1,5 +1,10 @@
 package main
 
+import (
+	"errors"
+	"sort"
+)
+
 // WeatherProvider provides an interface for a weather information provider
 type WeatherProvider interface {
 	GetProviderName() string
@@ -7,3 +12,56 @@ type WeatherProvider interface {
 	GetForecast() (Forecast, error)
 	SetConfig(c *Config)
 }
+
+// providerUserAgent is the User-Agent sent to providers that require requests to identify the client application
+const providerUserAgent = "weather/1.0 github.com/brumawen/weather"
+
+// ProviderInfo describes a weather provider that has been registered with the service
+type ProviderInfo struct {
+	Name          string                 // Stable name used to refer to the provider in the configuration
+	Description   string                 // Display name of the provider
+	AppIDOptional bool                   // Indicates that the provider does not need an Application ID
+	Precip        string                 // Field of the current weather the precipitation is reported in, precip or precipRate, if it is reported
+	New           func() WeatherProvider // Creates a new instance of the provider
+}
+
+var providers = map[string]ProviderInfo{}
+
+// RegisterProvider registers a weather provider under the name in the provided information.
+// Providers register themselves from an init function in their own source file.
+func RegisterProvider(i ProviderInfo) {
+	if i.Name == "" || i.New == nil {
+		panic("weather provider registration requires a name and a constructor")
+	}
+	if _, ok := providers[i.Name]; ok {
+		panic("weather provider " + i.Name + " has already been registered")
+	}
+	providers[i.Name] = i
+}
+
+// GetProviderInfo returns the registration information for the named provider
+func GetProviderInfo(name string) (ProviderInfo, bool) {
+	i, ok := providers[name]
+	return i, ok
+}
+
+// GetProviders returns the registration information for all the registered providers, sorted by name
+func GetProviders() []ProviderInfo {
+	l := []ProviderInfo{}
+	for _, i := range providers {
+		l = append(l, i)
+	}
+	sort.Slice(l, func(a, b int) bool { return l[a].Name < l[b].Name })
+	return l
+}
+
+// NewWeatherProvider creates a new instance of the named provider and sets its configuration
+func NewWeatherProvider(name string, c *Config) (WeatherProvider, error) {
+	i, ok := providers[name]
+	if !ok {
+		return nil, errors.New("Invalid Weather provider " + name)
+	}
+	p := i.New()
+	p.SetConfig(c)
+	return p, nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// WebhookController handles the Web Methods for maintaining the webhooks and reading their delivery log.
+type WebhookController struct {
+	Srv *Server
+}
+
+// AddController adds the controller routes to the router
+func (c *WebhookController) AddController(router *mux.Router, s *Server) {
+	c.Srv = s
+	router.Methods("GET").Path("/webhooks/get").Name("GetWebhooks").
+		Handler(Logger(c, http.HandlerFunc(c.handleGetWebhooks)))
+	router.Methods("GET").Path("/webhooks/get/{id}").Name("GetWebhook").
+		Handler(Logger(c, http.HandlerFunc(c.handleGetWebhook)))
+	router.Methods("POST").Path("/webhooks/set").Name("SetWebhook").
+		Handler(Logger(c, http.HandlerFunc(c.handleSetWebhook)))
+	router.Methods("POST").Path("/webhooks/delete/{id}").Name("DeleteWebhook").
+		Handler(Logger(c, http.HandlerFunc(c.handleDeleteWebhook)))
+	router.Methods("GET").Path("/webhooks/deliveries").Name("GetWebhookDeliveries").
+		Handler(Logger(c, http.HandlerFunc(c.handleGetDeliveries)))
+}
+
+// LogInfo is used to log information messages for this controller.
+func (c *WebhookController) LogInfo(v ...interface{}) {
+	a := fmt.Sprint(v...)
+	logger.Info("WebhookController: [Inf] ", a)
+}
+
+// LogError is used to log error messages for this controller.
+func (c *WebhookController) LogError(v ...interface{}) {
+	a := fmt.Sprint(v...)
+	logger.Error("WebhookController: [Err] ", a)
+}
+
+// Get all the webhooks
+func (c *WebhookController) handleGetWebhooks(w http.ResponseWriter, r *http.Request) {
+	hl := WebhookList(c.Srv.Config.GetWebhooks())
+	if err := hl.WriteTo(w); err != nil {
+		http.Error(w, "Error serializing webhooks. "+err.Error(), 500)
+	}
+}
+
+// Get a webhook
+func (c *WebhookController) handleGetWebhook(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	for _, h := range c.Srv.Config.GetWebhooks() {
+		if h.ID == id {
+			if err := h.WriteTo(w); err != nil {
+				http.Error(w, "Error serializing webhook. "+err.Error(), 500)
+			}
+			return
+		}
+	}
+	http.Error(w, "Webhook "+id+" does not exist", 404)
+}
+
+// Add a webhook, or update the webhook with the id
+func (c *WebhookController) handleSetWebhook(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	h := Webhook{
+		ID:     r.Form.Get("id"),
+		URL:    r.Form.Get("url"),
+		Secret: r.Form.Get("secret"),
+	}
+	// Events can be posted as separate values or as a comma separated list
+	for _, v := range r.Form["events"] {
+		for _, e := range strings.Split(v, ",") {
+			if e = strings.TrimSpace(e); e != "" {
+				h.Events = append(h.Events, e)
+			}
+		}
+	}
+	// The secret is not shown, so the webhook keeps its secret unless a new one is given
+	if s, ok := r.Form["secret"]; h.ID != "" && (!ok || s[0] == redactedSecret) {
+		for _, e := range c.Srv.Config.GetWebhooks() {
+			if e.ID == h.ID {
+				h.Secret = e.Secret
+			}
+		}
+	}
+	if err := h.Validate(); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	c.LogInfo("Setting webhook ", h.URL, ".")
+	h = c.Srv.Config.SetWebhook(h)
+	c.Srv.Config.WriteToFile("config.json")
+
+	if err := h.WriteTo(w); err != nil {
+		http.Error(w, "Error serializing webhook. "+err.Error(), 500)
+	}
+}
+
+// Delete the webhook with the id
+func (c *WebhookController) handleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if !c.Srv.Config.DeleteWebhook(id) {
+		http.Error(w, "Webhook "+id+" does not exist", 404)
+		return
+	}
+	c.LogInfo("Deleted webhook ", id, ".")
+	c.Srv.Config.WriteToFile("config.json")
+}
+
+// Get the latest deliveries to the webhooks
+func (c *WebhookController) handleGetDeliveries(w http.ResponseWriter, r *http.Request) {
+	ds := WebhookDeliveries{}
+	if c.Srv.Webhooks != nil {
+		ds = c.Srv.Webhooks.GetDeliveries()
+	}
+	if err := ds.WriteTo(w); err != nil {
+		http.Error(w, "Error serializing webhook deliveries. "+err.Error(), 500)
+	}
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Webhook is an address that is POSTed a JSON message on weather events
+type Webhook struct {
+	ID     string   `json:"id"`               // Identifier of the webhook
+	URL    string   `json:"url"`              // Address the events are posted to
+	Secret string   `json:"secret,omitempty"` // Key the body is signed with using HMAC-SHA256, if set
+	Events []string `json:"events,omitempty"` // Events that are posted, all events if empty
+}
+
+// WebhookList holds the webhooks
+type WebhookList []Webhook
+
+// redactedSecret is shown in place of the secret of a webhook, which is only needed to sign the events
+const redactedSecret = "********"
+
+// WebhookEvents are the events webhooks can be sent
+var WebhookEvents = []string{"observation", "forecast", "alert", "sunrise", "sunset", "rule"}
+
+// WebhookMessage is the body posted to a webhook
+type WebhookMessage struct {
+	ID       string      `json:"id"`                 // Identifier of the delivery
+	Event    string      `json:"event"`              // Name of the event
+	Location string      `json:"location,omitempty"` // Identifier of the named location of the event, empty for the configured location
+	Time     time.Time   `json:"time"`               // Date and time of the event
+	Data     interface{} `json:"data"`               // Weather, forecast, alert, sun time or notification of the event
+}
+
+// WebhookDelivery records the delivery of an event to a webhook
+type WebhookDelivery struct {
+	ID         string    `json:"id"`              // Identifier of the delivery
+	HookID     string    `json:"hookID"`          // Identifier of the webhook
+	URL        string    `json:"url"`             // Address the event was posted to
+	Event      string    `json:"event"`           // Name of the event
+	Time       time.Time `json:"time"`            // Date and time of the last attempt
+	Attempts   int       `json:"attempts"`        // Number of times the event was posted
+	StatusCode int       `json:"statusCode"`      // HTTP status of the last attempt
+	Error      string    `json:"error,omitempty"` // Error of the last attempt, if it failed
+	Success    bool      `json:"success"`         // Indicates if the webhook accepted the event
+}
+
+// WebhookDeliveries holds the latest deliveries, the most recent first
+type WebhookDeliveries []WebhookDelivery
+
+// SunEvent is the data of the sunrise and sunset events
+type SunEvent struct {
+	Time time.Time `json:"time"`         // Time of sunrise or sunset
+	Name string    `json:"locationName"` // Location Name
+}
+
+// WebhookSender posts the events to the configured webhooks. Failed deliveries are retried
+// with an exponential backoff, and the latest deliveries are kept for the delivery log.
+type WebhookSender struct {
+	Config      *Config       // Current Configuration
+	MaxAttempts int           // Number of times a delivery is attempted
+	Backoff     time.Duration // Delay before the first retry, doubled for each retry after it
+	Client      *http.Client  // Client the events are posted with
+	deliveries  WebhookDeliveries
+	lastSun     time.Time
+	seq         int
+	lock        sync.Mutex
+	wg          sync.WaitGroup
+}
+
+// maxDeliveries is the number of deliveries kept for the delivery log
+const maxDeliveries = 100
+
+// webhookSignatureHeader holds the HMAC-SHA256 signature of the body, if the webhook has a secret
+const webhookSignatureHeader = "X-Weather-Signature"
+
+// NewWebhookSender creates a sender for the webhooks of the configuration
+func NewWebhookSender(c *Config) *WebhookSender {
+	return &WebhookSender{
+		Config:      c,
+		MaxAttempts: 4,
+		Backoff:     5 * time.Second,
+		Client:      &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Validate checks that the webhook can be posted to
+func (h Webhook) Validate() error {
+	u, err := url.Parse(h.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("Invalid webhook address " + h.URL)
+	}
+	for _, e := range h.Events {
+		if !isWebhookEvent(e) {
+			return errors.New("Invalid webhook event " + e)
+		}
+	}
+	return nil
+}
+
+// wants indicates whether the webhook is sent the event
+func (h Webhook) wants(event string) bool {
+	if len(h.Events) == 0 {
+		return true
+	}
+	for _, e := range h.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+func isWebhookEvent(e string) bool {
+	for _, n := range WebhookEvents {
+		if n == e {
+			return true
+		}
+	}
+	return false
+}
+
+// Sign returns the HMAC-SHA256 signature of the body with the secret, as sent in the signature header
+func Sign(secret string, body []byte) string {
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write(body)
+	return "sha256=" + hex.EncodeToString(m.Sum(nil))
+}
+
+// Dispatch posts the event of the configured location to each webhook that is sent it.
+// The deliveries are made in the background.
+func (d *WebhookSender) Dispatch(event string, data interface{}) {
+	d.DispatchFor("", event, data)
+}
+
+// DispatchFor posts the event of the named location to each webhook that is sent it, the
+// configured location if the location is empty. The deliveries are made in the background.
+func (d *WebhookSender) DispatchFor(location string, event string, data interface{}) {
+	now := time.Now()
+	for _, h := range d.Config.GetWebhooks() {
+		if !h.wants(event) {
+			continue
+		}
+		d.lock.Lock()
+		d.seq++
+		id := strconv.FormatInt(now.UnixNano(), 36) + "-" + strconv.Itoa(d.seq)
+		d.lock.Unlock()
+		b, err := json.Marshal(WebhookMessage{ID: id, Event: event, Location: location, Time: now, Data: data})
+		if err != nil {
+			logger.Error("Webhooks: [Err] ", "Error serializing "+event+" event. "+err.Error())
+			continue
+		}
+		d.wg.Add(1)
+		go func(h Webhook, dl WebhookDelivery) {
+			defer d.wg.Done()
+			d.deliver(h, dl, b)
+		}(h, WebhookDelivery{ID: id, HookID: h.ID, URL: h.URL, Event: event})
+	}
+}
+
+// Notify posts the rule notification to the webhooks that are sent the rule event
+func (d *WebhookSender) Notify(n Notification) error {
+	d.DispatchFor(n.Rule.Location, "rule", n)
+	return nil
+}
+
+// Wait waits for the deliveries in progress to finish
+func (d *WebhookSender) Wait() {
+	d.wg.Wait()
+}
+
+// deliver posts the body to the webhook, retrying with an increasing delay until it is accepted
+// or the attempts run out. Client errors other than too many requests are not retried.
+func (d *WebhookSender) deliver(h Webhook, dl WebhookDelivery, b []byte) {
+	wait := d.Backoff
+	for dl.Attempts < d.MaxAttempts {
+		if dl.Attempts > 0 {
+			time.Sleep(wait)
+			wait *= 2
+		}
+		dl.Attempts++
+		dl.Time = time.Now()
+		code, err := d.post(h, dl, b)
+		dl.StatusCode = code
+		if err == nil {
+			dl.Success = true
+			dl.Error = ""
+			break
+		}
+		dl.Error = err.Error()
+		if code >= 400 && code < 500 && code != http.StatusTooManyRequests {
+			break
+		}
+	}
+	if !dl.Success {
+		logger.Error("Webhooks: [Err] ", "Error posting "+dl.Event+" event to "+h.URL+". "+dl.Error)
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.deliveries = append(WebhookDeliveries{dl}, d.deliveries...)
+	if len(d.deliveries) > maxDeliveries {
+		d.deliveries = d.deliveries[:maxDeliveries]
+	}
+}
+
+func (d *WebhookSender) post(h Webhook, dl WebhookDelivery, b []byte) (int, error) {
+	req, err := http.NewRequest("POST", h.URL, bytes.NewReader(b))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", providerUserAgent)
+	req.Header.Set("X-Weather-Event", dl.Event)
+	req.Header.Set("X-Weather-Delivery", dl.ID)
+	if h.Secret != "" {
+		req.Header.Set(webhookSignatureHeader, Sign(h.Secret, b))
+	}
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("Webhook returned status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// forecastChanged indicates whether the forecast of the days differs from the previous forecast
+func forecastChanged(p Forecast, f Forecast) bool {
+	if len(p.Forecast) != len(f.Forecast) {
+		return true
+	}
+	for i, d := range f.Forecast {
+		e := p.Forecast[i]
+		if !d.Day.Equal(e.Day) || d.WeatherIcon != e.WeatherIcon ||
+			roundTo(d.TempMin, 0) != roundTo(e.TempMin, 0) || roundTo(d.TempMax, 0) != roundTo(e.TempMax, 0) ||
+			roundTo(d.PrecipProb, -1) != roundTo(e.PrecipProb, -1) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetDeliveries returns the latest deliveries, the most recent first
+func (d *WebhookSender) GetDeliveries() WebhookDeliveries {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return append(WebhookDeliveries{}, d.deliveries...)
+}
+
+// Run checks for sunrise and sunset every minute until exit is closed
+func (d *WebhookSender) Run(exit chan struct{}) {
+	t := time.NewTicker(time.Minute)
+	defer t.Stop()
+	for {
+		select {
+		case <-exit:
+			return
+		case n := <-t.C:
+			d.checkSun(n)
+		}
+	}
+}
+
+// checkSun dispatches the sunrise and sunset events of the configured location and of each
+// named location that passed since the last check
+func (d *WebhookSender) checkSun(now time.Time) {
+	last := d.lastSun
+	d.lastSun = now
+	if last.IsZero() {
+		return
+	}
+	cs := []*Config{d.Config}
+	for _, l := range d.Config.GetLocations() {
+		if c, ok := d.Config.ForLocation(l.ID); ok {
+			cs = append(cs, c)
+		}
+	}
+	for _, c := range cs {
+		sr, ss, err := GetSunriseSunset(c, now)
+		if err != nil {
+			continue
+		}
+		if sr.After(last) && !sr.After(now) {
+			d.DispatchFor(c.GetNamedLocation(), "sunrise", SunEvent{Time: sr, Name: c.LocationName})
+		}
+		if ss.After(last) && !ss.After(now) {
+			d.DispatchFor(c.GetNamedLocation(), "sunset", SunEvent{Time: ss, Name: c.LocationName})
+		}
+	}
+}
+
+// redacted returns the webhook with its secret hidden
+func (c Webhook) redacted() Webhook {
+	if c.Secret != "" {
+		c.Secret = redactedSecret
+	}
+	return c
+}
+
+// WriteTo serializes the entity, without the secret, and writes it to the http response
+func (c *Webhook) WriteTo(w http.ResponseWriter) error {
+	b, err := json.Marshal(c.redacted())
+	if err != nil {
+		return err
+	}
+	w.Header().Set("content-type", "application/json")
+	w.Write(b)
+	return nil
+}
+
+// WriteTo serializes the entity and writes it to the http response
+func (c WebhookDeliveries) WriteTo(w http.ResponseWriter) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("content-type", "application/json")
+	w.Write(b)
+	return nil
+}
+
+// WriteTo serializes the entity, without the secrets, and writes it to the http response
+func (c WebhookList) WriteTo(w http.ResponseWriter) error {
+	hs := make(WebhookList, len(c))
+	for i, h := range c {
+		hs[i] = h.redacted()
+	}
+	b, err := json.Marshal(hs)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("content-type", "application/json")
+	w.Write(b)
+	return nil
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// webhookRecorder is a webhook server that records the requests posted to it
+type webhookRecorder struct {
+	Status []int // Statuses returned for each request in turn, 200 once they run out
+	reqs   []*http.Request
+	bodies [][]byte
+	lock   sync.Mutex
+}
+
+func (wr *webhookRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b, _ := ioutil.ReadAll(r.Body)
+	wr.lock.Lock()
+	defer wr.lock.Unlock()
+	wr.reqs = append(wr.reqs, r)
+	wr.bodies = append(wr.bodies, b)
+	if len(wr.Status) >= len(wr.reqs) {
+		w.WriteHeader(wr.Status[len(wr.reqs)-1])
+	}
+}
+
+func newTestWebhookSender(hs ...Webhook) *WebhookSender {
+	s := NewWebhookSender(&Config{Webhooks: hs})
+	s.Backoff = time.Millisecond
+	return s
+}
+
+func TestWebhooksAreSignedAndFiltered(t *testing.T) {
+	wr := &webhookRecorder{}
+	srv := httptest.NewServer(wr)
+	defer srv.Close()
+
+	s := newTestWebhookSender(
+		Webhook{ID: "alerts", URL: srv.URL + "/alerts", Events: []string{"alert"}},
+		Webhook{ID: "all", URL: srv.URL + "/all", Secret: "s3cret"},
+	)
+	s.Dispatch("observation", Weather{Provider: "OpenMeteo", Temp: 21})
+	s.Wait()
+
+	if len(wr.reqs) != 1 || wr.reqs[0].URL.Path != "/all" {
+		t.Fatal("Expected only the webhook without a filter to be posted the observation", len(wr.reqs))
+	}
+	r, b := wr.reqs[0], wr.bodies[0]
+	if r.Header.Get(webhookSignatureHeader) != Sign("s3cret", b) || !strings.HasPrefix(r.Header.Get(webhookSignatureHeader), "sha256=") {
+		t.Error("Unexpected signature", r.Header.Get(webhookSignatureHeader))
+	}
+	if r.Header.Get("X-Weather-Event") != "observation" || r.Header.Get("Content-Type") != "application/json" {
+		t.Error("Unexpected headers", r.Header)
+	}
+	m := struct {
+		Event string  `json:"event"`
+		Data  Weather `json:"data"`
+	}{}
+	if err := json.Unmarshal(b, &m); err != nil || m.Event != "observation" || m.Data.Temp != 21 {
+		t.Error("Unexpected message", string(b), err)
+	}
+
+	s.Dispatch("alert", Alert{Event: "Damaging Winds"})
+	s.Wait()
+	if len(wr.reqs) != 3 || wr.reqs[1].Header.Get(webhookSignatureHeader) == wr.reqs[2].Header.Get(webhookSignatureHeader) {
+		t.Error("Expected the alert to be posted to both webhooks, signed only by the one with the secret")
+	}
+}
+
+func TestWebhookDeliveryIsRetried(t *testing.T) {
+	wr := &webhookRecorder{Status: []int{503, 502}}
+	srv := httptest.NewServer(wr)
+	defer srv.Close()
+
+	s := newTestWebhookSender(Webhook{ID: "flaky", URL: srv.URL})
+	s.Dispatch("sunrise", SunEvent{Time: time.Now()})
+	s.Wait()
+	ds := s.GetDeliveries()
+	if len(ds) != 1 || !ds[0].Success || ds[0].Attempts != 3 || ds[0].StatusCode != 200 || ds[0].HookID != "flaky" {
+		t.Error("Expected the delivery to succeed on the third attempt", ds)
+	}
+
+	// A rejected event is not retried
+	wr.Status = []int{0, 0, 0, 400}
+	s.Dispatch("sunset", SunEvent{Time: time.Now()})
+	s.Wait()
+	ds = s.GetDeliveries()
+	if len(ds) != 2 || ds[0].Success || ds[0].Attempts != 1 || ds[0].Event != "sunset" || ds[0].Error == "" {
+		t.Error("Expected the rejected delivery to be logged first", ds)
+	}
+}
+
+func TestWebhookValidation(t *testing.T) {
+	if err := (Webhook{URL: "https://nodered.local/weather", Events: []string{"alert", "rule"}}).Validate(); err != nil {
+		t.Error(err)
+	}
+	for _, h := range []Webhook{
+		{URL: "nodered.local/weather"},
+		{URL: "ftp://nodered.local/weather"},
+		{URL: "http://nodered.local/weather", Events: []string{"hail"}},
+	} {
+		if h.Validate() == nil {
+			t.Error("Expected the webhook to be invalid", h)
+		}
+	}
+}
+
+func TestSunriseAndSunsetArePosted(t *testing.T) {
+	wr := &webhookRecorder{}
+	srv := httptest.NewServer(wr)
+	defer srv.Close()
+
+	s := newTestWebhookSender(Webhook{URL: srv.URL, Events: []string{"sunrise", "sunset"}})
+	s.Config.Latitude, s.Config.Longitude, s.Config.TimeZone = -33.92, 18.42, "Africa/Johannesburg"
+	sr, ss, err := GetSunriseSunset(s.Config, time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []time.Time{sr.Add(-2 * time.Minute), sr.Add(-time.Minute), sr.Add(time.Minute), ss.Add(-time.Minute), ss.Add(time.Second)} {
+		s.checkSun(n)
+	}
+	s.Wait()
+	ds := s.GetDeliveries()
+	if len(ds) != 2 || ds[1].Event != "sunrise" || ds[0].Event != "sunset" {
+		t.Error("Expected a sunrise and a sunset event", ds)
+	}
+
+	// The sun of a named location is posted with the location
+	s.Config.Locations = []Location{{ID: "office", Name: "Office", Latitude: -33.92, Longitude: 18.42, TimeZone: "Africa/Johannesburg"}}
+	s.lastSun = time.Time{}
+	for _, n := range []time.Time{sr.Add(-time.Minute), sr.Add(time.Minute)} {
+		s.checkSun(n)
+	}
+	s.Wait()
+	ls := map[string]string{}
+	for _, b := range wr.bodies[2:] {
+		m := WebhookMessage{}
+		json.Unmarshal(b, &m)
+		ls[m.Location] = m.Event
+	}
+	if len(ls) != 2 || ls[""] != "sunrise" || ls["office"] != "sunrise" {
+		t.Error("Expected the sunrise of both locations to be posted", ls)
+	}
+}
+
+func TestForecastChanged(t *testing.T) {
+	d := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	f := Forecast{Forecast: []ForecastDay{{Day: d, TempMin: 10.2, TempMax: 18.4, WeatherIcon: 1, PrecipProb: 20}}}
+	g := Forecast{Forecast: []ForecastDay{{Day: d, TempMin: 10.4, TempMax: 18.1, WeatherIcon: 1, PrecipProb: 22}}}
+	if forecastChanged(f, g) {
+		t.Error("Expected small differences not to change the forecast")
+	}
+	g.Forecast[0].WeatherIcon = 6
+	if !forecastChanged(f, g) || !forecastChanged(Forecast{}, f) {
+		t.Error("Expected the forecast to have changed")
+	}
+}
+
+func TestWebhooksCanBeAddedAndDeleted(t *testing.T) {
+	chdirTemp(t)
+
+	s := &Server{Config: &Config{}}
+	s.Webhooks = NewWebhookSender(s.Config)
+	router := mux.NewRouter()
+	c := WebhookController{}
+	c.AddController(router, s)
+
+	form := url.Values{"url": {"http://nodered.local:1880/weather"}, "secret": {"s3cret"}, "events": {"alert, rule", "sunrise"}}
+	req := httptest.NewRequest("POST", "/webhooks/set", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	h := Webhook{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &h); err != nil {
+		t.Fatal(err, rec.Body.String())
+	}
+	if h.ID == "" || len(h.Events) != 3 || h.Events[1] != "rule" || h.Secret != redactedSecret {
+		t.Error("Unexpected webhook", h)
+	}
+
+	// The secret is not shown, and is kept when the webhook is updated without it
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/webhooks/get", nil))
+	if strings.Contains(rec.Body.String(), "s3cret") {
+		t.Error("Expected the secret to be hidden", rec.Body.String())
+	}
+	form = url.Values{"id": {h.ID}, "url": {"http://nodered.local:1880/weather2"}}
+	req = httptest.NewRequest("POST", "/webhooks/set", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if hs := s.Config.GetWebhooks(); rec.Code != 200 || len(hs) != 1 || hs[0].Secret != "s3cret" || hs[0].URL != form.Get("url") {
+		t.Error("Expected the secret to be kept", rec.Code, hs)
+	}
+
+	form.Set("url", "ftp://nodered.local")
+	req = httptest.NewRequest("POST", "/webhooks/set", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != 400 {
+		t.Error("Expected an invalid webhook to be refused with 400", rec.Code)
+	}
+	cfg := Config{}
+	if err := cfg.ReadFromFile("config.json"); err != nil || len(cfg.Webhooks) != 1 {
+		t.Error("Expected the webhook to be saved", cfg.Webhooks, err)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/webhooks/deliveries", nil))
+	if rec.Code != 200 || strings.TrimSpace(rec.Body.String()) != "[]" {
+		t.Error("Expected no deliveries", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("POST", "/webhooks/delete/"+h.ID, nil))
+	if rec.Code != 200 || len(s.Config.Webhooks) != 0 {
+		t.Error("Expected the webhook to be deleted", rec.Code, rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/webhooks/get/"+h.ID, nil))
+	if rec.Code != 404 {
+		t.Error("Expected a deleted webhook not to be found", rec.Code)
+	}
+}
+
+func TestFreshWeatherIsPostedToWebhooks(t *testing.T) {
+	chdirTemp(t)
+	wr := &webhookRecorder{}
+	srv := httptest.NewServer(wr)
+	defer srv.Close()
+
+	cfg := &Config{Webhooks: []Webhook{{URL: srv.URL}}}
+	c := WeatherController{Srv: &Server{Config: cfg, Webhooks: NewWebhookSender(cfg)}}
+	ps := []WeatherProvider{&testProvider{Name: "Good", Temp: 21}}
+
+	c.getCurrentWeather(cfg, ps)
+	c.getCurrentForecast(cfg, ps)
+	// Cached weather, and weather in another language, is not posted again
+	c.getCurrentWeather(cfg, ps)
+	c.getCurrentWeather(cfg.ForLanguage("de"), ps)
+	c.Srv.Webhooks.Wait()
+
+	evs := []string{}
+	for _, r := range wr.reqs {
+		evs = append(evs, r.Header.Get("X-Weather-Event"))
+	}
+	if strings.Join(evs, ",") != "observation,forecast" && strings.Join(evs, ",") != "forecast,observation" {
+		t.Error("Expected an observation and a forecast event, got", evs)
+	}
+}